@@ -5,15 +5,20 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
-	"net"
 	"os"
 	"os/signal"
-	"strconv"
+	"time"
 
 	natserver "github.com/Mohd-Sayeedul-Hoda/tunnel/internal/nat-server"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/apikey"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/cache"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/cache/redis"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories/postgres"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/db"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/log"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/metrics"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/tracing"
 
 	"github.com/joho/godotenv"
 )
@@ -44,22 +49,150 @@ func run(ctx context.Context, getenv func(string) string, args []string, w io.Wr
 
 	slog.SetDefault(log.NewLogger(cfg, w))
 
+	shutdownTracing, err := tracing.Setup(ctx, cfg, "nat-server")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			slog.Warn("failed to flush traces", slog.Any("err", err))
+		}
+	}()
+
 	pgPool, err := db.OpenPostgresConn(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	slog.Info("database connection pool establish")
+
+	cacheRepo, err := redis.NewCacheRepo(cfg)
+	if err != nil {
+		return err
+	}
+	slog.Info("redis connection establish")
+
+	userRepo, err := postgres.NewUserRepo(pgPool)
+	if err != nil {
+		return err
+	}
+
+	apiKeyRepo, err := postgres.NewAPIKeyRepo(pgPool)
+	if err != nil {
+		return err
+	}
+
+	planRepo, err := postgres.NewPlanRepo(pgPool)
+	if err != nil {
+		return err
+	}
+
+	domainRepo, err := postgres.NewDomainRepo(pgPool)
+	if err != nil {
+		return err
+	}
+
+	usageRepo, err := postgres.NewUsageRepo(pgPool)
+	if err != nil {
+		return err
+	}
+
+	tunnelRepo, err := cache.NewTunnelRepo(cacheRepo)
+	if err != nil {
+		return err
+	}
+
+	accessLogRepo, err := postgres.NewAccessLogRepo(pgPool)
+	if err != nil {
+		return err
+	}
 
-	serverErrors := make(chan error, 1)
+	keyUsage := apikey.NewUsageTracker(apiKeyRepo)
+
+	metricsRegistry := metrics.NewRegistry()
+	metrics.RegisterDBPool(metricsRegistry, pgPool)
+
+	pool := natserver.NewConnectionsPool()
+	tunnelHandler := natserver.NewTunnelHandler(cfg, pool, apiKeyRepo, keyUsage, userRepo, planRepo, domainRepo, usageRepo, tunnelRepo, accessLogRepo, metricsRegistry)
+
+	serverErrors := make(chan error, 7)
 
 	go func() {
 		slog.Info("tcp server running")
-		err := natserver.ListenAndServer(ctx, w, cfg)
+		err := natserver.ListenAndServer(ctx, w, cfg, tunnelHandler)
+		serverErrors <- err
+	}()
+
+	go func() {
+		slog.Info("http ingress running")
+		err := natserver.ListenAndServeHttp(ctx, cfg, tunnelHandler)
+		serverErrors <- err
+	}()
+
+	go func() {
+		slog.Info("admin server running")
+		err := natserver.ListenAndServeAdmin(ctx, cfg, metricsRegistry)
+		serverErrors <- err
+	}()
+
+	if cfg.Cluster.Secret != "" {
+		go func() {
+			slog.Info("internal listener running")
+			err := natserver.ListenAndServeInternal(ctx, cfg, tunnelHandler)
+			serverErrors <- err
+		}()
+	} else {
+		slog.Warn("NAT_CLUSTER_SECRET is not set, requests are not forwarded between nodes")
+	}
+
+	go func() {
+		err := tunnelHandler.RunRegistry(ctx)
+		serverErrors <- err
+	}()
+
+	go func() {
+		err := tunnelHandler.RunAccessLogs(ctx)
+		serverErrors <- err
+	}()
+
+	go func() {
+		err := keyUsage.Run(ctx)
 		serverErrors <- err
 	}()
 
+	err = waitForShutdown(ctx, serverErrors)
+	if err != nil {
+		return err
+	}
+	// stop the listeners and workers that are still running before the
+	// sessions are drained
+	cancel()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), natserver.ShutdownTimeout)
+	defer cancel()
+	err = tunnelHandler.Shutdown(shutdownCtx)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("nat server stop", slog.String("node_id", cfg.Cluster.NodeId))
+
+	return nil
+}
+
+// waitForShutdown blocks until ctx is cancelled or a worker stops. Workers
+// return nil once ctx is cancelled so a nil error is a shutdown like any
+// other, only a non nil error skips the graceful shutdown
+func waitForShutdown(ctx context.Context, serverErrors <-chan error) error {
 	select {
 	case <-ctx.Done():
 		slog.Info("nat server shutdown initiated", slog.String("reason", "context cancelled"))
 	case err := <-serverErrors:
-		return err
+		if err != nil {
+			return err
+		}
+		slog.Info("nat server shutdown initiated", slog.String("reason", "worker stopped"))
 	}
-
 	return nil
 }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestRunInvalidConfig(t *testing.T) {
+	getenv := func(string) string { return "" }
+
+	err := run(context.Background(), getenv, []string{"nat-server"}, io.Discard)
+	if err == nil {
+		t.Fatalf("Expected run() to fail without configuration")
+	}
+}
+
+func TestWaitForShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// a worker that saw the cancellation first reports nil, the server must
+	// still go on to shut down gracefully
+	serverErrors := make(chan error, 1)
+	serverErrors <- nil
+	if err := waitForShutdown(ctx, serverErrors); err != nil {
+		t.Fatalf("Expected a worker stopping with nil to shut down, got %v", err)
+	}
+
+	failure := errors.New("listener failed")
+	serverErrors = make(chan error, 1)
+	serverErrors <- failure
+	if err := waitForShutdown(context.Background(), serverErrors); !errors.Is(err, failure) {
+		t.Fatalf("Expected the worker error to be returned, got %v", err)
+	}
+}
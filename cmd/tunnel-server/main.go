@@ -10,14 +10,22 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"sync"
 	"time"
 
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/account"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/apikey"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/cache"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/cache/redis"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/mailer"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/oauth"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories/postgres"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/db"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/log"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/metrics"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/tracing"
 
 	"github.com/joho/godotenv"
 )
@@ -50,6 +58,18 @@ func run(ctx context.Context, getenv func(string) string, args []string, w io.Wr
 
 	slog.SetDefault(log.NewLogger(cfg, w))
 
+	shutdownTracing, err := tracing.Setup(ctx, cfg, "tunnel-server")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			slog.Warn("failed to flush traces", slog.Any("err", err))
+		}
+	}()
+
 	pgPool, err := db.OpenPostgresConn(ctx, cfg)
 	if err != nil {
 		return err
@@ -67,6 +87,21 @@ func run(ctx context.Context, getenv func(string) string, args []string, w io.Wr
 		return err
 	}
 
+	identityRepo, err := postgres.NewIdentityRepo(pgPool)
+	if err != nil {
+		return err
+	}
+
+	orgRepo, err := postgres.NewOrgRepo(pgPool)
+	if err != nil {
+		return err
+	}
+
+	totpRepo, err := postgres.NewTotpRepo(pgPool)
+	if err != nil {
+		return err
+	}
+
 	apiKeyRepo, err := postgres.NewAPIKeyRepo(pgPool)
 	if err != nil {
 		return err
@@ -77,14 +112,113 @@ func run(ctx context.Context, getenv func(string) string, args []string, w io.Wr
 		return err
 	}
 
-	handler := api.NewHTTPServer(cfg, cacheRepo, userRepo, apiKeyRepo, emailOtpRepo)
+	planRepo, err := postgres.NewPlanRepo(pgPool)
+	if err != nil {
+		return err
+	}
+
+	domainRepo, err := postgres.NewDomainRepo(pgPool)
+	if err != nil {
+		return err
+	}
+
+	usageRepo, err := postgres.NewUsageRepo(pgPool)
+	if err != nil {
+		return err
+	}
+
+	accessLogRepo, err := postgres.NewAccessLogRepo(pgPool)
+	if err != nil {
+		return err
+	}
+
+	auditRepo, err := postgres.NewAuditRepo(pgPool)
+	if err != nil {
+		return err
+	}
+
+	tunnelRepo, err := cache.NewTunnelRepo(cacheRepo)
+	if err != nil {
+		return err
+	}
+
+	// the background workers outlive the http server so the requests still
+	// in flight at shutdown can queue mails and record key uses
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var workers sync.WaitGroup
+
+	m, err := mailer.New(cfg)
+	if err != nil {
+		return err
+	}
+	mailQueue := mailer.NewQueue(m)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		mailQueue.Run(workerCtx)
+	}()
+
+	sessionRepo, err := cache.NewSessionRepo(cacheRepo)
+	if err != nil {
+		return err
+	}
+
+	revocationRepo, err := cache.NewTokenRevocationRepo(cacheRepo)
+	if err != nil {
+		return err
+	}
+
+	rateLimiter, err := cache.NewRateLimiter(cacheRepo)
+	if err != nil {
+		return err
+	}
+
+	mfaRepo, err := cache.NewMfaRepo(cacheRepo)
+	if err != nil {
+		return err
+	}
+
+	lockRepo, err := cache.NewLoginLockRepo(cacheRepo)
+	if err != nil {
+		return err
+	}
+
+	oauthStateRepo, err := cache.NewOAuthStateRepo(cacheRepo)
+	if err != nil {
+		return err
+	}
+
+	providers, err := oauth.NewProviders(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	keyUsage := apikey.NewUsageTracker(apiKeyRepo)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		keyUsage.Run(workerCtx)
+	}()
+
+	purger := account.NewPurger(userRepo, auditRepo)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		purger.Run(workerCtx)
+	}()
+
+	metricsRegistry := metrics.NewRegistry()
+	metrics.RegisterDBPool(metricsRegistry, pgPool)
+
+	handler := api.NewHTTPServer(cfg, metricsRegistry, sessionRepo, revocationRepo, rateLimiter, userRepo, identityRepo, orgRepo, totpRepo, mfaRepo, lockRepo, oauthStateRepo, apiKeyRepo, keyUsage, emailOtpRepo, planRepo, domainRepo, usageRepo, tunnelRepo, accessLogRepo, auditRepo, mailQueue, providers)
 
 	httpServer := http.Server{
 		Addr:    net.JoinHostPort(cfg.Server.Host, strconv.Itoa(cfg.Server.Port)),
 		Handler: handler,
 	}
 
-	serverErrors := make(chan error, 1)
+	serverErrors := make(chan error, 2)
 
 	go func() {
 		slog.Info("http server running",
@@ -101,6 +235,14 @@ func run(ctx context.Context, getenv func(string) string, args []string, w io.Wr
 		}
 	}()
 
+	go func() {
+		err := api.ListenAndServeAdmin(ctx, cfg, metricsRegistry)
+		if err != nil {
+			slog.Error("error while starting admin server", slog.Any("err", err))
+			serverErrors <- err
+		}
+	}()
+
 	select {
 	case <-ctx.Done():
 		slog.Info("shutdown initiated", slog.String("reason", "context cancelled"))
@@ -117,5 +259,9 @@ func run(ctx context.Context, getenv func(string) string, args []string, w io.Wr
 
 	slog.Info("http server stop", slog.String("addrs", httpServer.Addr))
 
+	// the mail queue sends what is left, the key uses are flushed
+	stopWorkers()
+	workers.Wait()
+
 	return nil
 }
@@ -0,0 +1,178 @@
+package natserver
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+
+	"github.com/google/uuid"
+)
+
+const requestIdHeader = "X-Request-Id"
+
+// access logs are written to postgres in batches, when the database can't
+// keep up entries are dropped instead of slowing down the tunnels
+const (
+	accessLogBufferSize    = 4096
+	accessLogBatchSize     = 200
+	accessLogFlushInterval = time.Second
+)
+
+const accessRecordContextKey = contextKey("accessRecord")
+
+var requestIdRX = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestId returns the request id sent by the client, or a new one when it
+// is missing or not something we want to forward and store
+func requestId(r *http.Request) string {
+	if id := r.Header.Get(requestIdHeader); requestIdRX.MatchString(id) {
+		return id
+	}
+	return uuid.Must(uuid.NewV7()).String()
+}
+
+// accessRecord is filled in by the reverse proxy once the agent answered
+type accessRecord struct {
+	start           time.Time
+	upstreamLatency time.Duration
+}
+
+// serveTunnel proxies one request to a tunnel of this node and logs it
+func (h *TunnelHandler) serveTunnel(proxy http.Handler, w http.ResponseWriter, r *http.Request, tunnel *Tunnel, remoteAddr string) {
+
+	record := &accessRecord{start: time.Now()}
+	ctx := context.WithValue(r.Context(), remoteAddrContextKey, remoteAddr)
+	ctx = context.WithValue(ctx, accessRecordContextKey, record)
+
+	body := &countingReader{ReadCloser: r.Body}
+	r = r.WithContext(ctx)
+	r.Body = body
+
+	sw := &statusWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	proxy.ServeHTTP(sw, r)
+
+	if record.upstreamLatency == 0 {
+		// the agent never answered, the whole attempt counts
+		record.upstreamLatency = time.Since(record.start)
+	}
+
+	h.logAccess(ctx, models.AccessLog{
+		TunnelId:          tunnel.Id,
+		SessionId:         tunnel.conn.Id,
+		UserId:            tunnel.conn.UserId,
+		RequestId:         r.Header.Get(requestIdHeader),
+		Hostname:          tunnel.Hostname,
+		Method:            r.Method,
+		Path:              r.URL.Path,
+		Status:            sw.statusCode,
+		RemoteAddr:        remoteAddr,
+		UpstreamLatencyMs: record.upstreamLatency.Milliseconds(),
+		BytesIn:           body.n,
+		BytesOut:          sw.bytes,
+		CreatedAt:         record.start,
+	})
+}
+
+// observeUpstream is the ModifyResponse hook of the tunnel proxy
+func observeUpstream(resp *http.Response) error {
+	// the ingress already set the request id on the response
+	resp.Header.Del(requestIdHeader)
+
+	if record, ok := resp.Request.Context().Value(accessRecordContextKey).(*accessRecord); ok {
+		record.upstreamLatency = time.Since(record.start)
+	}
+	return nil
+}
+
+func (h *TunnelHandler) logAccess(ctx context.Context, log models.AccessLog) {
+	slog.InfoContext(ctx, "tunnel access",
+		slog.String("request_id", log.RequestId),
+		slog.String("tunnel_id", log.TunnelId),
+		slog.Int("user_id", log.UserId),
+		slog.String("hostname", log.Hostname),
+		slog.String("method", log.Method),
+		slog.String("path", log.Path),
+		slog.Int("status", log.Status),
+		slog.String("remote_addr", log.RemoteAddr),
+		slog.Int64("upstream_latency_ms", log.UpstreamLatencyMs),
+		slog.Int64("bytes_in", log.BytesIn),
+		slog.Int64("bytes_out", log.BytesOut),
+	)
+
+	select {
+	case h.accessLogs <- log:
+	default:
+		h.metrics.accessLogsDropped.Inc()
+	}
+}
+
+// RunAccessLogs writes the queued access logs to the database until ctx is
+// cancelled, whatever is left is written by Shutdown
+func (h *TunnelHandler) RunAccessLogs(ctx context.Context) error {
+
+	ticker := time.NewTicker(accessLogFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.AccessLog, 0, accessLogBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := h.accessLogRepo.CreateAccessLogs(batch); err != nil {
+			slog.Error("failed to write access logs", slog.Int("count", len(batch)), slog.Any("err", err))
+			h.metrics.accessLogsDropped.Add(float64(len(batch)))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			flush()
+			return nil
+		case log := <-h.accessLogs:
+			batch = append(batch, log)
+			if len(batch) >= accessLogBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (h *TunnelHandler) flushAccessLogs() {
+	batch := []models.AccessLog{}
+drain:
+	for {
+		select {
+		case log := <-h.accessLogs:
+			batch = append(batch, log)
+		default:
+			break drain
+		}
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := h.accessLogRepo.CreateAccessLogs(batch); err != nil {
+		slog.Error("failed to write access logs", slog.Int("count", len(batch)), slog.Any("err", err))
+	}
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,23 @@
+package natserver
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestId(t *testing.T) {
+	r := httptest.NewRequest("GET", "http://app.localhost/", nil)
+	r.Header.Set(requestIdHeader, "abc-123")
+	if id := requestId(r); id != "abc-123" {
+		t.Fatalf("Expected incoming request id to be kept, got %q", id)
+	}
+
+	for _, incoming := range []string{"", "has space", "new\nline", strings.Repeat("a", 129)} {
+		r.Header.Set(requestIdHeader, incoming)
+		id := requestId(r)
+		if id == incoming || !requestIdRX.MatchString(id) {
+			t.Fatalf("Expected a new request id for %q, got %q", incoming, id)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package natserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/cache"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requests for a hostname owned by another node are forwarded to the internal
+// listener of that node, the headers authenticate the forwarding node and
+// carry the address of the original client. Only http tunnels are routed
+// across nodes, a tcp tunnel is reachable on the node its agent connected to.
+const (
+	clusterSecretHeader     = "X-Tunnel-Cluster-Secret"
+	clusterRemoteAddrHeader = "X-Tunnel-Remote-Addr"
+)
+
+const nodeAddrContextKey = contextKey("nodeAddr")
+
+// newForwardProxy proxies a public request to the node owning its hostname,
+// the node address is taken from the request context
+func newForwardProxy(cfg *config.Config) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetXForwarded()
+			nodeAddr, _ := pr.In.Context().Value(nodeAddrContextKey).(string)
+			pr.Out.URL.Scheme = "http"
+			pr.Out.URL.Host = nodeAddr
+			pr.Out.Host = pr.In.Host
+			pr.Out.Header.Set(clusterSecretHeader, cfg.Cluster.Secret)
+			pr.Out.Header.Set(clusterRemoteAddrHeader, pr.In.RemoteAddr)
+			injectTraceparent(pr.Out.Context(), pr.Out.Header)
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			slog.WarnContext(r.Context(), "cluster forward error", slog.String("host", r.Host), slog.Any("err", err))
+			http.Error(w, "tunnel unavailable", http.StatusBadGateway)
+		},
+	}
+}
+
+// forward looks up which node owns the hostname and hands the request over
+// to it, it reports false when no other node serves the hostname
+func (h *TunnelHandler) forward(w http.ResponseWriter, r *http.Request) bool {
+	if h.cfg.Cluster.Secret == "" {
+		return false
+	}
+
+	ownerId, err := h.tunnelRepo.GetHostnameOwner(hostWithoutPort(r.Host))
+	if err != nil {
+		if !errors.Is(err, cache.ErrNotFound) {
+			slog.Error("failed to look up hostname owner", slog.String("host", r.Host), slog.Any("err", err))
+		}
+		return false
+	}
+	if ownerId == h.cfg.Cluster.NodeId {
+		return false
+	}
+
+	node, err := h.tunnelRepo.GetNode(ownerId)
+	if err != nil {
+		if !errors.Is(err, cache.ErrNotFound) {
+			slog.Error("failed to look up node", slog.String("node_id", ownerId), slog.Any("err", err))
+		}
+		return false
+	}
+
+	ctx, span := tracer.Start(r.Context(), "forward",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("node.id", node.Id)),
+	)
+	defer span.End()
+
+	ctx = context.WithValue(ctx, nodeAddrContextKey, node.Addr)
+	h.forwardProxy.ServeHTTP(w, r.WithContext(ctx))
+	return true
+}
+
+// NewInternalHandler serves requests forwarded by other nodes, they are only
+// routed to tunnels of this node so a request is forwarded at most once
+func NewInternalHandler(h *TunnelHandler) http.Handler {
+
+	proxy := newTunnelProxy(h, func(pr *httputil.ProxyRequest) {
+		// the forwarding node already set the X-Forwarded headers
+		for _, header := range []string{"X-Forwarded-For", "X-Forwarded-Host", "X-Forwarded-Proto"} {
+			if value := pr.In.Header.Get(header); value != "" {
+				pr.Out.Header.Set(header, value)
+			}
+		}
+		pr.Out.Header.Del(clusterSecretHeader)
+		pr.Out.Header.Del(clusterRemoteAddrHeader)
+	})
+
+	return traceIngress("forwarded ingress", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret := r.Header.Get(clusterSecretHeader)
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(h.cfg.Cluster.Secret)) != 1 {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		tunnel, ok := h.pool.GetTunnel(hostWithoutPort(r.Host))
+		if !ok {
+			http.Error(w, "tunnel not found", http.StatusNotFound)
+			return
+		}
+
+		// the forwarding node assigned the request id and returns it
+		r.Header.Set(requestIdHeader, requestId(r))
+		h.serveTunnel(proxy, w, r, tunnel, r.Header.Get(clusterRemoteAddrHeader))
+	}))
+}
+
+func ListenAndServeInternal(ctx context.Context, cfg *config.Config, h *TunnelHandler) error {
+
+	addr := net.JoinHostPort(cfg.Cluster.InternalHost, strconv.Itoa(cfg.Cluster.InternalPort))
+	httpServer := http.Server{
+		Addr:    addr,
+		Handler: NewInternalHandler(h),
+	}
+
+	go shutdownOnDone(ctx, &httpServer)
+
+	slog.Info("internal listener started", slog.String("addr", addr), slog.String("node_id", cfg.Cluster.NodeId))
+	err := httpServer.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
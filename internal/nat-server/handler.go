@@ -1,33 +1,683 @@
 package natserver
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http/httputil"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/request"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/apikey"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/policy"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories/postgres"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/utils"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/metrics"
 
+	"github.com/google/uuid"
 	"github.com/hashicorp/yamux"
 )
 
-func HandleTcpStream(cfg config.Config, session *yamux.Session) {
-	// handle authentication
-	// after that update the pool for connection so we can connect have presistance connection and way to manage connect so need state
+const handshakeTimeout = 10 * time.Second
+
+var (
+	ErrInvalidRequest      = errors.New("invalid request")
+	ErrAuthentication      = errors.New("authentication failed")
+	ErrQuotaExceeded       = errors.New("quota exceeded")
+	ErrHostnameUnavailable = errors.New("hostname unavailable")
+	ErrTunnelNotFound      = errors.New("tunnel not found")
+	ErrShuttingDown        = errors.New("server is shutting down")
+	ErrPermissionDenied    = errors.New("permission denied")
+)
+
+type TunnelHandler struct {
+	cfg        *config.Config
+	pool       *ConnectionsPool
+	apiKeyRepo repositories.APIRepo
+	keyUsage   *apikey.UsageTracker
+	userRepo   repositories.UserRepo
+	planRepo   repositories.PlanRepo
+	domainRepo repositories.DomainRepo
+	usageRepo  repositories.UsageRepo
+	tunnelRepo repositories.TunnelRepo
+	startedAt  time.Time
+
+	accessLogRepo repositories.AccessLogRepo
+	accessLogs    chan models.AccessLog
+
+	forwardProxy  *httputil.ReverseProxy
+	metrics       *serverMetrics
+	activeStreams atomic.Int64
+	shuttingDown  atomic.Bool
+}
+
+func NewTunnelHandler(cfg *config.Config, pool *ConnectionsPool, apiKeyRepo repositories.APIRepo, keyUsage *apikey.UsageTracker, userRepo repositories.UserRepo, planRepo repositories.PlanRepo, domainRepo repositories.DomainRepo, usageRepo repositories.UsageRepo, tunnelRepo repositories.TunnelRepo, accessLogRepo repositories.AccessLogRepo, metricsRegistry *metrics.Registry) *TunnelHandler {
+	return &TunnelHandler{
+		cfg:        cfg,
+		pool:       pool,
+		apiKeyRepo: apiKeyRepo,
+		keyUsage:   keyUsage,
+		userRepo:   userRepo,
+		planRepo:   planRepo,
+		domainRepo: domainRepo,
+		usageRepo:  usageRepo,
+		tunnelRepo: tunnelRepo,
+		startedAt:  time.Now(),
+
+		accessLogRepo: accessLogRepo,
+		accessLogs:    make(chan models.AccessLog, accessLogBufferSize),
+
+		forwardProxy: newForwardProxy(cfg),
+		metrics:      newServerMetrics(metricsRegistry, pool),
+	}
+}
+
+// HandleTcpStream runs the control stream of one agent session: the agent
+// authenticates with its api key and then opens and closes tunnels over it.
+func (h *TunnelHandler) HandleTcpStream(session *yamux.Session, clientIP string) {
+
+	control, err := session.AcceptStream()
+	if err != nil {
+		slog.Error("failed to accept control stream", slog.String("client_ip", clientIP), slog.Any("err", err))
+		return
+	}
+	defer control.Close()
+
+	control.SetDeadline(time.Now().Add(handshakeTimeout))
+	conn, err := h.handshake(control, session, clientIP)
+	if err != nil {
+		h.metrics.handshakeFailures.Inc(handshakeFailureReason(err))
+		slog.Info("agent handshake rejected", slog.String("client_ip", clientIP), slog.Any("err", err))
+		return
+	}
+	control.SetDeadline(time.Time{})
+	defer h.endSession(conn)
+
+	slog.Info("agent session started",
+		slog.String("session_id", conn.Id),
+		slog.Int("user_id", conn.UserId),
+		slog.String("client_ip", clientIP),
+		slog.String("agent_version", conn.AgentVersion),
+	)
+
+	for {
+		frame, err := ReadFrame(control)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, yamux.ErrStreamClosed) {
+				slog.Warn("failed to read control frame", slog.String("session_id", conn.Id), slog.Any("err", err))
+			}
+			break
+		}
+
+		switch frame.Type {
+		case OpenTunnelFrameType:
+			err = h.openTunnel(control, conn, frame)
+		case CloseTunnelFrameType:
+			err = h.closeTunnel(control, conn, frame)
+		default:
+			err = fmt.Errorf("%w: unexpected %s frame", ErrInvalidRequest, frame.Type)
+		}
+		if err != nil {
+			h.reject(control, err)
+		}
+	}
+
+	slog.Info("agent session ended", slog.String("session_id", conn.Id), slog.Int("user_id", conn.UserId))
+}
+
+func (h *TunnelHandler) handshake(control net.Conn, session *yamux.Session, clientIP string) (*Connection, error) {
+
+	if h.shuttingDown.Load() {
+		return nil, h.reject(control, ErrShuttingDown)
+	}
+
+	frame, err := ReadFrame(control)
+	if err != nil {
+		return nil, err
+	}
+
+	if frame.Type != HandshakeFrameType {
+		return nil, h.reject(control, fmt.Errorf("%w: expected %s frame", ErrInvalidRequest, HandshakeFrameType))
+	}
+
+	var req Handshake
+	if err := frame.Decode(&req); err != nil || req.APIKey == "" {
+		return nil, h.reject(control, fmt.Errorf("%w: handshake must contain an api key", ErrInvalidRequest))
+	}
+
+	apiKeyHash := utils.HashAPIKey(req.APIKey)
+	apiKey, err := h.apiKeyRepo.GetAPIKey(apiKeyHash)
+	if err != nil {
+		if errors.Is(err, postgres.ErrNotFound) {
+			return nil, h.reject(control, fmt.Errorf("%w: invalid api key", ErrAuthentication))
+		}
+		return nil, h.reject(control, err)
+	}
+
+	if !apiKey.ExpireAt.IsZero() && apiKey.ExpireAt.Before(time.Now()) {
+		return nil, h.reject(control, fmt.Errorf("%w: api key expired", ErrAuthentication))
+	}
+	h.keyUsage.Touch(apiKey.Id, clientIP)
+
+	user, err := h.userRepo.GetById(apiKey.UserId)
+	if err != nil {
+		return nil, h.reject(control, err)
+	}
+	if !user.DeletedAt.IsZero() {
+		return nil, h.reject(control, fmt.Errorf("%w: account is scheduled for deletion", ErrAuthentication))
+	}
+	if !user.SuspendedAt.IsZero() {
+		return nil, h.reject(control, fmt.Errorf("%w: account is suspended", ErrAuthentication))
+	}
+
+	plan, err := h.planRepo.GetPlan(user.Plan)
+	if err != nil {
+		return nil, h.reject(control, err)
+	}
+
+	if err := checkBandwidthQuota(h.usageRepo, plan, user.Id); err != nil {
+		return nil, h.reject(control, err)
+	}
+
+	// the pool only knows sessions on this node, the registry knows all of them
+	sessions, err := h.tunnelRepo.CountUserAgentSessions(user.Id)
+	if err != nil {
+		return nil, h.reject(control, err)
+	}
+	if sessions >= plan.MaxSessions {
+		return nil, h.reject(control, sessionQuotaError(plan))
+	}
+
+	sessionId, err := uuid.NewV7()
+	if err != nil {
+		return nil, h.reject(control, err)
+	}
+
+	conn := &Connection{
+		session:      session,
+		control:      control,
+		Id:           sessionId.String(),
+		NodeId:       h.cfg.Cluster.NodeId,
+		UserId:       user.Id,
+		OrgId:        apiKey.OrgId,
+		APIKeyId:     apiKey.Id,
+		APIKeyHash:   apiKeyHash,
+		Scopes:       apiKey.Permissions,
+		Plan:         *plan,
+		AgentVersion: req.AgentVersion,
+		ClientIP:     clientIP,
+		StartedAt:    time.Now(),
+		tunnels:      make(map[string]*Tunnel),
+	}
+
+	if err := h.pool.AddConnection(conn); err != nil {
+		return nil, h.reject(control, err)
+	}
+
+	h.publishSession(conn)
+
+	err = WriteFrame(control, HandshakeOkFrameType, HandshakeOk{SessionId: conn.Id})
+	if err != nil {
+		h.endSession(conn)
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// checkTunnelScope rejects tunnel types the api key of the agent was not
+// given, unknown types are left to openTunnel
+func checkTunnelScope(conn *Connection, tunnelType models.TunnelType) error {
+	var scope models.APIKeyScope
+	switch tunnelType {
+	case models.HttpTunnelType:
+		scope = models.TunnelHttpScope
+	case models.TcpTunnelType:
+		scope = models.TunnelTcpScope
+	default:
+		return nil
+	}
+
+	if !policy.HasScope(conn.Scopes, scope) {
+		return fmt.Errorf("%w: api key lacks the %s scope", ErrPermissionDenied, scope)
+	}
+	return nil
+}
+
+func (h *TunnelHandler) openTunnel(control net.Conn, conn *Connection, frame *Frame) error {
+
+	var req OpenTunnel
+	if err := frame.Decode(&req); err != nil {
+		return fmt.Errorf("%w: malformed %s frame", ErrInvalidRequest, OpenTunnelFrameType)
+	}
+	if strings.TrimSpace(req.LocalAddr) == "" {
+		return fmt.Errorf("%w: local_addr must not be empty", ErrInvalidRequest)
+	}
+	if h.shuttingDown.Load() {
+		return ErrShuttingDown
+	}
+	if err := checkTunnelScope(conn, req.Type); err != nil {
+		return err
+	}
+
+	if err := checkBandwidthQuota(h.usageRepo, &conn.Plan, conn.UserId); err != nil {
+		return err
+	}
+
+	tunnelId, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+
+	tunnel := &Tunnel{
+		Id:        tunnelId.String(),
+		Type:      req.Type,
+		LocalAddr: req.LocalAddr,
+		StartedAt: time.Now(),
+		conn:      conn,
+	}
+
+	switch req.Type {
+	case models.HttpTunnelType:
+		hostname, err := h.tunnelHostname(conn, req.Subdomain)
+		if err != nil {
+			return err
+		}
+		claimed, err := h.tunnelRepo.ClaimHostname(hostname, h.cfg.Cluster.NodeId, registryTTL)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			return fmt.Errorf("%w: %s is already in use", ErrHostnameUnavailable, hostname)
+		}
+		tunnel.Hostname = hostname
+		tunnel.PublicURL = publicHttpURL(h.cfg, hostname)
+
+	case models.TcpTunnelType:
+		// the registry counts the ports of every node, the pool checks again
+		// under its lock for the tunnels of this node not published yet
+		ports, err := h.tunnelRepo.CountUserTunnels(conn.UserId, models.TcpTunnelType)
+		if err != nil {
+			return err
+		}
+		if ports >= conn.Plan.MaxTcpPorts {
+			return tcpQuotaError(&conn.Plan)
+		}
+		listener, port, err := listenTcpTunnel(h.cfg)
+		if err != nil {
+			return err
+		}
+		tunnel.listener = listener
+		tunnel.Port = port
+		tunnel.PublicURL = fmt.Sprintf("tcp://%s:%d", h.cfg.NatHttpServer.Domain, port)
+
+	default:
+		return fmt.Errorf("%w: unsupported tunnel type %q", ErrInvalidRequest, req.Type)
+	}
+
+	if err := h.pool.AddTunnel(conn, tunnel); err != nil {
+		if tunnel.listener != nil {
+			tunnel.listener.Close()
+		}
+		if tunnel.Hostname != "" && !errors.Is(err, ErrHostnameUnavailable) {
+			h.releaseHostname(tunnel.Hostname)
+		}
+		return err
+	}
+
+	if tunnel.listener != nil {
+		go h.serveTcpTunnel(tunnel)
+	}
+	h.publishTunnel(tunnel)
+
+	slog.Info("tunnel opened",
+		slog.String("session_id", conn.Id),
+		slog.String("tunnel_id", tunnel.Id),
+		slog.String("type", string(tunnel.Type)),
+		slog.String("public_url", tunnel.PublicURL),
+	)
+
+	return WriteFrame(control, TunnelOpenedFrameType, TunnelOpened{
+		TunnelId:  tunnel.Id,
+		PublicURL: tunnel.PublicURL,
+	})
+}
+
+func (h *TunnelHandler) closeTunnel(control net.Conn, conn *Connection, frame *Frame) error {
+
+	var req CloseTunnel
+	if err := frame.Decode(&req); err != nil || req.TunnelId == "" {
+		return fmt.Errorf("%w: malformed %s frame", ErrInvalidRequest, CloseTunnelFrameType)
+	}
+
+	tunnel, ok := h.pool.RemoveTunnel(conn, req.TunnelId)
+	if !ok {
+		return ErrTunnelNotFound
+	}
+	h.unpublishTunnel(tunnel)
+
+	slog.Info("tunnel closed", slog.String("session_id", conn.Id), slog.String("tunnel_id", req.TunnelId))
+	return nil
+}
+
+// tunnelHostname returns the hostname for a new http tunnel, a requested
+// subdomain must be reserved by the owner of the session
+func (h *TunnelHandler) tunnelHostname(conn *Connection, subdomain string) (string, error) {
+
+	if subdomain == "" {
+		return strings.ToLower(utils.GenerateToken(12)) + "." + h.cfg.NatHttpServer.Domain, nil
+	}
+
+	v := request.NewValidator()
+	request.ValidSubdomain(v, subdomain)
+	if !v.Valid() {
+		return "", fmt.Errorf("%w: %s", ErrInvalidRequest, v.Errors["subdomain"])
+	}
+
+	hostname := subdomain + "." + h.cfg.NatHttpServer.Domain
+	domain, err := h.domainRepo.GetDomainByHostname(hostname)
+	if err != nil {
+		if errors.Is(err, postgres.ErrNotFound) {
+			return "", fmt.Errorf("%w: %s is not reserved by your account", ErrHostnameUnavailable, hostname)
+		}
+		return "", err
+	}
+	// org domains may be used by any key of the org, personal ones only by
+	// personal keys of their owner
+	owned := domain.OrgId == 0 && conn.OrgId == 0 && domain.UserId == conn.UserId
+	if domain.OrgId != 0 {
+		owned = domain.OrgId == conn.OrgId
+	}
+	if !owned {
+		return "", fmt.Errorf("%w: %s is not reserved by your account", ErrHostnameUnavailable, hostname)
+	}
+
+	return hostname, nil
+}
+
+// reject sends err to the agent as an error frame and returns err so callers
+// can hand it back up
+func (h *TunnelHandler) reject(control net.Conn, err error) error {
+	code := errorCode(err)
+	message := err.Error()
+
+	if code == InternalErrorCode {
+		slog.Error("tunnel server error", slog.Any("err", err))
+		message = "the server encounter a problem and could not process your request"
+	}
+
+	if writeErr := writeError(control, code, message); writeErr != nil {
+		slog.Warn("failed to write error frame", slog.Any("err", writeErr))
+	}
+
+	return err
+}
+
+func errorCode(err error) ErrorCode {
+	switch {
+	case errors.Is(err, ErrInvalidRequest), errors.Is(err, ErrTunnelNotFound), errors.Is(err, ErrFrameTooLarge):
+		return InvalidRequestErrorCode
+	case errors.Is(err, ErrAuthentication):
+		return AuthenticationErrorCode
+	case errors.Is(err, ErrQuotaExceeded):
+		return QuotaExceededErrorCode
+	case errors.Is(err, ErrHostnameUnavailable):
+		return HostnameUnavailableErrorCode
+	case errors.Is(err, ErrShuttingDown):
+		return ShuttingDownErrorCode
+	case errors.Is(err, ErrPermissionDenied):
+		return PermissionDeniedErrorCode
+	default:
+		return InternalErrorCode
+	}
+}
+
+// handshakeFailureReason labels failed handshakes for the metrics, agents
+// that time out or hang up never got an error frame
+func handshakeFailureReason(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, yamux.ErrStreamClosed):
+		return "disconnected"
+	default:
+		return string(errorCode(err))
+	}
 }
 
 type Connection struct {
-	session *yamux.Session
+	session      *yamux.Session
+	control      net.Conn // yamux streams are safe for concurrent writes
+	Id           string
+	NodeId       string
+	UserId       int
+	OrgId        int // set when the agent authenticated with an org api key
+	APIKeyId     int
+	APIKeyHash   string   // the secret the agent authenticated with
+	Scopes       []string // permissions of the api key, see policy.HasScope
+	Plan         models.Plan
+	AgentVersion string
+	ClientIP     string
+	StartedAt    time.Time
+
+	tunnels map[string]*Tunnel // guarded by ConnectionsPool.mu
 }
 
+func (c *Connection) Info() *models.AgentSession {
+	return &models.AgentSession{
+		Id:         c.Id,
+		UserId:     c.UserId,
+		NodeId:     c.NodeId,
+		APIKeyId:   c.APIKeyId,
+		APIKeyHash: c.APIKeyHash,
+		StartedAt:  c.StartedAt,
+	}
+}
+
+type Tunnel struct {
+	Id        string
+	Type      models.TunnelType
+	Hostname  string
+	Port      int
+	LocalAddr string
+	PublicURL string
+	StartedAt time.Time
+	BytesIn   atomic.Int64 // bytes sent from public clients to the agent
+	BytesOut  atomic.Int64 // bytes sent from the agent to public clients
+
+	conn     *Connection
+	listener net.Listener // only set for tcp tunnels
+}
+
+func (t *Tunnel) Info() *models.Tunnel {
+	return &models.Tunnel{
+		Id:           t.Id,
+		SessionId:    t.conn.Id,
+		NodeId:       t.conn.NodeId,
+		UserId:       t.conn.UserId,
+		OrgId:        t.conn.OrgId,
+		APIKeyId:     t.conn.APIKeyId,
+		Type:         t.Type,
+		PublicURL:    t.PublicURL,
+		LocalAddr:    t.LocalAddr,
+		ClientIP:     t.conn.ClientIP,
+		AgentVersion: t.conn.AgentVersion,
+		StartedAt:    t.StartedAt,
+		BytesIn:      t.BytesIn.Load(),
+		BytesOut:     t.BytesOut.Load(),
+	}
+}
+
+// ConnectionsPool holds the sessions connected to this node, it sits in front
+// of the shared registry which knows the sessions and hostnames of all nodes
 type ConnectionsPool struct {
-	pool map[string]*Connection
-	mu   sync.RWMutex
+	pool  map[string]*Connection // session id -> connection
+	hosts map[string]*Tunnel     // hostname -> http tunnel
+	mu    sync.RWMutex
+}
+
+func NewConnectionsPool() *ConnectionsPool {
+	return &ConnectionsPool{
+		pool:  make(map[string]*Connection),
+		hosts: make(map[string]*Tunnel),
+	}
+}
+
+// AddConnection registers a new agent session, the concurrent session quota
+// of the plan is checked under the same lock so parallel handshakes can't
+// exceed it
+func (c *ConnectionsPool) AddConnection(conn *Connection) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.countUserSessions(conn.UserId) >= conn.Plan.MaxSessions {
+		return sessionQuotaError(&conn.Plan)
+	}
+
+	c.pool[conn.Id] = conn
+	return nil
+}
+
+// RemoveConnection drops the session and all of its tunnels, the removed
+// tunnels are returned so they can be unpublished
+func (c *ConnectionsPool) RemoveConnection(id string) []*Tunnel {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	conn, ok := c.pool[id]
+	if !ok {
+		return nil
+	}
+
+	removed := make([]*Tunnel, 0, len(conn.tunnels))
+	for _, tunnel := range conn.tunnels {
+		c.removeTunnel(conn, tunnel)
+		removed = append(removed, tunnel)
+	}
+	delete(c.pool, id)
+
+	return removed
+}
+
+func (c *ConnectionsPool) GetConnection(id string) (*Connection, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	conn, ok := c.pool[id]
+	return conn, ok
 }
 
-// \r\n
-// functionality in connectionPool to check if user existis or not
-// connectionString = (user_id + connection) base64 encoded
-// connectionString = user_id\r
+// Connections returns a snapshot of every session connected to this node
+func (c *ConnectionsPool) Connections() []*Connection {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
-func (c *ConnectionsPool) AddConnection(conn Connection) {
+	conns := make([]*Connection, 0, len(c.pool))
+	for _, conn := range c.pool {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// Tunnels returns a snapshot of every tunnel open on this node
+func (c *ConnectionsPool) Tunnels() []*Tunnel {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	tunnels := []*Tunnel{}
+	for _, conn := range c.pool {
+		for _, tunnel := range conn.tunnels {
+			tunnels = append(tunnels, tunnel)
+		}
+	}
+	return tunnels
+}
+
+func (c *ConnectionsPool) AddTunnel(conn *Connection, tunnel *Tunnel) error {
 	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(conn.tunnels) >= conn.Plan.MaxTunnelsPerSession {
+		return fmt.Errorf("%w: %s plan allows %d tunnels per session", ErrQuotaExceeded, conn.Plan.Name, conn.Plan.MaxTunnelsPerSession)
+	}
+
+	switch tunnel.Type {
+	case models.HttpTunnelType:
+		if _, taken := c.hosts[tunnel.Hostname]; taken {
+			return fmt.Errorf("%w: %s is already in use", ErrHostnameUnavailable, tunnel.Hostname)
+		}
+		c.hosts[tunnel.Hostname] = tunnel
+	case models.TcpTunnelType:
+		if c.countUserTunnels(conn.UserId, models.TcpTunnelType) >= conn.Plan.MaxTcpPorts {
+			return tcpQuotaError(&conn.Plan)
+		}
+	}
+
+	conn.tunnels[tunnel.Id] = tunnel
+	return nil
+}
+
+func (c *ConnectionsPool) RemoveTunnel(conn *Connection, tunnelId string) (*Tunnel, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tunnel, ok := conn.tunnels[tunnelId]
+	if !ok {
+		return nil, false
+	}
+
+	c.removeTunnel(conn, tunnel)
+	return tunnel, true
+}
+
+func (c *ConnectionsPool) GetTunnel(hostname string) (*Tunnel, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	tunnel, ok := c.hosts[hostname]
+	return tunnel, ok
+}
+
+func (c *ConnectionsPool) removeTunnel(conn *Connection, tunnel *Tunnel) {
+	if tunnel.listener != nil {
+		tunnel.listener.Close()
+	}
+	if tunnel.Hostname != "" && c.hosts[tunnel.Hostname] == tunnel {
+		delete(c.hosts, tunnel.Hostname)
+	}
+	delete(conn.tunnels, tunnel.Id)
+}
+
+func (c *ConnectionsPool) countUserSessions(userId int) int {
+	count := 0
+	for _, conn := range c.pool {
+		if conn.UserId == userId {
+			count++
+		}
+	}
+	return count
+}
 
+func (c *ConnectionsPool) countUserTunnels(userId int, tunnelType models.TunnelType) int {
+	count := 0
+	for _, conn := range c.pool {
+		if conn.UserId != userId {
+			continue
+		}
+		for _, tunnel := range conn.tunnels {
+			if tunnel.Type == tunnelType {
+				count++
+			}
+		}
+	}
+	return count
 }
@@ -0,0 +1,98 @@
+package natserver
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+)
+
+func testConnection(id string, userId int, plan models.Plan) *Connection {
+	return &Connection{
+		Id:      id,
+		UserId:  userId,
+		Plan:    plan,
+		tunnels: make(map[string]*Tunnel),
+	}
+}
+
+func TestConnectionsPoolSessionQuota(t *testing.T) {
+	pool := NewConnectionsPool()
+	plan := models.Plan{Name: "free", MaxSessions: 1, MaxTunnelsPerSession: 1}
+
+	if err := pool.AddConnection(testConnection("a", 1, plan)); err != nil {
+		t.Fatalf("AddConnection() returned an unexpected error: %v", err)
+	}
+
+	err := pool.AddConnection(testConnection("b", 1, plan))
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Expected ErrQuotaExceeded for second session, got %v", err)
+	}
+
+	if err := pool.AddConnection(testConnection("c", 2, plan)); err != nil {
+		t.Fatalf("Sessions of other users should not count towards the quota: %v", err)
+	}
+
+	pool.RemoveConnection("a")
+	if err := pool.AddConnection(testConnection("b", 1, plan)); err != nil {
+		t.Fatalf("AddConnection() after RemoveConnection() returned an unexpected error: %v", err)
+	}
+}
+
+func TestConnectionsPoolTunnelQuota(t *testing.T) {
+	pool := NewConnectionsPool()
+	plan := models.Plan{Name: "pro", MaxSessions: 2, MaxTunnelsPerSession: 2, MaxTcpPorts: 1}
+
+	first := testConnection("a", 1, plan)
+	second := testConnection("b", 1, plan)
+	pool.AddConnection(first)
+	pool.AddConnection(second)
+
+	err := pool.AddTunnel(first, &Tunnel{Id: "t1", Type: models.HttpTunnelType, Hostname: "app.localhost"})
+	if err != nil {
+		t.Fatalf("AddTunnel() returned an unexpected error: %v", err)
+	}
+
+	err = pool.AddTunnel(second, &Tunnel{Id: "t2", Type: models.HttpTunnelType, Hostname: "app.localhost"})
+	if !errors.Is(err, ErrHostnameUnavailable) {
+		t.Fatalf("Expected ErrHostnameUnavailable for a hostname in use, got %v", err)
+	}
+
+	if err := pool.AddTunnel(first, &Tunnel{Id: "t3", Type: models.TcpTunnelType}); err != nil {
+		t.Fatalf("AddTunnel() returned an unexpected error: %v", err)
+	}
+
+	err = pool.AddTunnel(second, &Tunnel{Id: "t4", Type: models.TcpTunnelType})
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Expected ErrQuotaExceeded for tcp ports across sessions, got %v", err)
+	}
+
+	err = pool.AddTunnel(first, &Tunnel{Id: "t5", Type: models.HttpTunnelType, Hostname: "other.localhost"})
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Expected ErrQuotaExceeded for tunnels per session, got %v", err)
+	}
+
+	pool.RemoveConnection("a")
+	if _, ok := pool.GetTunnel("app.localhost"); ok {
+		t.Fatalf("Expected hostname to be released when the session is removed")
+	}
+}
+
+func TestCheckTunnelScope(t *testing.T) {
+	conn := testConnection("a", 1, models.Plan{})
+	if err := checkTunnelScope(conn, models.TcpTunnelType); err != nil {
+		t.Fatalf("Keys without scopes should open tcp tunnels, got %v", err)
+	}
+
+	conn.Scopes = []string{string(models.TunnelHttpScope)}
+	if err := checkTunnelScope(conn, models.HttpTunnelType); err != nil {
+		t.Fatalf("checkTunnelScope() returned an unexpected error: %v", err)
+	}
+	err := checkTunnelScope(conn, models.TcpTunnelType)
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("Expected ErrPermissionDenied for a tcp tunnel, got %v", err)
+	}
+	if errorCode(err) != PermissionDeniedErrorCode {
+		t.Fatalf("Expected %s error code, got %s", PermissionDeniedErrorCode, errorCode(err))
+	}
+}
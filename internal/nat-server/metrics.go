@@ -0,0 +1,78 @@
+package natserver
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/metrics"
+)
+
+type serverMetrics struct {
+	streamsOpened     *metrics.Counter
+	handshakeFailures *metrics.Counter
+	accessLogsDropped *metrics.Counter
+	// bytes are counted on every read and write, atomics keep that cheap
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+}
+
+func newServerMetrics(reg *metrics.Registry, pool *ConnectionsPool) *serverMetrics {
+	m := &serverMetrics{
+		streamsOpened:     reg.NewCounter("nat_streams_opened_total", "Streams opened to agents.", "type"),
+		handshakeFailures: reg.NewCounter("nat_handshake_failures_total", "Agent handshakes that failed.", "reason"),
+		accessLogsDropped: reg.NewCounter("nat_access_logs_dropped_total", "Tunnel access logs that could not be stored."),
+	}
+
+	reg.NewGaugeFunc("nat_active_sessions", "Agent sessions connected to this node.", func() float64 {
+		return float64(len(pool.Connections()))
+	})
+	reg.NewGaugeVecFunc("nat_active_tunnels", "Tunnels open on this node.", "type", func() map[string]float64 {
+		tunnels := map[string]float64{
+			string(models.HttpTunnelType): 0,
+			string(models.TcpTunnelType):  0,
+		}
+		for _, tunnel := range pool.Tunnels() {
+			tunnels[string(tunnel.Type)]++
+		}
+		return tunnels
+	})
+	reg.NewCounterFunc("nat_tunnel_bytes_in_total", "Bytes sent to agents.", func() float64 {
+		return float64(m.bytesIn.Load())
+	})
+	reg.NewCounterFunc("nat_tunnel_bytes_out_total", "Bytes received from agents.", func() float64 {
+		return float64(m.bytesOut.Load())
+	})
+
+	return m
+}
+
+// ListenAndServeAdmin serves /metrics on the admin port, it is kept apart from
+// the ingress so it is never reachable through a tunnel hostname
+func ListenAndServeAdmin(ctx context.Context, cfg *config.Config, metricsRegistry *metrics.Registry) error {
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metricsRegistry.Handler())
+
+	addr := net.JoinHostPort(cfg.NatAdminServer.Host, strconv.Itoa(cfg.NatAdminServer.Port))
+	httpServer := http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+
+	go shutdownOnDone(ctx, &httpServer)
+
+	slog.Info("admin server started", slog.String("addr", addr))
+	err := httpServer.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
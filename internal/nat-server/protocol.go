@@ -0,0 +1,161 @@
+package natserver
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+)
+
+// every frame on the wire is a 4 byte big endian length followed by the json
+// encoded Frame, so the agent can read exactly one frame off a stream before
+// switching it to raw traffic
+const maxFrameSize = 64 * 1024
+
+var ErrFrameTooLarge = errors.New("frame exceeds maximum size")
+
+type FrameType string
+
+const (
+	HandshakeFrameType    FrameType = "handshake"
+	HandshakeOkFrameType  FrameType = "handshake_ok"
+	OpenTunnelFrameType   FrameType = "open_tunnel"
+	TunnelOpenedFrameType FrameType = "tunnel_opened"
+	CloseTunnelFrameType  FrameType = "close_tunnel"
+	StreamFrameType       FrameType = "stream"
+	GoingAwayFrameType    FrameType = "going_away"
+	ErrorFrameType        FrameType = "error"
+)
+
+type ErrorCode string
+
+const (
+	InvalidRequestErrorCode      ErrorCode = "invalid_request"
+	AuthenticationErrorCode      ErrorCode = "authentication_failed"
+	QuotaExceededErrorCode       ErrorCode = "quota_exceeded"
+	HostnameUnavailableErrorCode ErrorCode = "hostname_unavailable"
+	ShuttingDownErrorCode        ErrorCode = "shutting_down"
+	PermissionDeniedErrorCode    ErrorCode = "permission_denied"
+	InternalErrorCode            ErrorCode = "internal_error"
+)
+
+type Frame struct {
+	Type FrameType       `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// sent by the agent on the control stream right after connecting
+type Handshake struct {
+	APIKey       string `json:"api_key"`
+	AgentVersion string `json:"agent_version"`
+}
+
+type HandshakeOk struct {
+	SessionId string `json:"session_id"`
+}
+
+type OpenTunnel struct {
+	Type      models.TunnelType `json:"type"`
+	Subdomain string            `json:"subdomain,omitempty"`
+	LocalAddr string            `json:"local_addr"`
+}
+
+type TunnelOpened struct {
+	TunnelId  string `json:"tunnel_id"`
+	PublicURL string `json:"public_url"`
+}
+
+type CloseTunnel struct {
+	TunnelId string `json:"tunnel_id"`
+}
+
+// written by the server as the first frame of every data stream it opens.
+// Traceparent is the w3c trace context of the server span that opened the
+// stream, the agent uses it as parent of its local dial and upstream spans.
+type StreamHeader struct {
+	TunnelId    string `json:"tunnel_id"`
+	RemoteAddr  string `json:"remote_addr"`
+	Traceparent string `json:"traceparent,omitempty"`
+}
+
+// sent by the server on the control stream when the node shuts down, the agent
+// should connect again so it lands on another node. Streams that are already
+// open keep working until Deadline, the session is closed after that.
+type GoingAway struct {
+	Message  string    `json:"message"`
+	Deadline time.Time `json:"deadline"`
+}
+
+type ErrorMessage struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+func WriteFrame(w io.Writer, frameType FrameType, data any) error {
+	frame := Frame{Type: frameType}
+
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("failed to encode frame data: %w", err)
+		}
+		frame.Data = raw
+	}
+
+	payload, err := json.Marshal(frame)
+	if err != nil {
+		return fmt.Errorf("failed to encode frame: %w", err)
+	}
+	if len(payload) > maxFrameSize {
+		return ErrFrameTooLarge
+	}
+
+	buf := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(len(payload)))
+	copy(buf[4:], payload)
+
+	_, err = w.Write(buf)
+	return err
+}
+
+func ReadFrame(r io.Reader) (*Frame, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxFrameSize {
+		return nil, ErrFrameTooLarge
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	var frame Frame
+	if err := json.Unmarshal(payload, &frame); err != nil {
+		return nil, fmt.Errorf("failed to decode frame: %w", err)
+	}
+
+	return &frame, nil
+}
+
+func (f *Frame) Decode(v any) error {
+	if len(f.Data) == 0 {
+		return fmt.Errorf("%s frame has no data", f.Type)
+	}
+	return json.Unmarshal(f.Data, v)
+}
+
+func writeError(w io.Writer, code ErrorCode, message string) error {
+	return WriteFrame(w, ErrorFrameType, ErrorMessage{
+		Code:    code,
+		Message: message,
+	})
+}
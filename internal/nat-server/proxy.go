@@ -0,0 +1,261 @@
+package natserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type contextKey string
+
+const remoteAddrContextKey = contextKey("remoteAddr")
+
+// NewHttpProxy routes public http requests to the agent owning the hostname,
+// every request gets its own yamux stream. Hostnames served by another node
+// are forwarded to that node.
+func NewHttpProxy(h *TunnelHandler) http.Handler {
+
+	proxy := newTunnelProxy(h, func(pr *httputil.ProxyRequest) {
+		pr.SetXForwarded()
+		pr.Out.Header.Del(clusterSecretHeader)
+		pr.Out.Header.Del(clusterRemoteAddrHeader)
+	})
+
+	return traceIngress("ingress", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestId(r)
+		r.Header.Set(requestIdHeader, id)
+		w.Header().Set(requestIdHeader, id)
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("http.request.id", id))
+
+		tunnel, ok := h.pool.GetTunnel(hostWithoutPort(r.Host))
+		if !ok {
+			if !h.forward(w, r) {
+				http.Error(w, "tunnel not found", http.StatusNotFound)
+			}
+			return
+		}
+
+		h.serveTunnel(proxy, w, r, tunnel, r.RemoteAddr)
+	}))
+}
+
+// newTunnelProxy proxies requests to tunnels of this node, rewrite sets the
+// forwarding headers
+func newTunnelProxy(h *TunnelHandler, rewrite func(*httputil.ProxyRequest)) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			rewrite(pr)
+			injectTraceparent(pr.Out.Context(), pr.Out.Header)
+			pr.Out.URL.Scheme = "http"
+			pr.Out.URL.Host = pr.In.Host
+			pr.Out.Host = pr.In.Host
+		},
+		Transport: &http.Transport{
+			DialContext:       h.dialTunnel,
+			DisableKeepAlives: true,
+		},
+		ModifyResponse: observeUpstream,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			slog.WarnContext(r.Context(), "tunnel proxy error", slog.String("host", r.Host), slog.Any("err", err))
+			http.Error(w, "tunnel unavailable", http.StatusBadGateway)
+		},
+	}
+}
+
+func ListenAndServeHttp(ctx context.Context, cfg *config.Config, h *TunnelHandler) error {
+
+	addr := net.JoinHostPort(cfg.NatHttpServer.Host, strconv.Itoa(cfg.NatHttpServer.Port))
+	httpServer := http.Server{
+		Addr:    addr,
+		Handler: NewHttpProxy(h),
+	}
+
+	go shutdownOnDone(ctx, &httpServer)
+
+	slog.Info("http ingress started", slog.String("addr", addr))
+	err := httpServer.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+func (h *TunnelHandler) dialTunnel(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	tunnel, ok := h.pool.GetTunnel(host)
+	if !ok {
+		return nil, ErrTunnelNotFound
+	}
+
+	remoteAddr, _ := ctx.Value(remoteAddrContextKey).(string)
+	return h.openStream(ctx, tunnel, remoteAddr)
+}
+
+// openStream opens a new yamux stream to the agent and writes the stream
+// header so the agent knows which local address to forward it to
+func (h *TunnelHandler) openStream(ctx context.Context, tunnel *Tunnel, remoteAddr string) (net.Conn, error) {
+	ctx, span := tracer.Start(ctx, "open stream",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("tunnel.id", tunnel.Id),
+			attribute.String("tunnel.type", string(tunnel.Type)),
+			attribute.String("session.id", tunnel.conn.Id),
+		),
+	)
+	defer span.End()
+
+	stream, err := tunnel.conn.session.OpenStream()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to open stream to agent: %w", err)
+	}
+
+	err = WriteFrame(stream, StreamFrameType, StreamHeader{
+		TunnelId:    tunnel.Id,
+		RemoteAddr:  remoteAddr,
+		Traceparent: traceparent(ctx),
+	})
+	if err != nil {
+		stream.Close()
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to write stream header: %w", err)
+	}
+
+	h.activeStreams.Add(1)
+	h.metrics.streamsOpened.Inc(string(tunnel.Type))
+	return &meteredConn{Conn: stream, tunnel: tunnel, handler: h}, nil
+}
+
+func (h *TunnelHandler) serveTcpTunnel(tunnel *Tunnel) {
+	for {
+		client, err := tunnel.listener.Accept()
+		if err != nil {
+			// listener is closed when the tunnel or session goes away
+			return
+		}
+
+		go func() {
+			defer client.Close()
+
+			ctx, span := tracer.Start(context.Background(), "tcp connection",
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("tunnel.id", tunnel.Id),
+					attribute.String("client.address", client.RemoteAddr().String()),
+				),
+			)
+			defer span.End()
+
+			stream, err := h.openStream(ctx, tunnel, client.RemoteAddr().String())
+			if err != nil {
+				slog.WarnContext(ctx, "failed to open tcp tunnel stream", slog.String("tunnel_id", tunnel.Id), slog.Any("err", err))
+				return
+			}
+			defer stream.Close()
+
+			pipe(client, stream)
+		}()
+	}
+}
+
+// pipe copies in both directions and returns as soon as one side is done
+func pipe(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+
+	go func() {
+		io.Copy(a, b)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(b, a)
+		done <- struct{}{}
+	}()
+
+	<-done
+}
+
+func listenTcpTunnel(cfg *config.Config) (net.Listener, int, error) {
+	for port := cfg.NatTcpTunnel.PortStart; port <= cfg.NatTcpTunnel.PortEnd; port++ {
+		listener, err := net.Listen("tcp", net.JoinHostPort(cfg.NatTcpServer.Host, strconv.Itoa(port)))
+		if err == nil {
+			return listener, port, nil
+		}
+	}
+
+	return nil, 0, errors.New("no free tcp tunnel port available")
+}
+
+func publicHttpURL(cfg *config.Config, hostname string) string {
+	if cfg.NatHttpServer.Port == 80 {
+		return "http://" + hostname
+	}
+	return fmt.Sprintf("http://%s:%d", hostname, cfg.NatHttpServer.Port)
+}
+
+func hostWithoutPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// meteredConn counts the bytes of a single stream into the live tunnel totals
+// and adds them to the monthly usage of the owner once the stream is closed
+type meteredConn struct {
+	net.Conn
+	tunnel   *Tunnel
+	handler  *TunnelHandler
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+	once     sync.Once
+}
+
+func (m *meteredConn) Read(b []byte) (int, error) {
+	n, err := m.Conn.Read(b)
+	m.bytesOut.Add(int64(n))
+	m.tunnel.BytesOut.Add(int64(n))
+	m.handler.metrics.bytesOut.Add(int64(n))
+	return n, err
+}
+
+func (m *meteredConn) Write(b []byte) (int, error) {
+	n, err := m.Conn.Write(b)
+	m.bytesIn.Add(int64(n))
+	m.tunnel.BytesIn.Add(int64(n))
+	m.handler.metrics.bytesIn.Add(int64(n))
+	return n, err
+}
+
+func (m *meteredConn) Close() error {
+	err := m.Conn.Close()
+
+	m.once.Do(func() {
+		m.handler.activeStreams.Add(-1)
+
+		in, out := m.bytesIn.Load(), m.bytesOut.Load()
+		if usageErr := m.handler.usageRepo.AddUsage(m.tunnel.conn.UserId, in, out); usageErr != nil {
+			slog.Error("failed to record tunnel usage", slog.String("tunnel_id", m.tunnel.Id), slog.Any("err", usageErr))
+		}
+	})
+
+	return err
+}
@@ -0,0 +1,32 @@
+package natserver
+
+import (
+	"fmt"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+)
+
+// checkBandwidthQuota rejects new sessions and tunnels once the user has used
+// up the monthly bandwidth of the plan, streams that are already open are
+// left alone
+func checkBandwidthQuota(usageRepo repositories.UsageRepo, plan *models.Plan, userId int) error {
+	used, err := usageRepo.GetCurrentMonthUsage(userId)
+	if err != nil {
+		return err
+	}
+
+	if used >= plan.MonthlyBandwidth {
+		return fmt.Errorf("%w: %s plan monthly bandwidth of %d bytes is used up", ErrQuotaExceeded, plan.Name, plan.MonthlyBandwidth)
+	}
+
+	return nil
+}
+
+func tcpQuotaError(plan *models.Plan) error {
+	return fmt.Errorf("%w: %s plan allows %d tcp ports", ErrQuotaExceeded, plan.Name, plan.MaxTcpPorts)
+}
+
+func sessionQuotaError(plan *models.Plan) error {
+	return fmt.Errorf("%w: %s plan allows %d concurrent sessions", ErrQuotaExceeded, plan.Name, plan.MaxSessions)
+}
@@ -0,0 +1,123 @@
+package natserver
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+)
+
+const (
+	registryHeartbeat = 10 * time.Second
+	registryTTL       = 3 * registryHeartbeat
+)
+
+// RunRegistry republishes the node, its sessions, hostname claims and tunnels
+// on every heartbeat so other nodes can route to them and the api server sees
+// live byte counts, and closes sessions the api server asks to disconnect.
+// Records of a node that dies expire after registryTTL.
+func (h *TunnelHandler) RunRegistry(ctx context.Context) error {
+
+	disconnects, err := h.tunnelRepo.SubscribeDisconnects(ctx)
+	if err != nil {
+		return err
+	}
+
+	h.publishNode()
+
+	ticker := time.NewTicker(registryHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			h.publishNode()
+			for _, conn := range h.pool.Connections() {
+				h.publishSession(conn)
+			}
+			for _, tunnel := range h.pool.Tunnels() {
+				h.publishTunnel(tunnel)
+			}
+		case sessionId, ok := <-disconnects:
+			if !ok {
+				return errors.New("tunnel disconnect subscription closed")
+			}
+			h.disconnect(sessionId)
+		}
+	}
+}
+
+// disconnect closes the yamux session, HandleTcpStream then notices the
+// closed control stream and cleans the session up
+func (h *TunnelHandler) disconnect(sessionId string) {
+	conn, ok := h.pool.GetConnection(sessionId)
+	if !ok {
+		// owned by another node
+		return
+	}
+
+	slog.Info("disconnecting agent session", slog.String("session_id", sessionId), slog.Int("user_id", conn.UserId))
+	conn.session.Close()
+}
+
+func (h *TunnelHandler) endSession(conn *Connection) {
+	for _, tunnel := range h.pool.RemoveConnection(conn.Id) {
+		h.unpublishTunnel(tunnel)
+	}
+	if err := h.tunnelRepo.DeleteAgentSession(conn.Info()); err != nil {
+		slog.Error("failed to unpublish agent session", slog.String("session_id", conn.Id), slog.Any("err", err))
+	}
+}
+
+func (h *TunnelHandler) publishNode() {
+	node := &models.Node{
+		Id:        h.cfg.Cluster.NodeId,
+		Addr:      h.cfg.Cluster.AdvertiseAddr,
+		StartedAt: h.startedAt,
+	}
+	if err := h.tunnelRepo.SaveNode(node, registryTTL); err != nil {
+		slog.Error("failed to publish node", slog.String("node_id", node.Id), slog.Any("err", err))
+	}
+}
+
+func (h *TunnelHandler) publishSession(conn *Connection) {
+	if err := h.tunnelRepo.SaveAgentSession(conn.Info(), registryTTL); err != nil {
+		slog.Error("failed to publish agent session", slog.String("session_id", conn.Id), slog.Any("err", err))
+	}
+}
+
+func (h *TunnelHandler) publishTunnel(tunnel *Tunnel) {
+	if tunnel.Hostname != "" {
+		// refreshes the claim, it is only lost if another node took the
+		// hostname after this node missed several heartbeats
+		claimed, err := h.tunnelRepo.ClaimHostname(tunnel.Hostname, h.cfg.Cluster.NodeId, registryTTL)
+		if err != nil {
+			slog.Error("failed to refresh hostname claim", slog.String("hostname", tunnel.Hostname), slog.Any("err", err))
+		} else if !claimed {
+			slog.Warn("hostname claimed by another node", slog.String("hostname", tunnel.Hostname), slog.String("tunnel_id", tunnel.Id))
+		}
+	}
+
+	if err := h.tunnelRepo.SaveTunnel(tunnel.Info(), registryTTL); err != nil {
+		slog.Error("failed to publish tunnel", slog.String("tunnel_id", tunnel.Id), slog.Any("err", err))
+	}
+}
+
+func (h *TunnelHandler) unpublishTunnel(tunnel *Tunnel) {
+	if err := h.tunnelRepo.DeleteTunnel(tunnel.Info()); err != nil {
+		slog.Error("failed to unpublish tunnel", slog.String("tunnel_id", tunnel.Id), slog.Any("err", err))
+	}
+	if tunnel.Hostname != "" {
+		h.releaseHostname(tunnel.Hostname)
+	}
+}
+
+func (h *TunnelHandler) releaseHostname(hostname string) {
+	if err := h.tunnelRepo.ReleaseHostname(hostname, h.cfg.Cluster.NodeId); err != nil {
+		slog.Error("failed to release hostname", slog.String("hostname", hostname), slog.Any("err", err))
+	}
+}
@@ -2,17 +2,30 @@ package natserver
 
 import (
 	"context"
+	"errors"
 	"io"
 	"log/slog"
 	"net"
+	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
 
 	"github.com/hashicorp/yamux"
 )
 
-func ListenAndServer(ctx context.Context, w io.Writer, cfg *config.Config) error {
+// ShutdownTimeout is how long in-flight streams get to finish once the node
+// starts shutting down
+const ShutdownTimeout = 10 * time.Second
+
+// sessionEndTimeout is how long Shutdown waits for the closed sessions to be
+// ended by HandleTcpStream, it only has to cover their registry writes
+const sessionEndTimeout = 2 * time.Second
+
+// ListenAndServer accepts agent connections until ctx is cancelled, sessions
+// that are already connected are drained by TunnelHandler.Shutdown
+func ListenAndServer(ctx context.Context, w io.Writer, cfg *config.Config, h *TunnelHandler) error {
 
 	listner, err := net.Listen("tcp", cfg.NatTcpServer.Host+":"+strconv.Itoa(cfg.NatTcpServer.Port))
 	if err != nil {
@@ -20,22 +33,31 @@ func ListenAndServer(ctx context.Context, w io.Writer, cfg *config.Config) error
 	}
 	defer listner.Close()
 
+	go func() {
+		<-ctx.Done()
+		listner.Close()
+	}()
+
 	slog.Info("tcp server started", slog.String("addr", cfg.NatTcpServer.Host+":"+strconv.Itoa(cfg.NatTcpServer.Port)))
 	for {
 		conn, err := listner.Accept()
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				slog.Info("tcp server stop", slog.String("addr", listner.Addr().String()))
+				return nil
+			}
 			slog.Error("failed to accept connection", slog.String("error", err.Error()))
 			continue
 		}
 
 		go func() {
 			defer conn.Close()
-			ManageConnection(conn, w, cfg)
+			ManageConnection(conn, w, cfg, h)
 		}()
 	}
 }
 
-func ManageConnection(conn net.Conn, w io.Writer, cfg *config.Config) {
+func ManageConnection(conn net.Conn, w io.Writer, cfg *config.Config, h *TunnelHandler) {
 
 	yamuxConfig := yamux.DefaultConfig()
 	yamuxConfig.LogOutput = w
@@ -46,4 +68,100 @@ func ManageConnection(conn net.Conn, w io.Writer, cfg *config.Config) {
 		conn.Close()
 		return
 	}
+	defer session.Close()
+
+	clientIP, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		clientIP = conn.RemoteAddr().String()
+	}
+
+	h.HandleTcpStream(session, clientIP)
+}
+
+// Shutdown tells every agent that the node is going away, waits for open
+// streams to finish until ctx is done and then closes the sessions
+func (h *TunnelHandler) Shutdown(ctx context.Context) error {
+	h.shuttingDown.Store(true)
+
+	deadline, _ := ctx.Deadline()
+	for _, conn := range h.pool.Connections() {
+		err := WriteFrame(conn.control, GoingAwayFrameType, GoingAway{
+			Message:  "server is shutting down, reconnect to continue",
+			Deadline: deadline,
+		})
+		if err != nil {
+			slog.Warn("failed to send going away frame", slog.String("session_id", conn.Id), slog.Any("err", err))
+		}
+	}
+
+	// no new tcp clients, the ones already connected are drained below
+	for _, tunnel := range h.pool.Tunnels() {
+		if tunnel.listener != nil {
+			tunnel.listener.Close()
+		}
+	}
+
+	err := h.drainStreams(ctx)
+
+	// closing the session stops its control stream, HandleTcpStream then
+	// ends the session itself
+	for _, conn := range h.pool.Connections() {
+		conn.session.Close()
+	}
+	endCtx, cancel := context.WithTimeout(context.Background(), sessionEndTimeout)
+	defer cancel()
+	h.waitSessionsEnded(endCtx)
+	h.flushAccessLogs()
+
+	return err
+}
+
+func (h *TunnelHandler) drainStreams(ctx context.Context) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if h.activeStreams.Load() == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			slog.Warn("closing streams that did not finish in time", slog.Int64("streams", h.activeStreams.Load()))
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitSessionsEnded waits until every session left the pool or ctx is done
+func (h *TunnelHandler) waitSessionsEnded(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		conns := h.pool.Connections()
+		if len(conns) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			slog.Warn("sessions did not end in time", slog.Int("sessions", len(conns)))
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// shutdownOnDone stops the http server once ctx is cancelled, in-flight
+// requests get ShutdownTimeout to finish
+func shutdownOnDone(ctx context.Context, httpServer *http.Server) {
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("http server shutdown", slog.String("addr", httpServer.Addr), slog.Any("err", err))
+	}
 }
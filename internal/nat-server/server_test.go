@@ -0,0 +1,69 @@
+package natserver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+)
+
+func TestDrainStreams(t *testing.T) {
+	h := &TunnelHandler{}
+
+	if err := h.drainStreams(context.Background()); err != nil {
+		t.Fatalf("drainStreams() returned an unexpected error without open streams: %v", err)
+	}
+
+	h.activeStreams.Add(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := h.drainStreams(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded for a stream that never closes, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		h.activeStreams.Add(-1)
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := h.drainStreams(ctx); err != nil {
+		t.Fatalf("drainStreams() returned an unexpected error after the stream closed: %v", err)
+	}
+}
+
+func TestWaitSessionsEnded(t *testing.T) {
+	h := &TunnelHandler{pool: NewConnectionsPool()}
+
+	if err := h.waitSessionsEnded(context.Background()); err != nil {
+		t.Fatalf("waitSessionsEnded() returned an unexpected error without sessions: %v", err)
+	}
+
+	conn := &Connection{Id: "s1", UserId: 1, Plan: models.Plan{MaxSessions: 1}, tunnels: map[string]*Tunnel{}}
+	if err := h.pool.AddConnection(conn); err != nil {
+		t.Fatalf("AddConnection() returned an unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := h.waitSessionsEnded(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded for a session that never ends, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		h.pool.RemoveConnection(conn.Id)
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := h.waitSessionsEnded(ctx); err != nil {
+		t.Fatalf("waitSessionsEnded() returned an unexpected error after the session ended: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package natserver
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/Mohd-Sayeedul-Hoda/tunnel/internal/nat-server")
+
+// traceIngress wraps an ingress handler in a server span, a traceparent sent
+// by the client or by the forwarding node is continued
+func traceIngress(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("server.address", hostWithoutPort(r.Host)),
+				attribute.String("url.path", r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		sw := &statusWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", sw.statusCode))
+		if sw.statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sw.statusCode))
+		}
+	})
+}
+
+// injectTraceparent propagates the span of ctx to the next hop
+func injectTraceparent(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// traceparent returns the w3c traceparent of the span in ctx, it is empty
+// when there is no span
+func traceparent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	statusCode int
+	bytes      int64
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	sw.statusCode = code
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	n, err := sw.ResponseWriter.Write(b)
+	sw.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the Flusher of the connection,
+// the reverse proxy flushes streamed responses through it
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
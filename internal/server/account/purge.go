@@ -0,0 +1,71 @@
+// Package account purges the accounts whose deletion grace period ended.
+package account
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+)
+
+const purgeInterval = time.Hour
+
+// Purger deletes the users whose scheduled purge passed, their rows in the
+// other tables go with them through the foreign keys and their email is
+// scrubbed from the audit events and otps that are kept. Every api server
+// runs one, a user is only returned to the purger whose delete removed it
+type Purger struct {
+	userRepo  repositories.UserRepo
+	auditRepo repositories.AuditRepo
+}
+
+func NewPurger(userRepo repositories.UserRepo, auditRepo repositories.AuditRepo) *Purger {
+	return &Purger{
+		userRepo:  userRepo,
+		auditRepo: auditRepo,
+	}
+}
+
+// Run purges once at start and then every purgeInterval until ctx is
+// cancelled
+func (p *Purger) Run(ctx context.Context) error {
+
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	p.Purge()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			p.Purge()
+		}
+	}
+}
+
+func (p *Purger) Purge() {
+	ids, err := p.userRepo.PurgeDeletedUsers()
+	if err != nil {
+		slog.Error("failed to purge deleted users", slog.Any("err", err))
+		return
+	}
+
+	for _, id := range ids {
+		err := p.auditRepo.CreateEvent(&models.AuditEvent{
+			Action:     models.UserDeletedAuditAction,
+			TargetType: "user",
+			TargetId:   strconv.Itoa(id),
+			Metadata:   map[string]any{"reason": "deletion grace period ended"},
+		})
+		if err != nil {
+			slog.Error("failed to record audit event", slog.String("action", string(models.UserDeletedAuditAction)), slog.Any("err", err))
+		}
+	}
+	if len(ids) > 0 {
+		slog.Info("purged deleted users", slog.Int("count", len(ids)))
+	}
+}
@@ -0,0 +1,51 @@
+package account
+
+import (
+	"testing"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+)
+
+type purgingRepo struct {
+	repositories.UserRepo
+	ids []int
+}
+
+func (r *purgingRepo) PurgeDeletedUsers() ([]int, error) {
+	ids := r.ids
+	r.ids = nil
+	return ids, nil
+}
+
+type recordingAuditRepo struct {
+	repositories.AuditRepo
+	events []models.AuditEvent
+}
+
+func (r *recordingAuditRepo) CreateEvent(event *models.AuditEvent) error {
+	r.events = append(r.events, *event)
+	return nil
+}
+
+func TestPurge(t *testing.T) {
+	userRepo := &purgingRepo{ids: []int{3, 7}}
+	auditRepo := &recordingAuditRepo{}
+	purger := NewPurger(userRepo, auditRepo)
+
+	purger.Purge()
+	if len(auditRepo.events) != 2 {
+		t.Fatalf("Expected an audit event per purged user, got %d", len(auditRepo.events))
+	}
+	for i, want := range []string{"3", "7"} {
+		event := auditRepo.events[i]
+		if event.Action != models.UserDeletedAuditAction || event.TargetId != want {
+			t.Fatalf("Unexpected audit event %+v", event)
+		}
+	}
+
+	purger.Purge()
+	if len(auditRepo.events) != 2 {
+		t.Fatalf("Expected nothing to be recorded without purged users, got %d events", len(auditRepo.events))
+	}
+}
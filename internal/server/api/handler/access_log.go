@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/request"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/policy"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+)
+
+// access logs outlive their tunnel so they are looked up by tunnel id alone,
+// users only see logs of their own tunnels while admins see all of them
+func accessLogOwner(r *http.Request) int {
+	subject := tokenSubject(r)
+	if policy.Can(subject, policy.ManageAllTunnelsAction) {
+		return 0
+	}
+	return subject.UserId
+}
+
+func ListAccessLogs(accessLogRepo repositories.AccessLogRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		v := request.NewValidator()
+		page := request.CursorPage{}
+
+		page.Cursor = request.ReadString(r, "cursor", "")
+		page.Limit = request.ReadInt(r, v, "limit", 50)
+		v = page.Valid(r.Context(), v)
+		if !v.Valid() {
+			failedValidationResponse(w, r, v)
+			return
+		}
+
+		tunnelId := r.PathValue("id")
+		userId := accessLogOwner(r)
+
+		total, err := accessLogRepo.CountAccessLogs(tunnelId, userId)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		logs, err := accessLogRepo.ListAccessLogs(tunnelId, userId, page.After, page.Limit+1)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		logs, metadata := request.Paginate(logs, page.Limit, total, accessLogCursor)
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"access_logs": logs,
+			},
+			"metadata": metadata,
+		})
+	})
+}
+
+func accessLogCursor(log models.AccessLog) models.Cursor {
+	return models.Cursor{Id: log.Id, Time: log.CreatedAt}
+}
+
+// ExportAccessLogs streams every access log of a tunnel as csv, newest first
+func ExportAccessLogs(accessLogRepo repositories.AccessLogRepo) http.Handler {
+	const batchSize = 1000
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		tunnelId := r.PathValue("id")
+		userId := accessLogOwner(r)
+
+		logs, err := accessLogRepo.ListAccessLogs(tunnelId, userId, nil, batchSize)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "access-logs-"+tunnelId+".csv"))
+		w.WriteHeader(http.StatusOK)
+
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"created_at", "request_id", "tunnel_id", "session_id", "user_id", "hostname", "method", "path", "status", "remote_addr", "upstream_latency_ms", "bytes_in", "bytes_out"})
+
+		for len(logs) > 0 {
+			for _, log := range logs {
+				cw.Write(accessLogRecord(log))
+			}
+			cw.Flush()
+
+			if len(logs) < batchSize {
+				break
+			}
+			next := accessLogCursor(logs[len(logs)-1])
+			logs, err = accessLogRepo.ListAccessLogs(tunnelId, userId, &next, batchSize)
+			if err != nil {
+				// the status line is already out, all we can do is stop
+				slog.ErrorContext(r.Context(), "failed to export access logs", slog.String("tunnel_id", tunnelId), slog.Any("err", err))
+				return
+			}
+		}
+
+		cw.Flush()
+	})
+}
+
+func accessLogRecord(log models.AccessLog) []string {
+	return []string{
+		log.CreatedAt.UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+		log.RequestId,
+		log.TunnelId,
+		log.SessionId,
+		strconv.Itoa(log.UserId),
+		log.Hostname,
+		log.Method,
+		log.Path,
+		strconv.Itoa(log.Status),
+		log.RemoteAddr,
+		strconv.FormatInt(log.UpstreamLatencyMs, 10),
+		strconv.FormatInt(log.BytesIn, 10),
+		strconv.FormatInt(log.BytesOut, 10),
+	}
+}
@@ -0,0 +1,316 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/encoding"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/request"
+	tools "github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/utils"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/mailer"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories/postgres"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/utils"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/password"
+)
+
+// signing in again within the grace period cancels a deletion
+const accountDeletionGracePeriod = 30 * 24 * time.Hour
+
+// exportPageSize is the page size the export reads the lists with
+const exportPageSize = 100
+
+// SendAccountDeletionOtp mails the code that confirms a deletion, for users
+// that signed up through a provider and never set a password
+func SendAccountDeletionOtp(cfg *config.Config, userRepo repositories.UserRepo, emailRepo repositories.EmailOtpRepo, m mailer.Mailer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		token := tools.ContextGetToken(r)
+
+		user, err := userRepo.GetById(token.UserID)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		emailOtp := utils.GenerateToken(6)
+		err = sendOtp(r.Context(), cfg, emailRepo, m, models.AccountDeletionOtpType, user.Email, emailOtp, maxOtpEmailsPerDay, mailer.OtpData{Otp: emailOtp})
+		if err != nil {
+			switch {
+			case errors.Is(err, errMaxOtpEmails):
+				errorResponse(w, r, http.StatusTooManyRequests, "rate limit exceeded: maximum emails per day reached")
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		respondWithJSON(w, r, http.StatusCreated, envelope{
+			"status": "success",
+		})
+	})
+}
+
+// DeleteAccount schedules the purge of the signed in user after the grace
+// period, confirmed by the password or a code from SendAccountDeletionOtp.
+// The user is signed out everywhere and the tunnels are disconnected right
+// away. Owners have to hand over or delete their organizations first
+func DeleteAccount(cfg *config.Config, userRepo repositories.UserRepo, orgRepo repositories.OrgRepo, emailRepo repositories.EmailOtpRepo, sessionRepo repositories.SessionRepo, revocationRepo repositories.TokenRevocationRepo, tunnelRepo repositories.TunnelRepo, auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		v := request.NewValidator()
+
+		var req request.DeleteAccount
+		err := encoding.Validated(w, r, v, &req)
+		if err != nil {
+			switch {
+			case errors.Is(err, encoding.ErrInvalidData):
+				failedValidationResponse(w, r, v)
+			case errors.Is(err, encoding.ErrInvalidRequest):
+				badRequestResponse(w, r, err)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		token := tools.ContextGetToken(r)
+
+		user, err := userRepo.GetById(token.UserID)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if req.Password != "" {
+			matched, err := password.MatchPassword(user.PasswordHash, req.Password)
+			if err != nil {
+				ServerErrorResponse(w, r, err)
+				return
+			}
+			if !matched {
+				InvalidCredentialsResponse(w, r)
+				return
+			}
+		} else {
+			ok, err := useOtp(cfg, emailRepo, models.AccountDeletionOtpType, user.Email, req.Otp)
+			if err != nil {
+				switch {
+				case errors.Is(err, postgres.ErrNotFound):
+					errorResponse(w, r, http.StatusUnauthorized, "invalid otp")
+				default:
+					ServerErrorResponse(w, r, err)
+				}
+				return
+			}
+			if !ok {
+				errorResponse(w, r, http.StatusUnauthorized, "invalid otp")
+				return
+			}
+		}
+
+		orgs, err := orgRepo.ListUserOrgs(user.Id)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+		for _, org := range orgs {
+			if org.Role != models.OwnerOrgRole {
+				continue
+			}
+			owners, err := orgRepo.CountOwners(org.Id)
+			if err != nil {
+				ServerErrorResponse(w, r, err)
+				return
+			}
+			if owners <= 1 {
+				errorResponse(w, r, http.StatusConflict, fmt.Sprintf("you are the only owner of the organization %q, hand it over or delete it first", org.Name))
+				return
+			}
+		}
+
+		purgeAt := time.Now().Add(accountDeletionGracePeriod).UTC()
+		err = userRepo.ScheduleDeletion(user.Id, purgeAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				errorResponse(w, r, http.StatusConflict, "account is already scheduled for deletion")
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = revokeUserSessions(cfg, sessionRepo, revocationRepo, user.Id)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+		disconnectUserSessions(r, tunnelRepo, user.Id)
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:    user.Id,
+			Action:     models.DeletionScheduledAuditAction,
+			TargetType: "user",
+			TargetId:   strconv.Itoa(user.Id),
+			Metadata:   map[string]any{"purge_at": purgeAt},
+		})
+
+		respondWithJSON(w, r, http.StatusAccepted, envelope{
+			"status": "success",
+			"data": envelope{
+				"purge_at": purgeAt,
+			},
+		})
+	})
+}
+
+// disconnectUserSessions asks the nat-servers to close every agent session
+// of the user
+func disconnectUserSessions(r *http.Request, tunnelRepo repositories.TunnelRepo, userId int) {
+	tunnels, err := tunnelRepo.ListUserTunnels(userId)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list tunnels of user", slog.Int("user_id", userId), slog.Any("err", err))
+		return
+	}
+
+	disconnected := map[string]bool{}
+	for _, tunnel := range tunnels {
+		if disconnected[tunnel.SessionId] {
+			continue
+		}
+		disconnected[tunnel.SessionId] = true
+		if err := tunnelRepo.RequestDisconnect(tunnel.SessionId); err != nil {
+			slog.ErrorContext(r.Context(), "failed to disconnect session of user", slog.String("session_id", tunnel.SessionId), slog.Any("err", err))
+		}
+	}
+}
+
+// ExportAccount returns everything stored about the signed in user as one
+// json document, served as a download
+func ExportAccount(userRepo repositories.UserRepo, identityRepo repositories.IdentityRepo, orgRepo repositories.OrgRepo, apiKeyRepo repositories.APIRepo, domainRepo repositories.DomainRepo, usageRepo repositories.UsageRepo, sessionRepo repositories.SessionRepo, auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		token := tools.ContextGetToken(r)
+
+		user, err := userRepo.GetById(token.UserID)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		identities, err := identityRepo.ListIdentities(user.Id)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		orgs, err := orgRepo.ListUserOrgs(user.Id)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		apiKeys, err := listAll(func(after *models.Cursor, limit int) ([]models.APIKey, error) {
+			return apiKeyRepo.ListAPIKeys(user.Id, after, limit)
+		}, apiKeyCursor)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		domains, err := listAll(func(after *models.Cursor, limit int) ([]models.ReservedDomain, error) {
+			return domainRepo.ListDomains(user.Id, after, limit)
+		}, domainCursor)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		usage, err := listAll(func(after *models.Cursor, limit int) ([]models.TunnelUsage, error) {
+			return usageRepo.ListUsage(user.Id, after, limit)
+		}, usageCursor)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		sessions, err := sessionRepo.ListUserSessions(user.Id)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		events, err := listAll(func(after *models.Cursor, limit int) ([]models.AuditEvent, error) {
+			return auditRepo.ListEvents(user.Id, after, limit)
+		}, auditEventCursor)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:    user.Id,
+			Action:     models.DataExportedAuditAction,
+			TargetType: "user",
+			TargetId:   strconv.Itoa(user.Id),
+		})
+
+		filename := fmt.Sprintf("tunnel-export-%d-%s.json", user.Id, time.Now().UTC().Format("20060102"))
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"exported_at":   time.Now().UTC(),
+				"user":          user,
+				"identities":    identities,
+				"organizations": orgs,
+				"api_keys":      apiKeys,
+				"domains":       domains,
+				"usage":         usage,
+				"sessions":      sessions,
+				"audit_events":  events,
+			},
+		})
+	})
+}
+
+// listAll reads every page of a list, cursor returns the position of an item
+func listAll[T any](list func(after *models.Cursor, limit int) ([]T, error), cursor func(T) models.Cursor) ([]T, error) {
+	all := []T{}
+	var after *models.Cursor
+	for {
+		page, err := list(after, exportPageSize)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+		if len(page) < exportPageSize {
+			return all, nil
+		}
+		next := cursor(page[len(page)-1])
+		after = &next
+	}
+}
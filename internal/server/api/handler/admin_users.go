@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/encoding"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/request"
+	tools "github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/utils"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories/postgres"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+)
+
+// SuspendUser signs the user out everywhere and disconnects their tunnels,
+// the user can not sign in or use api keys until UnsuspendUser
+func SuspendUser(cfg *config.Config, userRepo repositories.UserRepo, sessionRepo repositories.SessionRepo, revocationRepo repositories.TokenRevocationRepo, tunnelRepo repositories.TunnelRepo, auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		id, err := request.ReadIDParam(r)
+		if err != nil {
+			notFoundResponse(w, r)
+			return
+		}
+
+		token := tools.ContextGetToken(r)
+		if id == token.UserID {
+			errorResponse(w, r, http.StatusConflict, "you can not suspend your own account")
+			return
+		}
+
+		user, err := userRepo.GetById(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = userRepo.Suspend(user.Id)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				errorResponse(w, r, http.StatusConflict, "user is already suspended")
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = revokeUserSessions(cfg, sessionRepo, revocationRepo, user.Id)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+		disconnectUserSessions(r, tunnelRepo, user.Id)
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:    token.UserID,
+			Action:     models.UserSuspendedAuditAction,
+			TargetType: "user",
+			TargetId:   strconv.Itoa(user.Id),
+		})
+
+		respondWithJSON(w, r, http.StatusOK, envelope{"status": "success"})
+	})
+}
+
+func UnsuspendUser(userRepo repositories.UserRepo, auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		id, err := request.ReadIDParam(r)
+		if err != nil {
+			notFoundResponse(w, r)
+			return
+		}
+
+		user, err := userRepo.GetById(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = userRepo.Unsuspend(user.Id)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				errorResponse(w, r, http.StatusConflict, "user is not suspended")
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:    tools.ContextGetToken(r).UserID,
+			Action:     models.UserUnsuspendedAuditAction,
+			TargetType: "user",
+			TargetId:   strconv.Itoa(user.Id),
+		})
+
+		respondWithJSON(w, r, http.StatusOK, envelope{"status": "success"})
+	})
+}
+
+// UpdateUserAdmin promotes or demotes a user. The admin claim lives in the
+// access token, so a demoted user is signed out to drop it right away while
+// a promoted user gets it with the next refresh
+func UpdateUserAdmin(cfg *config.Config, userRepo repositories.UserRepo, sessionRepo repositories.SessionRepo, revocationRepo repositories.TokenRevocationRepo, auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		id, err := request.ReadIDParam(r)
+		if err != nil {
+			notFoundResponse(w, r)
+			return
+		}
+
+		v := request.NewValidator()
+		var req request.UpdateUserAdmin
+		err = encoding.Validated(w, r, v, &req)
+		if err != nil {
+			switch {
+			case errors.Is(err, encoding.ErrInvalidData):
+				failedValidationResponse(w, r, v)
+			case errors.Is(err, encoding.ErrInvalidRequest):
+				badRequestResponse(w, r, err)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		token := tools.ContextGetToken(r)
+		if id == token.UserID && !*req.IsAdmin {
+			errorResponse(w, r, http.StatusConflict, "you can not remove your own admin role")
+			return
+		}
+
+		user, err := userRepo.GetById(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if user.IsAdmin != *req.IsAdmin {
+			err = userRepo.SetAdmin(user.Id, *req.IsAdmin)
+			if err != nil {
+				switch {
+				case errors.Is(err, postgres.ErrNotFound):
+					notFoundResponse(w, r)
+				default:
+					ServerErrorResponse(w, r, err)
+				}
+				return
+			}
+			user.IsAdmin = *req.IsAdmin
+
+			action := models.AdminGrantedAuditAction
+			if !user.IsAdmin {
+				action = models.AdminRevokedAuditAction
+
+				err = revokeUserSessions(cfg, sessionRepo, revocationRepo, user.Id)
+				if err != nil {
+					ServerErrorResponse(w, r, err)
+					return
+				}
+			}
+
+			recordAudit(r, auditRepo, models.AuditEvent{
+				ActorId:    token.UserID,
+				Action:     action,
+				TargetType: "user",
+				TargetId:   strconv.Itoa(user.Id),
+			})
+		}
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"users": user,
+			},
+		})
+	})
+}
+
+// ForceVerifyEmail marks the email of a user as verified without a code, for
+// users that can not receive the verification email
+func ForceVerifyEmail(userRepo repositories.UserRepo, auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		id, err := request.ReadIDParam(r)
+		if err != nil {
+			notFoundResponse(w, r)
+			return
+		}
+
+		user, err := userRepo.GetById(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if !user.EmailVerified {
+			err = userRepo.VerifyUserEmail(user.Id)
+			if err != nil {
+				ServerErrorResponse(w, r, err)
+				return
+			}
+			user.EmailVerified = true
+
+			recordAudit(r, auditRepo, models.AuditEvent{
+				ActorId:    tools.ContextGetToken(r).UserID,
+				Action:     models.EmailVerifiedAuditAction,
+				TargetType: "user",
+				TargetId:   strconv.Itoa(user.Id),
+				Metadata:   map[string]any{"forced": true},
+			})
+		}
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"users": user,
+			},
+		})
+	})
+}
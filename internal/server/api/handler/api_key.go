@@ -2,18 +2,23 @@ package handler
 
 import (
 	"errors"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/encoding"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/request"
 	tools "github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/utils"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/mailer"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/policy"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories/postgres"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/utils"
 )
 
-func CreateAPIKey(apiKeyRepo repositories.APIRepo) http.Handler {
+func CreateAPIKey(apiKeyRepo repositories.APIRepo, auditRepo repositories.AuditRepo) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		v := request.NewValidator()
@@ -37,6 +42,11 @@ func CreateAPIKey(apiKeyRepo repositories.APIRepo) http.Handler {
 			return
 		}
 
+		scopes := req.Scopes
+		if len(scopes) == 0 {
+			scopes = policy.DefaultScopes
+		}
+
 		userDetails := tools.ContextGetToken(r)
 		apikey := models.APIKey{
 			Name:        req.Name,
@@ -45,6 +55,11 @@ func CreateAPIKey(apiKeyRepo repositories.APIRepo) http.Handler {
 			APIKeyHash:  utils.HashAPIKey(generatedKeyDetails.FullKey),
 			ExpireAt:    req.ExpiresAt,
 			UserId:      userDetails.UserID,
+			Permissions: scopes,
+			Labels:      req.Labels,
+		}
+		if member := tools.ContextGetOrgMember(r); member != nil {
+			apikey.OrgId = member.OrgId
 		}
 
 		err = apiKeyRepo.CreateAPIKey(&apikey)
@@ -53,6 +68,14 @@ func CreateAPIKey(apiKeyRepo repositories.APIRepo) http.Handler {
 			return
 		}
 
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:    userDetails.UserID,
+			Action:     models.APIKeyCreatedAuditAction,
+			TargetType: "api_key",
+			TargetId:   strconv.Itoa(apikey.Id),
+			Metadata:   map[string]any{"name": apikey.Name, "prefix": apikey.Prefix, "org_id": apikey.OrgId, "scopes": scopes},
+		})
+
 		respondWithJSON(w, r, http.StatusCreated, envelope{
 			"status": "success",
 			"data": envelope{
@@ -67,9 +90,9 @@ func ListAPIKey(apiKeyRepo repositories.APIRepo) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		v := request.NewValidator()
-		page := request.Pagination{}
+		page := request.CursorPage{}
 
-		page.Page = request.ReadInt(r, v, "page", 1)
+		page.Cursor = request.ReadString(r, "cursor", "")
 		page.Limit = request.ReadInt(r, v, "limit", 20)
 		v = page.Valid(r.Context(), v)
 		if !v.Valid() {
@@ -77,23 +100,43 @@ func ListAPIKey(apiKeyRepo repositories.APIRepo) http.Handler {
 			return
 		}
 
-		userDetails := tools.ContextGetToken(r)
-		keys, err := apiKeyRepo.ListAPIKeys(userDetails.UserID, page.Page, (page.Page-1)*page.Limit)
+		var keys []models.APIKey
+		var total int
+		var err error
+		if member := tools.ContextGetOrgMember(r); member != nil {
+			total, err = apiKeyRepo.CountOrgAPIKeys(member.OrgId)
+			if err == nil {
+				keys, err = apiKeyRepo.ListOrgAPIKeys(member.OrgId, page.After, page.Limit+1)
+			}
+		} else {
+			userDetails := tools.ContextGetToken(r)
+			total, err = apiKeyRepo.CountAPIKeys(userDetails.UserID)
+			if err == nil {
+				keys, err = apiKeyRepo.ListAPIKeys(userDetails.UserID, page.After, page.Limit+1)
+			}
+		}
 		if err != nil {
 			ServerErrorResponse(w, r, err)
 			return
 		}
 
+		keys, metadata := request.Paginate(keys, page.Limit, total, apiKeyCursor)
+
 		respondWithJSON(w, r, http.StatusOK, envelope{
 			"status": "success",
 			"data": envelope{
 				"api_keys": keys,
 			},
+			"metadata": metadata,
 		})
 	})
 }
 
-func DeleteAPIKey(apiKeyRepo repositories.APIRepo) http.Handler {
+func apiKeyCursor(key models.APIKey) models.Cursor {
+	return models.Cursor{Id: int64(key.Id), Time: key.CreatedAt}
+}
+
+func DeleteAPIKey(apiKeyRepo repositories.APIRepo, auditRepo repositories.AuditRepo) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		id, err := request.ReadIDParam(r)
 		if err != nil {
@@ -103,7 +146,11 @@ func DeleteAPIKey(apiKeyRepo repositories.APIRepo) http.Handler {
 
 		token := tools.ContextGetToken(r)
 
-		err = apiKeyRepo.DeleteAPIKey(token.UserID, id)
+		if member := tools.ContextGetOrgMember(r); member != nil {
+			err = apiKeyRepo.DeleteOrgAPIKey(member.OrgId, id)
+		} else {
+			err = apiKeyRepo.DeleteAPIKey(token.UserID, id)
+		}
 		if err != nil {
 			switch {
 			case errors.Is(err, postgres.ErrNotFound):
@@ -114,12 +161,235 @@ func DeleteAPIKey(apiKeyRepo repositories.APIRepo) http.Handler {
 			return
 		}
 
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:    token.UserID,
+			Action:     models.APIKeyDeletedAuditAction,
+			TargetType: "api_key",
+			TargetId:   strconv.Itoa(id),
+		})
+
 		respondWithJSON(w, r, http.StatusOK, envelope{
 			"status": "success",
 		})
 	})
 }
 
+// RotateAPIKey gives a key a new secret, the old one keeps working for the
+// requested overlap so running agents can be moved over
+func RotateAPIKey(apiKeyRepo repositories.APIRepo, auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := request.ReadIDParam(r)
+		if err != nil {
+			notFoundResponse(w, r)
+			return
+		}
+
+		v := request.NewValidator()
+		var req request.RotateAPIKey
+		err = encoding.Validated(w, r, v, &req)
+		if err != nil {
+			switch {
+			case !v.Valid():
+				failedValidationResponse(w, r, v)
+			case errors.Is(err, encoding.ErrInvalidRequest):
+				badRequestResponse(w, r, err)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		generatedKeyDetails, err := utils.GenerateAPIKeyToken(32)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		apikey := models.APIKey{
+			Id:          id,
+			Prefix:      generatedKeyDetails.Prefix,
+			APIkeyToken: generatedKeyDetails.FullKey,
+			APIKeyHash:  utils.HashAPIKey(generatedKeyDetails.FullKey),
+		}
+
+		var previousExpiresAt time.Time
+		if req.OverlapMinutes > 0 {
+			previousExpiresAt = time.Now().Add(time.Duration(req.OverlapMinutes) * time.Minute)
+		}
+
+		token := tools.ContextGetToken(r)
+		if member := tools.ContextGetOrgMember(r); member != nil {
+			err = apiKeyRepo.RotateOrgAPIKey(member.OrgId, &apikey, previousExpiresAt)
+		} else {
+			err = apiKeyRepo.RotateAPIKey(token.UserID, &apikey, previousExpiresAt)
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:    token.UserID,
+			Action:     models.APIKeyRotatedAuditAction,
+			TargetType: "api_key",
+			TargetId:   strconv.Itoa(id),
+			Metadata:   map[string]any{"prefix": apikey.Prefix, "overlap_minutes": req.OverlapMinutes},
+		})
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"api_key": apikey,
+			},
+		})
+	})
+}
+
+// UpdateAPIKeyLabels replaces the labels of a key, an empty object removes
+// all of them
+func UpdateAPIKeyLabels(apiKeyRepo repositories.APIRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := request.ReadIDParam(r)
+		if err != nil {
+			notFoundResponse(w, r)
+			return
+		}
+
+		v := request.NewValidator()
+		var req request.APIKeyLabels
+		err = encoding.Validated(w, r, v, &req)
+		if err != nil {
+			switch {
+			case !v.Valid():
+				failedValidationResponse(w, r, v)
+			case errors.Is(err, encoding.ErrInvalidRequest):
+				badRequestResponse(w, r, err)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if member := tools.ContextGetOrgMember(r); member != nil {
+			err = apiKeyRepo.UpdateOrgAPIKeyLabels(member.OrgId, id, req.Labels)
+		} else {
+			err = apiKeyRepo.UpdateAPIKeyLabels(tools.ContextGetToken(r).UserID, id, req.Labels)
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"labels": req.Labels,
+			},
+		})
+	})
+}
+
+// RevokeLeakedAPIKey is public so secret scanners can report keys they find,
+// the leaked secret stops working at once, the agents that authenticated
+// with it are disconnected and the owner is told by email. A secret that no
+// longer works is left alone and the answer is the same whether the key
+// existed or not
+func RevokeLeakedAPIKey(userRepo repositories.UserRepo, apiKeyRepo repositories.APIRepo, tunnelRepo repositories.TunnelRepo, auditRepo repositories.AuditRepo, m mailer.Mailer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		v := request.NewValidator()
+		var req request.RevokeAPIKey
+		err := encoding.Validated(w, r, v, &req)
+		if err != nil {
+			switch {
+			case !v.Valid():
+				failedValidationResponse(w, r, v)
+			case errors.Is(err, encoding.ErrInvalidRequest):
+				badRequestResponse(w, r, err)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		apiKeyHash := utils.HashAPIKey(req.Key)
+		apikey, err := apiKeyRepo.RevokeAPIKey(apiKeyHash)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				respondWithJSON(w, r, http.StatusAccepted, envelope{
+					"status": "success",
+				})
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			Action:     models.APIKeyRevokedAuditAction,
+			TargetType: "api_key",
+			TargetId:   strconv.Itoa(apikey.Id),
+			Metadata:   map[string]any{"prefix": apikey.Prefix, "user_id": apikey.UserId, "org_id": apikey.OrgId},
+		})
+
+		disconnectAPIKeySessions(r, tunnelRepo, apikey, apiKeyHash)
+
+		user, err := userRepo.GetById(apikey.UserId)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		msg, err := mailer.NewAPIKeyRevokedMessage(user.Email, mailer.APIKeyRevokedData{
+			Name:   apikey.Name,
+			Prefix: apikey.Prefix,
+		})
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+		if err := m.Send(r.Context(), msg); err != nil {
+			slog.ErrorContext(r.Context(), "failed to notify owner of revoked api key", slog.Int("api_key_id", apikey.Id), slog.Any("err", err))
+		}
+
+		respondWithJSON(w, r, http.StatusAccepted, envelope{
+			"status": "success",
+		})
+	})
+}
+
+// disconnectAPIKeySessions asks the nat-server nodes to drop the agent
+// sessions of apikey, when revokedHash is a secret its rotation replaced only
+// the sessions that authenticated with that secret are dropped
+func disconnectAPIKeySessions(r *http.Request, tunnelRepo repositories.TunnelRepo, apikey *models.APIKey, revokedHash string) {
+	sessions, err := tunnelRepo.ListAPIKeyAgentSessions(apikey.Id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list sessions of revoked api key", slog.Int("api_key_id", apikey.Id), slog.Any("err", err))
+		return
+	}
+
+	previous := revokedHash != apikey.APIKeyHash
+	for _, session := range sessions {
+		if previous && session.APIKeyHash != revokedHash {
+			continue
+		}
+		if err := tunnelRepo.RequestDisconnect(session.Id); err != nil {
+			slog.ErrorContext(r.Context(), "failed to disconnect session of revoked api key", slog.String("session_id", session.Id), slog.Any("err", err))
+		}
+	}
+}
+
 func VerifyAPIKey(apiKeyRepo repositories.APIRepo) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
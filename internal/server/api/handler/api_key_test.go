@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/mailer"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories/postgres"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/utils"
+)
+
+// fakeAPIRepo revokes keys like the postgres repo, a current secret expires
+// its key and a replaced secret only loses its grace period, secrets that no
+// longer work are not found
+type fakeAPIRepo struct {
+	repositories.APIRepo
+	keys         []*models.APIKey
+	previousKeys map[int]string // key id to the secret hash its rotation replaced
+}
+
+func (f *fakeAPIRepo) RevokeAPIKey(apiKeyHash string) (*models.APIKey, error) {
+	now := time.Now()
+	for _, key := range f.keys {
+		if !key.ExpireAt.IsZero() && !key.ExpireAt.After(now) {
+			continue
+		}
+		switch {
+		case key.APIKeyHash == apiKeyHash:
+			key.ExpireAt = now
+			key.PreviousExpiresAt = time.Time{}
+			delete(f.previousKeys, key.Id)
+		case f.previousKeys[key.Id] == apiKeyHash && key.PreviousExpiresAt.After(now):
+			key.PreviousExpiresAt = time.Time{}
+			delete(f.previousKeys, key.Id)
+		default:
+			continue
+		}
+		revoked := *key
+		return &revoked, nil
+	}
+	return nil, postgres.ErrNotFound
+}
+
+type fakeTunnelRepo struct {
+	repositories.TunnelRepo
+	tunnels      []models.Tunnel
+	sessions     []models.AgentSession
+	disconnected []string
+}
+
+func (f *fakeTunnelRepo) ListUserTunnels(userId int) ([]models.Tunnel, error) {
+	return f.tunnels, nil
+}
+
+func (f *fakeTunnelRepo) ListAPIKeyAgentSessions(apiKeyId int) ([]models.AgentSession, error) {
+	sessions := []models.AgentSession{}
+	for _, session := range f.sessions {
+		if session.APIKeyId == apiKeyId {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (f *fakeTunnelRepo) RequestDisconnect(sessionId string) error {
+	f.disconnected = append(f.disconnected, sessionId)
+	return nil
+}
+
+type fakeMailer struct {
+	sent []*mailer.Message
+}
+
+func (f *fakeMailer) Send(ctx context.Context, msg *mailer.Message) error {
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+func TestRevokeLeakedAPIKey(t *testing.T) {
+	secrets := map[string]string{}
+	for _, name := range []string{"current", "previous", "expired", "other"} {
+		secret, err := utils.GenerateAPIKeyToken(32)
+		if err != nil {
+			t.Fatalf("GenerateAPIKeyToken() returned an unexpected error: %v", err)
+		}
+		secrets[name] = secret.FullKey
+	}
+
+	tests := []struct {
+		name         string
+		keys         []string
+		disconnected []string
+	}{
+		{"current secret", []string{"current"}, []string{"s-current", "s-previous"}},
+		{"previous secret in its grace period", []string{"previous"}, []string{"s-previous"}},
+		{"previous secret past its grace period", []string{"expired"}, nil},
+		{"expired key", []string{"other"}, nil},
+		{"revoked secret reported again", []string{"current", "current"}, []string{"s-current", "s-previous"}},
+	}
+	for _, tt := range tests {
+		apiKeyRepo := &fakeAPIRepo{
+			keys: []*models.APIKey{
+				{Id: 7, UserId: 1, Name: "ci", APIKeyHash: utils.HashAPIKey(secrets["current"]), PreviousExpiresAt: time.Now().Add(time.Hour)},
+				{Id: 8, UserId: 1, Name: "old", APIKeyHash: utils.HashAPIKey(secrets["other"]), ExpireAt: time.Now().Add(-time.Hour)},
+			},
+			previousKeys: map[int]string{7: utils.HashAPIKey(secrets["previous"])},
+		}
+		tunnelRepo := &fakeTunnelRepo{sessions: []models.AgentSession{
+			// the sessions have no tunnels open, they are found by their key
+			{Id: "s-current", UserId: 1, APIKeyId: 7, APIKeyHash: utils.HashAPIKey(secrets["current"])},
+			{Id: "s-previous", UserId: 1, APIKeyId: 7, APIKeyHash: utils.HashAPIKey(secrets["previous"])},
+			{Id: "s-other", UserId: 1, APIKeyId: 8, APIKeyHash: utils.HashAPIKey(secrets["other"])},
+		}}
+		userRepo := &fakeUserRepo{user: &models.User{Id: 1, Email: "owner@example.com"}}
+		m := &fakeMailer{}
+
+		for _, key := range tt.keys {
+			body := strings.NewReader(`{"api_key": "` + secrets[key] + `"}`)
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/api-keys/revoke", body)
+			w := httptest.NewRecorder()
+
+			RevokeLeakedAPIKey(userRepo, apiKeyRepo, tunnelRepo, &fakeAuditRepo{}, m).ServeHTTP(w, r)
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("%s: expected status %d, got %d: %s", tt.name, http.StatusAccepted, w.Code, w.Body.String())
+			}
+		}
+
+		if notified := len(m.sent) > 0; notified != (tt.disconnected != nil) {
+			t.Fatalf("%s: expected owner notified to be %v, got %v", tt.name, tt.disconnected != nil, notified)
+		}
+		if len(m.sent) > 1 {
+			t.Fatalf("%s: expected the owner to be notified once, got %d emails", tt.name, len(m.sent))
+		}
+		if !slices.Equal(tunnelRepo.disconnected, tt.disconnected) {
+			t.Fatalf("%s: expected sessions %v disconnected, got %v", tt.name, tt.disconnected, tunnelRepo.disconnected)
+		}
+	}
+}
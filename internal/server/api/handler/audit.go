@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/request"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/policy"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+)
+
+// recordAudit stores the event with the address and user agent of the request,
+// a failed write is logged but never fails the request it belongs to
+func recordAudit(r *http.Request, auditRepo repositories.AuditRepo, event models.AuditEvent) {
+
+	event.IP = ClientIP(r)
+	event.UserAgent = r.UserAgent()
+
+	if err := auditRepo.CreateEvent(&event); err != nil {
+		slog.ErrorContext(r.Context(), "failed to record audit event",
+			slog.String("action", string(event.Action)),
+			slog.Int("actor_id", event.ActorId),
+			slog.Any("err", err),
+		)
+	}
+}
+
+func ClientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// ListAuditEvents returns the events of the caller, admins see the events of
+// every user
+func ListAuditEvents(auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		v := request.NewValidator()
+		page := request.CursorPage{}
+
+		page.Cursor = request.ReadString(r, "cursor", "")
+		page.Limit = request.ReadInt(r, v, "limit", 20)
+		v = page.Valid(r.Context(), v)
+		if !v.Valid() {
+			failedValidationResponse(w, r, v)
+			return
+		}
+
+		subject := tokenSubject(r)
+		actorId := subject.UserId
+		if policy.Can(subject, policy.ViewAllAuditAction) {
+			actorId = 0
+		}
+
+		total, err := auditRepo.CountEvents(actorId)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		events, err := auditRepo.ListEvents(actorId, page.After, page.Limit+1)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		events, metadata := request.Paginate(events, page.Limit, total, auditEventCursor)
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"events": events,
+			},
+			"metadata": metadata,
+		})
+	})
+}
+
+func auditEventCursor(event models.AuditEvent) models.Cursor {
+	return models.Cursor{Id: event.Id, Time: event.CreatedAt}
+}
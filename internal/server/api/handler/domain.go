@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/encoding"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/request"
+	tools "github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/utils"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories/postgres"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+)
+
+func CreateDomain(cfg *config.Config, userRepo repositories.UserRepo, planRepo repositories.PlanRepo, domainRepo repositories.DomainRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		v := request.NewValidator()
+		var req request.ReservedDomain
+		err := encoding.Validated(w, r, v, &req)
+		if err != nil {
+			switch {
+			case !v.Valid():
+				failedValidationResponse(w, r, v)
+			case errors.Is(err, encoding.ErrInvalidRequest):
+				badRequestResponse(w, r, err)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		token := tools.ContextGetToken(r)
+		user, err := userRepo.GetById(token.UserID)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		plan, err := planRepo.GetPlan(user.Plan)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		reserved, err := domainRepo.CountDomains(user.Id)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		if reserved >= plan.MaxReservedDomains {
+			quotaExceededResponse(w, r, fmt.Sprintf("%s plan allows %d reserved domains", plan.Name, plan.MaxReservedDomains))
+			return
+		}
+
+		domain := models.ReservedDomain{
+			Hostname: req.Subdomain + "." + cfg.NatHttpServer.Domain,
+			UserId:   user.Id,
+		}
+		if member := tools.ContextGetOrgMember(r); member != nil {
+			domain.OrgId = member.OrgId
+		}
+
+		err = domainRepo.CreateDomain(&domain)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrUniqueViolation):
+				v.AddError("subdomain", "this subdomain is already reserved")
+				failedValidationResponse(w, r, v)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		respondWithJSON(w, r, http.StatusCreated, envelope{
+			"status": "success",
+			"data": envelope{
+				"domain": domain,
+			},
+		})
+	})
+}
+
+func ListDomains(domainRepo repositories.DomainRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		v := request.NewValidator()
+		page := request.CursorPage{}
+
+		page.Cursor = request.ReadString(r, "cursor", "")
+		page.Limit = request.ReadInt(r, v, "limit", 20)
+		v = page.Valid(r.Context(), v)
+		if !v.Valid() {
+			failedValidationResponse(w, r, v)
+			return
+		}
+
+		var domains []models.ReservedDomain
+		var total int
+		var err error
+		if member := tools.ContextGetOrgMember(r); member != nil {
+			total, err = domainRepo.CountOrgDomains(member.OrgId)
+			if err == nil {
+				domains, err = domainRepo.ListOrgDomains(member.OrgId, page.After, page.Limit+1)
+			}
+		} else {
+			token := tools.ContextGetToken(r)
+			total, err = domainRepo.CountUserDomains(token.UserID)
+			if err == nil {
+				domains, err = domainRepo.ListDomains(token.UserID, page.After, page.Limit+1)
+			}
+		}
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		domains, metadata := request.Paginate(domains, page.Limit, total, domainCursor)
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"domains": domains,
+			},
+			"metadata": metadata,
+		})
+	})
+}
+
+func domainCursor(domain models.ReservedDomain) models.Cursor {
+	return models.Cursor{Id: int64(domain.Id), Time: domain.CreatedAt}
+}
+
+func DeleteDomain(domainRepo repositories.DomainRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		id, err := request.ReadIDParam(r)
+		if err != nil {
+			notFoundResponse(w, r)
+			return
+		}
+
+		if member := tools.ContextGetOrgMember(r); member != nil {
+			err = domainRepo.DeleteOrgDomain(member.OrgId, id)
+		} else {
+			token := tools.ContextGetToken(r)
+			err = domainRepo.DeleteDomain(token.UserID, id)
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+		})
+	})
+}
@@ -1,16 +1,18 @@
 package handler
 
 import (
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"log/slog"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/encoding"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/request"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/mailer"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories/postgres"
@@ -19,7 +21,16 @@ import (
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/password"
 )
 
-func SendEmailVerficationOtp(cfg *config.Config, userRepo repositories.UserRepo, emailRepo repositories.EmailOtpRepo) http.Handler {
+// the codes an email gets a day of each type, sign in codes are asked for on
+// every sign in so they get more
+const (
+	maxOtpEmailsPerDay       = 3
+	maxSignInOtpEmailsPerDay = 10
+)
+
+var errMaxOtpEmails = errors.New("maximum emails per day reached")
+
+func SendEmailVerficationOtp(cfg *config.Config, userRepo repositories.UserRepo, emailRepo repositories.EmailOtpRepo, m mailer.Mailer) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		v := request.NewValidator()
@@ -54,39 +65,25 @@ func SendEmailVerficationOtp(cfg *config.Config, userRepo repositories.UserRepo,
 			return
 		}
 
-		todayMidnightUtc := time.Now().UTC().Truncate(24 * time.Hour)
-		totalSend, err := emailRepo.CountOtpsAfterUtcTime(req.Email, models.EmailVerificationOtpType, todayMidnightUtc)
-		if err != nil {
-			ServerErrorResponse(w, r, err)
-			return
-		}
-
-		if totalSend >= 3 {
-			errorResponse(w, r, http.StatusTooManyRequests, "rate limit exceeded: maximum emails per day reached")
-			return
-		}
-
 		emailOtp := utils.GenerateToken(6)
-		err = emailRepo.CreateOtp(req.Email,
-			utils.HashOtp(cfg.EmailOtpSalt, emailOtp),
-			models.EmailVerificationOtpType,
-			time.Now().Add(cfg.EmailOtpExpiredIn),
-		)
+		err = sendOtp(r.Context(), cfg, emailRepo, m, models.EmailVerificationOtpType, req.Email, emailOtp, maxOtpEmailsPerDay, mailer.OtpData{Otp: emailOtp})
 		if err != nil {
-			ServerErrorResponse(w, r, err)
+			switch {
+			case errors.Is(err, errMaxOtpEmails):
+				errorResponse(w, r, http.StatusTooManyRequests, "rate limit exceeded: maximum emails per day reached")
+			default:
+				ServerErrorResponse(w, r, err)
+			}
 			return
 		}
 
-		//WARN: remove and email smtp client to send email
-		slog.Info("Email Otp", slog.String("email", req.Email), slog.String("otp", emailOtp), slog.String("otp-type", string(models.EmailVerificationOtpType)))
-
 		respondWithJSON(w, r, http.StatusCreated, envelope{
 			"status": "success",
 		})
 	})
 }
 
-func VerifyEmailVerficationOtp(cfg *config.Config, userRepo repositories.UserRepo, emailRepo repositories.EmailOtpRepo) http.Handler {
+func VerifyEmailVerficationOtp(cfg *config.Config, userRepo repositories.UserRepo, emailRepo repositories.EmailOtpRepo, auditRepo repositories.AuditRepo) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		v := request.NewValidator()
@@ -121,7 +118,7 @@ func VerifyEmailVerficationOtp(cfg *config.Config, userRepo repositories.UserRep
 			return
 		}
 
-		emailOtp, err := emailRepo.GetOtp(req.Email, models.EmailVerificationOtpType)
+		ok, err := useOtp(cfg, emailRepo, models.EmailVerificationOtpType, req.Email, req.EmailOtp)
 		if err != nil {
 			switch {
 			case errors.Is(err, postgres.ErrNotFound):
@@ -131,36 +128,10 @@ func VerifyEmailVerficationOtp(cfg *config.Config, userRepo repositories.UserRep
 			}
 			return
 		}
-
-		if emailOtp.IsInvalidated || emailOtp.Used || emailOtp.Attempts > 3 || emailOtp.ExpiresAt.Before(time.Now()) {
-			errorResponse(w, r, http.StatusUnauthorized, "invalid otp")
-			return
-		}
-
-		hashOtp := utils.HashOtp(cfg.EmailOtpSalt, req.EmailOtp)
-		if !(hashOtp == emailOtp.EmailOtp) {
-			if emailOtp.Attempts < 3 {
-				err = emailRepo.IncreaseOtpAttempt(emailOtp.Id)
-				if err != nil {
-					ServerErrorResponse(w, r, err)
-					return
-				}
-			} else {
-				err = emailRepo.IncreaseAttemptAndInvalidateOtp(emailOtp.Id)
-				if err != nil {
-					ServerErrorResponse(w, r, err)
-					return
-				}
-			}
+		if !ok {
 			errorResponse(w, r, http.StatusUnauthorized, "invalid otp")
 			return
 		}
-
-		err = emailRepo.VerifyOtp(emailOtp.Id)
-		if err != nil {
-			ServerErrorResponse(w, r, err)
-			return
-		}
 		err = userRepo.VerifyUserEmail(user.Id)
 		if err != nil {
 			switch {
@@ -172,13 +143,19 @@ func VerifyEmailVerficationOtp(cfg *config.Config, userRepo repositories.UserRep
 			return
 		}
 
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:  user.Id,
+			Action:   models.EmailVerifiedAuditAction,
+			Metadata: map[string]any{"email": user.Email},
+		})
+
 		respondWithJSON(w, r, http.StatusOK, envelope{
 			"status": "success",
 		})
 	})
 }
 
-func SendForgotPasswordLink(cfg *config.Config, userRepo repositories.UserRepo, emailRepo repositories.EmailOtpRepo) http.Handler {
+func SendForgotPasswordLink(cfg *config.Config, userRepo repositories.UserRepo, emailRepo repositories.EmailOtpRepo, m mailer.Mailer) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		v := request.NewValidator()
@@ -207,45 +184,28 @@ func SendForgotPasswordLink(cfg *config.Config, userRepo repositories.UserRepo,
 			return
 		}
 
-		todayMidnightUtc := time.Now().UTC().Truncate(24 * time.Hour)
-		totalSend, err := emailRepo.CountOtpsAfterUtcTime(req.Email, models.ForgotPasswordOtpType, todayMidnightUtc)
-		if err != nil {
-			ServerErrorResponse(w, r, err)
-			return
-		}
-
-		if totalSend >= 3 {
-			errorResponse(w, r, http.StatusTooManyRequests, "rate limit exceeded: maximum emails per day reached")
-			return
-		}
-
 		otp := utils.GenerateToken(32)
-		hashOtp := utils.HashOtp(cfg.EmailOtpSalt, otp)
-		err = emailRepo.CreateOtp(
-			req.Email,
-			hashOtp,
-			models.ForgotPasswordOtpType,
-			time.Now().Add(cfg.EmailOtpExpiredIn),
-		)
+		encodedToken := base64.StdEncoding.EncodeToString(fmt.Appendf([]byte{}, "%s|%s", req.Email, otp))
+		err = sendOtp(r.Context(), cfg, emailRepo, m, models.ForgotPasswordOtpType, req.Email, otp, maxOtpEmailsPerDay, mailer.OtpData{
+			URL: cfg.FrontendURL + "/forgot-password?token=" + url.QueryEscape(encodedToken),
+		})
 		if err != nil {
-			ServerErrorResponse(w, r, err)
+			switch {
+			case errors.Is(err, errMaxOtpEmails):
+				errorResponse(w, r, http.StatusTooManyRequests, "rate limit exceeded: maximum emails per day reached")
+			default:
+				ServerErrorResponse(w, r, err)
+			}
 			return
 		}
 
-		encodedToken := base64.StdEncoding.EncodeToString(fmt.Appendf([]byte{}, "%s|%s", req.Email, otp))
-
-		//TODO: change route here
-		//WARN: remove and email smtp client to send email
-		url := fmt.Sprintf("http://localhost:5173/forgot-password?token=%s", encodedToken)
-		slog.Info("Email Otp", slog.String("email", req.Email), slog.String("url", url), slog.String("otp-type", string(models.ForgotPasswordOtpType)))
-
 		respondWithJSON(w, r, http.StatusCreated, envelope{
 			"status": "success",
 		})
 	})
 }
 
-func VerifyForgotPasswordLink(cfg *config.Config, userRepo repositories.UserRepo, emailRepo repositories.EmailOtpRepo) http.Handler {
+func VerifyForgotPasswordLink(cfg *config.Config, userRepo repositories.UserRepo, emailRepo repositories.EmailOtpRepo, sessionRepo repositories.SessionRepo, revocationRepo repositories.TokenRevocationRepo, auditRepo repositories.AuditRepo) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		v := request.NewValidator()
@@ -273,7 +233,7 @@ func VerifyForgotPasswordLink(cfg *config.Config, userRepo repositories.UserRepo
 		email := tokenData[0]
 		token := tokenData[1]
 
-		_, err = userRepo.GetByEmail(email)
+		user, err := userRepo.GetByEmail(email)
 		if err != nil {
 			switch {
 			case errors.Is(err, postgres.ErrNotFound):
@@ -284,7 +244,7 @@ func VerifyForgotPasswordLink(cfg *config.Config, userRepo repositories.UserRepo
 			return
 		}
 
-		emailOtp, err := emailRepo.GetOtp(email, models.ForgotPasswordOtpType)
+		ok, err := useOtp(cfg, emailRepo, models.ForgotPasswordOtpType, email, token)
 		if err != nil {
 			switch {
 			case errors.Is(err, postgres.ErrNotFound):
@@ -294,52 +254,270 @@ func VerifyForgotPasswordLink(cfg *config.Config, userRepo repositories.UserRepo
 			}
 			return
 		}
-
-		if emailOtp.IsInvalidated || emailOtp.Used || emailOtp.Attempts > 3 || emailOtp.ExpiresAt.Before(time.Now()) {
+		if !ok {
 			errorResponse(w, r, http.StatusUnauthorized, "invalid otp")
 			return
 		}
 
-		hashOtp := utils.HashOtp(cfg.EmailOtpSalt, token)
-		if !(hashOtp == emailOtp.EmailOtp) {
-			if emailOtp.Attempts < 3 {
-				err = emailRepo.IncreaseOtpAttempt(emailOtp.Id)
-				if err != nil {
-					ServerErrorResponse(w, r, err)
-					return
-				}
-			} else {
-				err = emailRepo.IncreaseAttemptAndInvalidateOtp(emailOtp.Id)
-				if err != nil {
-					ServerErrorResponse(w, r, err)
-					return
-				}
+		hash, err := password.SetPassword(req.Password)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		err = userRepo.UpdateUserPassword(email, hash)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		err = revokeUserSessions(cfg, sessionRepo, revocationRepo, user.Id)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:  user.Id,
+			Action:   models.PasswordResetAuditAction,
+			Metadata: map[string]any{"email": email},
+		})
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+		})
+
+	})
+}
+
+func SendLoginOtp(cfg *config.Config, userRepo repositories.UserRepo, emailRepo repositories.EmailOtpRepo, m mailer.Mailer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		v := request.NewValidator()
+		var req request.BaseEmail
+		err := encoding.Validated(w, r, v, &req)
+		if err != nil {
+			switch {
+			case errors.Is(err, encoding.ErrInvalidData):
+				failedValidationResponse(w, r, v)
+			case errors.Is(err, encoding.ErrInvalidRequest):
+				badRequestResponse(w, r, err)
+			default:
+				ServerErrorResponse(w, r, err)
 			}
-			errorResponse(w, r, http.StatusUnauthorized, "invalid otp")
 			return
 		}
 
-		err = emailRepo.VerifyOtp(emailOtp.Id)
+		// an unknown email gets the same answer so accounts can't be
+		// enumerated through this endpoint
+		_, err = userRepo.GetByEmail(req.Email)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				respondWithJSON(w, r, http.StatusCreated, envelope{
+					"status": "success",
+				})
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		emailOtp := utils.GenerateToken(6)
+		err = sendOtp(r.Context(), cfg, emailRepo, m, models.SignInOtpType, req.Email, emailOtp, maxSignInOtpEmailsPerDay, mailer.OtpData{Otp: emailOtp})
+		if err != nil {
+			switch {
+			case errors.Is(err, errMaxOtpEmails):
+				errorResponse(w, r, http.StatusTooManyRequests, "rate limit exceeded: maximum emails per day reached")
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		respondWithJSON(w, r, http.StatusCreated, envelope{
+			"status": "success",
+		})
+	})
+}
+
+// VerifyLoginOtp signs in with a code from SendLoginOtp instead of the
+// password, the second factor is still asked for when totp is enabled. A
+// wrong code counts towards the login lock like a wrong password. Receiving
+// the code proves the email so an unverified email is verified
+func VerifyLoginOtp(cfg *config.Config, sessionRepo repositories.SessionRepo, userRepo repositories.UserRepo, totpRepo repositories.TotpRepo, mfaRepo repositories.MfaRepo, lockRepo repositories.LoginLockRepo, emailRepo repositories.EmailOtpRepo, auditRepo repositories.AuditRepo, m mailer.Mailer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		v := request.NewValidator()
+
+		var req request.VerifyUserOTP
+		err := encoding.Validated(w, r, v, &req)
+		if err != nil {
+			switch {
+			case !v.Valid():
+				failedValidationResponse(w, r, v)
+			case errors.Is(err, encoding.ErrInvalidRequest):
+				badRequestResponse(w, r, err)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		lock, wait, err := checkLoginLock(lockRepo, loginLockSubject(req.Email), ClientIP(r))
 		if err != nil {
 			ServerErrorResponse(w, r, err)
 			return
 		}
+		if lock != nil {
+			loginLockedResponse(w, r, time.Until(lock.ExpiresAt))
+			return
+		}
+		if wait > 0 {
+			setRetryAfter(w, wait)
+			TooManyResponse(w, r)
+			return
+		}
 
-		hash, err := password.SetPassword(req.Password)
+		user, err := userRepo.GetByEmail(req.Email)
 		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				failLogin(w, r, cfg, lockRepo, emailRepo, auditRepo, m, nil, req.Email, "unknown email")
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		ok, err := useOtp(cfg, emailRepo, models.SignInOtpType, req.Email, req.EmailOtp)
+		if err != nil && !errors.Is(err, postgres.ErrNotFound) {
 			ServerErrorResponse(w, r, err)
 			return
 		}
+		if !ok {
+			failLogin(w, r, cfg, lockRepo, emailRepo, auditRepo, m, user, req.Email, "wrong otp")
+			return
+		}
 
-		err = userRepo.UpdateUserPassword(email, hash)
+		if !user.EmailVerified {
+			err = userRepo.VerifyUserEmail(user.Id)
+			if err != nil {
+				ServerErrorResponse(w, r, err)
+				return
+			}
+			user.EmailVerified = true
+
+			recordAudit(r, auditRepo, models.AuditEvent{
+				ActorId:  user.Id,
+				Action:   models.EmailVerifiedAuditAction,
+				Metadata: map[string]any{"email": user.Email},
+			})
+		}
+
+		totp, err := totpRepo.GetTotp(user.Id)
+		if err != nil && !errors.Is(err, postgres.ErrNotFound) {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+		if totp != nil && totp.Enabled {
+			challenge, err := mfaRepo.CreateChallenge(user.Id, mfaChallengeExpiry)
+			if err != nil {
+				ServerErrorResponse(w, r, err)
+				return
+			}
+
+			respondWithJSON(w, r, http.StatusOK, envelope{
+				"status": "mfa_required",
+				"data": envelope{
+					"mfa_token":  challenge.Token,
+					"expires_at": challenge.ExpiresAt,
+				},
+			})
+			return
+		}
+
+		// with totp the failures are only cleared once the second factor
+		// passes, like a password sign in
+		err = lockRepo.ClearFailures(models.AccountLoginLockKind, loginLockSubject(req.Email))
 		if err != nil {
 			ServerErrorResponse(w, r, err)
 			return
 		}
 
-		respondWithJSON(w, r, http.StatusOK, envelope{
-			"status": "success",
+		response, err := startSession(w, r, cfg, sessionRepo, userRepo, auditRepo, user)
+		if err != nil {
+			switch {
+			case errors.Is(err, errAccountSuspended):
+				AccountSuspendedResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:  user.Id,
+			Action:   models.LoginAuditAction,
+			Metadata: map[string]any{"method": "email_otp"},
 		})
 
+		respondWithJSON(w, r, http.StatusOK, response)
 	})
 }
+
+// sendOtp stores secret as the newest otpType code of email and mails data
+// to it, at most limit codes a day before it returns errMaxOtpEmails
+func sendOtp(ctx context.Context, cfg *config.Config, emailRepo repositories.EmailOtpRepo, m mailer.Mailer, otpType models.OtpType, email, secret string, limit int, data mailer.OtpData) error {
+	todayMidnightUtc := time.Now().UTC().Truncate(24 * time.Hour)
+	totalSend, err := emailRepo.CountOtpsAfterUtcTime(email, otpType, todayMidnightUtc)
+	if err != nil {
+		return err
+	}
+	if totalSend >= limit {
+		return errMaxOtpEmails
+	}
+
+	err = emailRepo.CreateOtp(
+		email,
+		utils.HashOtp(cfg.EmailOtpSalt, secret),
+		otpType,
+		time.Now().Add(cfg.EmailOtpExpiredIn),
+	)
+	if err != nil {
+		return err
+	}
+
+	data.Email = email
+	data.ExpiresIn = cfg.EmailOtpExpiredIn.String()
+	msg, err := mailer.NewOtpMessage(otpType, email, data)
+	if err != nil {
+		return err
+	}
+	return m.Send(ctx, msg)
+}
+
+// useOtp checks secret against the newest otpType code of email and marks it
+// used, it returns false when the code is not accepted. A wrong secret counts
+// an attempt and the fourth one invalidates the code
+func useOtp(cfg *config.Config, emailRepo repositories.EmailOtpRepo, otpType models.OtpType, email, secret string) (bool, error) {
+	emailOtp, err := emailRepo.GetOtp(email, otpType)
+	if err != nil {
+		return false, err
+	}
+
+	if emailOtp.IsInvalidated || emailOtp.Used || emailOtp.Attempts > 3 || emailOtp.ExpiresAt.Before(time.Now()) {
+		return false, nil
+	}
+
+	if utils.HashOtp(cfg.EmailOtpSalt, secret) != emailOtp.EmailOtp {
+		if emailOtp.Attempts < 3 {
+			err = emailRepo.IncreaseOtpAttempt(emailOtp.Id)
+		} else {
+			err = emailRepo.IncreaseAttemptAndInvalidateOtp(emailOtp.Id)
+		}
+		return false, err
+	}
+
+	return true, emailRepo.VerifyOtp(emailOtp.Id)
+}
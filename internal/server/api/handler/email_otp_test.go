@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/utils"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+)
+
+type fakeEmailOtpRepo struct {
+	repositories.EmailOtpRepo
+	otp *models.OtpVerification
+}
+
+func (f *fakeEmailOtpRepo) GetOtp(email string, otpType models.OtpType) (*models.OtpVerification, error) {
+	otp := *f.otp
+	return &otp, nil
+}
+
+func (f *fakeEmailOtpRepo) VerifyOtp(id int) error {
+	f.otp.Used = true
+	return nil
+}
+
+func (f *fakeEmailOtpRepo) IncreaseOtpAttempt(id int) error {
+	f.otp.Attempts++
+	return nil
+}
+
+func (f *fakeEmailOtpRepo) IncreaseAttemptAndInvalidateOtp(id int) error {
+	f.otp.Attempts++
+	f.otp.IsInvalidated = true
+	return nil
+}
+
+func TestUseOtpInvalidatesAfterWrongGuesses(t *testing.T) {
+	cfg := &config.Config{EmailOtpSalt: "salt"}
+	emailRepo := &fakeEmailOtpRepo{otp: &models.OtpVerification{
+		Id:        1,
+		EmailOtp:  utils.HashOtp(cfg.EmailOtpSalt, "123456"),
+		ExpiresAt: time.Now().Add(time.Minute),
+	}}
+
+	for i := 0; i < 4; i++ {
+		ok, err := useOtp(cfg, emailRepo, models.SignInOtpType, "user@example.com", "000000")
+		if err != nil || ok {
+			t.Fatalf("Expected wrong guess %d to be rejected, got %v, %v", i+1, ok, err)
+		}
+	}
+	if !emailRepo.otp.IsInvalidated {
+		t.Fatalf("Expected the code to be invalidated after 4 wrong guesses")
+	}
+
+	ok, err := useOtp(cfg, emailRepo, models.SignInOtpType, "user@example.com", "123456")
+	if err != nil || ok {
+		t.Fatalf("Expected the invalidated code to be rejected, got %v, %v", ok, err)
+	}
+	if emailRepo.otp.Used {
+		t.Fatalf("Expected the invalidated code not to be marked used")
+	}
+}
+
+func TestVerifyLoginOtpCountsTowardsLoginLock(t *testing.T) {
+	cfg := &config.Config{EmailOtpSalt: "salt"}
+	lockRepo := newFakeLockRepo()
+	userRepo := &fakeUserRepo{user: &models.User{Id: 1, Email: "user@example.com", EmailVerified: true}}
+	emailRepo := &fakeEmailOtpRepo{otp: &models.OtpVerification{
+		Id:        1,
+		EmailOtp:  utils.HashOtp(cfg.EmailOtpSalt, "123456"),
+		ExpiresAt: time.Now().Add(time.Minute),
+	}}
+	verify := VerifyLoginOtp(cfg, nil, userRepo, &fakeTotpRepo{}, &fakeMfaRepo{}, lockRepo, emailRepo, &fakeAuditRepo{}, &fakeMailer{})
+
+	for i := range loginDelayAfter + 1 {
+		body := strings.NewReader(`{"email": "user@example.com", "otp": "000000"}`)
+		w := httptest.NewRecorder()
+		verify.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/auth/email/verify-login-otp", body))
+
+		status := http.StatusUnauthorized
+		if i == loginDelayAfter {
+			status = http.StatusTooManyRequests
+		}
+		if w.Code != status {
+			t.Fatalf("attempt %d: expected status %d, got %d: %s", i+1, status, w.Code, w.Body.String())
+		}
+	}
+
+	lockRepo.failures = map[string]*models.LoginFailures{}
+	lockRepo.locks[string(models.AccountLoginLockKind)+"user@example.com"] = &models.LoginLock{ExpiresAt: time.Now().Add(time.Minute)}
+	body := strings.NewReader(`{"email": "user@example.com", "otp": "123456"}`)
+	w := httptest.NewRecorder()
+	verify.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/auth/email/verify-login-otp", body))
+	if w.Code != http.StatusLocked {
+		t.Fatalf("Expected a locked account to get status %d, got %d: %s", http.StatusLocked, w.Code, w.Body.String())
+	}
+}
+
+func TestSendLoginOtpUnknownEmail(t *testing.T) {
+	cfg := &config.Config{EmailOtpSalt: "salt"}
+	userRepo := &fakeUserRepo{user: &models.User{Id: 1, Email: "user@example.com"}}
+	m := &fakeMailer{}
+
+	body := strings.NewReader(`{"email": "nobody@example.com"}`)
+	w := httptest.NewRecorder()
+	SendLoginOtp(cfg, userRepo, &fakeEmailOtpRepo{}, m).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/auth/email/send-login-otp", body))
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d for an unknown email, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if len(m.sent) != 0 {
+		t.Fatalf("Expected no email for an unknown account, got %d", len(m.sent))
+	}
+}
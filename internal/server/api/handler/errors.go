@@ -2,7 +2,10 @@ package handler
 
 import (
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/encoding"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/request"
@@ -18,14 +21,14 @@ func errorResponse(w http.ResponseWriter, r *http.Request, status int, message a
 
 	err := encoding.EncodeJson(w, r, status, resp)
 	if err != nil {
-		slog.Error("server error", "err", err)
+		slog.ErrorContext(r.Context(), "server error", "err", err)
 		w.WriteHeader(500)
 	}
 }
 
 func ServerErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 
-	slog.Error("server error",
+	slog.ErrorContext(r.Context(), "server error",
 		slog.String("err", err.Error()),
 		slog.String("request", r.Method),
 		slog.String("url", r.URL.Path),
@@ -44,6 +47,11 @@ func notFoundResponse(w http.ResponseWriter, r *http.Request) {
 	errorResponse(w, r, http.StatusNotFound, message)
 }
 
+// NotFoundResponse is notFoundResponse for the middlewares
+func NotFoundResponse(w http.ResponseWriter, r *http.Request) {
+	notFoundResponse(w, r)
+}
+
 func failedValidationResponse(w http.ResponseWriter, r *http.Request, errors *request.Valid) {
 	errorResponse(w, r, http.StatusUnprocessableEntity, errors.Errors)
 }
@@ -58,11 +66,21 @@ func TokenExpireResponse(w http.ResponseWriter, r *http.Request) {
 	errorResponse(w, r, http.StatusUnauthorized, message)
 }
 
+func APIKeyExpiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "api key expired"
+	errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
 func InvalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
 	message := "invalid authentication credentials"
 	errorResponse(w, r, http.StatusUnauthorized, message)
 }
 
+func TokenRevokedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "token has been revoked"
+	errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
 func NotPermittedResponse(w http.ResponseWriter, r *http.Request) {
 	message := "your user account doesn't have the necessary permissions to access this resource"
 	errorResponse(w, r, http.StatusForbidden, message)
@@ -73,7 +91,26 @@ func InactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
 	errorResponse(w, r, http.StatusForbidden, message)
 }
 
-func tooManyResponse(w http.ResponseWriter, r *http.Request) {
+func AccountSuspendedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account has been suspended"
+	errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func TooManyResponse(w http.ResponseWriter, r *http.Request) {
 	message := "rate limit exceeded"
 	errorResponse(w, r, http.StatusTooManyRequests, message)
 }
+
+func loginLockedResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	setRetryAfter(w, retryAfter)
+	message := "too many failed sign in attempts, try again later or unlock the account with the link sent by email"
+	errorResponse(w, r, http.StatusLocked, message)
+}
+
+func setRetryAfter(w http.ResponseWriter, d time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+}
+
+func quotaExceededResponse(w http.ResponseWriter, r *http.Request, message string) {
+	errorResponse(w, r, http.StatusForbidden, "plan quota exceeded: "+message)
+}
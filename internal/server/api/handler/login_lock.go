@@ -0,0 +1,347 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/encoding"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/request"
+	tools "github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/utils"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/cache"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/mailer"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories/postgres"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/utils"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+)
+
+const (
+	// failures are forgotten once an account or ip went this long without one
+	loginFailureWindow = 15 * time.Minute
+	loginLockDuration  = 30 * time.Minute
+	// wrong passwords of an account before every further attempt has to
+	// wait, the wait doubles with each failure up to maxLoginDelay
+	loginDelayAfter  = 3
+	maxLoginDelay    = 30 * time.Second
+	accountLockAfter = 10
+	// an ip trying many accounts is locked without touching the accounts
+	ipLockAfter = 50
+)
+
+// loginDelay is how long the next attempt of an account has to wait after
+// failures wrong passwords
+func loginDelay(failures int) time.Duration {
+	if failures < loginDelayAfter {
+		return 0
+	}
+	delay := time.Second << min(failures-loginDelayAfter, 5)
+	return min(delay, maxLoginDelay)
+}
+
+// checkLoginLock returns the lock of the ip or the account when either is
+// locked, otherwise how long the account still has to wait before its next
+// password check
+func checkLoginLock(lockRepo repositories.LoginLockRepo, email, ip string) (*models.LoginLock, time.Duration, error) {
+	for _, subject := range []struct {
+		kind  models.LoginLockKind
+		value string
+	}{
+		{models.IPLoginLockKind, ip},
+		{models.AccountLoginLockKind, email},
+	} {
+		lock, err := lockRepo.GetLock(subject.kind, subject.value)
+		if err == nil {
+			return lock, 0, nil
+		}
+		if !errors.Is(err, cache.ErrNotFound) {
+			return nil, 0, err
+		}
+	}
+
+	failures, err := lockRepo.GetFailures(models.AccountLoginLockKind, email)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	wait := time.Until(failures.LastFailedAt.Add(loginDelay(failures.Count)))
+	return nil, max(wait, 0), nil
+}
+
+// recordLoginFailure counts a wrong password for the account and the ip and
+// locks the ones that ran out of attempts
+func recordLoginFailure(lockRepo repositories.LoginLockRepo, email, ip string) ([]models.LoginLock, error) {
+	var locks []models.LoginLock
+
+	for _, subject := range []struct {
+		kind  models.LoginLockKind
+		value string
+		after int
+	}{
+		{models.AccountLoginLockKind, email, accountLockAfter},
+		{models.IPLoginLockKind, ip, ipLockAfter},
+	} {
+		failures, err := lockRepo.RecordFailure(subject.kind, subject.value, loginFailureWindow)
+		if err != nil {
+			return nil, err
+		}
+		if failures.Count < subject.after {
+			continue
+		}
+
+		lock := models.LoginLock{
+			Kind:      subject.kind,
+			Subject:   subject.value,
+			Failures:  failures.Count,
+			LockedAt:  failures.LastFailedAt,
+			ExpiresAt: failures.LastFailedAt.Add(loginLockDuration),
+		}
+		if err := lockRepo.Lock(&lock); err != nil {
+			return nil, err
+		}
+		locks = append(locks, lock)
+	}
+
+	return locks, nil
+}
+
+// sendUnlockLink mails a link that lifts the lock of the account, at most
+// three a day like the other otp emails
+func sendUnlockLink(ctx context.Context, cfg *config.Config, emailRepo repositories.EmailOtpRepo, m mailer.Mailer, email string) error {
+	otp := utils.GenerateToken(32)
+	encodedToken := base64.StdEncoding.EncodeToString(fmt.Appendf([]byte{}, "%s|%s", email, otp))
+
+	return sendOtp(ctx, cfg, emailRepo, m, models.AccountUnlockOtpType, email, otp, maxOtpEmailsPerDay, mailer.OtpData{
+		URL: cfg.FrontendURL + "/unlock-account?token=" + url.QueryEscape(encodedToken),
+	})
+}
+
+func SendUnlockAccountLink(cfg *config.Config, userRepo repositories.UserRepo, lockRepo repositories.LoginLockRepo, emailRepo repositories.EmailOtpRepo, m mailer.Mailer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		v := request.NewValidator()
+		var req request.BaseEmail
+		err := encoding.Validated(w, r, v, &req)
+		if err != nil {
+			switch {
+			case errors.Is(err, encoding.ErrInvalidData):
+				failedValidationResponse(w, r, v)
+			case errors.Is(err, encoding.ErrInvalidRequest):
+				badRequestResponse(w, r, err)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		_, err = userRepo.GetByEmail(req.Email)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		email := loginLockSubject(req.Email)
+		_, err = lockRepo.GetLock(models.AccountLoginLockKind, email)
+		if err != nil {
+			switch {
+			case errors.Is(err, cache.ErrNotFound):
+				errorResponse(w, r, http.StatusBadRequest, "account is not locked")
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = sendUnlockLink(r.Context(), cfg, emailRepo, m, email)
+		if err != nil {
+			switch {
+			case errors.Is(err, errMaxOtpEmails):
+				errorResponse(w, r, http.StatusTooManyRequests, "rate limit exceeded: maximum emails per day reached")
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		respondWithJSON(w, r, http.StatusCreated, envelope{
+			"status": "success",
+		})
+	})
+}
+
+func VerifyUnlockAccountLink(cfg *config.Config, lockRepo repositories.LoginLockRepo, emailRepo repositories.EmailOtpRepo, auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		v := request.NewValidator()
+		var req request.UnlockAccount
+		err := encoding.Validated(w, r, v, &req)
+		if err != nil {
+			switch {
+			case errors.Is(err, encoding.ErrInvalidRequest):
+				badRequestResponse(w, r, err)
+			case errors.Is(err, encoding.ErrInvalidData):
+				failedValidationResponse(w, r, v)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		decodeByte, err := base64.StdEncoding.DecodeString(req.EmailOtp)
+		if err != nil {
+			badRequestResponse(w, r, errors.New("invalid base64 encoding in otp"))
+			return
+		}
+		email, token, _ := strings.Cut(string(decodeByte), "|")
+
+		ok, err := useOtp(cfg, emailRepo, models.AccountUnlockOtpType, email, token)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+		if !ok {
+			errorResponse(w, r, http.StatusUnauthorized, "invalid otp")
+			return
+		}
+
+		// the link still clears the failures when the lock already expired
+		err = lockRepo.Unlock(models.AccountLoginLockKind, email)
+		if err != nil && !errors.Is(err, cache.ErrNotFound) {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			Action:     models.LoginUnlockedAuditAction,
+			TargetType: string(models.AccountLoginLockKind),
+			TargetId:   email,
+			Metadata:   map[string]any{"via": "email"},
+		})
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+		})
+	})
+}
+
+func ListLoginLocks(lockRepo repositories.LoginLockRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		locks, err := lockRepo.ListLocks()
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data":   locks,
+		})
+	})
+}
+
+func ClearLoginLock(lockRepo repositories.LoginLockRepo, auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		kind := models.LoginLockKind(r.PathValue("kind"))
+		if kind != models.AccountLoginLockKind && kind != models.IPLoginLockKind {
+			notFoundResponse(w, r)
+			return
+		}
+		subject := r.PathValue("subject")
+
+		err := lockRepo.Unlock(kind, subject)
+		if err != nil {
+			switch {
+			case errors.Is(err, cache.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:    tools.ContextGetToken(r).UserID,
+			Action:     models.LoginUnlockedAuditAction,
+			TargetType: string(kind),
+			TargetId:   subject,
+			Metadata:   map[string]any{"via": "admin"},
+		})
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+		})
+	})
+}
+
+// failLogin answers a wrong email or password, user is nil for an unknown
+// email. The owner of an account that got locked is mailed an unlock link
+func failLogin(w http.ResponseWriter, r *http.Request, cfg *config.Config, lockRepo repositories.LoginLockRepo, emailRepo repositories.EmailOtpRepo, auditRepo repositories.AuditRepo, m mailer.Mailer, user *models.User, email, reason string) {
+	event := models.AuditEvent{
+		Action:   models.LoginFailedAuditAction,
+		Metadata: map[string]any{"email": email, "reason": reason},
+	}
+	if user != nil {
+		event.ActorId = user.Id
+	}
+	recordAudit(r, auditRepo, event)
+
+	failSignIn(w, r, cfg, lockRepo, emailRepo, auditRepo, m, user, email, InvalidCredentialsResponse)
+}
+
+// failSignIn counts a failed password or second factor against the account
+// and the ip, respond answers the attempt unless it locked either of them
+func failSignIn(w http.ResponseWriter, r *http.Request, cfg *config.Config, lockRepo repositories.LoginLockRepo, emailRepo repositories.EmailOtpRepo, auditRepo repositories.AuditRepo, m mailer.Mailer, user *models.User, email string, respond func(http.ResponseWriter, *http.Request)) {
+	locks, err := recordLoginFailure(lockRepo, loginLockSubject(email), ClientIP(r))
+	if err != nil {
+		ServerErrorResponse(w, r, err)
+		return
+	}
+	if len(locks) == 0 {
+		respond(w, r)
+		return
+	}
+
+	for _, lock := range locks {
+		event := models.AuditEvent{
+			Action:     models.LoginLockedAuditAction,
+			TargetType: string(lock.Kind),
+			TargetId:   lock.Subject,
+			Metadata:   map[string]any{"failures": lock.Failures, "expires_at": lock.ExpiresAt},
+		}
+		if lock.Kind == models.AccountLoginLockKind && user != nil {
+			event.ActorId = user.Id
+			err := sendUnlockLink(r.Context(), cfg, emailRepo, m, lock.Subject)
+			if err != nil && !errors.Is(err, errMaxOtpEmails) {
+				ServerErrorResponse(w, r, err)
+				return
+			}
+		}
+		recordAudit(r, auditRepo, event)
+	}
+
+	loginLockedResponse(w, r, loginLockDuration)
+}
+
+// loginLockSubject is the email a lock is kept under, so changing the case
+// of the email does not get around it
+func loginLockSubject(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
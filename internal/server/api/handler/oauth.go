@@ -0,0 +1,438 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/request"
+	tools "github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/utils"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/cache"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/oauth"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories/postgres"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/utils"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/password"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	oauthStateExpiry = 10 * time.Minute
+	oauthNonceCookie = "oauth_nonce"
+)
+
+// StartOAuthLogin sends the browser to the sign in page of the provider
+func StartOAuthLogin(providers oauth.Providers, oauthStateRepo repositories.OAuthStateRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		provider, err := providers.Get(r.PathValue("provider"))
+		if err != nil {
+			notFoundResponse(w, r)
+			return
+		}
+
+		authURL, err := newOAuthState(w, r, provider, oauthStateRepo, 0)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		http.Redirect(w, r, authURL, http.StatusFound)
+	})
+}
+
+// OAuthCallback finishes a sign in or a link started by StartOAuthLogin or
+// LinkIdentity in the same browser. Accounts are matched by the linked
+// identity first and by email only when the provider verified it, an
+// unverified email never takes over an existing account. An account matched
+// by email that was never verified loses its password and sessions before it
+// is linked
+func OAuthCallback(cfg *config.Config, providers oauth.Providers, oauthStateRepo repositories.OAuthStateRepo, sessionRepo repositories.SessionRepo, revocationRepo repositories.TokenRevocationRepo, userRepo repositories.UserRepo, identityRepo repositories.IdentityRepo, totpRepo repositories.TotpRepo, mfaRepo repositories.MfaRepo, auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		provider, err := providers.Get(r.PathValue("provider"))
+		if err != nil {
+			notFoundResponse(w, r)
+			return
+		}
+
+		query := r.URL.Query()
+		if query.Get("error") != "" {
+			errorResponse(w, r, http.StatusBadRequest, "sign in was cancelled at the provider")
+			return
+		}
+
+		stateParam := query.Get("state")
+		code := query.Get("code")
+		if stateParam == "" || code == "" || len(stateParam) > 100 {
+			badRequestResponse(w, r, errors.New("missing state or code"))
+			return
+		}
+
+		state, err := oauthStateRepo.TakeState(stateParam)
+		if err != nil {
+			switch {
+			case errors.Is(err, cache.ErrNotFound):
+				badRequestResponse(w, r, errors.New("invalid or expired state"))
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+		if state.Provider != provider.Name() || !validOAuthNonce(r, state) {
+			badRequestResponse(w, r, errors.New("invalid or expired state"))
+			return
+		}
+		clearOAuthNonce(w, r)
+
+		identity, err := provider.Exchange(r.Context(), code, state.Verifier)
+		if err != nil {
+			errorResponse(w, r, http.StatusBadGateway, "could not sign in with "+provider.Name())
+			return
+		}
+
+		if state.LinkUserId != 0 {
+			linkIdentity(w, r, cfg, identityRepo, auditRepo, state.LinkUserId, identity)
+			return
+		}
+
+		user, created, err := findOrCreateOAuthUser(cfg, userRepo, identityRepo, sessionRepo, revocationRepo, identity)
+		if err != nil {
+			switch {
+			case errors.Is(err, errEmailNotVerified):
+				errorResponse(w, r, http.StatusConflict, "an account with this email already exists, sign in and link "+provider.Name()+" from your profile")
+			case errors.Is(err, errNoEmail):
+				errorResponse(w, r, http.StatusBadRequest, provider.Name()+" did not share an email address")
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if created {
+			recordAudit(r, auditRepo, models.AuditEvent{
+				ActorId:    user.Id,
+				Action:     models.IdentityLinkedAuditAction,
+				TargetType: "user",
+				TargetId:   strconv.Itoa(user.Id),
+				Metadata:   map[string]any{"provider": identity.Provider},
+			})
+		}
+
+		totp, err := totpRepo.GetTotp(user.Id)
+		if err != nil && !errors.Is(err, postgres.ErrNotFound) {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+		if totp != nil && totp.Enabled {
+			challenge, err := mfaRepo.CreateChallenge(user.Id, mfaChallengeExpiry)
+			if err != nil {
+				ServerErrorResponse(w, r, err)
+				return
+			}
+
+			http.Redirect(w, r, cfg.FrontendURL+"/mfa?mfa_token="+url.QueryEscape(challenge.Token), http.StatusFound)
+			return
+		}
+
+		_, err = startSession(w, r, cfg, sessionRepo, userRepo, auditRepo, user)
+		if err != nil {
+			switch {
+			case errors.Is(err, errAccountSuspended):
+				AccountSuspendedResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:  user.Id,
+			Action:   models.LoginAuditAction,
+			Metadata: map[string]any{"provider": identity.Provider},
+		})
+
+		http.Redirect(w, r, cfg.FrontendURL, http.StatusFound)
+	})
+}
+
+// LinkIdentity returns the provider url that links the account of the
+// signed in user once the callback is reached
+func LinkIdentity(providers oauth.Providers, oauthStateRepo repositories.OAuthStateRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		provider, err := providers.Get(r.PathValue("provider"))
+		if err != nil {
+			notFoundResponse(w, r)
+			return
+		}
+
+		token := tools.ContextGetToken(r)
+
+		authURL, err := newOAuthState(w, r, provider, oauthStateRepo, token.UserID)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"url": authURL,
+			},
+		})
+	})
+}
+
+func ListIdentities(providers oauth.Providers, identityRepo repositories.IdentityRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		token := tools.ContextGetToken(r)
+
+		identities, err := identityRepo.ListIdentities(token.UserID)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		available := []string{}
+		for name := range providers {
+			available = append(available, name)
+		}
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"identities": identities,
+				"providers":  available,
+			},
+		})
+	})
+}
+
+func UnlinkIdentity(identityRepo repositories.IdentityRepo, auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		id, err := request.ReadIDParam(r)
+		if err != nil {
+			notFoundResponse(w, r)
+			return
+		}
+
+		token := tools.ContextGetToken(r)
+
+		err = identityRepo.DeleteIdentity(token.UserID, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:    token.UserID,
+			Action:     models.IdentityUnlinkedAuditAction,
+			TargetType: "identity",
+			TargetId:   strconv.Itoa(id),
+		})
+
+		respondWithJSON(w, r, http.StatusOK, envelope{"status": "success"})
+	})
+}
+
+var (
+	errEmailNotVerified = errors.New("email not verified by provider")
+	errNoEmail          = errors.New("provider did not share an email")
+)
+
+// findOrCreateOAuthUser returns the user of identity, created reports
+// whether the identity was linked by this call
+func findOrCreateOAuthUser(cfg *config.Config, userRepo repositories.UserRepo, identityRepo repositories.IdentityRepo, sessionRepo repositories.SessionRepo, revocationRepo repositories.TokenRevocationRepo, identity *oauth.Identity) (*models.User, bool, error) {
+	linked, err := identityRepo.GetIdentity(identity.Provider, identity.Subject)
+	if err == nil {
+		user, err := userRepo.GetById(linked.UserId)
+		return user, false, err
+	}
+	if !errors.Is(err, postgres.ErrNotFound) {
+		return nil, false, err
+	}
+
+	if identity.Email == "" {
+		return nil, false, errNoEmail
+	}
+
+	user, err := userRepo.GetByEmail(identity.Email)
+	switch {
+	case err == nil:
+		if !identity.EmailVerified {
+			return nil, false, errEmailNotVerified
+		}
+		if !user.EmailVerified {
+			err = resetUnverifiedUser(cfg, userRepo, sessionRepo, revocationRepo, user)
+			if err != nil {
+				return nil, false, err
+			}
+		}
+	case errors.Is(err, postgres.ErrNotFound):
+		user, err = createOAuthUser(userRepo, identity)
+		if err != nil {
+			return nil, false, err
+		}
+	default:
+		return nil, false, err
+	}
+
+	err = identityRepo.CreateIdentity(&models.UserIdentity{
+		UserId:   user.Id,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if identity.EmailVerified && !user.EmailVerified {
+		err = userRepo.VerifyUserEmail(user.Id)
+		if err != nil {
+			return nil, false, err
+		}
+		user.EmailVerified = true
+	}
+
+	return user, true, nil
+}
+
+// createOAuthUser signs up a user with a random password, it can be set
+// later through the forgot password flow
+func createOAuthUser(userRepo repositories.UserRepo, identity *oauth.Identity) (*models.User, error) {
+	name := strings.TrimSpace(identity.Name)
+	if name == "" {
+		name, _, _ = strings.Cut(identity.Email, "@")
+	}
+
+	hash, err := password.SetPassword(utils.GenerateToken(32))
+	if err != nil {
+		return nil, err
+	}
+
+	user := &models.User{
+		Email:        identity.Email,
+		Name:         name,
+		PasswordHash: hash,
+	}
+
+	err = userRepo.Create(user)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// resetUnverifiedUser drops the password and sessions of an account nobody
+// proved the email of before it is handed to the owner the provider vouches
+// for, whoever signed it up first may have been squatting on the address
+func resetUnverifiedUser(cfg *config.Config, userRepo repositories.UserRepo, sessionRepo repositories.SessionRepo, revocationRepo repositories.TokenRevocationRepo, user *models.User) error {
+	hash, err := password.SetPassword(utils.GenerateToken(32))
+	if err != nil {
+		return err
+	}
+
+	err = userRepo.UpdateUserPassword(user.Email, hash)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = hash
+
+	return revokeEachSession(cfg, sessionRepo, revocationRepo, user.Id)
+}
+
+func linkIdentity(w http.ResponseWriter, r *http.Request, cfg *config.Config, identityRepo repositories.IdentityRepo, auditRepo repositories.AuditRepo, userId int, identity *oauth.Identity) {
+	err := identityRepo.CreateIdentity(&models.UserIdentity{
+		UserId:   userId,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, postgres.ErrUniqueViolation):
+			errorResponse(w, r, http.StatusConflict, "this "+identity.Provider+" account is already linked")
+		default:
+			ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	recordAudit(r, auditRepo, models.AuditEvent{
+		ActorId:    userId,
+		Action:     models.IdentityLinkedAuditAction,
+		TargetType: "user",
+		TargetId:   strconv.Itoa(userId),
+		Metadata:   map[string]any{"provider": identity.Provider},
+	})
+
+	http.Redirect(w, r, cfg.FrontendURL, http.StatusFound)
+}
+
+// newOAuthState stores a fresh state and pkce verifier and returns the
+// authorization url carrying them. The nonce of the state goes to the
+// browser as a cookie so the callback only finishes the flow in the browser
+// that started it
+func newOAuthState(w http.ResponseWriter, r *http.Request, provider oauth.Provider, oauthStateRepo repositories.OAuthStateRepo, linkUserId int) (string, error) {
+	state := utils.GenerateToken(32)
+	nonce := utils.GenerateToken(32)
+	verifier := oauth2.GenerateVerifier()
+
+	err := oauthStateRepo.SaveState(state, &models.OAuthState{
+		Provider:   provider.Name(),
+		Verifier:   verifier,
+		Nonce:      nonce,
+		LinkUserId: linkUserId,
+	}, oauthStateExpiry)
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthNonceCookie,
+		Value:    nonce,
+		Path:     "/api/v1/auth/oauth",
+		MaxAge:   int(oauthStateExpiry.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return provider.AuthCodeURL(state, verifier), nil
+}
+
+func validOAuthNonce(r *http.Request, state *models.OAuthState) bool {
+	cookie, err := r.Cookie(oauthNonceCookie)
+	if err != nil || state.Nonce == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state.Nonce)) == 1
+}
+
+func clearOAuthNonce(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthNonceCookie,
+		Path:     "/api/v1/auth/oauth",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/cache"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/oauth"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories/postgres"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/password"
+)
+
+type fakeIdentityRepo struct {
+	repositories.IdentityRepo
+	identities []models.UserIdentity
+}
+
+func (f *fakeIdentityRepo) GetIdentity(provider, subject string) (*models.UserIdentity, error) {
+	for _, identity := range f.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, postgres.ErrNotFound
+}
+
+func (f *fakeIdentityRepo) CreateIdentity(identity *models.UserIdentity) error {
+	f.identities = append(f.identities, *identity)
+	return nil
+}
+
+type fakeOAuthStateRepo struct {
+	states map[string]models.OAuthState
+}
+
+func (f *fakeOAuthStateRepo) SaveState(state string, data *models.OAuthState, ttl time.Duration) error {
+	f.states[state] = *data
+	return nil
+}
+
+func (f *fakeOAuthStateRepo) TakeState(state string) (*models.OAuthState, error) {
+	data, ok := f.states[state]
+	if !ok {
+		return nil, cache.ErrNotFound
+	}
+	delete(f.states, state)
+	return &data, nil
+}
+
+// fakeProvider fails every exchange, reaching it means the state was accepted
+type fakeProvider struct {
+	exchanged bool
+}
+
+func (f *fakeProvider) Name() string { return "github" }
+
+func (f *fakeProvider) AuthCodeURL(state, verifier string) string {
+	return "https://github.example/authorize?state=" + url.QueryEscape(state)
+}
+
+func (f *fakeProvider) Exchange(ctx context.Context, code, verifier string) (*oauth.Identity, error) {
+	f.exchanged = true
+	return nil, errors.New("exchange failed")
+}
+
+func TestOAuthCallbackRequiresNonceCookie(t *testing.T) {
+	cfg := &config.Config{}
+
+	tests := []struct {
+		name      string
+		useCookie bool
+		status    int
+	}{
+		{"browser that started the flow", true, http.StatusBadGateway},
+		{"another browser", false, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		provider := &fakeProvider{}
+		providers := oauth.Providers{"github": provider}
+		stateRepo := &fakeOAuthStateRepo{states: map[string]models.OAuthState{}}
+
+		mux := http.NewServeMux()
+		mux.Handle("GET /api/v1/auth/oauth/{provider}", StartOAuthLogin(providers, stateRepo))
+		mux.Handle("GET /api/v1/auth/oauth/{provider}/callback", OAuthCallback(cfg, providers, stateRepo, nil, nil, nil, nil, nil, nil, nil))
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oauth/github", nil))
+		if w.Code != http.StatusFound {
+			t.Fatalf("%s: expected status %d, got %d", tt.name, http.StatusFound, w.Code)
+		}
+		location, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("%s: failed to parse redirect: %v", tt.name, err)
+		}
+
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oauth/github/callback?code=code&state="+url.QueryEscape(location.Query().Get("state")), nil)
+		if tt.useCookie {
+			for _, cookie := range w.Result().Cookies() {
+				r.AddCookie(cookie)
+			}
+		}
+		w = httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Fatalf("%s: expected status %d, got %d: %s", tt.name, tt.status, w.Code, w.Body.String())
+		}
+		if provider.exchanged != tt.useCookie {
+			t.Fatalf("%s: expected the code exchanged to be %v, got %v", tt.name, tt.useCookie, provider.exchanged)
+		}
+	}
+}
+
+func TestOAuthLinkResetsUnverifiedUser(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Token.AccessTokenExpiredIn = 15 * time.Minute
+
+	hash, err := password.SetPassword("squatter-password")
+	if err != nil {
+		t.Fatalf("SetPassword() returned an unexpected error: %v", err)
+	}
+	userRepo := &fakeUserRepo{user: &models.User{Id: 1, Email: "victim@example.com", PasswordHash: hash}}
+	sessionRepo := &fakeSessionRepo{sessions: map[string]models.Session{
+		"squatter-session": {Id: "squatter-session", UserId: 1},
+	}}
+	revocationRepo := newFakeRevocationRepo()
+	identityRepo := &fakeIdentityRepo{}
+
+	user, created, err := findOrCreateOAuthUser(cfg, userRepo, identityRepo, sessionRepo, revocationRepo, &oauth.Identity{
+		Provider:      "github",
+		Subject:       "42",
+		Email:         "victim@example.com",
+		EmailVerified: true,
+	})
+	if err != nil {
+		t.Fatalf("findOrCreateOAuthUser() returned an unexpected error: %v", err)
+	}
+	if !created || user.Id != 1 || !user.EmailVerified {
+		t.Fatalf("Expected the identity to be linked to the verified user, got %+v, %v", user, created)
+	}
+
+	if bytes.Equal(userRepo.user.PasswordHash, hash) {
+		t.Fatalf("Expected the password set before the email was verified to be replaced")
+	}
+	matched, err := password.MatchPassword(userRepo.user.PasswordHash, "squatter-password")
+	if err != nil || matched {
+		t.Fatalf("Expected the old password to stop working, got %v, %v", matched, err)
+	}
+
+	revoked, err := revocationRepo.IsTokenRevoked(1, "squatter-session", "squatter-token", time.Now())
+	if err != nil || !revoked {
+		t.Fatalf("Expected the sessions started before the link to be revoked, got %v, %v", revoked, err)
+	}
+}
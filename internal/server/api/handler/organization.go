@@ -0,0 +1,575 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/encoding"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/request"
+	tools "github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/utils"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/mailer"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/policy"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories/postgres"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/utils"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+)
+
+const orgInvitationExpiry = 7 * 24 * time.Hour
+
+// tokenSubject is the policy subject of the signed in user, the org role of
+// the request is added when the route is scoped to an organization
+func tokenSubject(r *http.Request) policy.Subject {
+	token := tools.ContextGetToken(r)
+	subject := policy.Subject{UserId: token.UserID, IsAdmin: token.IsAdmin}
+	if member := tools.ContextGetOrgMember(r); member != nil {
+		subject.Role = member.Role
+	}
+	return subject
+}
+
+func CreateOrg(orgRepo repositories.OrgRepo, auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		v := request.NewValidator()
+		var req request.Organization
+		err := encoding.Validated(w, r, v, &req)
+		if err != nil {
+			switch {
+			case errors.Is(err, encoding.ErrInvalidData):
+				failedValidationResponse(w, r, v)
+			case errors.Is(err, encoding.ErrInvalidRequest):
+				badRequestResponse(w, r, err)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		token := tools.ContextGetToken(r)
+
+		org := models.Organization{Name: strings.TrimSpace(req.Name)}
+		err = orgRepo.CreateOrg(&org, token.UserID)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:    token.UserID,
+			Action:     models.OrgCreatedAuditAction,
+			TargetType: "org",
+			TargetId:   strconv.Itoa(org.Id),
+			Metadata:   map[string]any{"name": org.Name},
+		})
+
+		respondWithJSON(w, r, http.StatusCreated, envelope{
+			"status": "success",
+			"data": envelope{
+				"org": org,
+			},
+		})
+	})
+}
+
+func ListOrgs(orgRepo repositories.OrgRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		token := tools.ContextGetToken(r)
+
+		orgs, err := orgRepo.ListUserOrgs(token.UserID)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"orgs": orgs,
+			},
+		})
+	})
+}
+
+func GetOrg(orgRepo repositories.OrgRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		member := tools.ContextGetOrgMember(r)
+
+		org, err := orgRepo.GetOrg(member.OrgId)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+		org.Role = member.Role
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"org": org,
+			},
+		})
+	})
+}
+
+func RenameOrg(orgRepo repositories.OrgRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		v := request.NewValidator()
+		var req request.Organization
+		err := encoding.Validated(w, r, v, &req)
+		if err != nil {
+			switch {
+			case errors.Is(err, encoding.ErrInvalidData):
+				failedValidationResponse(w, r, v)
+			case errors.Is(err, encoding.ErrInvalidRequest):
+				badRequestResponse(w, r, err)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		member := tools.ContextGetOrgMember(r)
+
+		err = orgRepo.RenameOrg(member.OrgId, strings.TrimSpace(req.Name))
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		respondWithJSON(w, r, http.StatusOK, envelope{"status": "success"})
+	})
+}
+
+// DeleteOrg removes the organization along with its api keys, reserved
+// domains and invitations
+func DeleteOrg(orgRepo repositories.OrgRepo, auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		member := tools.ContextGetOrgMember(r)
+
+		err := orgRepo.DeleteOrg(member.OrgId)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:    member.UserId,
+			Action:     models.OrgDeletedAuditAction,
+			TargetType: "org",
+			TargetId:   strconv.Itoa(member.OrgId),
+		})
+
+		respondWithJSON(w, r, http.StatusOK, envelope{"status": "success"})
+	})
+}
+
+func ListOrgMembers(orgRepo repositories.OrgRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		member := tools.ContextGetOrgMember(r)
+
+		members, err := orgRepo.ListMembers(member.OrgId)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"members": members,
+			},
+		})
+	})
+}
+
+func UpdateOrgMember(orgRepo repositories.OrgRepo, auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		userId, err := request.ReadIntParam(r, "user_id")
+		if err != nil {
+			notFoundResponse(w, r)
+			return
+		}
+
+		v := request.NewValidator()
+		var req request.UpdateOrgMember
+		err = encoding.Validated(w, r, v, &req)
+		if err != nil {
+			switch {
+			case errors.Is(err, encoding.ErrInvalidData):
+				failedValidationResponse(w, r, v)
+			case errors.Is(err, encoding.ErrInvalidRequest):
+				badRequestResponse(w, r, err)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		member := tools.ContextGetOrgMember(r)
+		role := models.OrgRole(req.Role)
+
+		target, err := orgRepo.GetMember(member.OrgId, userId)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if !policy.CanAssign(tokenSubject(r), target.Role, role) {
+			NotPermittedResponse(w, r)
+			return
+		}
+
+		if target.Role == models.OwnerOrgRole && role != models.OwnerOrgRole {
+			if !keepsAnOwner(w, r, orgRepo, member.OrgId) {
+				return
+			}
+		}
+
+		err = orgRepo.UpdateMemberRole(member.OrgId, userId, role)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:    member.UserId,
+			Action:     models.OrgMemberUpdatedAuditAction,
+			TargetType: "user",
+			TargetId:   strconv.Itoa(userId),
+			Metadata:   map[string]any{"org_id": member.OrgId, "from": target.Role, "to": role},
+		})
+
+		respondWithJSON(w, r, http.StatusOK, envelope{"status": "success"})
+	})
+}
+
+// RemoveOrgMember lets admins remove members and every member leave on
+// their own, the last owner can do neither
+func RemoveOrgMember(orgRepo repositories.OrgRepo, auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		userId, err := request.ReadIntParam(r, "user_id")
+		if err != nil {
+			notFoundResponse(w, r)
+			return
+		}
+
+		member := tools.ContextGetOrgMember(r)
+
+		target, err := orgRepo.GetMember(member.OrgId, userId)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		subject := tokenSubject(r)
+		leaving := userId == subject.UserId
+		if !leaving && !policy.CanAssign(subject, target.Role, models.ViewerOrgRole) {
+			NotPermittedResponse(w, r)
+			return
+		}
+
+		if target.Role == models.OwnerOrgRole {
+			if !keepsAnOwner(w, r, orgRepo, member.OrgId) {
+				return
+			}
+		}
+
+		err = orgRepo.RemoveMember(member.OrgId, userId)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:    subject.UserId,
+			Action:     models.OrgMemberRemovedAuditAction,
+			TargetType: "user",
+			TargetId:   strconv.Itoa(userId),
+			Metadata:   map[string]any{"org_id": member.OrgId, "role": target.Role},
+		})
+
+		respondWithJSON(w, r, http.StatusOK, envelope{"status": "success"})
+	})
+}
+
+// CreateOrgInvitation emails a link to join the organization, inviting the
+// same address again replaces the previous link
+func CreateOrgInvitation(cfg *config.Config, userRepo repositories.UserRepo, orgRepo repositories.OrgRepo, auditRepo repositories.AuditRepo, m mailer.Mailer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		v := request.NewValidator()
+		var req request.OrgInvitation
+		err := encoding.Validated(w, r, v, &req)
+		if err != nil {
+			switch {
+			case errors.Is(err, encoding.ErrInvalidData):
+				failedValidationResponse(w, r, v)
+			case errors.Is(err, encoding.ErrInvalidRequest):
+				badRequestResponse(w, r, err)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		member := tools.ContextGetOrgMember(r)
+		role := models.OrgRole(req.Role)
+
+		if !policy.CanAssign(tokenSubject(r), "", role) {
+			NotPermittedResponse(w, r)
+			return
+		}
+
+		org, err := orgRepo.GetOrg(member.OrgId)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		inviter, err := userRepo.GetById(member.UserId)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		token := utils.GenerateToken(32)
+		invitation := models.OrgInvitation{
+			OrgId:     member.OrgId,
+			Email:     strings.ToLower(req.Email),
+			Role:      role,
+			TokenHash: utils.HashOtp(cfg.EmailOtpSalt, token),
+			InvitedBy: member.UserId,
+			ExpiresAt: time.Now().Add(orgInvitationExpiry),
+		}
+
+		err = orgRepo.CreateInvitation(&invitation)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		msg, err := mailer.NewInvitationMessage(invitation.Email, mailer.InvitationData{
+			OrgName:   org.Name,
+			InvitedBy: inviter.Name,
+			Role:      string(role),
+			URL:       cfg.FrontendURL + "/invitations?token=" + url.QueryEscape(token),
+			ExpiresIn: orgInvitationExpiry.String(),
+		})
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+		err = m.Send(r.Context(), msg)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:    member.UserId,
+			Action:     models.OrgMemberInvitedAuditAction,
+			TargetType: "org",
+			TargetId:   strconv.Itoa(member.OrgId),
+			Metadata:   map[string]any{"email": invitation.Email, "role": role},
+		})
+
+		respondWithJSON(w, r, http.StatusCreated, envelope{
+			"status": "success",
+			"data": envelope{
+				"invitation": invitation,
+			},
+		})
+	})
+}
+
+func ListOrgInvitations(orgRepo repositories.OrgRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		member := tools.ContextGetOrgMember(r)
+
+		invitations, err := orgRepo.ListInvitations(member.OrgId)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"invitations": invitations,
+			},
+		})
+	})
+}
+
+func DeleteOrgInvitation(orgRepo repositories.OrgRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		id, err := request.ReadIDParam(r)
+		if err != nil {
+			notFoundResponse(w, r)
+			return
+		}
+
+		member := tools.ContextGetOrgMember(r)
+
+		err = orgRepo.DeleteInvitation(member.OrgId, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		respondWithJSON(w, r, http.StatusOK, envelope{"status": "success"})
+	})
+}
+
+// AcceptOrgInvitation adds the signed in user to the organization, the
+// invitation only works for the address it was sent to
+func AcceptOrgInvitation(cfg *config.Config, userRepo repositories.UserRepo, orgRepo repositories.OrgRepo, auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		v := request.NewValidator()
+		var req request.AcceptOrgInvitation
+		err := encoding.Validated(w, r, v, &req)
+		if err != nil {
+			switch {
+			case errors.Is(err, encoding.ErrInvalidData):
+				failedValidationResponse(w, r, v)
+			case errors.Is(err, encoding.ErrInvalidRequest):
+				badRequestResponse(w, r, err)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		token := tools.ContextGetToken(r)
+		user, err := userRepo.GetById(token.UserID)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		invitation, err := orgRepo.GetInvitationByToken(utils.HashOtp(cfg.EmailOtpSalt, req.Token))
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				v.AddError("token", "invalid or expired invitation")
+				failedValidationResponse(w, r, v)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if invitation.ExpiresAt.Before(time.Now()) || !strings.EqualFold(invitation.Email, user.Email) {
+			v.AddError("token", "invalid or expired invitation")
+			failedValidationResponse(w, r, v)
+			return
+		}
+
+		orgId, err := orgRepo.AcceptInvitation(invitation.Id, token.UserID)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				errorResponse(w, r, http.StatusConflict, "you are already a member of this organization")
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:    token.UserID,
+			Action:     models.OrgMemberJoinedAuditAction,
+			TargetType: "org",
+			TargetId:   strconv.Itoa(orgId),
+			Metadata:   map[string]any{"role": invitation.Role},
+		})
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"org_id": orgId,
+				"role":   invitation.Role,
+			},
+		})
+	})
+}
+
+// keepsAnOwner responds with a conflict when the organization would be left
+// without an owner
+func keepsAnOwner(w http.ResponseWriter, r *http.Request, orgRepo repositories.OrgRepo, orgId int) bool {
+	owners, err := orgRepo.CountOwners(orgId)
+	if err != nil {
+		ServerErrorResponse(w, r, err)
+		return false
+	}
+	if owners <= 1 {
+		errorResponse(w, r, http.StatusConflict, "an organization needs at least one owner")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/encoding"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/request"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories/postgres"
+)
+
+func ListPlans(planRepo repositories.PlanRepo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		plans, err := planRepo.ListPlans()
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"plans": plans,
+			},
+		})
+	}
+}
+
+func UpdateUserPlan(userRepo repositories.UserRepo, planRepo repositories.PlanRepo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		id, err := request.ReadIDParam(r)
+		if err != nil {
+			notFoundResponse(w, r)
+			return
+		}
+
+		v := request.NewValidator()
+		var req request.UpdateUserPlan
+		err = encoding.Validated(w, r, v, &req)
+		if err != nil {
+			switch {
+			case errors.Is(err, encoding.ErrInvalidData):
+				failedValidationResponse(w, r, v)
+			case errors.Is(err, encoding.ErrInvalidRequest):
+				badRequestResponse(w, r, err)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		plan, err := planRepo.GetPlan(req.Plan)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				v.AddError("plan", "plan does not exist")
+				failedValidationResponse(w, r, v)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = userRepo.UpdateUserPlan(id, plan.Name)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"plan": plan,
+			},
+		})
+	}
+}
@@ -0,0 +1,322 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/encoding"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/request"
+	tools "github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/utils"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/mailer"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories/postgres"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/utils"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/password"
+)
+
+func UpdateProfile(userRepo repositories.UserRepo, auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		v := request.NewValidator()
+
+		var req request.UpdateProfile
+		err := encoding.Validated(w, r, v, &req)
+		if err != nil {
+			switch {
+			case errors.Is(err, encoding.ErrInvalidData):
+				failedValidationResponse(w, r, v)
+			case errors.Is(err, encoding.ErrInvalidRequest):
+				badRequestResponse(w, r, err)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		token := tools.ContextGetToken(r)
+
+		user, err := userRepo.UpdateUserName(token.UserID, req.Name)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:    user.Id,
+			Action:     models.ProfileUpdatedAuditAction,
+			TargetType: "user",
+			TargetId:   strconv.Itoa(user.Id),
+			Metadata:   map[string]any{"fields": []string{"name"}},
+		})
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"users": user,
+			},
+		})
+	})
+}
+
+// ChangePassword signs out every session of the user, the device that made
+// the change gets a new session in the response
+func ChangePassword(cfg *config.Config, userRepo repositories.UserRepo, sessionRepo repositories.SessionRepo, revocationRepo repositories.TokenRevocationRepo, auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		v := request.NewValidator()
+
+		var req request.ChangePassword
+		err := encoding.Validated(w, r, v, &req)
+		if err != nil {
+			switch {
+			case errors.Is(err, encoding.ErrInvalidData):
+				failedValidationResponse(w, r, v)
+			case errors.Is(err, encoding.ErrInvalidRequest):
+				badRequestResponse(w, r, err)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		token := tools.ContextGetToken(r)
+
+		user, err := userRepo.GetById(token.UserID)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		matched, err := password.MatchPassword(user.PasswordHash, req.CurrentPassword)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+		if !matched {
+			InvalidCredentialsResponse(w, r)
+			return
+		}
+
+		hash, err := password.SetPassword(req.NewPassword)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		err = userRepo.UpdateUserPassword(user.Email, hash)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		err = revokeEachSession(cfg, sessionRepo, revocationRepo, user.Id)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+		// tokens issued before sessions existed are not covered above
+		err = revokeAccessToken(cfg, revocationRepo, token)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		response, err := startSession(w, r, cfg, sessionRepo, userRepo, auditRepo, user)
+		if err != nil {
+			switch {
+			case errors.Is(err, errAccountSuspended):
+				AccountSuspendedResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:    user.Id,
+			Action:     models.PasswordChangedAuditAction,
+			TargetType: "user",
+			TargetId:   strconv.Itoa(user.Id),
+		})
+
+		respondWithJSON(w, r, http.StatusOK, response)
+	})
+}
+
+// SendEmailChangeOtp mails a code to the new address, the code is bound to
+// the user that asked for it so only they can swap in the address
+func SendEmailChangeOtp(cfg *config.Config, userRepo repositories.UserRepo, emailRepo repositories.EmailOtpRepo, m mailer.Mailer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		v := request.NewValidator()
+
+		var req request.ChangeEmail
+		err := encoding.Validated(w, r, v, &req)
+		if err != nil {
+			switch {
+			case errors.Is(err, encoding.ErrInvalidData):
+				failedValidationResponse(w, r, v)
+			case errors.Is(err, encoding.ErrInvalidRequest):
+				badRequestResponse(w, r, err)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		token := tools.ContextGetToken(r)
+
+		user, err := userRepo.GetById(token.UserID)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		matched, err := password.MatchPassword(user.PasswordHash, req.Password)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+		if !matched {
+			InvalidCredentialsResponse(w, r)
+			return
+		}
+
+		if req.Email == user.Email {
+			v.AddError("email", "new email should differ from the current one")
+			failedValidationResponse(w, r, v)
+			return
+		}
+
+		_, err = userRepo.GetByEmail(req.Email)
+		if err == nil {
+			v.AddError("email", "a user with this email address already exists")
+			failedValidationResponse(w, r, v)
+			return
+		}
+		if !errors.Is(err, postgres.ErrNotFound) {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		emailOtp := utils.GenerateToken(6)
+		err = sendOtp(r.Context(), cfg, emailRepo, m, models.EmailChangeOtpType, req.Email, emailChangeOtp(user.Id, emailOtp), maxOtpEmailsPerDay, mailer.OtpData{Otp: emailOtp})
+		if err != nil {
+			switch {
+			case errors.Is(err, errMaxOtpEmails):
+				errorResponse(w, r, http.StatusTooManyRequests, "rate limit exceeded: maximum emails per day reached")
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		respondWithJSON(w, r, http.StatusCreated, envelope{
+			"status": "success",
+		})
+	})
+}
+
+// VerifyEmailChangeOtp swaps in the new address, it counts as verified since
+// the user received the code there
+func VerifyEmailChangeOtp(cfg *config.Config, userRepo repositories.UserRepo, emailRepo repositories.EmailOtpRepo, auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		v := request.NewValidator()
+
+		var req request.VerifyUserOTP
+		err := encoding.Validated(w, r, v, &req)
+		if err != nil {
+			switch {
+			case !v.Valid():
+				failedValidationResponse(w, r, v)
+			case errors.Is(err, encoding.ErrInvalidRequest):
+				badRequestResponse(w, r, err)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		token := tools.ContextGetToken(r)
+
+		user, err := userRepo.GetById(token.UserID)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		ok, err := useOtp(cfg, emailRepo, models.EmailChangeOtpType, req.Email, emailChangeOtp(user.Id, req.EmailOtp))
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+		if !ok {
+			errorResponse(w, r, http.StatusUnauthorized, "invalid otp")
+			return
+		}
+
+		updated, err := userRepo.UpdateUserEmail(user.Id, req.Email)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrUniqueViolation):
+				v.AddError("email", "a user with this email address already exists")
+				failedValidationResponse(w, r, v)
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:    user.Id,
+			Action:     models.EmailChangedAuditAction,
+			TargetType: "user",
+			TargetId:   strconv.Itoa(user.Id),
+			Metadata:   map[string]any{"old_email": user.Email, "email": updated.Email},
+		})
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"users": updated,
+			},
+		})
+	})
+}
+
+// emailChangeOtp binds a code to the user it was sent for, the otp table only
+// knows the address the code went to
+func emailChangeOtp(userId int, otp string) string {
+	return strconv.Itoa(userId) + "|" + otp
+}
@@ -0,0 +1,231 @@
+package handler
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tools "github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/utils"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/cache"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories/postgres"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/utils"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/password"
+)
+
+type fakeUserRepo struct {
+	repositories.UserRepo
+	user *models.User
+}
+
+func (f *fakeUserRepo) GetById(id int) (*models.User, error) {
+	user := *f.user
+	return &user, nil
+}
+
+func (f *fakeUserRepo) UpdateUserPassword(email string, hash []byte) error {
+	f.user.PasswordHash = hash
+	return nil
+}
+
+func (f *fakeUserRepo) GetByEmail(email string) (*models.User, error) {
+	if f.user.Email != email {
+		return nil, postgres.ErrNotFound
+	}
+	user := *f.user
+	return &user, nil
+}
+
+func (f *fakeUserRepo) VerifyUserEmail(id int) error {
+	f.user.EmailVerified = true
+	return nil
+}
+
+type fakeSessionRepo struct {
+	repositories.SessionRepo
+	sessions      map[string]models.Session
+	refreshTokens map[string]string // refresh token id to session id
+	usedTokens    map[string]bool
+}
+
+func (f *fakeSessionRepo) CreateSession(session *models.Session, refreshTokenId string, ttl time.Duration) error {
+	f.sessions[session.Id] = *session
+	return nil
+}
+
+func (f *fakeSessionRepo) GetSessionByRefreshToken(refreshTokenId string) (*models.Session, error) {
+	session, ok := f.sessions[f.refreshTokens[refreshTokenId]]
+	if !ok {
+		return nil, cache.ErrNotFound
+	}
+	return &session, nil
+}
+
+func (f *fakeSessionRepo) RotateRefreshToken(refreshTokenId, newRefreshTokenId, ip, userAgent string, ttl time.Duration) (*models.Session, error) {
+	session, err := f.GetSessionByRefreshToken(refreshTokenId)
+	if err != nil {
+		return nil, err
+	}
+	if f.usedTokens[refreshTokenId] {
+		delete(f.sessions, session.Id)
+		return session, cache.ErrRefreshTokenReused
+	}
+	f.usedTokens[refreshTokenId] = true
+	f.refreshTokens[newRefreshTokenId] = session.Id
+	return session, nil
+}
+
+func (f *fakeSessionRepo) ListUserSessions(userId int) ([]models.Session, error) {
+	sessions := []models.Session{}
+	for _, session := range f.sessions {
+		if session.UserId == userId {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (f *fakeSessionRepo) DeleteSession(session *models.Session) error {
+	delete(f.sessions, session.Id)
+	return nil
+}
+
+func (f *fakeSessionRepo) DeleteUserSessions(userId int) error {
+	for id, session := range f.sessions {
+		if session.UserId == userId {
+			delete(f.sessions, id)
+		}
+	}
+	return nil
+}
+
+// fakeRevocationRepo denies tokens the way the cache backed repo does
+type fakeRevocationRepo struct {
+	tokens   map[string]bool
+	sessions map[string]bool
+	cutoffs  map[int]int64
+}
+
+func newFakeRevocationRepo() *fakeRevocationRepo {
+	return &fakeRevocationRepo{tokens: map[string]bool{}, sessions: map[string]bool{}, cutoffs: map[int]int64{}}
+}
+
+func (f *fakeRevocationRepo) RevokeToken(tokenUuid string, ttl time.Duration) error {
+	f.tokens[tokenUuid] = true
+	return nil
+}
+
+func (f *fakeRevocationRepo) RevokeSession(sessionId string, ttl time.Duration) error {
+	f.sessions[sessionId] = true
+	return nil
+}
+
+func (f *fakeRevocationRepo) RevokeUserTokens(userId int, ttl time.Duration) error {
+	f.cutoffs[userId] = time.Now().UnixMilli()
+	return nil
+}
+
+func (f *fakeRevocationRepo) IsTokenRevoked(userId int, sessionId, tokenUuid string, issuedAt time.Time) (bool, error) {
+	if f.tokens[tokenUuid] || f.sessions[sessionId] {
+		return true, nil
+	}
+	cutoff, ok := f.cutoffs[userId]
+	return ok && issuedAt.UnixMilli() < cutoff, nil
+}
+
+type fakeAuditRepo struct {
+	repositories.AuditRepo
+	events []models.AuditEvent
+}
+
+func (f *fakeAuditRepo) CreateEvent(event *models.AuditEvent) error {
+	f.events = append(f.events, *event)
+	return nil
+}
+
+func generateTestKeys(t *testing.T) (privateKeyB64 string, publicKeyB64 string) {
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Failed to generate ed25519 key pair: %v", err)
+	}
+
+	pkcs8PrivateKey, err := x509.MarshalPKCS8PrivateKey(privKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal private key to PKCS8: %v", err)
+	}
+	pkixPublicKey, err := x509.MarshalPKIXPublicKey(pubKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal public key to PKIX: %v", err)
+	}
+
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8PrivateKey})
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkixPublicKey})
+
+	return base64.StdEncoding.EncodeToString(privateKeyPEM), base64.StdEncoding.EncodeToString(publicKeyPEM)
+}
+
+func TestChangePasswordKeepsNewSession(t *testing.T) {
+	cfg := &config.Config{AppEnv: "dev"}
+	cfg.Token.AccessTokenPrivateKey, cfg.Token.AccessTokenPublicKey = generateTestKeys(t)
+	cfg.Token.RefreshTokenPrivateKey, cfg.Token.RefreshTokenPublicKey = generateTestKeys(t)
+	cfg.Token.AccessTokenExpiredIn = 15 * time.Minute
+	cfg.Token.RefreshTokenExpiredIn = time.Hour
+
+	hash, err := password.SetPassword("old-password")
+	if err != nil {
+		t.Fatalf("SetPassword() returned an unexpected error: %v", err)
+	}
+	userRepo := &fakeUserRepo{user: &models.User{Id: 1, Email: "user@example.com", PasswordHash: hash, EmailVerified: true}}
+	sessionRepo := &fakeSessionRepo{sessions: map[string]models.Session{
+		"old-session":   {Id: "old-session", UserId: 1},
+		"other-session": {Id: "other-session", UserId: 1},
+	}}
+	revocationRepo := newFakeRevocationRepo()
+
+	body := strings.NewReader(`{"current_password": "old-password", "new_password": "new-password"}`)
+	r := httptest.NewRequest(http.MethodPut, "/api/v1/users/me/password", body)
+	r = tools.ContextSetToken(r, &utils.TokenDetails{UserID: 1, SessionId: "old-session", TokenUuid: "old-token"})
+	w := httptest.NewRecorder()
+
+	ChangePassword(cfg, userRepo, sessionRepo, revocationRepo, &fakeAuditRepo{}).ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Data struct {
+			AccessToken string `json:"access_token"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	token, err := utils.ValidateToken(response.Data.AccessToken, cfg.Token.AccessTokenPublicKey)
+	if err != nil {
+		t.Fatalf("ValidateToken() returned an unexpected error: %v", err)
+	}
+	revoked, err := revocationRepo.IsTokenRevoked(token.UserID, token.SessionId, token.TokenUuid, time.UnixMilli(token.IssuedAtMilli))
+	if err != nil || revoked {
+		t.Fatalf("Expected the token returned by the password change to authenticate, got %v, %v", revoked, err)
+	}
+
+	for _, sessionId := range []string{"old-session", "other-session"} {
+		revoked, err := revocationRepo.IsTokenRevoked(1, sessionId, "token-"+sessionId, time.Now().Add(-time.Minute))
+		if err != nil || !revoked {
+			t.Fatalf("Expected the tokens of %s to be revoked, got %v, %v", sessionId, revoked, err)
+		}
+		if _, ok := sessionRepo.sessions[sessionId]; ok {
+			t.Fatalf("Expected %s to be deleted", sessionId)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	tools "github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/utils"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/cache"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+)
+
+// ListSessions returns the signed in devices of the caller, most recently
+// used first
+func ListSessions(sessionRepo repositories.SessionRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		token := tools.ContextGetToken(r)
+
+		sessions, err := sessionRepo.ListUserSessions(token.UserID)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		for i := range sessions {
+			sessions[i].Current = sessions[i].Id == token.SessionId
+		}
+		slices.SortFunc(sessions, func(a, b models.Session) int {
+			return b.LastUsedAt.Compare(a.LastUsedAt)
+		})
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"sessions": sessions,
+			},
+		})
+	})
+}
+
+func RevokeSession(cfg *config.Config, sessionRepo repositories.SessionRepo, revocationRepo repositories.TokenRevocationRepo, auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		session, err := sessionRepo.GetSession(r.PathValue("id"))
+		if err != nil {
+			switch {
+			case errors.Is(err, cache.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		token := tools.ContextGetToken(r)
+		if session.UserId != token.UserID {
+			notFoundResponse(w, r)
+			return
+		}
+
+		err = sessionRepo.DeleteSession(session)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+		err = revocationRepo.RevokeSession(session.Id, cfg.Token.AccessTokenExpiredIn)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:    token.UserID,
+			Action:     models.SessionRevokedAuditAction,
+			TargetType: "session",
+			TargetId:   session.Id,
+		})
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+		})
+	})
+}
+
+// RevokeSessions signs the caller out of every device including the current
+// one
+func RevokeSessions(cfg *config.Config, sessionRepo repositories.SessionRepo, revocationRepo repositories.TokenRevocationRepo, auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		token := tools.ContextGetToken(r)
+
+		err := revokeUserSessions(cfg, sessionRepo, revocationRepo, token.UserID)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:    token.UserID,
+			Action:     models.SessionRevokedAuditAction,
+			TargetType: "session",
+			Metadata:   map[string]any{"all": true},
+		})
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+		})
+	})
+}
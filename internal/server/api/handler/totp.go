@@ -0,0 +1,498 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/encoding"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/request"
+	tools "github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/utils"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/cache"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/mailer"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories/postgres"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/utils"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/password"
+)
+
+const (
+	totpIssuer         = "Tunnel"
+	recoveryCodeCount  = 10
+	mfaChallengeExpiry = 5 * time.Minute
+)
+
+var totpCodeRegex = regexp.MustCompile("^[0-9]{6}$")
+
+func GetTotpStatus(totpRepo repositories.TotpRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		token := tools.ContextGetToken(r)
+
+		totp, err := totpRepo.GetTotp(token.UserID)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				totp = &models.Totp{}
+			default:
+				ServerErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		remaining := 0
+		if totp.Enabled {
+			remaining, err = totpRepo.CountRecoveryCodes(token.UserID)
+			if err != nil {
+				ServerErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"totp":                     totp,
+				"recovery_codes_remaining": remaining,
+			},
+		})
+	})
+}
+
+// EnrollTotp creates a new secret, it only protects sign in once a code
+// generated from it was confirmed
+func EnrollTotp(userRepo repositories.UserRepo, totpRepo repositories.TotpRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		token := tools.ContextGetToken(r)
+
+		user, err := userRepo.GetById(token.UserID)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		existing, err := totpRepo.GetTotp(user.Id)
+		if err != nil && !errors.Is(err, postgres.ErrNotFound) {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+		if existing != nil && existing.Enabled {
+			errorResponse(w, r, http.StatusConflict, "two-factor authentication is already enabled")
+			return
+		}
+
+		secret, err := utils.GenerateTotpSecret()
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		err = totpRepo.CreateTotp(user.Id, secret)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		respondWithJSON(w, r, http.StatusCreated, envelope{
+			"status": "success",
+			"data": envelope{
+				"secret":      secret,
+				"otpauth_uri": utils.TotpURI(totpIssuer, user.Email, secret),
+			},
+		})
+	})
+}
+
+// ConfirmTotp enables totp with the first code from the authenticator app
+// and returns the recovery codes, they are only shown this once
+func ConfirmTotp(cfg *config.Config, totpRepo repositories.TotpRepo, auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		v := request.NewValidator()
+
+		var req request.TotpCode
+		err := encoding.Validated(w, r, v, &req)
+		if err != nil {
+			switch {
+			case errors.Is(err, encoding.ErrInvalidData):
+				failedValidationResponse(w, r, v)
+			case errors.Is(err, encoding.ErrInvalidRequest):
+				badRequestResponse(w, r, err)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		token := tools.ContextGetToken(r)
+
+		totp, err := totpRepo.GetTotp(token.UserID)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if totp.Enabled {
+			errorResponse(w, r, http.StatusConflict, "two-factor authentication is already enabled")
+			return
+		}
+
+		ok, err := verifyTotpCode(totpRepo, totp, req.Code)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+		if !ok {
+			invalidCodeResponse(w, r)
+			return
+		}
+
+		err = totpRepo.EnableTotp(token.UserID)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		codes, err := replaceRecoveryCodes(cfg, totpRepo, token.UserID)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId: token.UserID,
+			Action:  models.TotpEnabledAuditAction,
+		})
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"recovery_codes": codes,
+			},
+		})
+	})
+}
+
+// RegenerateRecoveryCodes replaces every recovery code, codes that were not
+// used yet stop working
+func RegenerateRecoveryCodes(cfg *config.Config, totpRepo repositories.TotpRepo, auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		v := request.NewValidator()
+
+		var req request.TotpCode
+		err := encoding.Validated(w, r, v, &req)
+		if err != nil {
+			switch {
+			case errors.Is(err, encoding.ErrInvalidData):
+				failedValidationResponse(w, r, v)
+			case errors.Is(err, encoding.ErrInvalidRequest):
+				badRequestResponse(w, r, err)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		token := tools.ContextGetToken(r)
+
+		totp, err := totpRepo.GetTotp(token.UserID)
+		if err != nil && !errors.Is(err, postgres.ErrNotFound) {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+		if totp == nil || !totp.Enabled {
+			errorResponse(w, r, http.StatusConflict, "two-factor authentication is not enabled")
+			return
+		}
+
+		ok, err := verifyTotpCode(totpRepo, totp, req.Code)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+		if !ok {
+			invalidCodeResponse(w, r)
+			return
+		}
+
+		codes, err := replaceRecoveryCodes(cfg, totpRepo, token.UserID)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId: token.UserID,
+			Action:  models.RecoveryCodesAuditAction,
+		})
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"recovery_codes": codes,
+			},
+		})
+	})
+}
+
+// DisableTotp turns two-factor authentication off, it needs the password and
+// a code so a stolen session alone is not enough
+func DisableTotp(cfg *config.Config, userRepo repositories.UserRepo, totpRepo repositories.TotpRepo, auditRepo repositories.AuditRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		v := request.NewValidator()
+
+		var req request.DisableTotp
+		err := encoding.Validated(w, r, v, &req)
+		if err != nil {
+			switch {
+			case errors.Is(err, encoding.ErrInvalidData):
+				failedValidationResponse(w, r, v)
+			case errors.Is(err, encoding.ErrInvalidRequest):
+				badRequestResponse(w, r, err)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		token := tools.ContextGetToken(r)
+
+		user, err := userRepo.GetById(token.UserID)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		matched, err := password.MatchPassword(user.PasswordHash, req.Password)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+		if !matched {
+			InvalidCredentialsResponse(w, r)
+			return
+		}
+
+		totp, err := totpRepo.GetTotp(user.Id)
+		if err != nil && !errors.Is(err, postgres.ErrNotFound) {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+		if totp == nil || !totp.Enabled {
+			errorResponse(w, r, http.StatusConflict, "two-factor authentication is not enabled")
+			return
+		}
+
+		ok, err := verifySecondFactor(cfg, totpRepo, totp, req.Code)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+		if !ok {
+			invalidCodeResponse(w, r)
+			return
+		}
+
+		err = totpRepo.DeleteTotp(user.Id)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId: user.Id,
+			Action:  models.TotpDisabledAuditAction,
+		})
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+		})
+	})
+}
+
+// VerifyMfa exchanges the mfa token returned by AuthenticateUser and a totp
+// or recovery code for the session cookies. Wrong codes count towards the
+// login lock of the account like wrong passwords do
+func VerifyMfa(cfg *config.Config, sessionRepo repositories.SessionRepo, userRepo repositories.UserRepo, totpRepo repositories.TotpRepo, mfaRepo repositories.MfaRepo, lockRepo repositories.LoginLockRepo, emailRepo repositories.EmailOtpRepo, auditRepo repositories.AuditRepo, m mailer.Mailer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		v := request.NewValidator()
+
+		var req request.VerifyMfa
+		err := encoding.Validated(w, r, v, &req)
+		if err != nil {
+			switch {
+			case errors.Is(err, encoding.ErrInvalidData):
+				failedValidationResponse(w, r, v)
+			case errors.Is(err, encoding.ErrInvalidRequest):
+				badRequestResponse(w, r, err)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		challenge, err := mfaRepo.GetChallenge(req.MfaToken)
+		if err != nil {
+			switch {
+			case errors.Is(err, cache.ErrNotFound):
+				InvalidCredentialsResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		user, err := userRepo.GetById(challenge.UserId)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				InvalidCredentialsResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		lock, wait, err := checkLoginLock(lockRepo, loginLockSubject(user.Email), ClientIP(r))
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+		if lock != nil {
+			loginLockedResponse(w, r, time.Until(lock.ExpiresAt))
+			return
+		}
+		if wait > 0 {
+			setRetryAfter(w, wait)
+			TooManyResponse(w, r)
+			return
+		}
+
+		totp, err := totpRepo.GetTotp(user.Id)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				InvalidCredentialsResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		ok, err := verifySecondFactor(cfg, totpRepo, totp, req.Code)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+		if !ok {
+			err = mfaRepo.FailChallenge(challenge)
+			if err != nil {
+				ServerErrorResponse(w, r, err)
+				return
+			}
+			recordAudit(r, auditRepo, models.AuditEvent{
+				ActorId: user.Id,
+				Action:  models.MfaFailedAuditAction,
+			})
+			failSignIn(w, r, cfg, lockRepo, emailRepo, auditRepo, m, user, user.Email, invalidCodeResponse)
+			return
+		}
+
+		err = mfaRepo.DeleteChallenge(challenge.Token)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		err = lockRepo.ClearFailures(models.AccountLoginLockKind, loginLockSubject(user.Email))
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		response, err := startSession(w, r, cfg, sessionRepo, userRepo, auditRepo, user)
+		if err != nil {
+			switch {
+			case errors.Is(err, errAccountSuspended):
+				AccountSuspendedResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:  user.Id,
+			Action:   models.LoginAuditAction,
+			Metadata: map[string]any{"mfa": true},
+		})
+
+		respondWithJSON(w, r, http.StatusOK, response)
+	})
+}
+
+func invalidCodeResponse(w http.ResponseWriter, r *http.Request) {
+	errorResponse(w, r, http.StatusUnauthorized, "invalid code")
+}
+
+// verifyTotpCode checks code against the secret, a code is accepted once
+func verifyTotpCode(totpRepo repositories.TotpRepo, totp *models.Totp, code string) (bool, error) {
+	step, ok := utils.ValidateTotp(totp.Secret, code, time.Now())
+	if !ok || step <= totp.LastUsedStep {
+		return false, nil
+	}
+	return totpRepo.UseTotpStep(totp.UserId, step)
+}
+
+// verifySecondFactor accepts a totp code or an unused recovery code
+func verifySecondFactor(cfg *config.Config, totpRepo repositories.TotpRepo, totp *models.Totp, code string) (bool, error) {
+	if totpCodeRegex.MatchString(code) {
+		return verifyTotpCode(totpRepo, totp, code)
+	}
+	return totpRepo.UseRecoveryCode(totp.UserId, utils.HashOtp(cfg.EmailOtpSalt, normalizeRecoveryCode(code)))
+}
+
+// replaceRecoveryCodes generates new recovery codes formatted as xxxxx-xxxxx
+// and stores their hashes
+func replaceRecoveryCodes(cfg *config.Config, totpRepo repositories.TotpRepo, userId int) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		code := strings.ToLower(utils.GenerateToken(10))
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, utils.HashOtp(cfg.EmailOtpSalt, code))
+	}
+
+	if err := totpRepo.ReplaceRecoveryCodes(userId, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
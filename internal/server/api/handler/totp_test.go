@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/cache"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+)
+
+type fakeLockRepo struct {
+	repositories.LoginLockRepo
+	failures map[string]*models.LoginFailures
+	locks    map[string]*models.LoginLock
+}
+
+func newFakeLockRepo() *fakeLockRepo {
+	return &fakeLockRepo{failures: map[string]*models.LoginFailures{}, locks: map[string]*models.LoginLock{}}
+}
+
+func (f *fakeLockRepo) RecordFailure(kind models.LoginLockKind, subject string, window time.Duration) (*models.LoginFailures, error) {
+	failures, ok := f.failures[string(kind)+subject]
+	if !ok {
+		failures = &models.LoginFailures{}
+		f.failures[string(kind)+subject] = failures
+	}
+	failures.Count++
+	failures.LastFailedAt = time.Now()
+	return failures, nil
+}
+
+func (f *fakeLockRepo) GetFailures(kind models.LoginLockKind, subject string) (*models.LoginFailures, error) {
+	if failures, ok := f.failures[string(kind)+subject]; ok {
+		return failures, nil
+	}
+	return &models.LoginFailures{}, nil
+}
+
+func (f *fakeLockRepo) ClearFailures(kind models.LoginLockKind, subject string) error {
+	delete(f.failures, string(kind)+subject)
+	return nil
+}
+
+func (f *fakeLockRepo) Lock(lock *models.LoginLock) error {
+	f.locks[string(lock.Kind)+lock.Subject] = lock
+	return nil
+}
+
+func (f *fakeLockRepo) GetLock(kind models.LoginLockKind, subject string) (*models.LoginLock, error) {
+	if lock, ok := f.locks[string(kind)+subject]; ok {
+		return lock, nil
+	}
+	return nil, cache.ErrNotFound
+}
+
+type fakeTotpRepo struct {
+	repositories.TotpRepo
+	totp *models.Totp
+}
+
+func (f *fakeTotpRepo) GetTotp(userId int) (*models.Totp, error) {
+	return f.totp, nil
+}
+
+func (f *fakeTotpRepo) UseRecoveryCode(userId int, codeHash string) (bool, error) {
+	return false, nil
+}
+
+type fakeMfaRepo struct {
+	repositories.MfaRepo
+}
+
+func (f *fakeMfaRepo) GetChallenge(token string) (*models.MfaChallenge, error) {
+	return &models.MfaChallenge{Token: token, UserId: 1, ExpiresAt: time.Now().Add(time.Minute)}, nil
+}
+
+func (f *fakeMfaRepo) FailChallenge(challenge *models.MfaChallenge) error {
+	return nil
+}
+
+func TestVerifyMfaFailuresCountTowardsLoginLock(t *testing.T) {
+	cfg := &config.Config{}
+	lockRepo := newFakeLockRepo()
+	verify := VerifyMfa(cfg, nil, &fakeUserRepo{user: &models.User{Id: 1, Email: "User@example.com"}},
+		&fakeTotpRepo{totp: &models.Totp{UserId: 1, Enabled: true}}, &fakeMfaRepo{}, lockRepo, nil, &fakeAuditRepo{}, &fakeMailer{})
+
+	// every password replay hands out a fresh challenge, the wrong codes
+	// still add up on the account
+	for i := range loginDelayAfter + 1 {
+		body := strings.NewReader(`{"mfa_token": "challenge-` + string(rune('a'+i)) + `", "code": "wrong-recovery"}`)
+		w := httptest.NewRecorder()
+		verify.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/auth/mfa/verify", body))
+
+		status := http.StatusUnauthorized
+		if i == loginDelayAfter {
+			status = http.StatusTooManyRequests
+		}
+		if w.Code != status {
+			t.Fatalf("attempt %d: expected status %d, got %d: %s", i+1, status, w.Code, w.Body.String())
+		}
+	}
+
+	failures, _ := lockRepo.GetFailures(models.AccountLoginLockKind, "user@example.com")
+	if failures.Count != loginDelayAfter {
+		t.Fatalf("Expected %d failures on the account, got %d", loginDelayAfter, failures.Count)
+	}
+}
@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/request"
+	tools "github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/utils"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/cache"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/policy"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories/postgres"
+)
+
+func ListTunnels(tunnelRepo repositories.TunnelRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		page, ok := readTunnelPage(w, r)
+		if !ok {
+			return
+		}
+
+		var tunnels []models.Tunnel
+		var err error
+		if member := tools.ContextGetOrgMember(r); member != nil {
+			tunnels, err = tunnelRepo.ListOrgTunnels(member.OrgId)
+		} else {
+			token := tools.ContextGetToken(r)
+			tunnels, err = tunnelRepo.ListUserTunnels(token.UserID)
+		}
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		tunnels, metadata := pageTunnels(tunnels, page)
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"tunnels": tunnels,
+			},
+			"metadata": metadata,
+		})
+	})
+}
+
+func ListAllTunnels(tunnelRepo repositories.TunnelRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		page, ok := readTunnelPage(w, r)
+		if !ok {
+			return
+		}
+
+		tunnels, err := tunnelRepo.ListTunnels()
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		tunnels, metadata := pageTunnels(tunnels, page)
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"tunnels": tunnels,
+			},
+			"metadata": metadata,
+		})
+	})
+}
+
+func readTunnelPage(w http.ResponseWriter, r *http.Request) (request.CursorPage, bool) {
+	v := request.NewValidator()
+	page := request.CursorPage{}
+
+	page.Cursor = request.ReadString(r, "cursor", "")
+	page.Limit = request.ReadInt(r, v, "limit", 50)
+	v = page.Valid(r.Context(), v)
+	if !v.Valid() {
+		failedValidationResponse(w, r, v)
+		return page, false
+	}
+
+	return page, true
+}
+
+// pageTunnels pages the live tunnels, which are read from the registry all at
+// once, newest first with the id breaking ties
+func pageTunnels(tunnels []models.Tunnel, page request.CursorPage) ([]models.Tunnel, request.Metadata) {
+	slices.SortFunc(tunnels, func(a, b models.Tunnel) int {
+		if c := b.StartedAt.Compare(a.StartedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(b.Id, a.Id)
+	})
+
+	start := 0
+	if page.After != nil {
+		start = len(tunnels)
+		for i, tunnel := range tunnels {
+			c := tunnel.StartedAt.Compare(page.After.Time)
+			if c < 0 || (c == 0 && tunnel.Id < page.After.Value) {
+				start = i
+				break
+			}
+		}
+	}
+	end := min(start+page.Limit+1, len(tunnels))
+
+	return request.Paginate(tunnels[start:end], page.Limit, len(tunnels), tunnelCursor)
+}
+
+func tunnelCursor(tunnel models.Tunnel) models.Cursor {
+	return models.Cursor{Time: tunnel.StartedAt, Value: tunnel.Id}
+}
+
+// DisconnectTunnel force disconnects the agent session that owns the tunnel,
+// the nat-server holding the session closes it asynchronously
+func DisconnectTunnel(tunnelRepo repositories.TunnelRepo, orgRepo repositories.OrgRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		tunnel, err := tunnelRepo.GetTunnel(r.PathValue("id"))
+		if err != nil {
+			switch {
+			case errors.Is(err, cache.ErrNotFound):
+				notFoundResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		allowed, err := canManageTunnel(r, orgRepo, tunnel)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+		if !allowed {
+			notFoundResponse(w, r)
+			return
+		}
+
+		err = tunnelRepo.RequestDisconnect(tunnel.SessionId)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		respondWithJSON(w, r, http.StatusAccepted, envelope{
+			"status": "success",
+			"data": envelope{
+				"session_id": tunnel.SessionId,
+			},
+		})
+	})
+}
+
+// canManageTunnel reports whether the user of the request may act on
+// tunnel, org tunnels are open to every member allowed to manage the
+// resources of the org
+func canManageTunnel(r *http.Request, orgRepo repositories.OrgRepo, tunnel *models.Tunnel) (bool, error) {
+	subject := tokenSubject(r)
+	if tunnel.UserId == subject.UserId || policy.Can(subject, policy.ManageAllTunnelsAction) {
+		return true, nil
+	}
+	if tunnel.OrgId == 0 {
+		return false, nil
+	}
+
+	member, err := orgRepo.GetMember(tunnel.OrgId, subject.UserId)
+	if err != nil {
+		if errors.Is(err, postgres.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	subject.Role = member.Role
+
+	return policy.Can(subject, policy.ManageResourcesAction), nil
+}
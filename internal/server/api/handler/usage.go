@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/request"
+	tools "github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/utils"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+)
+
+func ListUsage(usageRepo repositories.UsageRepo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		v := request.NewValidator()
+		page := request.CursorPage{}
+
+		page.Cursor = request.ReadString(r, "cursor", "")
+		page.Limit = request.ReadInt(r, v, "limit", 12)
+		v = page.Valid(r.Context(), v)
+		if !v.Valid() {
+			failedValidationResponse(w, r, v)
+			return
+		}
+
+		token := tools.ContextGetToken(r)
+		total, err := usageRepo.CountUsage(token.UserID)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		usage, err := usageRepo.ListUsage(token.UserID, page.After, page.Limit+1)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		usage, metadata := request.Paginate(usage, page.Limit, total, usageCursor)
+
+		respondWithJSON(w, r, http.StatusOK, envelope{
+			"status": "success",
+			"data": envelope{
+				"usage": usage,
+			},
+			"metadata": metadata,
+		})
+	})
+}
+
+func usageCursor(usage models.TunnelUsage) models.Cursor {
+	return models.Cursor{Id: int64(usage.Id), Time: usage.Period}
+}
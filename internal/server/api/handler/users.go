@@ -4,51 +4,88 @@ import (
 	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/encoding"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/request"
 	tools "github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/utils"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/cache"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/mailer"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories/postgres"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/utils"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/password"
+
+	"github.com/google/uuid"
 )
 
+// ListUsers lets admins search and filter the users, the metadata holds the
+// total number of users that match and the cursor of the next page
 func ListUsers(userRepo repositories.UserRepo) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var err error
 
 		v := request.NewValidator()
-		filters := request.Pagination{}
+		filters := request.UserFilters{}
 
-		filters.Page = request.ReadInt(r, v, "page", 1)
+		filters.Cursor = request.ReadString(r, "cursor", "")
 		filters.Limit = request.ReadInt(r, v, "limit", 20)
+		filters.Search = request.ReadString(r, "search", "")
+		filters.EmailVerified = request.ReadBool(r, v, "verified")
+		filters.IsAdmin = request.ReadBool(r, v, "admin")
+		filters.Suspended = request.ReadBool(r, v, "suspended")
+		filters.Plan = request.ReadString(r, "plan", "")
+		filters.CreatedAfter = request.ReadTime(r, v, "created_after")
+		filters.CreatedBefore = request.ReadTime(r, v, "created_before")
+		filters.Sort = request.ReadString(r, "sort", "-created_at")
 		v = filters.Valid(r.Context(), v)
 		if !v.Valid() {
 			failedValidationResponse(w, r, v)
 			return
 		}
 
-		users, err := userRepo.ListUsers(filters.Limit, (filters.Page-1)*filters.Limit)
+		total, err := userRepo.CountUsers(filters.UserFilter)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		users, err := userRepo.ListUsers(filters.UserFilter, filters.After, filters.Limit+1)
 		if err != nil {
 			ServerErrorResponse(w, r, err)
 			return
 		}
 
+		users, metadata := request.Paginate(users, filters.Limit, total, func(user models.User) models.Cursor {
+			return userCursor(user, filters.Sort)
+		})
+
 		respondWithJSON(w, r, http.StatusOK, envelope{
 			"status": "success",
 			"data": envelope{
 				"users": users,
 			},
+			"metadata": metadata,
 		})
 
 	}
 }
 
+// userCursor is the position of user in the list sorted by sort
+func userCursor(user models.User, sort string) models.Cursor {
+	cursor := models.Cursor{Id: int64(user.Id), Time: user.CreatedAt, Sort: sort}
+	switch strings.TrimPrefix(sort, "-") {
+	case "email":
+		cursor.Value = user.Email
+	case "name":
+		cursor.Value = user.Name
+	}
+	return cursor
+}
+
 func GetUsers(userRepo repositories.UserRepo) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
@@ -127,7 +164,7 @@ func SignupUser(userRepo repositories.UserRepo) http.HandlerFunc {
 	}
 }
 
-func DeleteUser(userRepo repositories.UserRepo) http.HandlerFunc {
+func DeleteUser(cfg *config.Config, userRepo repositories.UserRepo, sessionRepo repositories.SessionRepo, revocationRepo repositories.TokenRevocationRepo, auditRepo repositories.AuditRepo) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id, err := request.ReadIDParam(r)
 		if err != nil {
@@ -145,11 +182,27 @@ func DeleteUser(userRepo repositories.UserRepo) http.HandlerFunc {
 			}
 			return
 		}
+
+		err = revokeUserSessions(cfg, sessionRepo, revocationRepo, id)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:    tools.ContextGetToken(r).UserID,
+			Action:     models.UserDeletedAuditAction,
+			TargetType: "user",
+			TargetId:   strconv.Itoa(id),
+		})
+
 		respondWithJSON(w, r, http.StatusOK, envelope{"status": "sucess"})
 	}
 }
 
-func AuthenticateUser(cfg *config.Config, cacheRepo cache.CacheRepo, userRepo repositories.UserRepo) http.HandlerFunc {
+// AuthenticateUser checks the password, users with totp enabled get an mfa
+// token instead of the session cookies which VerifyMfa exchanges
+func AuthenticateUser(cfg *config.Config, sessionRepo repositories.SessionRepo, userRepo repositories.UserRepo, totpRepo repositories.TotpRepo, mfaRepo repositories.MfaRepo, lockRepo repositories.LoginLockRepo, emailRepo repositories.EmailOtpRepo, auditRepo repositories.AuditRepo, m mailer.Mailer) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
@@ -169,11 +222,26 @@ func AuthenticateUser(cfg *config.Config, cacheRepo cache.CacheRepo, userRepo re
 			return
 		}
 
+		lock, wait, err := checkLoginLock(lockRepo, loginLockSubject(req.Email), ClientIP(r))
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+		if lock != nil {
+			loginLockedResponse(w, r, time.Until(lock.ExpiresAt))
+			return
+		}
+		if wait > 0 {
+			setRetryAfter(w, wait)
+			TooManyResponse(w, r)
+			return
+		}
+
 		user, err := userRepo.GetByEmail(req.Email)
 		if err != nil {
 			switch {
 			case errors.Is(err, postgres.ErrNotFound):
-				InvalidCredentialsResponse(w, r)
+				failLogin(w, r, cfg, lockRepo, emailRepo, auditRepo, m, nil, req.Email, "unknown email")
 			default:
 				ServerErrorResponse(w, r, err)
 			}
@@ -186,77 +254,66 @@ func AuthenticateUser(cfg *config.Config, cacheRepo cache.CacheRepo, userRepo re
 			return
 		}
 		if !matched {
-			InvalidCredentialsResponse(w, r)
+			failLogin(w, r, cfg, lockRepo, emailRepo, auditRepo, m, user, req.Email, "wrong password")
 			return
 		}
 
-		jwt, err := utils.CreateToken(user, cfg.Token.AccessTokenExpiredIn, cfg.Token.AccessTokenPrivateKey)
-		if err != nil {
-			ServerErrorResponse(w, r, err)
+		if !user.SuspendedAt.IsZero() {
+			AccountSuspendedResponse(w, r)
 			return
 		}
 
-		refreshToken, err := utils.CreateToken(user, cfg.Token.RefreshTokenExpiredIn, cfg.Token.RefreshTokenPrivateKey)
-		if err != nil {
+		totp, err := totpRepo.GetTotp(user.Id)
+		if err != nil && !errors.Is(err, postgres.ErrNotFound) {
 			ServerErrorResponse(w, r, err)
 			return
 		}
+		if totp != nil && totp.Enabled {
+			challenge, err := mfaRepo.CreateChallenge(user.Id, mfaChallengeExpiry)
+			if err != nil {
+				ServerErrorResponse(w, r, err)
+				return
+			}
 
-		now := time.Now()
-		err = cacheRepo.Set(refreshToken.TokenUuid, user.Id, time.Unix(jwt.ExpiresIn, 0).Sub(now))
-		if err != nil {
-			ServerErrorResponse(w, r, err)
+			respondWithJSON(w, r, http.StatusOK, envelope{
+				"status": "mfa_required",
+				"data": envelope{
+					"mfa_token":  challenge.Token,
+					"expires_at": challenge.ExpiresAt,
+				},
+			})
 			return
 		}
 
-		accessCookie := http.Cookie{
-			Name:     "jwt",
-			Value:    jwt.Token,
-			Path:     "/",
-			MaxAge:   int(cfg.Token.AccessTokenMaxAge) * 60,
-			HttpOnly: true,
-			Secure:   r.TLS != nil,
-			SameSite: http.SameSiteLaxMode,
-		}
-		http.SetCookie(w, &accessCookie)
-
-		refreshCookie := http.Cookie{
-			Name:     "refresh_token",
-			Value:    refreshToken.Token,
-			Path:     "/",
-			MaxAge:   int(cfg.Token.RefreshTokenMaxAge) * 60,
-			HttpOnly: true,
-			Secure:   r.TLS != nil,
-			SameSite: http.SameSiteLaxMode,
-		}
-		http.SetCookie(w, &refreshCookie)
-
-		loginCookie := http.Cookie{
-			Name:     "logged_in",
-			Value:    "true",
-			Path:     "/",
-			MaxAge:   int(cfg.Token.AccessTokenMaxAge) * 60,
-			Secure:   false,
-			HttpOnly: false,
-		}
-		http.SetCookie(w, &loginCookie)
-
-		response := envelope{
-			"status": "success",
+		// with totp the failures are only cleared once the second factor
+		// passes, otherwise each replay of the password buys more guesses
+		err = lockRepo.ClearFailures(models.AccountLoginLockKind, loginLockSubject(req.Email))
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
 		}
 
-		if cfg.AppEnv != "prod" {
-			response["data"] = envelope{
-				"access_token":  jwt.Token,
-				"refresh_token": refreshToken.Token,
+		response, err := startSession(w, r, cfg, sessionRepo, userRepo, auditRepo, user)
+		if err != nil {
+			switch {
+			case errors.Is(err, errAccountSuspended):
+				AccountSuspendedResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
 			}
+			return
 		}
 
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId: user.Id,
+			Action:  models.LoginAuditAction,
+		})
+
 		respondWithJSON(w, r, http.StatusOK, response)
 	}
 }
 
-func LogoutUser(cfg *config.Config, cacheRepo cache.CacheRepo, userRepo repositories.UserRepo) http.Handler {
+func LogoutUser(cfg *config.Config, sessionRepo repositories.SessionRepo, revocationRepo repositories.TokenRevocationRepo, userRepo repositories.UserRepo, auditRepo repositories.AuditRepo) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		refreshToken := r.CookiesNamed("refresh_token")
@@ -276,7 +333,20 @@ func LogoutUser(cfg *config.Config, cacheRepo cache.CacheRepo, userRepo reposito
 			return
 		}
 
-		_, err = cacheRepo.Delete(tokenClaims.TokenUuid)
+		session, err := sessionRepo.GetSessionByRefreshToken(tokenClaims.TokenUuid)
+		switch {
+		case err == nil:
+			err = sessionRepo.DeleteSession(session)
+			if err != nil {
+				ServerErrorResponse(w, r, err)
+				return
+			}
+		case !errors.Is(err, cache.ErrNotFound):
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		err = revokeAccessToken(cfg, revocationRepo, tools.ContextGetToken(r))
 		if err != nil {
 			ServerErrorResponse(w, r, err)
 			return
@@ -304,6 +374,11 @@ func LogoutUser(cfg *config.Config, cacheRepo cache.CacheRepo, userRepo reposito
 		}
 		http.SetCookie(w, &loginCookie)
 
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId: tokenClaims.UserID,
+			Action:  models.LogoutAuditAction,
+		})
+
 		respondWithJSON(w, r, http.StatusOK, envelope{
 			"status": "success",
 		})
@@ -311,7 +386,10 @@ func LogoutUser(cfg *config.Config, cacheRepo cache.CacheRepo, userRepo reposito
 	})
 }
 
-func RefreshUserAccessToken(cfg *config.Config, cache cache.CacheRepo, userRepo repositories.UserRepo) http.HandlerFunc {
+// RefreshUserAccessToken rotates the refresh token on every call, presenting
+// a refresh token that was already rotated revokes the session it belongs to
+// and every access token issued to it
+func RefreshUserAccessToken(cfg *config.Config, sessionRepo repositories.SessionRepo, revocationRepo repositories.TokenRevocationRepo, userRepo repositories.UserRepo, auditRepo repositories.AuditRepo) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		RefreshToken, err := r.Cookie("refresh_token")
@@ -333,21 +411,61 @@ func RefreshUserAccessToken(cfg *config.Config, cache cache.CacheRepo, userRepo
 			return
 		}
 
-		userIdStr, err := cache.Get(tokenClaims.TokenUuid)
+		session, err := sessionRepo.GetSessionByRefreshToken(tokenClaims.TokenUuid)
 		if err != nil {
+			switch {
+			case errors.Is(err, cache.ErrNotFound):
+				NotPermittedResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+		if session.UserId != tokenClaims.UserID {
 			NotPermittedResponse(w, r)
 			return
 		}
 
-		userId, err := strconv.Atoi(userIdStr)
+		user, err := userRepo.GetById(session.UserId)
 		if err != nil {
-			NotPermittedResponse(w, r)
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				NotPermittedResponse(w, r)
+			default:
+				ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+		if !user.SuspendedAt.IsZero() {
+			AccountSuspendedResponse(w, r)
 			return
 		}
-		user, err := userRepo.GetById(userId)
+
+		refreshToken, err := utils.CreateToken(user, session.Id, cfg.Token.RefreshTokenExpiredIn, cfg.Token.RefreshTokenPrivateKey)
+		if err != nil {
+			ServerErrorResponse(w, r, err)
+			return
+		}
+
+		session, err = sessionRepo.RotateRefreshToken(tokenClaims.TokenUuid, refreshToken.TokenUuid, ClientIP(r), r.UserAgent(), cfg.Token.RefreshTokenExpiredIn)
 		if err != nil {
 			switch {
-			case errors.Is(err, postgres.ErrNotFound):
+			case errors.Is(err, cache.ErrRefreshTokenReused):
+				// the session is gone, its access tokens have to go too or a
+				// thief keeps access until they expire
+				err = revocationRepo.RevokeSession(session.Id, cfg.Token.AccessTokenExpiredIn)
+				if err != nil {
+					ServerErrorResponse(w, r, err)
+					return
+				}
+				recordAudit(r, auditRepo, models.AuditEvent{
+					ActorId:    user.Id,
+					Action:     models.RefreshTokenReusedAuditAction,
+					TargetType: "session",
+					TargetId:   session.Id,
+				})
+				NotPermittedResponse(w, r)
+			case errors.Is(err, cache.ErrNotFound):
 				NotPermittedResponse(w, r)
 			default:
 				ServerErrorResponse(w, r, err)
@@ -355,7 +473,7 @@ func RefreshUserAccessToken(cfg *config.Config, cache cache.CacheRepo, userRepo
 			return
 		}
 
-		jwt, err := utils.CreateToken(user, cfg.Token.AccessTokenExpiredIn, cfg.Token.AccessTokenPrivateKey)
+		jwt, err := utils.CreateToken(user, session.Id, cfg.Token.AccessTokenExpiredIn, cfg.Token.AccessTokenPrivateKey)
 		if err != nil {
 			ServerErrorResponse(w, r, err)
 			return
@@ -372,6 +490,17 @@ func RefreshUserAccessToken(cfg *config.Config, cache cache.CacheRepo, userRepo
 		}
 		http.SetCookie(w, &accessCookie)
 
+		refreshCookie := http.Cookie{
+			Name:     "refresh_token",
+			Value:    refreshToken.Token,
+			Path:     "/",
+			MaxAge:   int(cfg.Token.RefreshTokenMaxAge) * 60,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		}
+		http.SetCookie(w, &refreshCookie)
+
 		loginCookie := http.Cookie{
 			Name:     "logged_in",
 			Value:    "true",
@@ -388,7 +517,8 @@ func RefreshUserAccessToken(cfg *config.Config, cache cache.CacheRepo, userRepo
 
 		if cfg.AppEnv != "prod" {
 			response["data"] = envelope{
-				"access_token": jwt.Token,
+				"access_token":  jwt.Token,
+				"refresh_token": refreshToken.Token,
 			}
 		}
 
@@ -396,3 +526,142 @@ func RefreshUserAccessToken(cfg *config.Config, cache cache.CacheRepo, userRepo
 
 	}
 }
+
+// errAccountSuspended is returned by startSession for suspended users
+var errAccountSuspended = errors.New("account suspended")
+
+// startSession creates a session for user, sets the auth cookies and returns
+// the response body of a successful sign in. Signing in while the account
+// waits for its purge cancels the deletion, suspended users can not sign in
+func startSession(w http.ResponseWriter, r *http.Request, cfg *config.Config, sessionRepo repositories.SessionRepo, userRepo repositories.UserRepo, auditRepo repositories.AuditRepo, user *models.User) (envelope, error) {
+	if !user.SuspendedAt.IsZero() {
+		return nil, errAccountSuspended
+	}
+
+	if !user.DeletedAt.IsZero() {
+		err := userRepo.CancelDeletion(user.Id)
+		if err != nil && !errors.Is(err, postgres.ErrNotFound) {
+			return nil, err
+		}
+		user.DeletedAt, user.PurgeAt = time.Time{}, time.Time{}
+
+		recordAudit(r, auditRepo, models.AuditEvent{
+			ActorId:    user.Id,
+			Action:     models.DeletionCancelledAuditAction,
+			TargetType: "user",
+			TargetId:   strconv.Itoa(user.Id),
+		})
+	}
+
+	sessionId, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	jwt, err := utils.CreateToken(user, sessionId.String(), cfg.Token.AccessTokenExpiredIn, cfg.Token.AccessTokenPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := utils.CreateToken(user, sessionId.String(), cfg.Token.RefreshTokenExpiredIn, cfg.Token.RefreshTokenPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	err = sessionRepo.CreateSession(&models.Session{
+		Id:         sessionId.String(),
+		UserId:     user.Id,
+		IP:         ClientIP(r),
+		UserAgent:  r.UserAgent(),
+		CreatedAt:  now,
+		LastUsedAt: now,
+	}, refreshToken.TokenUuid, cfg.Token.RefreshTokenExpiredIn)
+	if err != nil {
+		return nil, err
+	}
+
+	accessCookie := http.Cookie{
+		Name:     "jwt",
+		Value:    jwt.Token,
+		Path:     "/",
+		MaxAge:   int(cfg.Token.AccessTokenMaxAge) * 60,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+	http.SetCookie(w, &accessCookie)
+
+	refreshCookie := http.Cookie{
+		Name:     "refresh_token",
+		Value:    refreshToken.Token,
+		Path:     "/",
+		MaxAge:   int(cfg.Token.RefreshTokenMaxAge) * 60,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+	http.SetCookie(w, &refreshCookie)
+
+	loginCookie := http.Cookie{
+		Name:     "logged_in",
+		Value:    "true",
+		Path:     "/",
+		MaxAge:   int(cfg.Token.AccessTokenMaxAge) * 60,
+		Secure:   false,
+		HttpOnly: false,
+	}
+	http.SetCookie(w, &loginCookie)
+
+	response := envelope{
+		"status": "success",
+	}
+
+	if cfg.AppEnv != "prod" {
+		response["data"] = envelope{
+			"access_token":  jwt.Token,
+			"refresh_token": refreshToken.Token,
+		}
+	}
+
+	return response, nil
+}
+
+// revokeAccessToken denies the access token of the current request along
+// with every other access token of its session
+func revokeAccessToken(cfg *config.Config, revocationRepo repositories.TokenRevocationRepo, token *utils.TokenDetails) error {
+	if token.SessionId != "" {
+		return revocationRepo.RevokeSession(token.SessionId, cfg.Token.AccessTokenExpiredIn)
+	}
+	return revocationRepo.RevokeToken(token.TokenUuid, cfg.Token.AccessTokenExpiredIn)
+}
+
+// revokeUserSessions signs the user out everywhere, the sessions are deleted
+// so refresh tokens stop working and issued access tokens are denied
+func revokeUserSessions(cfg *config.Config, sessionRepo repositories.SessionRepo, revocationRepo repositories.TokenRevocationRepo, userId int) error {
+	if err := sessionRepo.DeleteUserSessions(userId); err != nil {
+		return err
+	}
+	return revocationRepo.RevokeUserTokens(userId, cfg.Token.AccessTokenExpiredIn)
+}
+
+// revokeEachSession signs the user out of the sessions they have now, one
+// session at a time, so a session started right after is left alone unlike
+// with revokeUserSessions
+func revokeEachSession(cfg *config.Config, sessionRepo repositories.SessionRepo, revocationRepo repositories.TokenRevocationRepo, userId int) error {
+	sessions, err := sessionRepo.ListUserSessions(userId)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if err := sessionRepo.DeleteSession(&session); err != nil {
+			return err
+		}
+		if err := revocationRepo.RevokeSession(session.Id, cfg.Token.AccessTokenExpiredIn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
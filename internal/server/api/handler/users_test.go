@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/utils"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+)
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	cfg := &config.Config{AppEnv: "dev"}
+	cfg.Token.AccessTokenPrivateKey, cfg.Token.AccessTokenPublicKey = generateTestKeys(t)
+	cfg.Token.RefreshTokenPrivateKey, cfg.Token.RefreshTokenPublicKey = generateTestKeys(t)
+	cfg.Token.AccessTokenExpiredIn = 15 * time.Minute
+	cfg.Token.RefreshTokenExpiredIn = time.Hour
+
+	user := &models.User{Id: 1, Email: "user@example.com", EmailVerified: true}
+	refreshToken, err := utils.CreateToken(user, "session-1", cfg.Token.RefreshTokenExpiredIn, cfg.Token.RefreshTokenPrivateKey)
+	if err != nil {
+		t.Fatalf("CreateToken() returned an unexpected error: %v", err)
+	}
+
+	sessionRepo := &fakeSessionRepo{
+		sessions:      map[string]models.Session{"session-1": {Id: "session-1", UserId: 1}},
+		refreshTokens: map[string]string{refreshToken.TokenUuid: "session-1"},
+		usedTokens:    map[string]bool{},
+	}
+	revocationRepo := newFakeRevocationRepo()
+	refresh := RefreshUserAccessToken(cfg, sessionRepo, revocationRepo, &fakeUserRepo{user: user}, &fakeAuditRepo{})
+
+	for i, status := range []int{http.StatusOK, http.StatusForbidden} {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh-token", nil)
+		r.AddCookie(&http.Cookie{Name: "refresh_token", Value: refreshToken.Token})
+		w := httptest.NewRecorder()
+
+		refresh.ServeHTTP(w, r)
+		if w.Code != status {
+			t.Fatalf("refresh %d: expected status %d, got %d: %s", i+1, status, w.Code, w.Body.String())
+		}
+	}
+
+	revoked, err := revocationRepo.IsTokenRevoked(1, "session-1", "access-token", time.Now())
+	if err != nil || !revoked {
+		t.Fatalf("Expected the access tokens of the reused session to be revoked, got %v, %v", revoked, err)
+	}
+}
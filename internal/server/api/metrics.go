@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/metrics"
+)
+
+type httpMetrics struct {
+	requests *metrics.Counter
+	duration *metrics.Histogram
+}
+
+func newHTTPMetrics(reg *metrics.Registry) *httpMetrics {
+	return &httpMetrics{
+		requests: reg.NewCounter("http_requests_total", "HTTP requests served by the api.", "route", "status"),
+		duration: reg.NewHistogram("http_request_duration_seconds", "Latency of HTTP requests served by the api.", metrics.DefaultBuckets, "route", "status"),
+	}
+}
+
+// observe records one request, route is the ServeMux pattern so path values
+// like ids don't create a series per request
+func (m *httpMetrics) observe(route string, statusCode int, seconds float64) {
+	if route == "" {
+		route = "unmatched"
+	}
+	status := strconv.Itoa(statusCode)
+
+	m.requests.Inc(route, status)
+	m.duration.Observe(seconds, route, status)
+}
+
+// ListenAndServeAdmin serves /metrics on the admin port, it is kept apart from
+// the api so it is not reachable from the internet
+func ListenAndServeAdmin(ctx context.Context, cfg *config.Config, metricsRegistry *metrics.Registry) error {
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metricsRegistry.Handler())
+
+	addr := net.JoinHostPort(cfg.AdminServer.Host, strconv.Itoa(cfg.AdminServer.Port))
+	httpServer := http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("admin server shutdown", slog.String("addr", addr), slog.Any("err", err))
+		}
+	}()
+
+	slog.Info("admin server started", slog.String("addr", addr))
+	err := httpServer.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
@@ -10,9 +10,21 @@ import (
 	"time"
 
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/handler"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/request"
 	tools "github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/utils"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/apikey"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/policy"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories/postgres"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/utils"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type logRespWriter struct {
@@ -29,15 +41,38 @@ func (lrw *logRespWriter) WriteHeader(code int) {
 	lrw.ResponseWriter.WriteHeader(code)
 }
 
-func NewLoggingMiddleware(next http.Handler) http.HandlerFunc {
+func NewLoggingMiddleware(next http.Handler, m *httpMetrics) http.HandlerFunc {
+	tracer := otel.Tracer("github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api")
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		lrw := NewLoggingResponseWriter(w)
 		startTime := time.Now()
 
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+		r = r.WithContext(ctx)
+
 		next.ServeHTTP(lrw, r)
 
 		duration := time.Since(startTime)
-		slog.Info("api info",
+		// the mux sets r.Pattern once it matched a route
+		m.observe(r.Pattern, lrw.statusCode, duration.Seconds())
+
+		if r.Pattern != "" {
+			span.SetName(r.Pattern)
+		}
+		span.SetAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("http.route", r.Pattern),
+			attribute.String("url.path", r.URL.Path),
+			attribute.Int("http.response.status_code", lrw.statusCode),
+		)
+		if lrw.statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(lrw.statusCode))
+		}
+
+		slog.InfoContext(ctx, "api info",
 			"status_code", lrw.statusCode,
 			"status", http.StatusText(lrw.statusCode),
 			"method", r.Method,
@@ -61,9 +96,9 @@ func RecoverPanic(next http.Handler) http.HandlerFunc {
 	}
 }
 
-func newAuthenticateAndVerifyMiddleware(cfg *config.Config) func(http.Handler) http.Handler {
+func newAuthenticateAndVerifyMiddleware(cfg *config.Config, revocationRepo repositories.TokenRevocationRepo) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
-		return authenticate(cfg, requireVerifiedUser(next))
+		return authenticate(cfg, revocationRepo, requireVerifiedUser(next))
 	}
 }
 
@@ -78,7 +113,105 @@ func requireVerifiedUser(next http.Handler) http.Handler {
 	})
 }
 
-func authenticate(cfg *config.Config, next http.Handler) http.Handler {
+// newAPIKeyMiddleware is like newAuthenticateAndVerifyMiddleware but also
+// lets api keys holding scope through
+func newAPIKeyMiddleware(cfg *config.Config, revocationRepo repositories.TokenRevocationRepo, apiKeyRepo repositories.APIRepo, keyUsage *apikey.UsageTracker, userRepo repositories.UserRepo) func(models.APIKeyScope, http.Handler) http.Handler {
+	return func(scope models.APIKeyScope, next http.Handler) http.Handler {
+		return authenticateAPIKey(cfg, revocationRepo, apiKeyRepo, keyUsage, userRepo, scope, requireVerifiedUser(next))
+	}
+}
+
+// authenticateAPIKey resolves an api key sent as a bearer token or in the
+// X-API-Key header into the same token details as an access token, other
+// requests go through authenticate. Keys only act on the routes of their
+// owner, an org key on the routes of its organization and a personal key
+// outside of organizations
+func authenticateAPIKey(cfg *config.Config, revocationRepo repositories.TokenRevocationRepo, apiKeyRepo repositories.APIRepo, keyUsage *apikey.UsageTracker, userRepo repositories.UserRepo, scope models.APIKeyScope, next http.Handler) http.Handler {
+	withToken := authenticate(cfg, revocationRepo, next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := readAPIKey(r)
+		if key == "" {
+			withToken.ServeHTTP(w, r)
+			return
+		}
+
+		apiKey, err := apiKeyRepo.GetAPIKey(utils.HashAPIKey(key))
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				handler.InvalidCredentialsResponse(w, r)
+			default:
+				handler.ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+		if !apiKey.ExpireAt.IsZero() && apiKey.ExpireAt.Before(time.Now()) {
+			handler.APIKeyExpiredResponse(w, r)
+			return
+		}
+		keyUsage.Touch(apiKey.Id, handler.ClientIP(r))
+
+		orgId := 0
+		if r.PathValue("org_id") != "" {
+			orgId, err = request.ReadIntParam(r, "org_id")
+			if err != nil {
+				handler.NotFoundResponse(w, r)
+				return
+			}
+		}
+		if apiKey.OrgId != orgId || !policy.HasScope(apiKey.Permissions, scope) {
+			handler.NotPermittedResponse(w, r)
+			return
+		}
+
+		user, err := userRepo.GetById(apiKey.UserId)
+		if err != nil {
+			switch {
+			case errors.Is(err, postgres.ErrNotFound):
+				handler.InvalidCredentialsResponse(w, r)
+			default:
+				handler.ServerErrorResponse(w, r, err)
+			}
+			return
+		}
+		if !user.DeletedAt.IsZero() {
+			handler.InvalidCredentialsResponse(w, r)
+			return
+		}
+		if !user.SuspendedAt.IsZero() {
+			handler.AccountSuspendedResponse(w, r)
+			return
+		}
+
+		// keys never carry admin rights, those need a signed in admin
+		r = tools.ContextSetToken(r, &utils.TokenDetails{
+			UserID:   user.Id,
+			Verified: user.EmailVerified,
+			APIKeyId: apiKey.Id,
+			Scopes:   apiKey.Permissions,
+		})
+		next.ServeHTTP(w, r)
+	})
+}
+
+// readAPIKey returns the api key of the request or an empty string when it
+// carries none
+func readAPIKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if ok && strings.HasPrefix(token, utils.APIKeyPrefix) {
+		return token
+	}
+	return ""
+}
+
+// authenticate accepts a valid access token that was not revoked through
+// logout, a password change or the deletion of its user
+func authenticate(cfg *config.Config, revocationRepo repositories.TokenRevocationRepo, next http.Handler) http.Handler {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -113,18 +246,79 @@ func authenticate(cfg *config.Config, next http.Handler) http.Handler {
 			return
 		}
 
+		revoked, err := revocationRepo.IsTokenRevoked(tokenDetail.UserID, tokenDetail.SessionId, tokenDetail.TokenUuid, time.UnixMilli(tokenDetail.IssuedAtMilli))
+		if err != nil {
+			handler.ServerErrorResponse(w, r, err)
+			return
+		}
+		if revoked {
+			handler.TokenRevokedResponse(w, r)
+			return
+		}
+
 		r = tools.ContextSetToken(r, tokenDetail)
 		next.ServeHTTP(w, r)
 	})
 }
 
-func adminOnly(next http.Handler) http.Handler {
+// requirePermission lets the request through when policy allows the user
+// to perform a service wide action
+func requirePermission(action policy.Action, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := tools.ContextGetToken(r)
+		if !policy.Can(policy.Subject{UserId: token.UserID, IsAdmin: token.IsAdmin}, action) {
+			handler.NotPermittedResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireOrgPermission checks action against the role of the user in the
+// organization of the {org_id} path value and stores the membership for the
+// handlers. Organizations the user is not a member of are reported as not
+// found
+func requireOrgPermission(orgRepo repositories.OrgRepo, action policy.Action, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgId, err := request.ReadIntParam(r, "org_id")
+		if err != nil {
+			handler.NotFoundResponse(w, r)
+			return
+		}
+
 		token := tools.ContextGetToken(r)
-		if !token.IsAdmin {
+
+		member, err := orgRepo.GetMember(orgId, token.UserID)
+		if err != nil {
+			if !errors.Is(err, postgres.ErrNotFound) {
+				handler.ServerErrorResponse(w, r, err)
+				return
+			}
+			if !token.IsAdmin {
+				handler.NotFoundResponse(w, r)
+				return
+			}
+
+			// admins act on organizations they are not part of
+			if _, err := orgRepo.GetOrg(orgId); err != nil {
+				switch {
+				case errors.Is(err, postgres.ErrNotFound):
+					handler.NotFoundResponse(w, r)
+				default:
+					handler.ServerErrorResponse(w, r, err)
+				}
+				return
+			}
+			member = &models.OrgMember{OrgId: orgId, UserId: token.UserID}
+		}
+
+		subject := policy.Subject{UserId: token.UserID, IsAdmin: token.IsAdmin, Role: member.Role}
+		if !policy.Can(subject, action) {
 			handler.NotPermittedResponse(w, r)
 			return
 		}
+
+		r = tools.ContextSetOrgMember(r, member)
 		next.ServeHTTP(w, r)
 	})
 }
@@ -151,9 +345,10 @@ func CORS(next http.Handler) http.Handler {
 			w.Header().Set("Access-Control-Allow-Credentials", "true")
 
 			// Add CORS headers for all requests (including OPTIONS)
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, X-API-Key")
 			w.Header().Set("Access-Control-Max-Age", "86400")
+			w.Header().Set("Access-Control-Expose-Headers", "RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After")
 
 			if r.Method == http.MethodOptions {
 				w.WriteHeader(http.StatusOK)
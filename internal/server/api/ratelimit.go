@@ -0,0 +1,140 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/handler"
+	tools "github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/utils"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+)
+
+// rateLimitPolicy allows limit requests per window for every value of key,
+// requests for which key returns an empty string are not counted
+type rateLimitPolicy struct {
+	name   string
+	limit  int
+	window time.Duration
+	key    func(r *http.Request) string
+}
+
+var (
+	signupLimits = []rateLimitPolicy{
+		{name: "signup:ip", limit: 10, window: time.Hour, key: byIP},
+	}
+	loginLimits = []rateLimitPolicy{
+		{name: "login:ip", limit: 30, window: time.Minute, key: byIP},
+		{name: "login:email", limit: 10, window: 15 * time.Minute, key: byEmail},
+	}
+	mfaLimits = []rateLimitPolicy{
+		{name: "mfa:ip", limit: 20, window: time.Minute, key: byIP},
+	}
+	refreshLimits = []rateLimitPolicy{
+		{name: "refresh:ip", limit: 60, window: time.Minute, key: byIP},
+	}
+	oauthLimits = []rateLimitPolicy{
+		{name: "oauth:ip", limit: 30, window: time.Minute, key: byIP},
+	}
+	sendOtpLimits = []rateLimitPolicy{
+		{name: "otp-send:ip", limit: 20, window: time.Hour, key: byIP},
+		{name: "otp-send:email", limit: 3, window: 10 * time.Minute, key: byEmail},
+	}
+	verifyOtpLimits = []rateLimitPolicy{
+		{name: "otp-verify:ip", limit: 30, window: time.Minute, key: byIP},
+		{name: "otp-verify:email", limit: 10, window: 15 * time.Minute, key: byEmail},
+	}
+	secondFactorLimits = []rateLimitPolicy{
+		{name: "second-factor:user", limit: 10, window: 15 * time.Minute, key: byUser},
+	}
+	passwordChangeLimits = []rateLimitPolicy{
+		{name: "password-change:user", limit: 10, window: 15 * time.Minute, key: byUser},
+	}
+	apiKeyCheckLimits = []rateLimitPolicy{
+		{name: "api-key-check:ip", limit: 60, window: time.Minute, key: byIP},
+	}
+)
+
+// rateLimit rejects requests once any of policies is exhausted. The
+// RateLimit headers describe the policy closest to its limit. When the
+// limiter is unreachable requests are let through, an outage of redis should
+// not lock everyone out
+func rateLimit(limiter repositories.RateLimiter, policies []rateLimitPolicy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var tightest *models.RateLimit
+		var rejected *models.RateLimit
+
+		for _, policy := range policies {
+			key := policy.key(r)
+			if key == "" {
+				continue
+			}
+
+			limit, err := limiter.Hit(policy.name+":"+key, policy.limit, policy.window)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "rate limiter unavailable", slog.String("policy", policy.name), slog.Any("err", err))
+				continue
+			}
+
+			if tightest == nil || limit.Remaining < tightest.Remaining {
+				tightest = limit
+			}
+			if !limit.Allowed && (rejected == nil || limit.Reset > rejected.Reset) {
+				rejected = limit
+			}
+		}
+
+		if tightest != nil {
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(tightest.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(tightest.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(tightest.Reset)))
+		}
+
+		if rejected != nil {
+			w.Header().Set("Retry-After", strconv.Itoa(seconds(rejected.Reset)))
+			handler.TooManyResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+func byIP(r *http.Request) string {
+	return handler.ClientIP(r)
+}
+
+// byUser must run after authenticate
+func byUser(r *http.Request) string {
+	return strconv.Itoa(tools.ContextGetToken(r).UserID)
+}
+
+// byEmail reads the email of a json body and puts the body back for the
+// handler
+func byEmail(r *http.Request) string {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1_048_576))
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(req.Email))
+}
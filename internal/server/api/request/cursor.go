@@ -0,0 +1,80 @@
+package request
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// CursorPage is a page of a list paged with keyset cursors. Cursor is the
+// next_cursor of the previous page as the client sent it, Valid decodes it
+// into After which stays nil for the first page
+type CursorPage struct {
+	Cursor string
+	Limit  int
+	After  *models.Cursor
+}
+
+func (p *CursorPage) Valid(ctx context.Context, v *Valid) *Valid {
+
+	v.Check(p.Limit > 0, "limit", "must be greater than zero")
+	v.Check(p.Limit <= 100, "limit", "must be a maximum of 100")
+
+	if p.Cursor != "" {
+		after, err := DecodeCursor(p.Cursor)
+		v.Check(err == nil, "cursor", "must be the next_cursor of a previous page")
+		p.After = after
+	}
+
+	return v
+}
+
+// EncodeCursor turns a position into the opaque string clients get back as
+// next_cursor
+func EncodeCursor(cursor models.Cursor) string {
+	// a cursor only holds plain values, marshaling it can not fail
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeCursor(s string) (*models.Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor models.Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+// Metadata describes a page next to the total number of records, NextCursor
+// is set when there are more records after the page
+type Metadata struct {
+	TotalRecords int    `json:"total_records"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	HasMore      bool   `json:"has_more"`
+}
+
+// Paginate cuts items down to the page, the list should be read with one row
+// more than limit so the extra row tells whether there is a next page.
+// cursor returns the position of an item
+func Paginate[T any](items []T, limit, total int, cursor func(T) models.Cursor) ([]T, Metadata) {
+	metadata := Metadata{TotalRecords: total}
+
+	if len(items) > limit {
+		items = items[:limit]
+		metadata.HasMore = true
+		metadata.NextCursor = EncodeCursor(cursor(items[len(items)-1]))
+	}
+
+	return items, metadata
+}
@@ -0,0 +1,60 @@
+package request
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	want := models.Cursor{Id: 42, Time: time.Date(2026, 10, 19, 9, 0, 0, 123, time.UTC), Value: "a@example.com", Sort: "email"}
+
+	got, err := DecodeCursor(EncodeCursor(want))
+	if err != nil {
+		t.Fatalf("DecodeCursor() returned an unexpected error: %v", err)
+	}
+	if got.Id != want.Id || !got.Time.Equal(want.Time) || got.Value != want.Value || got.Sort != want.Sort {
+		t.Fatalf("Expected %+v, got %+v", want, got)
+	}
+
+	for _, cursor := range []string{"not base64!", "bm90IGpzb24"} {
+		if _, err := DecodeCursor(cursor); err == nil {
+			t.Fatalf("Expected DecodeCursor(%q) to fail", cursor)
+		}
+	}
+}
+
+func TestCursorPageValid(t *testing.T) {
+	page := CursorPage{Cursor: EncodeCursor(models.Cursor{Id: 7}), Limit: 20}
+	if v := page.Valid(context.Background(), NewValidator()); !v.Valid() {
+		t.Fatalf("Expected a valid page, got %v", v.Errors)
+	}
+	if page.After == nil || page.After.Id != 7 {
+		t.Fatalf("Expected the cursor to be decoded, got %+v", page.After)
+	}
+
+	page = CursorPage{Cursor: "garbage!", Limit: 20}
+	if v := page.Valid(context.Background(), NewValidator()); v.Valid() {
+		t.Fatalf("Expected an invalid cursor to fail validation")
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	cursor := func(i int) models.Cursor { return models.Cursor{Id: int64(i)} }
+
+	items, metadata := Paginate([]int{1, 2, 3}, 2, 10, cursor)
+	if len(items) != 2 || !metadata.HasMore || metadata.TotalRecords != 10 {
+		t.Fatalf("Unexpected page %v, %+v", items, metadata)
+	}
+	next, err := DecodeCursor(metadata.NextCursor)
+	if err != nil || next.Id != 2 {
+		t.Fatalf("Expected the next cursor to point at the last item, got %+v, %v", next, err)
+	}
+
+	items, metadata = Paginate([]int{1, 2}, 2, 2, cursor)
+	if len(items) != 2 || metadata.HasMore || metadata.NextCursor != "" {
+		t.Fatalf("Expected the last page to have no next cursor, got %v, %+v", items, metadata)
+	}
+}
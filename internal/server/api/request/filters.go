@@ -2,19 +2,28 @@ package request
 
 import (
 	"context"
+	"slices"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
 )
 
-type Pagination struct {
-	Page  int
-	Limit int
+// UserFilters are the query parameters admins list users with, a cursor
+// only continues the sort it was made for
+type UserFilters struct {
+	CursorPage
+	models.UserFilter
 }
 
-func (f *Pagination) Valid(ctx context.Context, v *Valid) *Valid {
+var userSortSafelist = []string{"created_at", "-created_at", "email", "-email", "name", "-name"}
+
+func (f *UserFilters) Valid(ctx context.Context, v *Valid) *Valid {
 
-	v.Check(f.Page > 0, "page", "must be greater than zero")
-	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
-	v.Check(f.Limit > 0, "limit", "must be greater than zero")
-	v.Check(f.Limit <= 100, "limit", "must be a maximum of 100")
+	v = f.CursorPage.Valid(ctx, v)
+	v.Check(f.After == nil || f.After.Sort == f.Sort, "cursor", "cursor belongs to another sort")
+	v.Check(len(f.Search) <= 300, "search", "must be a maximum of 300 character")
+	v.Check(len(f.Plan) <= 50, "plan", "plan too long")
+	v.Check(slices.Contains(userSortSafelist, f.Sort), "sort", "must be one of created_at, email or name, prefixed with - to sort descending")
+	v.Check(f.CreatedAfter.IsZero() || f.CreatedBefore.IsZero() || f.CreatedAfter.Before(f.CreatedBefore), "created_after", "must be before created_before")
 
 	return v
 }
@@ -1,7 +1,13 @@
 package request
 
 import (
+	"encoding/base64"
 	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/policy"
 )
 
 func ValidEmail(v *Valid, email string) {
@@ -33,3 +39,78 @@ func ValidAlphanumeric(v *Valid, s string, fieldName string) {
 	}
 	v.Check(alphanumeric, fieldName, fieldName+" must contain only letters and numbers")
 }
+
+func ValidSubdomain(v *Valid, subdomain string) {
+	v.Check(subdomain != "", "subdomain", "subdomain should not be empty")
+	v.Check(len(subdomain) >= 3, "subdomain", "subdomain should be at least 3 character")
+	v.Check(len(subdomain) <= 63, "subdomain", "subdomain should be at most 63 character")
+
+	subdomainRegex := regexp.MustCompile("^[a-z0-9]([a-z0-9-]*[a-z0-9])?$")
+	v.Check(subdomainRegex.MatchString(subdomain), "subdomain", "subdomain must contain only lowercase letters, numbers and inner hyphens")
+}
+
+func ValidTotpCode(v *Valid, code string) {
+	v.Check(regexp.MustCompile("^[0-9]{6}$").MatchString(code), "code", "code must be 6 digits")
+}
+
+// ValidSecondFactor accepts a totp code or a recovery code
+func ValidSecondFactor(v *Valid, code string) {
+	v.Check(code != "", "code", "code should not be empty")
+	v.Check(len(code) <= 50, "code", "code too long")
+}
+
+func ValidOrgRole(v *Valid, role string) {
+	v.Check(policy.ValidRole(models.OrgRole(role)), "role", "role must be one of owner, admin, member or viewer")
+}
+
+func ValidScopes(v *Valid, scopes []string) {
+	for _, scope := range scopes {
+		v.Check(policy.ValidScope(scope), "scopes", "unknown scope "+scope)
+	}
+	v.Check(len(scopes) == len(slices.Compact(slices.Sorted(slices.Values(scopes)))), "scopes", "scopes must not repeat")
+}
+
+var labelKeyRX = regexp.MustCompile("^[a-z0-9]([a-z0-9_.-]{0,61}[a-z0-9])?$")
+
+func ValidLabels(v *Valid, labels map[string]string) {
+	v.Check(len(labels) <= 20, "labels", "must have at most 20 labels")
+	for key, value := range labels {
+		v.Check(labelKeyRX.MatchString(key), "labels", "label "+key+" must be lowercase letters, numbers and inner . _ -, at most 63 character")
+		v.Check(len(value) <= 255, "labels", "value of label "+key+" should be at most 255 character")
+	}
+}
+
+// ValidOtpLink checks the token of an emailed link, the base64 of the email
+// and the otp joined by a "|"
+func ValidOtpLink(v *Valid, otp string) {
+	v.Check(strings.TrimSpace(otp) != "", "email-otp", "otp should not be empty")
+	v.Check(len(otp) <= 200, "email-otp", "otp too long")
+
+	if v.Valid() {
+		decodedBytes, err := base64.StdEncoding.DecodeString(otp)
+		if err != nil {
+			v.AddError("email-otp", "otp format invalid")
+		} else {
+			decoded := string(decodedBytes)
+
+			if !strings.Contains(decoded, "|") {
+				v.AddError("email-otp", "otp format invalid")
+			} else {
+				parts := strings.SplitN(decoded, "|", 2)
+
+				if len(parts) != 2 {
+					v.AddError("email-otp", "otp format invalid")
+				}
+				email := strings.TrimSpace(parts[0])
+				token := parts[1]
+
+				ValidEmail(v, email)
+
+				if len(token) != 32 {
+					v.AddError("email-otp", "otp format invalid")
+				}
+				ValidAlphanumeric(v, token, "email-otp")
+			}
+		}
+	}
+}
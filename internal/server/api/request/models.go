@@ -2,9 +2,10 @@ package request
 
 import (
 	"context"
-	"encoding/base64"
 	"strings"
 	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/utils"
 )
 
 type User struct {
@@ -36,8 +37,10 @@ func (u *Login) Valid(ctx context.Context, v *Valid) *Valid {
 }
 
 type APIKeys struct {
-	Name      string    `json:"name"`
-	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	Name      string            `json:"name"`
+	ExpiresAt time.Time         `json:"expires_at,omitzero"`
+	Scopes    []string          `json:"scopes"`
+	Labels    map[string]string `json:"labels"`
 }
 
 func (u *APIKeys) Valid(ctx context.Context, v *Valid) *Valid {
@@ -45,6 +48,43 @@ func (u *APIKeys) Valid(ctx context.Context, v *Valid) *Valid {
 	if !u.ExpiresAt.IsZero() && u.ExpiresAt.Before(time.Now()) {
 		v.AddError("expires_at", "must be in the future")
 	}
+	ValidScopes(v, u.Scopes)
+	ValidLabels(v, u.Labels)
+
+	return v
+}
+
+// RotateAPIKey keeps the old secret working for OverlapMinutes so agents
+// can be switched over without downtime
+type RotateAPIKey struct {
+	OverlapMinutes int `json:"overlap_minutes"`
+}
+
+func (u *RotateAPIKey) Valid(ctx context.Context, v *Valid) *Valid {
+	v.Check(u.OverlapMinutes >= 0, "overlap_minutes", "must not be negative")
+	v.Check(u.OverlapMinutes <= 7*24*60, "overlap_minutes", "must be at most 7 days")
+	return v
+}
+
+type APIKeyLabels struct {
+	Labels map[string]string `json:"labels"`
+}
+
+func (u *APIKeyLabels) Valid(ctx context.Context, v *Valid) *Valid {
+	ValidLabels(v, u.Labels)
+	return v
+}
+
+// RevokeAPIKey is sent by whoever found a leaked key, usually a secret
+// scanner
+type RevokeAPIKey struct {
+	Key string `json:"api_key"`
+}
+
+func (u *RevokeAPIKey) Valid(ctx context.Context, v *Valid) *Valid {
+	v.Check(u.Key != "", "api_key", "api key should not be empty")
+	v.Check(len(u.Key) <= 200, "api_key", "api key too long")
+	v.Check(utils.ValidAPIKeyChecksum(u.Key), "api_key", "not an api key issued by this service")
 
 	return v
 }
@@ -77,39 +117,62 @@ func (u *VerifyUserOTP) Valid(ctx context.Context, v *Valid) *Valid {
 }
 
 func (u *ForgotPasswordVerify) Valid(ctx context.Context, v *Valid) *Valid {
+	ValidOtpLink(v, u.EmailOtp)
+	ValidPassword(v, u.Password)
+	return v
+}
 
-	v.Check(strings.TrimSpace(u.EmailOtp) != "", "email-otp", "otp should not be empty")
-	v.Check(len(u.EmailOtp) <= 200, "email-otp", "otp too long")
+type UnlockAccount struct {
+	EmailOtp string `json:"otp"`
+}
 
-	if v.Valid() {
-		decodedBytes, err := base64.StdEncoding.DecodeString(u.EmailOtp)
-		if err != nil {
-			v.AddError("email-otp", "otp format invalid")
-		} else {
-			decoded := string(decodedBytes)
-
-			if !strings.Contains(decoded, "|") {
-				v.AddError("email-otp", "otp format invalid")
-			} else {
-				parts := strings.SplitN(decoded, "|", 2)
-
-				if len(parts) != 2 {
-					v.AddError("email-otp", "otp format invalid")
-				}
-				email := strings.TrimSpace(parts[0])
-				token := parts[1]
-
-				ValidEmail(v, email)
-
-				if len(token) != 32 {
-					v.AddError("email-otp", "otp format invalid")
-				}
-				ValidAlphanumeric(v, token, "email-otp")
-			}
-		}
-	}
+func (u *UnlockAccount) Valid(ctx context.Context, v *Valid) *Valid {
+	ValidOtpLink(v, u.EmailOtp)
+	return v
+}
 
-	ValidPassword(v, u.Password)
+type UpdateProfile struct {
+	Name string `json:"name"`
+}
+
+func (u *UpdateProfile) Valid(ctx context.Context, v *Valid) *Valid {
+	ValidName(v, u.Name)
+	return v
+}
+
+type ChangePassword struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+func (u *ChangePassword) Valid(ctx context.Context, v *Valid) *Valid {
+	v.Check(u.CurrentPassword != "", "current_password", "current password should not be empty string")
+	ValidPassword(v, u.NewPassword)
+	v.Check(u.NewPassword != u.CurrentPassword, "password", "new password should differ from the current one")
+	return v
+}
+
+type ChangeEmail struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func (u *ChangeEmail) Valid(ctx context.Context, v *Valid) *Valid {
+	ValidEmail(v, u.Email)
+	v.Check(u.Password != "", "password", "password should not be empty string")
+	return v
+}
+
+// DeleteAccount is confirmed by either the password or an emailed otp
+type DeleteAccount struct {
+	Password string `json:"password"`
+	Otp      string `json:"otp"`
+}
+
+func (u *DeleteAccount) Valid(ctx context.Context, v *Valid) *Valid {
+	v.Check((u.Password == "") != (u.Otp == ""), "password", "either the password or the otp should be provided")
+	v.Check(len(u.Password) <= 50, "password", "lenght of password should be smaller then 50 character")
+	v.Check(len(u.Otp) <= 200, "otp", "otp too long")
 	return v
 }
 
@@ -123,3 +186,103 @@ func (u *VerifyAPIKey) Valid(ctx context.Context, v *Valid) *Valid {
 
 	return v
 }
+
+type ReservedDomain struct {
+	Subdomain string `json:"subdomain"`
+}
+
+func (u *ReservedDomain) Valid(ctx context.Context, v *Valid) *Valid {
+	ValidSubdomain(v, u.Subdomain)
+	return v
+}
+
+type UpdateUserPlan struct {
+	Plan string `json:"plan"`
+}
+
+func (u *UpdateUserPlan) Valid(ctx context.Context, v *Valid) *Valid {
+	v.Check(strings.TrimSpace(u.Plan) != "", "plan", "plan should not be empty")
+	v.Check(len(u.Plan) <= 50, "plan", "plan too long")
+	return v
+}
+
+type UpdateUserAdmin struct {
+	IsAdmin *bool `json:"is_admin"`
+}
+
+func (u *UpdateUserAdmin) Valid(ctx context.Context, v *Valid) *Valid {
+	v.Check(u.IsAdmin != nil, "is_admin", "is_admin must be provided")
+	return v
+}
+
+type TotpCode struct {
+	Code string `json:"code"`
+}
+
+func (u *TotpCode) Valid(ctx context.Context, v *Valid) *Valid {
+	ValidTotpCode(v, u.Code)
+	return v
+}
+
+type DisableTotp struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+func (u *DisableTotp) Valid(ctx context.Context, v *Valid) *Valid {
+	ValidPassword(v, u.Password)
+	ValidSecondFactor(v, u.Code)
+	return v
+}
+
+type VerifyMfa struct {
+	MfaToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+func (u *VerifyMfa) Valid(ctx context.Context, v *Valid) *Valid {
+	v.Check(strings.TrimSpace(u.MfaToken) != "", "mfa_token", "mfa token should not be empty")
+	v.Check(len(u.MfaToken) <= 100, "mfa_token", "mfa token too long")
+	ValidSecondFactor(v, u.Code)
+	return v
+}
+
+type Organization struct {
+	Name string `json:"name"`
+}
+
+func (u *Organization) Valid(ctx context.Context, v *Valid) *Valid {
+	v.Check(strings.TrimSpace(u.Name) != "", "name", "name should not be empty string")
+	v.Check(len(u.Name) <= 100, "name", "name should be less then 100 character")
+	return v
+}
+
+type OrgInvitation struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+func (u *OrgInvitation) Valid(ctx context.Context, v *Valid) *Valid {
+	ValidEmail(v, u.Email)
+	ValidOrgRole(v, u.Role)
+	return v
+}
+
+type UpdateOrgMember struct {
+	Role string `json:"role"`
+}
+
+func (u *UpdateOrgMember) Valid(ctx context.Context, v *Valid) *Valid {
+	ValidOrgRole(v, u.Role)
+	return v
+}
+
+type AcceptOrgInvitation struct {
+	Token string `json:"token"`
+}
+
+func (u *AcceptOrgInvitation) Valid(ctx context.Context, v *Valid) *Valid {
+	v.Check(strings.TrimSpace(u.Token) != "", "token", "token should not be empty")
+	v.Check(len(u.Token) <= 100, "token", "token too long")
+	return v
+}
@@ -5,13 +5,18 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 func ReadIDParam(r *http.Request) (int, error) {
+	return ReadIntParam(r, "id")
+}
+
+func ReadIntParam(r *http.Request, name string) (int, error) {
 
-	id, err := strconv.Atoi(r.PathValue("id"))
+	id, err := strconv.Atoi(r.PathValue(name))
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, errors.New("invalid " + name + " parameter")
 	}
 
 	return id, nil
@@ -29,3 +34,42 @@ func ReadInt(r *http.Request, v *Valid, key string, defaultValue int) int {
 	}
 	return value
 }
+
+func ReadString(r *http.Request, key string, defaultValue string) string {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// ReadBool returns nil when the query parameter is missing
+func ReadBool(r *http.Request, v *Valid, key string) *bool {
+	valueStr := r.URL.Query().Get(key)
+	if valueStr == "" {
+		return nil
+	}
+	value, err := strconv.ParseBool(valueStr)
+	if err != nil {
+		v.AddError(key, fmt.Sprintf("query parameter '%s' must be true or false", key))
+		return nil
+	}
+	return &value
+}
+
+// ReadTime accepts an rfc3339 time or a date, it returns the zero time when
+// the query parameter is missing
+func ReadTime(r *http.Request, v *Valid, key string) time.Time {
+	valueStr := r.URL.Query().Get(key)
+	if valueStr == "" {
+		return time.Time{}
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		value, err := time.Parse(layout, valueStr)
+		if err == nil {
+			return value
+		}
+	}
+	v.AddError(key, fmt.Sprintf("query parameter '%s' must be a rfc3339 time or a date", key))
+	return time.Time{}
+}
@@ -4,35 +4,125 @@ import (
 	"net/http"
 
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/api/handler"
-	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/cache"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/apikey"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/mailer"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/oauth"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/policy"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
 )
 
-func AddRoute(mux *http.ServeMux, cfg *config.Config, cacheRepo cache.CacheRepo, userRepo repositories.UserRepo, apiKeyRepo repositories.APIRepo, emailOtpRepo repositories.EmailOtpRepo) {
+func AddRoute(mux *http.ServeMux, cfg *config.Config, sessionRepo repositories.SessionRepo, revocationRepo repositories.TokenRevocationRepo, rateLimiter repositories.RateLimiter, userRepo repositories.UserRepo, identityRepo repositories.IdentityRepo, orgRepo repositories.OrgRepo, totpRepo repositories.TotpRepo, mfaRepo repositories.MfaRepo, lockRepo repositories.LoginLockRepo, oauthStateRepo repositories.OAuthStateRepo, apiKeyRepo repositories.APIRepo, keyUsage *apikey.UsageTracker, emailOtpRepo repositories.EmailOtpRepo, planRepo repositories.PlanRepo, domainRepo repositories.DomainRepo, usageRepo repositories.UsageRepo, tunnelRepo repositories.TunnelRepo, accessLogRepo repositories.AccessLogRepo, auditRepo repositories.AuditRepo, m mailer.Mailer, providers oauth.Providers) {
 
 	// general
 	mux.HandleFunc("/", handler.HandleRoot())
 	mux.HandleFunc("GET /api/v1/healthcheck", handler.HealthCheck(cfg))
 
+	limited := func(policies []rateLimitPolicy, next http.Handler) http.Handler {
+		return rateLimit(rateLimiter, policies, next)
+	}
+
 	// users
-	requireVerified := newAuthenticateAndVerifyMiddleware(cfg)
+	requireVerified := newAuthenticateAndVerifyMiddleware(cfg, revocationRepo)
+	requireKey := newAPIKeyMiddleware(cfg, revocationRepo, apiKeyRepo, keyUsage, userRepo)
 	mux.Handle("GET /api/v1/users/me", requireVerified(handler.GetUsers(userRepo)))
-	mux.Handle("DELETE /api/v1/users/{id}", requireVerified(adminOnly(handler.DeleteUser(userRepo))))
-	mux.Handle("GET /api/v1/users", requireVerified(adminOnly(handler.ListUsers(userRepo))))
-	mux.Handle("POST /api/v1/users/email/send-verfication", handler.SendEmailVerficationOtp(cfg, userRepo, emailOtpRepo))
-	mux.Handle("POST /api/v1/users/email/verify-verfication", handler.VerifyEmailVerficationOtp(cfg, userRepo, emailOtpRepo))
-	mux.Handle("POST /api/v1/users/passsword/forgot/send-otp", handler.SendForgotPasswordLink(cfg, userRepo, emailOtpRepo))
-	mux.Handle("POST /api/v1/users/password/forgot/verify-otp", handler.VerifyForgotPasswordLink(cfg, userRepo, emailOtpRepo))
-
-	mux.Handle("POST /api/v1/auth/signup", handler.SignupUser(userRepo))
-	mux.Handle("POST /api/v1/auth/login", handler.AuthenticateUser(cfg, cacheRepo, userRepo))
-	mux.Handle("POST /api/v1/auth/refresh-token", handler.RefreshUserAccessToken(cfg, cacheRepo, userRepo))
-	mux.Handle("POST /api/v1/auth/logout", authenticate(cfg, handler.LogoutUser(cfg, cacheRepo, userRepo)))
+	mux.Handle("DELETE /api/v1/users/{id}", requireVerified(requirePermission(policy.ManageUsersAction, handler.DeleteUser(cfg, userRepo, sessionRepo, revocationRepo, auditRepo))))
+	mux.Handle("GET /api/v1/users", requireVerified(requirePermission(policy.ManageUsersAction, handler.ListUsers(userRepo))))
+	mux.Handle("PUT /api/v1/users/{id}/plan", requireVerified(requirePermission(policy.ManageUsersAction, handler.UpdateUserPlan(userRepo, planRepo))))
+	mux.Handle("POST /api/v1/users/{id}/suspend", requireVerified(requirePermission(policy.ManageUsersAction, handler.SuspendUser(cfg, userRepo, sessionRepo, revocationRepo, tunnelRepo, auditRepo))))
+	mux.Handle("POST /api/v1/users/{id}/unsuspend", requireVerified(requirePermission(policy.ManageUsersAction, handler.UnsuspendUser(userRepo, auditRepo))))
+	mux.Handle("PUT /api/v1/users/{id}/admin", requireVerified(requirePermission(policy.ManageUsersAction, handler.UpdateUserAdmin(cfg, userRepo, sessionRepo, revocationRepo, auditRepo))))
+	mux.Handle("POST /api/v1/users/{id}/verify-email", requireVerified(requirePermission(policy.ManageUsersAction, handler.ForceVerifyEmail(userRepo, auditRepo))))
+	mux.Handle("GET /api/v1/login-locks", requireVerified(requirePermission(policy.ManageUsersAction, handler.ListLoginLocks(lockRepo))))
+	mux.Handle("DELETE /api/v1/login-locks/{kind}/{subject}", requireVerified(requirePermission(policy.ManageUsersAction, handler.ClearLoginLock(lockRepo, auditRepo))))
+	mux.Handle("PATCH /api/v1/users/me", requireVerified(handler.UpdateProfile(userRepo, auditRepo)))
+	mux.Handle("POST /api/v1/users/me/password", requireVerified(limited(passwordChangeLimits, handler.ChangePassword(cfg, userRepo, sessionRepo, revocationRepo, auditRepo))))
+	mux.Handle("POST /api/v1/users/me/email", requireVerified(limited(sendOtpLimits, handler.SendEmailChangeOtp(cfg, userRepo, emailOtpRepo, m))))
+	mux.Handle("POST /api/v1/users/me/email/verify", requireVerified(limited(verifyOtpLimits, handler.VerifyEmailChangeOtp(cfg, userRepo, emailOtpRepo, auditRepo))))
+	mux.Handle("DELETE /api/v1/users/me", requireVerified(limited(passwordChangeLimits, handler.DeleteAccount(cfg, userRepo, orgRepo, emailOtpRepo, sessionRepo, revocationRepo, tunnelRepo, auditRepo))))
+	mux.Handle("POST /api/v1/users/me/delete-otp", requireVerified(limited(sendOtpLimits, handler.SendAccountDeletionOtp(cfg, userRepo, emailOtpRepo, m))))
+	mux.Handle("GET /api/v1/users/me/export", requireVerified(handler.ExportAccount(userRepo, identityRepo, orgRepo, apiKeyRepo, domainRepo, usageRepo, sessionRepo, auditRepo)))
+	mux.Handle("GET /api/v1/users/me/2fa", requireVerified(handler.GetTotpStatus(totpRepo)))
+	mux.Handle("POST /api/v1/users/me/2fa/totp", requireVerified(handler.EnrollTotp(userRepo, totpRepo)))
+	mux.Handle("POST /api/v1/users/me/2fa/totp/confirm", requireVerified(limited(secondFactorLimits, handler.ConfirmTotp(cfg, totpRepo, auditRepo))))
+	mux.Handle("POST /api/v1/users/me/2fa/recovery-codes", requireVerified(limited(secondFactorLimits, handler.RegenerateRecoveryCodes(cfg, totpRepo, auditRepo))))
+	mux.Handle("DELETE /api/v1/users/me/2fa", requireVerified(limited(secondFactorLimits, handler.DisableTotp(cfg, userRepo, totpRepo, auditRepo))))
+	mux.Handle("GET /api/v1/users/me/identities", requireVerified(handler.ListIdentities(providers, identityRepo)))
+	mux.Handle("POST /api/v1/users/me/identities/{provider}", requireVerified(handler.LinkIdentity(providers, oauthStateRepo)))
+	mux.Handle("DELETE /api/v1/users/me/identities/{id}", requireVerified(handler.UnlinkIdentity(identityRepo, auditRepo)))
+	mux.Handle("POST /api/v1/users/email/send-verfication", limited(sendOtpLimits, handler.SendEmailVerficationOtp(cfg, userRepo, emailOtpRepo, m)))
+	mux.Handle("POST /api/v1/users/email/verify-verfication", limited(verifyOtpLimits, handler.VerifyEmailVerficationOtp(cfg, userRepo, emailOtpRepo, auditRepo)))
+	mux.Handle("POST /api/v1/users/passsword/forgot/send-otp", limited(sendOtpLimits, handler.SendForgotPasswordLink(cfg, userRepo, emailOtpRepo, m)))
+	mux.Handle("POST /api/v1/users/password/forgot/verify-otp", limited(verifyOtpLimits, handler.VerifyForgotPasswordLink(cfg, userRepo, emailOtpRepo, sessionRepo, revocationRepo, auditRepo)))
+
+	mux.Handle("POST /api/v1/auth/signup", limited(signupLimits, handler.SignupUser(userRepo)))
+	mux.Handle("POST /api/v1/auth/login", limited(loginLimits, handler.AuthenticateUser(cfg, sessionRepo, userRepo, totpRepo, mfaRepo, lockRepo, emailOtpRepo, auditRepo, m)))
+	mux.Handle("POST /api/v1/auth/email/send-login-otp", limited(sendOtpLimits, handler.SendLoginOtp(cfg, userRepo, emailOtpRepo, m)))
+	mux.Handle("POST /api/v1/auth/email/verify-login-otp", limited(verifyOtpLimits, handler.VerifyLoginOtp(cfg, sessionRepo, userRepo, totpRepo, mfaRepo, lockRepo, emailOtpRepo, auditRepo, m)))
+	mux.Handle("POST /api/v1/auth/unlock/send-otp", limited(sendOtpLimits, handler.SendUnlockAccountLink(cfg, userRepo, lockRepo, emailOtpRepo, m)))
+	mux.Handle("POST /api/v1/auth/unlock/verify-otp", limited(verifyOtpLimits, handler.VerifyUnlockAccountLink(cfg, lockRepo, emailOtpRepo, auditRepo)))
+	mux.Handle("POST /api/v1/auth/mfa/verify", limited(mfaLimits, handler.VerifyMfa(cfg, sessionRepo, userRepo, totpRepo, mfaRepo, lockRepo, emailOtpRepo, auditRepo, m)))
+	mux.Handle("GET /api/v1/auth/oauth/{provider}", limited(oauthLimits, handler.StartOAuthLogin(providers, oauthStateRepo)))
+	mux.Handle("GET /api/v1/auth/oauth/{provider}/callback", limited(oauthLimits, handler.OAuthCallback(cfg, providers, oauthStateRepo, sessionRepo, revocationRepo, userRepo, identityRepo, totpRepo, mfaRepo, auditRepo)))
+	mux.Handle("POST /api/v1/auth/refresh-token", limited(refreshLimits, handler.RefreshUserAccessToken(cfg, sessionRepo, revocationRepo, userRepo, auditRepo)))
+	mux.Handle("POST /api/v1/auth/logout", authenticate(cfg, revocationRepo, handler.LogoutUser(cfg, sessionRepo, revocationRepo, userRepo, auditRepo)))
+
+	mux.Handle("GET /api/v1/sessions", requireVerified(handler.ListSessions(sessionRepo)))
+	mux.Handle("DELETE /api/v1/sessions", requireVerified(handler.RevokeSessions(cfg, sessionRepo, revocationRepo, auditRepo)))
+	mux.Handle("DELETE /api/v1/sessions/{id}", requireVerified(handler.RevokeSession(cfg, sessionRepo, revocationRepo, auditRepo)))
 
 	mux.Handle("GET /api/v1/api-key", requireVerified(handler.ListAPIKey(apiKeyRepo)))
-	mux.Handle("POST /api/v1/api-key", requireVerified(handler.CreateAPIKey(apiKeyRepo)))
-	mux.Handle("DELETE /api/v1/api-key/{id}", requireVerified(handler.DeleteAPIKey(apiKeyRepo)))
-	mux.Handle("POST /api/v1/api-key/valid", handler.VerifyAPIKey(apiKeyRepo))
+	mux.Handle("POST /api/v1/api-key", requireVerified(handler.CreateAPIKey(apiKeyRepo, auditRepo)))
+	mux.Handle("DELETE /api/v1/api-key/{id}", requireVerified(handler.DeleteAPIKey(apiKeyRepo, auditRepo)))
+	mux.Handle("POST /api/v1/api-key/{id}/rotate", requireVerified(handler.RotateAPIKey(apiKeyRepo, auditRepo)))
+	mux.Handle("PUT /api/v1/api-key/{id}/labels", requireVerified(handler.UpdateAPIKeyLabels(apiKeyRepo)))
+	mux.Handle("POST /api/v1/api-key/valid", limited(apiKeyCheckLimits, handler.VerifyAPIKey(apiKeyRepo)))
+	mux.Handle("POST /api/v1/api-key/revoke", limited(apiKeyCheckLimits, handler.RevokeLeakedAPIKey(userRepo, apiKeyRepo, tunnelRepo, auditRepo, m)))
+
+	// organizations
+	requireOrg := func(action policy.Action, next http.Handler) http.Handler {
+		return requireVerified(requireOrgPermission(orgRepo, action, next))
+	}
+	requireOrgKey := func(scope models.APIKeyScope, action policy.Action, next http.Handler) http.Handler {
+		return requireKey(scope, requireOrgPermission(orgRepo, action, next))
+	}
+	mux.Handle("GET /api/v1/orgs", requireVerified(handler.ListOrgs(orgRepo)))
+	mux.Handle("POST /api/v1/orgs", requireVerified(handler.CreateOrg(orgRepo, auditRepo)))
+	mux.Handle("GET /api/v1/orgs/{org_id}", requireOrg(policy.ViewOrgAction, handler.GetOrg(orgRepo)))
+	mux.Handle("PUT /api/v1/orgs/{org_id}", requireOrg(policy.ManageOrgAction, handler.RenameOrg(orgRepo)))
+	mux.Handle("DELETE /api/v1/orgs/{org_id}", requireOrg(policy.ManageOrgAction, handler.DeleteOrg(orgRepo, auditRepo)))
+	mux.Handle("GET /api/v1/orgs/{org_id}/members", requireOrg(policy.ViewOrgAction, handler.ListOrgMembers(orgRepo)))
+	mux.Handle("PUT /api/v1/orgs/{org_id}/members/{user_id}", requireOrg(policy.ManageMembersAction, handler.UpdateOrgMember(orgRepo, auditRepo)))
+	mux.Handle("DELETE /api/v1/orgs/{org_id}/members/{user_id}", requireOrg(policy.ViewOrgAction, handler.RemoveOrgMember(orgRepo, auditRepo)))
+	mux.Handle("GET /api/v1/orgs/{org_id}/invitations", requireOrg(policy.ManageMembersAction, handler.ListOrgInvitations(orgRepo)))
+	mux.Handle("POST /api/v1/orgs/{org_id}/invitations", requireOrg(policy.ManageMembersAction, handler.CreateOrgInvitation(cfg, userRepo, orgRepo, auditRepo, m)))
+	mux.Handle("DELETE /api/v1/orgs/{org_id}/invitations/{id}", requireOrg(policy.ManageMembersAction, handler.DeleteOrgInvitation(orgRepo)))
+	mux.Handle("POST /api/v1/invitations/accept", requireVerified(handler.AcceptOrgInvitation(cfg, userRepo, orgRepo, auditRepo)))
+
+	mux.Handle("GET /api/v1/orgs/{org_id}/api-key", requireOrg(policy.ViewResourcesAction, handler.ListAPIKey(apiKeyRepo)))
+	mux.Handle("POST /api/v1/orgs/{org_id}/api-key", requireOrg(policy.ManageResourcesAction, handler.CreateAPIKey(apiKeyRepo, auditRepo)))
+	mux.Handle("DELETE /api/v1/orgs/{org_id}/api-key/{id}", requireOrg(policy.ManageResourcesAction, handler.DeleteAPIKey(apiKeyRepo, auditRepo)))
+	mux.Handle("POST /api/v1/orgs/{org_id}/api-key/{id}/rotate", requireOrg(policy.ManageResourcesAction, handler.RotateAPIKey(apiKeyRepo, auditRepo)))
+	mux.Handle("PUT /api/v1/orgs/{org_id}/api-key/{id}/labels", requireOrg(policy.ManageResourcesAction, handler.UpdateAPIKeyLabels(apiKeyRepo)))
+	mux.Handle("GET /api/v1/orgs/{org_id}/domains", requireOrgKey(models.DomainsReadScope, policy.ViewResourcesAction, handler.ListDomains(domainRepo)))
+	mux.Handle("POST /api/v1/orgs/{org_id}/domains", requireOrgKey(models.DomainsWriteScope, policy.ManageResourcesAction, handler.CreateDomain(cfg, userRepo, planRepo, domainRepo)))
+	mux.Handle("DELETE /api/v1/orgs/{org_id}/domains/{id}", requireOrgKey(models.DomainsWriteScope, policy.ManageResourcesAction, handler.DeleteDomain(domainRepo)))
+	mux.Handle("GET /api/v1/orgs/{org_id}/tunnels", requireOrgKey(models.APIReadScope, policy.ViewResourcesAction, handler.ListTunnels(tunnelRepo)))
+
+	mux.Handle("GET /api/v1/audit", requireVerified(handler.ListAuditEvents(auditRepo)))
+
+	mux.Handle("GET /api/v1/plans", requireKey(models.APIReadScope, handler.ListPlans(planRepo)))
+	mux.Handle("GET /api/v1/usage", requireKey(models.APIReadScope, handler.ListUsage(usageRepo)))
+
+	mux.Handle("GET /api/v1/domains", requireKey(models.DomainsReadScope, handler.ListDomains(domainRepo)))
+	mux.Handle("POST /api/v1/domains", requireKey(models.DomainsWriteScope, handler.CreateDomain(cfg, userRepo, planRepo, domainRepo)))
+	mux.Handle("DELETE /api/v1/domains/{id}", requireKey(models.DomainsWriteScope, handler.DeleteDomain(domainRepo)))
+
+	mux.Handle("GET /api/v1/tunnels", requireKey(models.APIReadScope, handler.ListTunnels(tunnelRepo)))
+	mux.Handle("GET /api/v1/tunnels/all", requireVerified(requirePermission(policy.ManageAllTunnelsAction, handler.ListAllTunnels(tunnelRepo))))
+	mux.Handle("DELETE /api/v1/tunnels/{id}", requireVerified(handler.DisconnectTunnel(tunnelRepo, orgRepo)))
+	mux.Handle("GET /api/v1/tunnels/{id}/access-logs", requireKey(models.APIReadScope, handler.ListAccessLogs(accessLogRepo)))
+	mux.Handle("GET /api/v1/tunnels/{id}/access-logs/export", requireKey(models.APIReadScope, handler.ExportAccessLogs(accessLogRepo)))
 
 }
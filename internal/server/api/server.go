@@ -3,18 +3,21 @@ package api
 import (
 	"net/http"
 
-	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/cache"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/apikey"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/mailer"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/oauth"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/metrics"
 )
 
-func NewHTTPServer(cfg *config.Config, cacheRepo cache.CacheRepo, userRepo repositories.UserRepo, apiKeyRepo repositories.APIRepo, emailOtpRepo repositories.EmailOtpRepo) http.Handler {
+func NewHTTPServer(cfg *config.Config, metricsRegistry *metrics.Registry, sessionRepo repositories.SessionRepo, revocationRepo repositories.TokenRevocationRepo, rateLimiter repositories.RateLimiter, userRepo repositories.UserRepo, identityRepo repositories.IdentityRepo, orgRepo repositories.OrgRepo, totpRepo repositories.TotpRepo, mfaRepo repositories.MfaRepo, lockRepo repositories.LoginLockRepo, oauthStateRepo repositories.OAuthStateRepo, apiKeyRepo repositories.APIRepo, keyUsage *apikey.UsageTracker, emailOtpRepo repositories.EmailOtpRepo, planRepo repositories.PlanRepo, domainRepo repositories.DomainRepo, usageRepo repositories.UsageRepo, tunnelRepo repositories.TunnelRepo, accessLogRepo repositories.AccessLogRepo, auditRepo repositories.AuditRepo, m mailer.Mailer, providers oauth.Providers) http.Handler {
 
 	mux := http.NewServeMux()
-	AddRoute(mux, cfg, cacheRepo, userRepo, apiKeyRepo, emailOtpRepo)
+	AddRoute(mux, cfg, sessionRepo, revocationRepo, rateLimiter, userRepo, identityRepo, orgRepo, totpRepo, mfaRepo, lockRepo, oauthStateRepo, apiKeyRepo, keyUsage, emailOtpRepo, planRepo, domainRepo, usageRepo, tunnelRepo, accessLogRepo, auditRepo, m, providers)
 
 	var handler http.Handler = mux
-	handler = CORS(RecoverPanic(NewLoggingMiddleware(handler)))
+	handler = CORS(RecoverPanic(NewLoggingMiddleware(handler, newHTTPMetrics(metricsRegistry))))
 
 	return handler
 }
@@ -4,12 +4,16 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/utils"
 )
 
 type contextKey string
 
-const tokenContextKey = contextKey("tokenDetails")
+const (
+	tokenContextKey     = contextKey("tokenDetails")
+	orgMemberContextKey = contextKey("orgMember")
+)
 
 func ContextSetToken(r *http.Request, token *utils.TokenDetails) *http.Request {
 	ctx := context.WithValue(r.Context(), tokenContextKey, token)
@@ -24,3 +28,15 @@ func ContextGetToken(r *http.Request) *utils.TokenDetails {
 
 	return token
 }
+
+func ContextSetOrgMember(r *http.Request, member *models.OrgMember) *http.Request {
+	ctx := context.WithValue(r.Context(), orgMemberContextKey, member)
+	return r.WithContext(ctx)
+}
+
+// ContextGetOrgMember returns nil outside of organization routes, handlers
+// shared by personal and org routes use it to pick the owner
+func ContextGetOrgMember(r *http.Request) *models.OrgMember {
+	member, _ := r.Context().Value(orgMemberContextKey).(*models.OrgMember)
+	return member
+}
@@ -0,0 +1,76 @@
+// Package apikey keeps track of when and from where api keys were last used.
+package apikey
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+)
+
+const usageFlushInterval = 30 * time.Second
+
+// UsageTracker collects the uses of api keys and writes them in batches, a
+// key authenticating many requests between two flushes is written once with
+// its latest use
+type UsageTracker struct {
+	apiKeyRepo repositories.APIRepo
+
+	mu      sync.Mutex
+	pending map[int]models.APIKeyUse
+}
+
+func NewUsageTracker(apiKeyRepo repositories.APIRepo) *UsageTracker {
+	return &UsageTracker{
+		apiKeyRepo: apiKeyRepo,
+		pending:    make(map[int]models.APIKeyUse),
+	}
+}
+
+// Touch records that keyId authenticated a request from ip, it never blocks
+// on the database
+func (t *UsageTracker) Touch(keyId int, ip string) {
+	t.mu.Lock()
+	t.pending[keyId] = models.APIKeyUse{KeyId: keyId, Ip: ip, UsedAt: time.Now()}
+	t.mu.Unlock()
+}
+
+// Run flushes the recorded uses until ctx is cancelled and once more after
+func (t *UsageTracker) Run(ctx context.Context) error {
+
+	ticker := time.NewTicker(usageFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			t.Flush()
+			return nil
+		case <-ticker.C:
+			t.Flush()
+		}
+	}
+}
+
+// Flush writes the uses recorded since the last flush, when that fails they
+// are dropped, the next use of a key records it again
+func (t *UsageTracker) Flush() {
+	t.mu.Lock()
+	if len(t.pending) == 0 {
+		t.mu.Unlock()
+		return
+	}
+	uses := make([]models.APIKeyUse, 0, len(t.pending))
+	for _, use := range t.pending {
+		uses = append(uses, use)
+	}
+	t.pending = make(map[int]models.APIKeyUse)
+	t.mu.Unlock()
+
+	if err := t.apiKeyRepo.RecordAPIKeyUses(uses); err != nil {
+		slog.Error("failed to record api key uses", slog.Int("count", len(uses)), slog.Any("err", err))
+	}
+}
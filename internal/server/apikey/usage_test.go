@@ -0,0 +1,47 @@
+package apikey
+
+import (
+	"testing"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/repositories"
+)
+
+type recordingRepo struct {
+	repositories.APIRepo
+	batches [][]models.APIKeyUse
+}
+
+func (r *recordingRepo) RecordAPIKeyUses(uses []models.APIKeyUse) error {
+	r.batches = append(r.batches, uses)
+	return nil
+}
+
+func TestUsageTrackerFlush(t *testing.T) {
+	repo := &recordingRepo{}
+	tracker := NewUsageTracker(repo)
+
+	tracker.Flush()
+	if len(repo.batches) != 0 {
+		t.Fatalf("Expected nothing to be written without uses, got %d batches", len(repo.batches))
+	}
+
+	tracker.Touch(1, "10.0.0.1")
+	tracker.Touch(2, "10.0.0.2")
+	tracker.Touch(1, "10.0.0.3")
+	tracker.Flush()
+
+	if len(repo.batches) != 1 || len(repo.batches[0]) != 2 {
+		t.Fatalf("Expected one batch with 2 keys, got %v", repo.batches)
+	}
+	for _, use := range repo.batches[0] {
+		if use.KeyId == 1 && use.Ip != "10.0.0.3" {
+			t.Fatalf("Expected the latest use of key 1, got ip %s", use.Ip)
+		}
+	}
+
+	tracker.Flush()
+	if len(repo.batches) != 1 {
+		t.Fatalf("Expected flushed uses to not be written again, got %d batches", len(repo.batches))
+	}
+}
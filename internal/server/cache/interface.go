@@ -1,9 +1,26 @@
 package cache
 
-import "time"
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("record not found")
+)
 
 type CacheRepo interface {
 	Get(key string) (string, error)
 	Set(key string, value any, exp time.Duration) error
+	SetNX(key string, value any, exp time.Duration) (bool, error)
 	Delete(key string) (bool, error)
+	// Increment adds one to the counter at key and returns the new value,
+	// exp is set on every call
+	Increment(key string, exp time.Duration) (int64, error)
+	SetAdd(key string, members ...string) error
+	SetRemove(key string, members ...string) error
+	SetMembers(key string) ([]string, error)
+	Publish(channel string, message string) error
+	Subscribe(ctx context.Context, channel string) (<-chan string, error)
 }
@@ -0,0 +1,203 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+)
+
+const (
+	loginFailuresKeyPrefix    = "login-failures:"
+	lastLoginFailureKeyPrefix = "login-failures:last:"
+	loginLockKeyPrefix        = "login-locks:"
+	lockedLoginsKey           = "login-locks"
+	loginLockSubjectSeparator = "|"
+)
+
+// loginLockRepo counts failures with one counter per account or ip that
+// expires a window after the last failure, next to the time of that failure
+// for the progressive delay. Locks are indexed in a set so admins can list
+// them, members of expired locks are pruned while listing
+type loginLockRepo struct {
+	cache CacheRepo
+}
+
+func NewLoginLockRepo(cacheRepo CacheRepo) (*loginLockRepo, error) {
+	if cacheRepo == nil {
+		return nil, errors.New("no cache repo provided")
+	}
+
+	return &loginLockRepo{
+		cache: cacheRepo,
+	}, nil
+}
+
+func (l *loginLockRepo) RecordFailure(kind models.LoginLockKind, subject string, window time.Duration) (*models.LoginFailures, error) {
+	count, err := l.cache.Increment(loginFailuresKey(kind, subject), window)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count login failure: %w", err)
+	}
+
+	now := time.Now().UTC()
+	if err := l.cache.Set(lastLoginFailureKey(kind, subject), now.UnixNano(), window); err != nil {
+		return nil, fmt.Errorf("failed to save login failure: %w", err)
+	}
+
+	return &models.LoginFailures{
+		Count:        int(count),
+		LastFailedAt: now,
+	}, nil
+}
+
+// GetFailures returns zero failures when there were none within the window
+func (l *loginLockRepo) GetFailures(kind models.LoginLockKind, subject string) (*models.LoginFailures, error) {
+	failures := &models.LoginFailures{}
+
+	count, err := l.cache.Get(loginFailuresKey(kind, subject))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return failures, nil
+		}
+		return nil, err
+	}
+	failures.Count, err = strconv.Atoi(count)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode login failures: %w", err)
+	}
+
+	last, err := l.cache.Get(lastLoginFailureKey(kind, subject))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return failures, nil
+		}
+		return nil, err
+	}
+	nanos, err := strconv.ParseInt(last, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode last login failure: %w", err)
+	}
+	failures.LastFailedAt = time.Unix(0, nanos).UTC()
+
+	return failures, nil
+}
+
+func (l *loginLockRepo) ClearFailures(kind models.LoginLockKind, subject string) error {
+	if _, err := l.cache.Delete(loginFailuresKey(kind, subject)); err != nil {
+		return fmt.Errorf("failed to clear login failures: %w", err)
+	}
+	if _, err := l.cache.Delete(lastLoginFailureKey(kind, subject)); err != nil {
+		return fmt.Errorf("failed to clear login failures: %w", err)
+	}
+	return nil
+}
+
+func (l *loginLockRepo) Lock(lock *models.LoginLock) error {
+	ttl := time.Until(lock.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(lock)
+	if err != nil {
+		return fmt.Errorf("failed to encode login lock: %w", err)
+	}
+
+	if err := l.cache.Set(loginLockKey(lock.Kind, lock.Subject), data, ttl); err != nil {
+		return fmt.Errorf("failed to save login lock: %w", err)
+	}
+	if err := l.cache.SetAdd(lockedLoginsKey, loginLockMember(lock.Kind, lock.Subject)); err != nil {
+		return fmt.Errorf("failed to index login lock: %w", err)
+	}
+
+	return nil
+}
+
+func (l *loginLockRepo) GetLock(kind models.LoginLockKind, subject string) (*models.LoginLock, error) {
+	data, err := l.cache.Get(loginLockKey(kind, subject))
+	if err != nil {
+		return nil, err
+	}
+
+	var lock models.LoginLock
+	if err := json.Unmarshal([]byte(data), &lock); err != nil {
+		return nil, fmt.Errorf("failed to decode login lock: %w", err)
+	}
+
+	return &lock, nil
+}
+
+func (l *loginLockRepo) ListLocks() ([]models.LoginLock, error) {
+	members, err := l.cache.SetMembers(lockedLoginsKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list login locks: %w", err)
+	}
+
+	locks := []models.LoginLock{}
+	var stale []string
+	for _, member := range members {
+		kind, subject, ok := strings.Cut(member, loginLockSubjectSeparator)
+		if !ok {
+			stale = append(stale, member)
+			continue
+		}
+
+		lock, err := l.GetLock(models.LoginLockKind(kind), subject)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				stale = append(stale, member)
+				continue
+			}
+			return nil, err
+		}
+		locks = append(locks, *lock)
+	}
+
+	if len(stale) > 0 {
+		if err := l.cache.SetRemove(lockedLoginsKey, stale...); err != nil {
+			return nil, fmt.Errorf("failed to prune expired login locks: %w", err)
+		}
+	}
+
+	return locks, nil
+}
+
+// Unlock drops the lock together with the failures that led to it, it
+// returns ErrNotFound when there was no lock
+func (l *loginLockRepo) Unlock(kind models.LoginLockKind, subject string) error {
+	deleted, err := l.cache.Delete(loginLockKey(kind, subject))
+	if err != nil {
+		return fmt.Errorf("failed to delete login lock: %w", err)
+	}
+	if err := l.cache.SetRemove(lockedLoginsKey, loginLockMember(kind, subject)); err != nil {
+		return fmt.Errorf("failed to remove login lock index: %w", err)
+	}
+	if err := l.ClearFailures(kind, subject); err != nil {
+		return err
+	}
+
+	if !deleted {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func loginLockMember(kind models.LoginLockKind, subject string) string {
+	return string(kind) + loginLockSubjectSeparator + subject
+}
+
+func loginFailuresKey(kind models.LoginLockKind, subject string) string {
+	return loginFailuresKeyPrefix + loginLockMember(kind, subject)
+}
+
+func lastLoginFailureKey(kind models.LoginLockKind, subject string) string {
+	return lastLoginFailureKeyPrefix + loginLockMember(kind, subject)
+}
+
+func loginLockKey(kind models.LoginLockKind, subject string) string {
+	return loginLockKeyPrefix + loginLockMember(kind, subject)
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+)
+
+func TestLoginLocks(t *testing.T) {
+	repo, err := NewLoginLockRepo(newMemoryCache())
+	if err != nil {
+		t.Fatalf("NewLoginLockRepo() returned an unexpected error: %v", err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		failures, err := repo.RecordFailure(models.AccountLoginLockKind, "a@example.com", time.Hour)
+		if err != nil {
+			t.Fatalf("RecordFailure() returned an unexpected error: %v", err)
+		}
+		if failures.Count != i {
+			t.Fatalf("Expected %d failures, got %d", i, failures.Count)
+		}
+	}
+
+	failures, err := repo.GetFailures(models.AccountLoginLockKind, "a@example.com")
+	if err != nil || failures.Count != 3 || failures.LastFailedAt.IsZero() {
+		t.Fatalf("Unexpected failures %+v, %v", failures, err)
+	}
+	failures, err = repo.GetFailures(models.IPLoginLockKind, "a@example.com")
+	if err != nil || failures.Count != 0 {
+		t.Fatalf("Expected the failures of an ip to be counted apart, got %+v, %v", failures, err)
+	}
+
+	lock := &models.LoginLock{
+		Kind:      models.IPLoginLockKind,
+		Subject:   "2001:db8::1",
+		Failures:  3,
+		LockedAt:  time.Now(),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	if err := repo.Lock(lock); err != nil {
+		t.Fatalf("Lock() returned an unexpected error: %v", err)
+	}
+
+	locks, err := repo.ListLocks()
+	if err != nil {
+		t.Fatalf("ListLocks() returned an unexpected error: %v", err)
+	}
+	if len(locks) != 1 || locks[0].Subject != "2001:db8::1" || locks[0].Kind != models.IPLoginLockKind {
+		t.Fatalf("Unexpected locks %+v", locks)
+	}
+
+	if err := repo.Unlock(models.IPLoginLockKind, "2001:db8::1"); err != nil {
+		t.Fatalf("Unlock() returned an unexpected error: %v", err)
+	}
+	if _, err := repo.GetLock(models.IPLoginLockKind, "2001:db8::1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound after unlocking, got %v", err)
+	}
+	if err := repo.Unlock(models.IPLoginLockKind, "2001:db8::1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected unlocking twice to fail with ErrNotFound, got %v", err)
+	}
+
+	if err := repo.Unlock(models.AccountLoginLockKind, "a@example.com"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound for an account that was not locked, got %v", err)
+	}
+	failures, err = repo.GetFailures(models.AccountLoginLockKind, "a@example.com")
+	if err != nil || failures.Count != 0 {
+		t.Fatalf("Expected Unlock to clear the failures, got %+v, %v", failures, err)
+	}
+}
@@ -0,0 +1,133 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/utils"
+)
+
+const (
+	mfaChallengeKeyPrefix = "mfa-challenges:"
+	mfaAttemptsKeyPrefix  = "mfa-challenges:attempts:"
+	// wrong codes allowed per challenge, the user has to sign in with the
+	// password again afterwards
+	maxMfaAttempts = 5
+)
+
+// mfaRepo keeps the challenges of users that passed the password check and
+// still have to enter a second factor
+type mfaRepo struct {
+	cache CacheRepo
+}
+
+func NewMfaRepo(cacheRepo CacheRepo) (*mfaRepo, error) {
+	if cacheRepo == nil {
+		return nil, errors.New("no cache repo provided")
+	}
+
+	return &mfaRepo{
+		cache: cacheRepo,
+	}, nil
+}
+
+func (m *mfaRepo) CreateChallenge(userId int, ttl time.Duration) (*models.MfaChallenge, error) {
+	challenge := &models.MfaChallenge{
+		Token:     utils.GenerateToken(32),
+		UserId:    userId,
+		ExpiresAt: time.Now().Add(ttl).UTC(),
+	}
+
+	if err := m.save(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+func (m *mfaRepo) GetChallenge(token string) (*models.MfaChallenge, error) {
+	data, err := m.cache.Get(mfaChallengeKey(token))
+	if err != nil {
+		return nil, err
+	}
+
+	var challenge models.MfaChallenge
+	if err := json.Unmarshal([]byte(data), &challenge); err != nil {
+		return nil, fmt.Errorf("failed to decode mfa challenge: %w", err)
+	}
+
+	attempts, err := m.cache.Get(mfaAttemptsKey(token))
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if attempts != "" {
+		challenge.Attempts, err = strconv.Atoi(attempts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode mfa attempts: %w", err)
+		}
+	}
+	// a guess racing the one that used up the attempts sees no challenge
+	if challenge.Attempts >= maxMfaAttempts {
+		return nil, ErrNotFound
+	}
+
+	return &challenge, nil
+}
+
+// FailChallenge counts a wrong code and drops the challenge once it ran out
+// of attempts. The attempts live in their own counter so concurrent guesses
+// on the same challenge are all counted.
+func (m *mfaRepo) FailChallenge(challenge *models.MfaChallenge) error {
+	ttl := time.Until(challenge.ExpiresAt)
+	if ttl <= 0 {
+		return m.DeleteChallenge(challenge.Token)
+	}
+
+	attempts, err := m.cache.Increment(mfaAttemptsKey(challenge.Token), ttl)
+	if err != nil {
+		return fmt.Errorf("failed to count mfa attempt: %w", err)
+	}
+	challenge.Attempts = int(attempts)
+	if attempts >= maxMfaAttempts {
+		return m.DeleteChallenge(challenge.Token)
+	}
+	return nil
+}
+
+func (m *mfaRepo) DeleteChallenge(token string) error {
+	if _, err := m.cache.Delete(mfaChallengeKey(token)); err != nil {
+		return fmt.Errorf("failed to delete mfa challenge: %w", err)
+	}
+	if _, err := m.cache.Delete(mfaAttemptsKey(token)); err != nil {
+		return fmt.Errorf("failed to delete mfa attempts: %w", err)
+	}
+	return nil
+}
+
+func (m *mfaRepo) save(challenge *models.MfaChallenge) error {
+	ttl := time.Until(challenge.ExpiresAt)
+	if ttl <= 0 {
+		return m.DeleteChallenge(challenge.Token)
+	}
+
+	data, err := json.Marshal(challenge)
+	if err != nil {
+		return fmt.Errorf("failed to encode mfa challenge: %w", err)
+	}
+
+	if err := m.cache.Set(mfaChallengeKey(challenge.Token), data, ttl); err != nil {
+		return fmt.Errorf("failed to save mfa challenge: %w", err)
+	}
+	return nil
+}
+
+func mfaChallengeKey(token string) string {
+	return mfaChallengeKeyPrefix + token
+}
+
+func mfaAttemptsKey(token string) string {
+	return mfaAttemptsKeyPrefix + token
+}
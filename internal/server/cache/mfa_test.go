@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFailChallengeCountsConcurrentGuesses(t *testing.T) {
+	cache := newMemoryCache()
+	repo, err := NewMfaRepo(cache)
+	if err != nil {
+		t.Fatalf("NewMfaRepo() returned an unexpected error: %v", err)
+	}
+
+	challenge, err := repo.CreateChallenge(7, time.Minute)
+	if err != nil {
+		t.Fatalf("CreateChallenge() returned an unexpected error: %v", err)
+	}
+
+	// every guess loaded the challenge before any of them failed it
+	for i := 0; i < maxMfaAttempts; i++ {
+		loaded, err := repo.GetChallenge(challenge.Token)
+		if err != nil {
+			t.Fatalf("GetChallenge() before attempt %d returned an unexpected error: %v", i+1, err)
+		}
+		if loaded.Attempts != i {
+			t.Fatalf("Expected %d attempts before attempt %d, got %d", i, i+1, loaded.Attempts)
+		}
+		stale := *challenge
+		if err := repo.FailChallenge(&stale); err != nil {
+			t.Fatalf("FailChallenge() returned an unexpected error: %v", err)
+		}
+	}
+
+	_, err = repo.GetChallenge(challenge.Token)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected the challenge to be gone after %d wrong codes, got %v", maxMfaAttempts, err)
+	}
+	if _, ok := cache.values[mfaAttemptsKey(challenge.Token)]; ok {
+		t.Fatalf("Expected the attempts counter to be deleted with the challenge")
+	}
+}
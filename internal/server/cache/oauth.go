@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+)
+
+const oauthStateKeyPrefix = "oauth-states:"
+
+type oauthStateRepo struct {
+	cache CacheRepo
+}
+
+func NewOAuthStateRepo(cacheRepo CacheRepo) (*oauthStateRepo, error) {
+	if cacheRepo == nil {
+		return nil, errors.New("no cache repo provided")
+	}
+
+	return &oauthStateRepo{
+		cache: cacheRepo,
+	}, nil
+}
+
+func (o *oauthStateRepo) SaveState(state string, data *models.OAuthState, ttl time.Duration) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode oauth state: %w", err)
+	}
+
+	if err := o.cache.Set(oauthStateKey(state), encoded, ttl); err != nil {
+		return fmt.Errorf("failed to save oauth state: %w", err)
+	}
+	return nil
+}
+
+// TakeState deletes the state while reading it so a callback can not be
+// replayed, only the caller whose delete removed the key gets the state
+func (o *oauthStateRepo) TakeState(state string) (*models.OAuthState, error) {
+	encoded, err := o.cache.Get(oauthStateKey(state))
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := o.cache.Delete(oauthStateKey(state))
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete oauth state: %w", err)
+	}
+	if !deleted {
+		return nil, ErrNotFound
+	}
+
+	var data models.OAuthState
+	if err := json.Unmarshal([]byte(encoded), &data); err != nil {
+		return nil, fmt.Errorf("failed to decode oauth state: %w", err)
+	}
+
+	return &data, nil
+}
+
+func oauthStateKey(state string) string {
+	return oauthStateKeyPrefix + state
+}
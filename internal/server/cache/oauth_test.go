@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+)
+
+func TestTakeStateOnce(t *testing.T) {
+	repo, err := NewOAuthStateRepo(newMemoryCache())
+	if err != nil {
+		t.Fatalf("NewOAuthStateRepo() returned an unexpected error: %v", err)
+	}
+
+	err = repo.SaveState("state", &models.OAuthState{Provider: "github", Verifier: "verifier", LinkUserId: 7}, time.Minute)
+	if err != nil {
+		t.Fatalf("SaveState() returned an unexpected error: %v", err)
+	}
+
+	state, err := repo.TakeState("state")
+	if err != nil {
+		t.Fatalf("TakeState() returned an unexpected error: %v", err)
+	}
+	if state.Provider != "github" || state.Verifier != "verifier" || state.LinkUserId != 7 {
+		t.Fatalf("TakeState() returned %+v", state)
+	}
+
+	_, err = repo.TakeState("state")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected a second TakeState() to fail with ErrNotFound, got %v", err)
+	}
+}
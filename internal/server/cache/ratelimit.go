@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+)
+
+const rateLimitKeyPrefix = "rate-limit:"
+
+// rateLimiter is a sliding window counter: hits are counted in fixed
+// windows and the previous window is weighted by how much of it still
+// overlaps the sliding window. Two keys per limit instead of one entry per
+// hit, at the cost of assuming the previous window's hits were spread evenly
+type rateLimiter struct {
+	cache CacheRepo
+	now   func() time.Time
+}
+
+func NewRateLimiter(cacheRepo CacheRepo) (*rateLimiter, error) {
+	if cacheRepo == nil {
+		return nil, errors.New("no cache repo provided")
+	}
+
+	return &rateLimiter{
+		cache: cacheRepo,
+		now:   time.Now,
+	}, nil
+}
+
+func (l *rateLimiter) Hit(key string, limit int, window time.Duration) (*models.RateLimit, error) {
+	now := l.now()
+	index := now.UnixNano() / int64(window)
+	elapsed := time.Duration(now.UnixNano() % int64(window))
+
+	current, err := l.cache.Increment(rateLimitKey(key, index), 2*window)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count rate limit hit: %w", err)
+	}
+
+	var previous int64
+	value, err := l.cache.Get(rateLimitKey(key, index-1))
+	switch {
+	case errors.Is(err, ErrNotFound):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read rate limit window: %w", err)
+	default:
+		previous, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit count %q: %w", value, err)
+		}
+	}
+
+	overlap := 1 - float64(elapsed)/float64(window)
+	count := int(math.Ceil(float64(previous)*overlap)) + int(current)
+
+	return &models.RateLimit{
+		Allowed:   count <= limit,
+		Limit:     limit,
+		Remaining: max(limit-count, 0),
+		Reset:     window - elapsed,
+	}, nil
+}
+
+func rateLimitKey(key string, index int64) string {
+	return rateLimitKeyPrefix + key + ":" + strconv.FormatInt(index, 10)
+}
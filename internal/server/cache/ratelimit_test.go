@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterSlidingWindow(t *testing.T) {
+	limiter, err := NewRateLimiter(newMemoryCache())
+	if err != nil {
+		t.Fatalf("NewRateLimiter() returned an unexpected error: %v", err)
+	}
+	now := time.Unix(0, 0).Add(time.Hour)
+	limiter.now = func() time.Time { return now }
+
+	for i := range 3 {
+		limit, err := limiter.Hit("login:1.2.3.4", 3, time.Minute)
+		if err != nil {
+			t.Fatalf("Hit() returned an unexpected error: %v", err)
+		}
+		if !limit.Allowed || limit.Remaining != 2-i {
+			t.Fatalf("Expected hit %d to be allowed with %d remaining, got %+v", i+1, 2-i, limit)
+		}
+	}
+
+	limit, _ := limiter.Hit("login:1.2.3.4", 3, time.Minute)
+	if limit.Allowed {
+		t.Fatalf("Expected the 4th hit in a window to be rejected")
+	}
+	if other, _ := limiter.Hit("login:5.6.7.8", 3, time.Minute); !other.Allowed {
+		t.Fatalf("Expected other keys to have their own limit")
+	}
+
+	// halfway into the next window half of the previous hits still count
+	now = now.Add(90 * time.Second)
+	limit, _ = limiter.Hit("login:1.2.3.4", 3, time.Minute)
+	if !limit.Allowed || limit.Remaining != 0 {
+		t.Fatalf("Expected 2 of the 4 previous hits to still count, got %+v", limit)
+	}
+	if limit.Reset != 30*time.Second {
+		t.Fatalf("Expected the window to reset in 30s, got %s", limit.Reset)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if limit, _ := limiter.Hit("login:1.2.3.4", 3, time.Minute); !limit.Allowed || limit.Remaining != 2 {
+		t.Fatalf("Expected a fresh window after the limit passed, got %+v", limit)
+	}
+}
@@ -6,13 +6,14 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/cache"
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
 
 	"github.com/redis/go-redis/v9"
 )
 
 var (
-	ErrNotFound = errors.New("record not found")
+	ErrNotFound = cache.ErrNotFound
 )
 
 type redisRepo struct {
@@ -55,6 +56,10 @@ func (r *redisRepo) Set(key string, value any, exp time.Duration) error {
 	return r.client.Set(context.Background(), key, value, exp).Err()
 }
 
+func (r *redisRepo) SetNX(key string, value any, exp time.Duration) (bool, error) {
+	return r.client.SetNX(context.Background(), key, value, exp).Result()
+}
+
 func (r *redisRepo) Delete(key string) (bool, error) {
 	cmd := r.client.Del(context.Background(), key)
 	if cmd.Err() != nil {
@@ -62,3 +67,75 @@ func (r *redisRepo) Delete(key string) (bool, error) {
 	}
 	return cmd.Val() > 0, nil
 }
+
+func (r *redisRepo) Increment(key string, exp time.Duration) (int64, error) {
+	var incr *redis.IntCmd
+	_, err := r.client.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(context.Background(), key)
+		pipe.Expire(context.Background(), key, exp)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+func (r *redisRepo) SetAdd(key string, members ...string) error {
+	return r.client.SAdd(context.Background(), key, toAny(members)...).Err()
+}
+
+func (r *redisRepo) SetRemove(key string, members ...string) error {
+	return r.client.SRem(context.Background(), key, toAny(members)...).Err()
+}
+
+func (r *redisRepo) SetMembers(key string) ([]string, error) {
+	return r.client.SMembers(context.Background(), key).Result()
+}
+
+func (r *redisRepo) Publish(channel string, message string) error {
+	return r.client.Publish(context.Background(), channel, message).Err()
+}
+
+// Subscribe delivers messages published on channel until ctx is cancelled,
+// the returned channel is closed when the subscription ends
+func (r *redisRepo) Subscribe(ctx context.Context, channel string) (<-chan string, error) {
+	sub := r.client.Subscribe(ctx, channel)
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, fmt.Errorf("redis subscribe failed: %w", err)
+	}
+
+	messages := make(chan string)
+	go func() {
+		defer close(messages)
+		defer sub.Close()
+
+		ch := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				select {
+				case messages <- msg.Payload:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return messages, nil
+}
+
+func toAny(values []string) []any {
+	result := make([]any, len(values))
+	for i, v := range values {
+		result[i] = v
+	}
+	return result
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	revokedTokenKeyPrefix   = "revoked-tokens:"
+	revokedSessionKeyPrefix = "revoked-tokens:session:"
+	revokedUserKeyPrefix    = "revoked-tokens:user:"
+)
+
+// tokenRevocationRepo denies access tokens before they expire, either one
+// token, every token of a session or every token a user was issued before a
+// point in time. Entries only have to outlive the access tokens they deny so
+// ttl is the access token lifetime.
+type tokenRevocationRepo struct {
+	cache CacheRepo
+}
+
+func NewTokenRevocationRepo(cacheRepo CacheRepo) (*tokenRevocationRepo, error) {
+	if cacheRepo == nil {
+		return nil, errors.New("no cache repo provided")
+	}
+
+	return &tokenRevocationRepo{
+		cache: cacheRepo,
+	}, nil
+}
+
+func (t *tokenRevocationRepo) RevokeToken(tokenUuid string, ttl time.Duration) error {
+	if err := t.cache.Set(revokedTokenKeyPrefix+tokenUuid, 1, ttl); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	return nil
+}
+
+func (t *tokenRevocationRepo) RevokeSession(sessionId string, ttl time.Duration) error {
+	if err := t.cache.Set(revokedSessionKeyPrefix+sessionId, 1, ttl); err != nil {
+		return fmt.Errorf("failed to revoke session tokens: %w", err)
+	}
+	return nil
+}
+
+// RevokeUserTokens denies every token of userId issued before now. The
+// cutoff is kept in milliseconds so a token issued right after the
+// revocation, in the same second, stays valid.
+func (t *tokenRevocationRepo) RevokeUserTokens(userId int, ttl time.Duration) error {
+	cutoff := time.Now().UnixMilli()
+	if err := t.cache.Set(revokedUserKeyPrefix+strconv.Itoa(userId), cutoff, ttl); err != nil {
+		return fmt.Errorf("failed to revoke user tokens: %w", err)
+	}
+	return nil
+}
+
+func (t *tokenRevocationRepo) IsTokenRevoked(userId int, sessionId, tokenUuid string, issuedAt time.Time) (bool, error) {
+	if revoked, err := t.exists(revokedTokenKeyPrefix + tokenUuid); err != nil || revoked {
+		return revoked, err
+	}
+
+	if sessionId != "" {
+		if revoked, err := t.exists(revokedSessionKeyPrefix + sessionId); err != nil || revoked {
+			return revoked, err
+		}
+	}
+
+	value, err := t.cache.Get(revokedUserKeyPrefix + strconv.Itoa(userId))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	cutoff, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("invalid revocation cutoff %q: %w", value, err)
+	}
+
+	return issuedAt.UnixMilli() < cutoff, nil
+}
+
+func (t *tokenRevocationRepo) exists(key string) (bool, error) {
+	_, err := t.cache.Get(key)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsTokenRevoked(t *testing.T) {
+	repo, err := NewTokenRevocationRepo(newMemoryCache())
+	if err != nil {
+		t.Fatalf("NewTokenRevocationRepo() returned an unexpected error: %v", err)
+	}
+
+	issuedAt := time.Now().Add(-time.Minute)
+
+	if err := repo.RevokeSession("session-1", time.Hour); err != nil {
+		t.Fatalf("RevokeSession() returned an unexpected error: %v", err)
+	}
+	if err := repo.RevokeToken("token-1", time.Hour); err != nil {
+		t.Fatalf("RevokeToken() returned an unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		userId    int
+		sessionId string
+		tokenUuid string
+		issuedAt  time.Time
+		revoked   bool
+	}{
+		{"valid token", 1, "session-2", "token-2", issuedAt, false},
+		{"revoked token", 1, "", "token-1", issuedAt, true},
+		{"revoked session", 1, "session-1", "token-3", issuedAt, true},
+	}
+	for _, tt := range tests {
+		revoked, err := repo.IsTokenRevoked(tt.userId, tt.sessionId, tt.tokenUuid, tt.issuedAt)
+		if err != nil {
+			t.Fatalf("%s: IsTokenRevoked() returned an unexpected error: %v", tt.name, err)
+		}
+		if revoked != tt.revoked {
+			t.Fatalf("%s: expected revoked to be %v, got %v", tt.name, tt.revoked, revoked)
+		}
+	}
+
+	if err := repo.RevokeUserTokens(1, time.Hour); err != nil {
+		t.Fatalf("RevokeUserTokens() returned an unexpected error: %v", err)
+	}
+
+	revoked, err := repo.IsTokenRevoked(1, "session-2", "token-2", issuedAt)
+	if err != nil || !revoked {
+		t.Fatalf("Expected a token issued before the cutoff to be revoked, got %v, %v", revoked, err)
+	}
+	revoked, err = repo.IsTokenRevoked(1, "session-3", "token-4", time.Now())
+	if err != nil || revoked {
+		t.Fatalf("Expected a token issued after the cutoff to be valid, got %v, %v", revoked, err)
+	}
+	revoked, err = repo.IsTokenRevoked(2, "session-4", "token-5", issuedAt)
+	if err != nil || revoked {
+		t.Fatalf("Expected the tokens of another user to be valid, got %v, %v", revoked, err)
+	}
+}
+
+func TestRevokeUserTokensSameSecond(t *testing.T) {
+	repo, err := NewTokenRevocationRepo(newMemoryCache())
+	if err != nil {
+		t.Fatalf("NewTokenRevocationRepo() returned an unexpected error: %v", err)
+	}
+
+	// revoke halfway through a second so the new token shares it
+	now := time.Now()
+	time.Sleep(now.Truncate(time.Second).Add(1500 * time.Millisecond).Sub(now))
+
+	before := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	if err := repo.RevokeUserTokens(1, time.Hour); err != nil {
+		t.Fatalf("RevokeUserTokens() returned an unexpected error: %v", err)
+	}
+	after := time.Now()
+
+	if after.Unix() != before.Unix() {
+		t.Skip("revocation crossed a second boundary")
+	}
+
+	revoked, err := repo.IsTokenRevoked(1, "session-1", "token-1", before)
+	if err != nil || !revoked {
+		t.Fatalf("Expected a token issued before the revocation to be revoked, got %v, %v", revoked, err)
+	}
+	revoked, err = repo.IsTokenRevoked(1, "session-2", "token-2", after)
+	if err != nil || revoked {
+		t.Fatalf("Expected a token issued after the revocation in the same second to be valid, got %v, %v", revoked, err)
+	}
+}
@@ -0,0 +1,199 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+)
+
+// ErrRefreshTokenReused is returned when a refresh token that was already
+// rotated is presented again, the session it belongs to is revoked by then
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
+const (
+	authSessionKeyPrefix      = "sessions:"
+	userAuthSessionsKeyPrefix = "sessions:user:"
+	refreshTokenKeyPrefix     = "refresh-tokens:"
+	usedRefreshTokenKeyPrefix = "refresh-tokens:used:"
+)
+
+// sessionRepo stores one expiring key per session and maps every refresh
+// token of the session to its id. Rotated tokens are marked as used instead
+// of deleted so that presenting one again can be told apart from an unknown
+// token.
+type sessionRepo struct {
+	cache CacheRepo
+}
+
+func NewSessionRepo(cacheRepo CacheRepo) (*sessionRepo, error) {
+	if cacheRepo == nil {
+		return nil, errors.New("no cache repo provided")
+	}
+
+	return &sessionRepo{
+		cache: cacheRepo,
+	}, nil
+}
+
+func (s *sessionRepo) CreateSession(session *models.Session, refreshTokenId string, ttl time.Duration) error {
+	if err := s.saveSession(session, ttl); err != nil {
+		return err
+	}
+	if err := s.cache.Set(refreshTokenKey(refreshTokenId), session.Id, ttl); err != nil {
+		return fmt.Errorf("failed to save refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// RotateRefreshToken replaces refreshTokenId with newRefreshTokenId. When
+// refreshTokenId was already rotated the whole session is revoked and
+// ErrRefreshTokenReused is returned along with the revoked session.
+func (s *sessionRepo) RotateRefreshToken(refreshTokenId, newRefreshTokenId, ip, userAgent string, ttl time.Duration) (*models.Session, error) {
+	session, err := s.GetSessionByRefreshToken(refreshTokenId)
+	if err != nil {
+		return nil, err
+	}
+
+	// only one caller can mark the token as used, a second refresh with the
+	// same token is a reuse even when both arrive at the same time
+	first, err := s.cache.SetNX(usedRefreshTokenKey(refreshTokenId), session.Id, ttl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark refresh token as used: %w", err)
+	}
+	if !first {
+		if err := s.DeleteSession(session); err != nil {
+			return nil, err
+		}
+		return session, ErrRefreshTokenReused
+	}
+
+	session.IP = ip
+	session.UserAgent = userAgent
+	session.LastUsedAt = time.Now().UTC()
+	if err := s.saveSession(session, ttl); err != nil {
+		return nil, err
+	}
+	if err := s.cache.Set(refreshTokenKey(newRefreshTokenId), session.Id, ttl); err != nil {
+		return nil, fmt.Errorf("failed to save refresh token: %w", err)
+	}
+
+	return session, nil
+}
+
+func (s *sessionRepo) GetSessionByRefreshToken(refreshTokenId string) (*models.Session, error) {
+	id, err := s.cache.Get(refreshTokenKey(refreshTokenId))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetSession(id)
+}
+
+func (s *sessionRepo) GetSession(id string) (*models.Session, error) {
+	data, err := s.cache.Get(authSessionKey(id))
+	if err != nil {
+		return nil, err
+	}
+
+	var session models.Session
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return nil, fmt.Errorf("failed to decode session: %w", err)
+	}
+
+	return &session, nil
+}
+
+func (s *sessionRepo) ListUserSessions(userId int) ([]models.Session, error) {
+	setKey := userAuthSessionsKey(userId)
+	ids, err := s.cache.SetMembers(setKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list session ids: %w", err)
+	}
+
+	sessions := []models.Session{}
+	var stale []string
+	for _, id := range ids {
+		session, err := s.GetSession(id)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				stale = append(stale, id)
+				continue
+			}
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+
+	if len(stale) > 0 {
+		if err := s.cache.SetRemove(setKey, stale...); err != nil {
+			return nil, fmt.Errorf("failed to prune expired sessions: %w", err)
+		}
+	}
+
+	return sessions, nil
+}
+
+// DeleteSession revokes the session, the refresh tokens pointing to it stop
+// working since the session they resolve to is gone
+func (s *sessionRepo) DeleteSession(session *models.Session) error {
+	if _, err := s.cache.Delete(authSessionKey(session.Id)); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	if err := s.cache.SetRemove(userAuthSessionsKey(session.UserId), session.Id); err != nil {
+		return fmt.Errorf("failed to remove session index: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sessionRepo) DeleteUserSessions(userId int) error {
+	sessions, err := s.ListUserSessions(userId)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if err := s.DeleteSession(&session); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *sessionRepo) saveSession(session *models.Session, ttl time.Duration) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %w", err)
+	}
+
+	if err := s.cache.Set(authSessionKey(session.Id), data, ttl); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	if err := s.cache.SetAdd(userAuthSessionsKey(session.UserId), session.Id); err != nil {
+		return fmt.Errorf("failed to index session: %w", err)
+	}
+
+	return nil
+}
+
+func authSessionKey(id string) string {
+	return authSessionKeyPrefix + id
+}
+
+func userAuthSessionsKey(userId int) string {
+	return userAuthSessionsKeyPrefix + strconv.Itoa(userId)
+}
+
+func refreshTokenKey(id string) string {
+	return refreshTokenKeyPrefix + id
+}
+
+func usedRefreshTokenKey(id string) string {
+	return usedRefreshTokenKeyPrefix + id
+}
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+)
+
+// memoryCache is a CacheRepo without expiry, enough to exercise the repos
+type memoryCache struct {
+	values map[string]string
+	sets   map[string]map[string]bool
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{values: map[string]string{}, sets: map[string]map[string]bool{}}
+}
+
+func (m *memoryCache) Get(key string) (string, error) {
+	v, ok := m.values[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
+
+func (m *memoryCache) Set(key string, value any, _ time.Duration) error {
+	switch v := value.(type) {
+	case []byte:
+		m.values[key] = string(v)
+	default:
+		m.values[key] = fmt.Sprint(v)
+	}
+	return nil
+}
+
+func (m *memoryCache) SetNX(key string, value any, exp time.Duration) (bool, error) {
+	if _, ok := m.values[key]; ok {
+		return false, nil
+	}
+	return true, m.Set(key, value, exp)
+}
+
+func (m *memoryCache) Delete(key string) (bool, error) {
+	_, ok := m.values[key]
+	delete(m.values, key)
+	return ok, nil
+}
+
+func (m *memoryCache) Increment(key string, _ time.Duration) (int64, error) {
+	n, _ := strconv.ParseInt(m.values[key], 10, 64)
+	n++
+	m.values[key] = strconv.FormatInt(n, 10)
+	return n, nil
+}
+
+func (m *memoryCache) SetAdd(key string, members ...string) error {
+	if m.sets[key] == nil {
+		m.sets[key] = map[string]bool{}
+	}
+	for _, member := range members {
+		m.sets[key][member] = true
+	}
+	return nil
+}
+
+func (m *memoryCache) SetRemove(key string, members ...string) error {
+	for _, member := range members {
+		delete(m.sets[key], member)
+	}
+	return nil
+}
+
+func (m *memoryCache) SetMembers(key string) ([]string, error) {
+	members := []string{}
+	for member := range m.sets[key] {
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+func (m *memoryCache) Publish(string, string) error { return nil }
+
+func (m *memoryCache) Subscribe(context.Context, string) (<-chan string, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	repo, err := NewSessionRepo(newMemoryCache())
+	if err != nil {
+		t.Fatalf("NewSessionRepo() returned an unexpected error: %v", err)
+	}
+
+	session := &models.Session{Id: "session-1", UserId: 7}
+	if err := repo.CreateSession(session, "token-1", time.Hour); err != nil {
+		t.Fatalf("CreateSession() returned an unexpected error: %v", err)
+	}
+
+	rotated, err := repo.RotateRefreshToken("token-1", "token-2", "10.0.0.1", "curl", time.Hour)
+	if err != nil {
+		t.Fatalf("RotateRefreshToken() returned an unexpected error: %v", err)
+	}
+	if rotated.Id != session.Id || rotated.IP != "10.0.0.1" {
+		t.Fatalf("Unexpected rotated session %+v", rotated)
+	}
+
+	// presenting the rotated token again revokes the session
+	_, err = repo.RotateRefreshToken("token-1", "token-3", "10.0.0.2", "curl", time.Hour)
+	if !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("Expected ErrRefreshTokenReused, got %v", err)
+	}
+
+	_, err = repo.RotateRefreshToken("token-2", "token-4", "10.0.0.1", "curl", time.Hour)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected the latest token of a revoked session to fail with ErrNotFound, got %v", err)
+	}
+
+	sessions, err := repo.ListUserSessions(7)
+	if err != nil {
+		t.Fatalf("ListUserSessions() returned an unexpected error: %v", err)
+	}
+	if len(sessions) != 0 {
+		t.Fatalf("Expected no sessions after reuse, got %d", len(sessions))
+	}
+}
@@ -0,0 +1,354 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+)
+
+const (
+	tunnelKeyPrefix       = "tunnels:"
+	userTunnelsKeyPrefix  = "tunnels:user:"
+	orgTunnelsKeyPrefix   = "tunnels:org:"
+	allTunnelsKey         = "tunnels:all"
+	disconnectChannel     = "tunnels:disconnect"
+	hostnameKeyPrefix     = "hostnames:"
+	sessionKeyPrefix      = "agent-sessions:"
+	userSessionsKeyPrefix = "agent-sessions:user:"
+	keySessionsKeyPrefix  = "agent-sessions:api-key:"
+	nodeKeyPrefix         = "nat-nodes:"
+)
+
+// tunnelRepo keeps one expiring key per tunnel plus per user, per org and
+// global sets of tunnel ids, members whose key has expired are dropped while listing
+type tunnelRepo struct {
+	cache CacheRepo
+}
+
+func NewTunnelRepo(cacheRepo CacheRepo) (*tunnelRepo, error) {
+	if cacheRepo == nil {
+		return nil, errors.New("no cache repo provided")
+	}
+
+	return &tunnelRepo{
+		cache: cacheRepo,
+	}, nil
+}
+
+func (t *tunnelRepo) SaveTunnel(tunnel *models.Tunnel, ttl time.Duration) error {
+	data, err := json.Marshal(tunnel)
+	if err != nil {
+		return fmt.Errorf("failed to encode tunnel: %w", err)
+	}
+
+	if err := t.cache.Set(tunnelKey(tunnel.Id), data, ttl); err != nil {
+		return fmt.Errorf("failed to save tunnel: %w", err)
+	}
+	if err := t.cache.SetAdd(userTunnelsKey(tunnel.UserId), tunnel.Id); err != nil {
+		return fmt.Errorf("failed to index user tunnel: %w", err)
+	}
+	if tunnel.OrgId != 0 {
+		if err := t.cache.SetAdd(orgTunnelsKey(tunnel.OrgId), tunnel.Id); err != nil {
+			return fmt.Errorf("failed to index org tunnel: %w", err)
+		}
+	}
+	if err := t.cache.SetAdd(allTunnelsKey, tunnel.Id); err != nil {
+		return fmt.Errorf("failed to index tunnel: %w", err)
+	}
+
+	return nil
+}
+
+func (t *tunnelRepo) DeleteTunnel(tunnel *models.Tunnel) error {
+	if _, err := t.cache.Delete(tunnelKey(tunnel.Id)); err != nil {
+		return fmt.Errorf("failed to delete tunnel: %w", err)
+	}
+	if err := t.cache.SetRemove(userTunnelsKey(tunnel.UserId), tunnel.Id); err != nil {
+		return fmt.Errorf("failed to remove user tunnel index: %w", err)
+	}
+	if tunnel.OrgId != 0 {
+		if err := t.cache.SetRemove(orgTunnelsKey(tunnel.OrgId), tunnel.Id); err != nil {
+			return fmt.Errorf("failed to remove org tunnel index: %w", err)
+		}
+	}
+	if err := t.cache.SetRemove(allTunnelsKey, tunnel.Id); err != nil {
+		return fmt.Errorf("failed to remove tunnel index: %w", err)
+	}
+
+	return nil
+}
+
+func (t *tunnelRepo) GetTunnel(id string) (*models.Tunnel, error) {
+	data, err := t.cache.Get(tunnelKey(id))
+	if err != nil {
+		return nil, err
+	}
+
+	var tunnel models.Tunnel
+	if err := json.Unmarshal([]byte(data), &tunnel); err != nil {
+		return nil, fmt.Errorf("failed to decode tunnel: %w", err)
+	}
+
+	return &tunnel, nil
+}
+
+func (t *tunnelRepo) ListUserTunnels(userId int) ([]models.Tunnel, error) {
+	return t.listTunnels(userTunnelsKey(userId))
+}
+
+func (t *tunnelRepo) ListOrgTunnels(orgId int) ([]models.Tunnel, error) {
+	return t.listTunnels(orgTunnelsKey(orgId))
+}
+
+func (t *tunnelRepo) ListTunnels() ([]models.Tunnel, error) {
+	return t.listTunnels(allTunnelsKey)
+}
+
+func (t *tunnelRepo) RequestDisconnect(sessionId string) error {
+	return t.cache.Publish(disconnectChannel, sessionId)
+}
+
+func (t *tunnelRepo) SubscribeDisconnects(ctx context.Context) (<-chan string, error) {
+	return t.cache.Subscribe(ctx, disconnectChannel)
+}
+
+// ClaimHostname takes ownership of hostname for nodeId, or refreshes the ttl
+// when nodeId already owns it. It reports false when another node holds it.
+func (t *tunnelRepo) ClaimHostname(hostname, nodeId string, ttl time.Duration) (bool, error) {
+	claimed, err := t.cache.SetNX(hostnameKey(hostname), nodeId, ttl)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim hostname: %w", err)
+	}
+	if claimed {
+		return true, nil
+	}
+
+	owner, err := t.GetHostnameOwner(hostname)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			// expired between the two calls, try once more
+			return t.cache.SetNX(hostnameKey(hostname), nodeId, ttl)
+		}
+		return false, err
+	}
+	if owner != nodeId {
+		return false, nil
+	}
+
+	if err := t.cache.Set(hostnameKey(hostname), nodeId, ttl); err != nil {
+		return false, fmt.Errorf("failed to refresh hostname claim: %w", err)
+	}
+	return true, nil
+}
+
+func (t *tunnelRepo) ReleaseHostname(hostname, nodeId string) error {
+	owner, err := t.GetHostnameOwner(hostname)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if owner != nodeId {
+		return nil
+	}
+
+	if _, err := t.cache.Delete(hostnameKey(hostname)); err != nil {
+		return fmt.Errorf("failed to release hostname: %w", err)
+	}
+	return nil
+}
+
+func (t *tunnelRepo) GetHostnameOwner(hostname string) (string, error) {
+	return t.cache.Get(hostnameKey(hostname))
+}
+
+func (t *tunnelRepo) SaveAgentSession(session *models.AgentSession, ttl time.Duration) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to encode agent session: %w", err)
+	}
+
+	if err := t.cache.Set(sessionKey(session.Id), data, ttl); err != nil {
+		return fmt.Errorf("failed to save agent session: %w", err)
+	}
+	if err := t.cache.SetAdd(userSessionsKey(session.UserId), session.Id); err != nil {
+		return fmt.Errorf("failed to index agent session: %w", err)
+	}
+	if session.APIKeyId != 0 {
+		if err := t.cache.SetAdd(keySessionsKey(session.APIKeyId), session.Id); err != nil {
+			return fmt.Errorf("failed to index api key agent session: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (t *tunnelRepo) DeleteAgentSession(session *models.AgentSession) error {
+	if _, err := t.cache.Delete(sessionKey(session.Id)); err != nil {
+		return fmt.Errorf("failed to delete agent session: %w", err)
+	}
+	if err := t.cache.SetRemove(userSessionsKey(session.UserId), session.Id); err != nil {
+		return fmt.Errorf("failed to remove agent session index: %w", err)
+	}
+	if session.APIKeyId != 0 {
+		if err := t.cache.SetRemove(keySessionsKey(session.APIKeyId), session.Id); err != nil {
+			return fmt.Errorf("failed to remove api key agent session index: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (t *tunnelRepo) CountUserAgentSessions(userId int) (int, error) {
+	sessions, err := t.listAgentSessions(userSessionsKey(userId))
+	if err != nil {
+		return 0, err
+	}
+	return len(sessions), nil
+}
+
+func (t *tunnelRepo) CountUserTunnels(userId int, tunnelType models.TunnelType) (int, error) {
+	tunnels, err := t.ListUserTunnels(userId)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, tunnel := range tunnels {
+		if tunnel.Type == tunnelType {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (t *tunnelRepo) ListAPIKeyAgentSessions(apiKeyId int) ([]models.AgentSession, error) {
+	return t.listAgentSessions(keySessionsKey(apiKeyId))
+}
+
+func (t *tunnelRepo) SaveNode(node *models.Node, ttl time.Duration) error {
+	data, err := json.Marshal(node)
+	if err != nil {
+		return fmt.Errorf("failed to encode node: %w", err)
+	}
+
+	if err := t.cache.Set(nodeKey(node.Id), data, ttl); err != nil {
+		return fmt.Errorf("failed to save node: %w", err)
+	}
+	return nil
+}
+
+func (t *tunnelRepo) GetNode(id string) (*models.Node, error) {
+	data, err := t.cache.Get(nodeKey(id))
+	if err != nil {
+		return nil, err
+	}
+
+	var node models.Node
+	if err := json.Unmarshal([]byte(data), &node); err != nil {
+		return nil, fmt.Errorf("failed to decode node: %w", err)
+	}
+
+	return &node, nil
+}
+
+func (t *tunnelRepo) listTunnels(setKey string) ([]models.Tunnel, error) {
+	ids, err := t.cache.SetMembers(setKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tunnel ids: %w", err)
+	}
+
+	tunnels := []models.Tunnel{}
+	var stale []string
+	for _, id := range ids {
+		tunnel, err := t.GetTunnel(id)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				stale = append(stale, id)
+				continue
+			}
+			return nil, err
+		}
+		tunnels = append(tunnels, *tunnel)
+	}
+
+	if len(stale) > 0 {
+		if err := t.cache.SetRemove(setKey, stale...); err != nil {
+			return nil, fmt.Errorf("failed to prune expired tunnels: %w", err)
+		}
+	}
+
+	return tunnels, nil
+}
+
+func (t *tunnelRepo) listAgentSessions(setKey string) ([]models.AgentSession, error) {
+	ids, err := t.cache.SetMembers(setKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list agent session ids: %w", err)
+	}
+
+	sessions := []models.AgentSession{}
+	var stale []string
+	for _, id := range ids {
+		data, err := t.cache.Get(sessionKey(id))
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				stale = append(stale, id)
+				continue
+			}
+			return nil, err
+		}
+
+		var session models.AgentSession
+		if err := json.Unmarshal([]byte(data), &session); err != nil {
+			return nil, fmt.Errorf("failed to decode agent session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if len(stale) > 0 {
+		if err := t.cache.SetRemove(setKey, stale...); err != nil {
+			return nil, fmt.Errorf("failed to prune expired agent sessions: %w", err)
+		}
+	}
+
+	return sessions, nil
+}
+
+func tunnelKey(id string) string {
+	return tunnelKeyPrefix + id
+}
+
+func userTunnelsKey(userId int) string {
+	return userTunnelsKeyPrefix + strconv.Itoa(userId)
+}
+
+func orgTunnelsKey(orgId int) string {
+	return orgTunnelsKeyPrefix + strconv.Itoa(orgId)
+}
+
+func hostnameKey(hostname string) string {
+	return hostnameKeyPrefix + hostname
+}
+
+func sessionKey(id string) string {
+	return sessionKeyPrefix + id
+}
+
+func userSessionsKey(userId int) string {
+	return userSessionsKeyPrefix + strconv.Itoa(userId)
+}
+
+func keySessionsKey(apiKeyId int) string {
+	return keySessionsKeyPrefix + strconv.Itoa(apiKeyId)
+}
+
+func nodeKey(id string) string {
+	return nodeKeyPrefix + id
+}
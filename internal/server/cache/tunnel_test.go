@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+)
+
+func TestCountUserTunnelsAcrossNodes(t *testing.T) {
+	repo, err := NewTunnelRepo(newMemoryCache())
+	if err != nil {
+		t.Fatalf("NewTunnelRepo() returned an unexpected error: %v", err)
+	}
+
+	tunnels := []*models.Tunnel{
+		{Id: "a", NodeId: "node-1", UserId: 7, Type: models.TcpTunnelType},
+		{Id: "b", NodeId: "node-2", UserId: 7, Type: models.TcpTunnelType},
+		{Id: "c", NodeId: "node-2", UserId: 7, Type: models.HttpTunnelType},
+		{Id: "d", NodeId: "node-1", UserId: 8, Type: models.TcpTunnelType},
+	}
+	for _, tunnel := range tunnels {
+		if err := repo.SaveTunnel(tunnel, time.Minute); err != nil {
+			t.Fatalf("SaveTunnel() returned an unexpected error: %v", err)
+		}
+	}
+
+	count, err := repo.CountUserTunnels(7, models.TcpTunnelType)
+	if err != nil {
+		t.Fatalf("CountUserTunnels() returned an unexpected error: %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("Expected 2 tcp tunnels over both nodes, got %d", count)
+	}
+}
@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// logMailer writes the text part of every message to the log, meant for
+// local development where no smtp server is running
+type logMailer struct{}
+
+func NewLogMailer() *logMailer {
+	return &logMailer{}
+}
+
+func (m *logMailer) Send(ctx context.Context, msg *Message) error {
+	slog.InfoContext(ctx, "email",
+		slog.String("to", msg.To),
+		slog.String("subject", msg.Subject),
+		slog.String("text", msg.Text),
+	)
+	return nil
+}
+
+// fileMailer appends every message to a file
+type fileMailer struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileMailer(path string) (*fileMailer, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return &fileMailer{path: path}, nil
+}
+
+func (m *fileMailer) Send(_ context.Context, msg *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n", time.Now().Format(time.RFC1123Z), msg.To, msg.Subject, msg.Text)
+	return err
+}
@@ -0,0 +1,35 @@
+// Package mailer renders the emails the api server sends and delivers them
+// over smtp, or to the log or a file during development.
+package mailer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// New returns the mailer selected by cfg.Mail.Driver
+func New(cfg *config.Config) (Mailer, error) {
+	switch cfg.Mail.Driver {
+	case "smtp":
+		return NewSMTPMailer(cfg), nil
+	case "log":
+		return NewLogMailer(), nil
+	case "file":
+		return NewFileMailer(cfg.Mail.FilePath)
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Mail.Driver)
+	}
+}
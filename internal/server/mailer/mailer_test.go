@@ -0,0 +1,219 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+)
+
+func TestNewOtpMessage(t *testing.T) {
+	msg, err := NewOtpMessage(models.ForgotPasswordOtpType, "a@example.com", OtpData{
+		Email:     "a@example.com",
+		URL:       "http://localhost:5173/forgot-password?token=a&b",
+		ExpiresIn: "10m0s",
+	})
+	if err != nil {
+		t.Fatalf("NewOtpMessage() returned an unexpected error: %v", err)
+	}
+
+	if msg.Subject != "Reset your password" {
+		t.Fatalf("Unexpected subject %q", msg.Subject)
+	}
+	if !strings.Contains(msg.Text, "http://localhost:5173/forgot-password?token=a&b") {
+		t.Fatalf("Text body does not contain the reset url:\n%s", msg.Text)
+	}
+	if !strings.Contains(msg.HTML, `href="http://localhost:5173/forgot-password?token=a&amp;b"`) {
+		t.Fatalf("HTML body does not contain the escaped reset url:\n%s", msg.HTML)
+	}
+
+	msg, err = NewOtpMessage(models.AccountUnlockOtpType, "a@example.com", OtpData{
+		Email:     "a@example.com",
+		URL:       "http://localhost:5173/unlock-account?token=a",
+		ExpiresIn: "10m0s",
+	})
+	if err != nil {
+		t.Fatalf("NewOtpMessage() returned an unexpected error for the unlock link: %v", err)
+	}
+	if msg.Subject != "Your account was locked" {
+		t.Fatalf("Unexpected subject %q", msg.Subject)
+	}
+
+	if _, err := NewOtpMessage(models.OtpType("unknown"), "a@example.com", OtpData{}); err == nil {
+		t.Fatalf("NewOtpMessage() expected an error for an unknown otp type")
+	}
+}
+
+func TestNewInvitationMessage(t *testing.T) {
+	msg, err := NewInvitationMessage("b@example.com", InvitationData{
+		OrgName:   "Acme",
+		InvitedBy: "a@example.com",
+		Role:      "member",
+		URL:       "http://localhost:5173/invitations?token=abc",
+		ExpiresIn: "168h0m0s",
+	})
+	if err != nil {
+		t.Fatalf("NewInvitationMessage() returned an unexpected error: %v", err)
+	}
+
+	if msg.Subject != "You have been invited to join Acme" {
+		t.Fatalf("Unexpected subject %q", msg.Subject)
+	}
+
+	// every template defines a subject block, they must not override each other
+	otp, err := NewOtpMessage(models.EmailVerificationOtpType, "b@example.com", OtpData{Email: "b@example.com", Otp: "123456"})
+	if err != nil {
+		t.Fatalf("NewOtpMessage() returned an unexpected error: %v", err)
+	}
+	if otp.Subject != "Verify your email address" {
+		t.Fatalf("Unexpected subject %q", otp.Subject)
+	}
+}
+
+func TestNewAPIKeyRevokedMessage(t *testing.T) {
+	msg, err := NewAPIKeyRevokedMessage("a@example.com", APIKeyRevokedData{Name: "ci", Prefix: "ak_0123456789abcdef"})
+	if err != nil {
+		t.Fatalf("NewAPIKeyRevokedMessage() returned an unexpected error: %v", err)
+	}
+
+	if msg.Subject != "Your API key ci was revoked" {
+		t.Fatalf("Unexpected subject %q", msg.Subject)
+	}
+	if !strings.Contains(msg.Text, "ak_0123456789abcdef") {
+		t.Fatalf("Expected the key prefix in the text body, got %q", msg.Text)
+	}
+}
+
+type flakyMailer struct {
+	mu       sync.Mutex
+	failures int
+	sent     []*Message
+}
+
+func (m *flakyMailer) Send(_ context.Context, msg *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.failures > 0 {
+		m.failures--
+		return errors.New("connection refused")
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestQueueRetries(t *testing.T) {
+	m := &flakyMailer{failures: 2}
+	q := NewQueue(m)
+	q.backoff = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	if err := q.Send(ctx, &Message{To: "a@example.com"}); err != nil {
+		t.Fatalf("Send() returned an unexpected error: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		m.mu.Lock()
+		sent := len(m.sent)
+		m.mu.Unlock()
+		if sent == 1 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("message was not delivered after retries")
+}
+
+// recipientMailer fails every message to failing
+type recipientMailer struct {
+	mu      sync.Mutex
+	failing string
+	sent    []string
+}
+
+func (m *recipientMailer) Send(_ context.Context, msg *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if msg.To == m.failing {
+		return errors.New("mailbox unavailable")
+	}
+	m.sent = append(m.sent, msg.To)
+	return nil
+}
+
+func TestQueueFailingRecipientDoesNotBlock(t *testing.T) {
+	m := &recipientMailer{failing: "bad@example.com"}
+	q := NewQueue(m)
+	q.backoff = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	for _, to := range []string{"bad@example.com", "a@example.com", "b@example.com"} {
+		if err := q.Send(ctx, &Message{To: to}); err != nil {
+			t.Fatalf("Send() returned an unexpected error: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		m.mu.Lock()
+		sent := len(m.sent)
+		m.mu.Unlock()
+		if sent == 2 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("messages behind a failing recipient were not delivered")
+}
+
+func TestQueueDrainsOnShutdown(t *testing.T) {
+	m := &flakyMailer{failures: 1}
+	q := NewQueue(m)
+	q.backoff = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+
+	for _, to := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		if err := q.Send(ctx, &Message{To: to}); err != nil {
+			t.Fatalf("Send() returned an unexpected error: %v", err)
+		}
+	}
+	// the failed message waits an hour for its retry, shutting down sends it
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		m.mu.Lock()
+		sent := len(m.sent)
+		m.mu.Unlock()
+		if sent == 2 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Run() did not return after ctx was cancelled")
+	}
+	if len(m.sent) != 3 {
+		t.Fatalf("Expected every queued message to be sent on shutdown, got %d", len(m.sent))
+	}
+}
@@ -0,0 +1,175 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var ErrQueueFull = errors.New("mail queue is full")
+
+const (
+	queueSize       = 256
+	queueWorkers    = 4
+	maxSendAttempts = 5
+	sendTimeout     = 30 * time.Second
+	// how long the messages still queued at shutdown get to be sent
+	drainTimeout = 10 * time.Second
+)
+
+// Queue sends messages in the background so handlers never wait on the
+// smtp server. A failed send waits out its backoff outside the queue so a
+// recipient that keeps failing never holds up the messages behind it
+type Queue struct {
+	mailer  Mailer
+	pending chan *queuedMessage
+	backoff time.Duration
+
+	mu      sync.Mutex
+	retries map[*queuedMessage]struct{}
+}
+
+type queuedMessage struct {
+	msg     *Message
+	attempt int
+	retry   *time.Timer // guarded by Queue.mu
+}
+
+func NewQueue(m Mailer) *Queue {
+	return &Queue{
+		mailer:  m,
+		pending: make(chan *queuedMessage, queueSize),
+		backoff: time.Second,
+		retries: make(map[*queuedMessage]struct{}),
+	}
+}
+
+// Send enqueues msg and returns immediately
+func (q *Queue) Send(_ context.Context, msg *Message) error {
+	select {
+	case q.pending <- &queuedMessage{msg: msg}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Run delivers queued messages with queueWorkers workers until ctx is done,
+// the messages still queued or waiting for a retry then get one last attempt
+// before it returns
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range queueWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case item := <-q.pending:
+					q.deliver(item)
+				}
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	wg.Wait()
+	q.drain()
+}
+
+func (q *Queue) deliver(item *queuedMessage) {
+	item.attempt++
+
+	sendCtx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	err := q.mailer.Send(sendCtx, item.msg)
+	cancel()
+	if err == nil {
+		return
+	}
+
+	if item.attempt == maxSendAttempts {
+		slog.Error("failed to send email", slog.String("to", item.msg.To), slog.String("subject", item.msg.Subject), slog.Int("attempts", item.attempt), slog.Any("err", err))
+		return
+	}
+	slog.Warn("retrying email", slog.String("to", item.msg.To), slog.Int("attempt", item.attempt), slog.Any("err", err))
+
+	// the backoff doubles with each failed attempt
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.retries[item] = struct{}{}
+	item.retry = time.AfterFunc(q.backoff<<(item.attempt-1), func() {
+		q.requeue(item)
+	})
+}
+
+// requeue puts a message whose backoff passed back in the queue, a full
+// queue pushes the retry back once more
+func (q *Queue) requeue(item *queuedMessage) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.retries[item]; !ok {
+		// already taken by drain
+		return
+	}
+
+	select {
+	case q.pending <- item:
+		delete(q.retries, item)
+	default:
+		item.retry.Reset(q.backoff)
+	}
+}
+
+// drain makes one last attempt at every message still queued or waiting for
+// a retry, the ones not sent within drainTimeout are dropped
+func (q *Queue) drain() {
+	q.mu.Lock()
+	items := make([]*queuedMessage, 0, len(q.retries))
+	for item := range q.retries {
+		item.retry.Stop()
+		items = append(items, item)
+	}
+	clear(q.retries)
+	q.mu.Unlock()
+
+	for len(q.pending) > 0 {
+		items = append(items, <-q.pending)
+	}
+	if len(items) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	work := make(chan *queuedMessage)
+	var wg sync.WaitGroup
+	for range queueWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range work {
+				if err := q.mailer.Send(ctx, item.msg); err != nil {
+					slog.Error("failed to send email", slog.String("to", item.msg.To), slog.String("subject", item.msg.Subject), slog.Int("attempts", item.attempt+1), slog.Any("err", err))
+				}
+			}
+		}()
+	}
+
+	for i, item := range items {
+		select {
+		case work <- item:
+			continue
+		case <-ctx.Done():
+			slog.Warn("dropping queued emails", slog.Int("emails", len(items)-i))
+		}
+		break
+	}
+	close(work)
+	wg.Wait()
+}
@@ -0,0 +1,110 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+)
+
+type smtpMailer struct {
+	addr string
+	host string
+	from string
+	auth smtp.Auth
+}
+
+func NewSMTPMailer(cfg *config.Config) *smtpMailer {
+	m := &smtpMailer{
+		addr: net.JoinHostPort(cfg.Mail.SMTPHost, strconv.Itoa(cfg.Mail.SMTPPort)),
+		host: cfg.Mail.SMTPHost,
+		from: cfg.Mail.From,
+	}
+	// sinks like mailhog accept mail without auth
+	if cfg.Mail.SMTPUsername != "" {
+		m.auth = smtp.PlainAuth("", cfg.Mail.SMTPUsername, cfg.Mail.SMTPPassword, cfg.Mail.SMTPHost)
+	}
+	return m
+}
+
+// Send delivers msg, net/smtp has no context support so ctx is only checked
+// before dialing
+func (m *smtpMailer) Send(ctx context.Context, msg *Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	from, err := mail.ParseAddress(m.from)
+	if err != nil {
+		return fmt.Errorf("invalid from address: %w", err)
+	}
+
+	body, err := buildMIME(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(m.addr, m.auth, from.Address, []string{msg.To}, body)
+}
+
+// buildMIME writes msg as a multipart/alternative message with a text and an
+// html part
+func buildMIME(from string, msg *Message) ([]byte, error) {
+	boundary, err := randomBoundary()
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+	for _, part := range []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain", msg.Text},
+		{"text/html", msg.HTML},
+	} {
+		if part.body == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "--%s\r\n", boundary)
+		fmt.Fprintf(&b, "Content-Type: %s; charset=utf-8\r\n", part.contentType)
+		b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+		qp := quotedprintable.NewWriter(&b)
+		if _, err := qp.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+		b.WriteString("\r\n")
+	}
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+
+	return b.Bytes(), nil
+}
+
+func randomBoundary() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,106 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+// every email has a <name>.txt and a <name>.html template, the text
+// template also defines the "subject" block. Each file is parsed on its own
+// so the subject blocks do not replace each other
+var textTemplates, htmlTemplates = mustParseTemplates()
+
+type OtpData struct {
+	Email     string
+	Otp       string // the code the user types in, empty for link based otps
+	URL       string
+	ExpiresIn string
+}
+
+type InvitationData struct {
+	OrgName   string
+	InvitedBy string
+	Role      string
+	URL       string
+	ExpiresIn string
+}
+
+type APIKeyRevokedData struct {
+	Name   string
+	Prefix string
+}
+
+func NewOtpMessage(otpType models.OtpType, to string, data OtpData) (*Message, error) {
+	msg, err := newMessage(string(otpType), to, data)
+	if err != nil {
+		return nil, fmt.Errorf("no email template for otp type %q", otpType)
+	}
+	return msg, nil
+}
+
+func NewInvitationMessage(to string, data InvitationData) (*Message, error) {
+	return newMessage("org-invitation", to, data)
+}
+
+func NewAPIKeyRevokedMessage(to string, data APIKeyRevokedData) (*Message, error) {
+	return newMessage("api-key-revoked", to, data)
+}
+
+func newMessage(name, to string, data any) (*Message, error) {
+	text := textTemplates[name]
+	html := htmlTemplates[name]
+	if text == nil || html == nil {
+		return nil, fmt.Errorf("no email template %q", name)
+	}
+
+	var subject, textBody, htmlBody bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err := text.Execute(&textBody, data); err != nil {
+		return nil, err
+	}
+	if err := html.Execute(&htmlBody, data); err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    textBody.String(),
+		HTML:    htmlBody.String(),
+	}, nil
+}
+
+func mustParseTemplates() (map[string]*texttemplate.Template, map[string]*htmltemplate.Template) {
+	texts := map[string]*texttemplate.Template{}
+	htmls := map[string]*htmltemplate.Template{}
+
+	files, err := fs.Glob(templateFS, "templates/*")
+	if err != nil {
+		panic(err)
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), path.Ext(file))
+		switch path.Ext(file) {
+		case ".txt":
+			texts[name] = texttemplate.Must(texttemplate.ParseFS(templateFS, file))
+		case ".html":
+			htmls[name] = htmltemplate.Must(htmltemplate.ParseFS(templateFS, file))
+		}
+	}
+
+	return texts, htmls
+}
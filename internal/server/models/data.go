@@ -2,6 +2,9 @@ package models
 
 import "time"
 
+// User is an account, DeletedAt is set while the account waits for its
+// purge at PurgeAt and signing in again before that cancels the deletion.
+// A suspended user can not sign in until an admin lifts the suspension
 type User struct {
 	Id            int       `json:"id"`
 	Name          string    `json:"name"`
@@ -10,20 +13,198 @@ type User struct {
 	PasswordHash  []byte    `json:"-"`
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
-	EmailVerified bool      `json:"-"`
-	IsAdmin       bool      `json:"-"`
+	EmailVerified bool      `json:"email_verified"`
+	IsAdmin       bool      `json:"is_admin"`
+	Plan          string    `json:"plan"`
+	DeletedAt     time.Time `json:"deleted_at,omitzero"`
+	PurgeAt       time.Time `json:"purge_at,omitzero"`
+	SuspendedAt   time.Time `json:"suspended_at,omitzero"`
+}
+
+// Cursor is the keyset position of the last item of a page, a list goes on
+// with the items sorted after it. Value holds the sort key of lists that are
+// not sorted by time and Sort the order the cursor was made for
+type Cursor struct {
+	Id    int64     `json:"i,omitempty"`
+	Time  time.Time `json:"t,omitzero"`
+	Value string    `json:"v,omitempty"`
+	Sort  string    `json:"s,omitempty"`
+}
+
+// UserFilter narrows the users admins list, nil and zero fields match every
+// user. Search matches a part of the email or the name
+type UserFilter struct {
+	Search        string
+	EmailVerified *bool
+	IsAdmin       *bool
+	Suspended     *bool
+	Plan          string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Sort          string
+}
+
+// UserIdentity links a user to an account at an oauth provider
+type UserIdentity struct {
+	Id        int       `json:"id"`
+	UserId    int       `json:"-"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"-"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OAuthState is kept between the authorize redirect and the callback,
+// LinkUserId is set when a signed in user links a provider to the account
+type OAuthState struct {
+	Provider   string `json:"provider"`
+	Verifier   string `json:"verifier"`
+	Nonce      string `json:"nonce"` // also set as a cookie on the browser that started the flow
+	LinkUserId int    `json:"link_user_id,omitempty"`
+}
+
+// Totp is the authenticator app enrolled by a user, it only guards sign in
+// once Enabled is set after the first code was confirmed
+type Totp struct {
+	UserId       int       `json:"-"`
+	Secret       string    `json:"-"`
+	Enabled      bool      `json:"enabled"`
+	LastUsedStep int64     `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	EnabledAt    time.Time `json:"enabled_at,omitzero"`
+}
+
+// MfaChallenge is handed out after the password check of a user with totp
+// enabled, it is exchanged together with a code for the session cookies
+type MfaChallenge struct {
+	Token     string    `json:"token"`
+	UserId    int       `json:"user_id"`
+	Attempts  int       `json:"attempts"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 type APIKey struct {
-	Id          int       `json:"id"`
-	Name        string    `json:"name"`
-	Prefix      string    `json:"prefix"`
-	APIkeyToken string    `json:"api_key_token,omitempty"`
-	APIKeyHash  string    `json:"-"`
-	UserId      int       `json:"user_id"`
-	ExpireAt    time.Time `json:"expire_at"`
-	CreatedAt   time.Time `json:"created_at"`
-	Permissions []string  `json:"permission,omitempty"`
+	Id          int               `json:"id"`
+	Name        string            `json:"name"`
+	Prefix      string            `json:"prefix"`
+	APIkeyToken string            `json:"api_key_token,omitempty"`
+	APIKeyHash  string            `json:"-"`
+	UserId      int               `json:"user_id"`
+	OrgId       int               `json:"org_id,omitempty"`
+	ExpireAt    time.Time         `json:"expire_at"`
+	CreatedAt   time.Time         `json:"created_at"`
+	Permissions []string          `json:"permission,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	// the secret replaced by the last rotation keeps working until
+	// PreviousExpiresAt
+	PreviousExpiresAt time.Time `json:"previous_expires_at,omitzero"`
+	RotatedAt         time.Time `json:"rotated_at,omitzero"`
+	LastUsedAt        time.Time `json:"last_used_at,omitzero"`
+	LastUsedIp        string    `json:"last_used_ip,omitempty"`
+}
+
+// APIKeyUse is one authentication with an api key, see apikey.UsageTracker
+type APIKeyUse struct {
+	KeyId  int
+	Ip     string
+	UsedAt time.Time
+}
+
+// APIKeyScope is a permission granted to an api key, stored in the
+// permissions column
+type APIKeyScope string
+
+const (
+	TunnelHttpScope   APIKeyScope = "tunnel:http"
+	TunnelTcpScope    APIKeyScope = "tunnel:tcp"
+	DomainsReadScope  APIKeyScope = "domains:read"
+	DomainsWriteScope APIKeyScope = "domains:write"
+	APIReadScope      APIKeyScope = "api:read"
+)
+
+type Plan struct {
+	Id                   int       `json:"id"`
+	Name                 string    `json:"name"`
+	MaxSessions          int       `json:"max_sessions"`
+	MaxTunnelsPerSession int       `json:"max_tunnels_per_session"`
+	MaxReservedDomains   int       `json:"max_reserved_domains"`
+	MaxTcpPorts          int       `json:"max_tcp_ports"`
+	MonthlyBandwidth     int64     `json:"monthly_bandwidth"`
+	CreatedAt            time.Time `json:"created_at"`
+	UpdatedAt            time.Time `json:"updated_at"`
+}
+
+type ReservedDomain struct {
+	Id        int       `json:"id"`
+	Hostname  string    `json:"hostname"`
+	UserId    int       `json:"user_id"`
+	OrgId     int       `json:"org_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OrgRole string
+
+const (
+	OwnerOrgRole  OrgRole = "owner"
+	AdminOrgRole  OrgRole = "admin"
+	MemberOrgRole OrgRole = "member"
+	ViewerOrgRole OrgRole = "viewer"
+)
+
+// Organization shares api keys, reserved domains and tunnels between its
+// members, Role is the role of the user the organization was listed for
+type Organization struct {
+	Id        int       `json:"id"`
+	Name      string    `json:"name"`
+	Role      OrgRole   `json:"role,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OrgMember struct {
+	OrgId    int       `json:"org_id"`
+	UserId   int       `json:"user_id"`
+	Name     string    `json:"name,omitempty"`
+	Email    string    `json:"email,omitempty"`
+	Role     OrgRole   `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type OrgInvitation struct {
+	Id        int       `json:"id"`
+	OrgId     int       `json:"org_id"`
+	Email     string    `json:"email"`
+	Role      OrgRole   `json:"role"`
+	TokenHash string    `json:"-"`
+	InvitedBy int       `json:"invited_by,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type TunnelUsage struct {
+	Id        int       `json:"id"`
+	UserId    int       `json:"user_id"`
+	Period    time.Time `json:"period"`
+	BytesIn   int64     `json:"bytes_in"`
+	BytesOut  int64     `json:"bytes_out"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AccessLog is one http request proxied through a tunnel
+type AccessLog struct {
+	Id                int64     `json:"id"`
+	TunnelId          string    `json:"tunnel_id"`
+	SessionId         string    `json:"session_id"`
+	UserId            int       `json:"user_id"`
+	RequestId         string    `json:"request_id"`
+	Hostname          string    `json:"hostname"`
+	Method            string    `json:"method"`
+	Path              string    `json:"path"`
+	Status            int       `json:"status"`
+	RemoteAddr        string    `json:"remote_addr"`
+	UpstreamLatencyMs int64     `json:"upstream_latency_ms"`
+	BytesIn           int64     `json:"bytes_in"`
+	BytesOut          int64     `json:"bytes_out"`
+	CreatedAt         time.Time `json:"created_at"`
 }
 
 type OtpVerification struct {
@@ -44,4 +225,154 @@ type OtpType string
 var (
 	EmailVerificationOtpType OtpType = "email-verification"
 	ForgotPasswordOtpType    OtpType = "forget-password"
+	AccountUnlockOtpType     OtpType = "account-unlock"
+	SignInOtpType            OtpType = "sign-in"
+	EmailChangeOtpType       OtpType = "email-change"
+	AccountDeletionOtpType   OtpType = "account-deletion"
+)
+
+// Tunnel is the live view of an open tunnel, published by the nat-server
+type Tunnel struct {
+	Id           string     `json:"id"`
+	SessionId    string     `json:"session_id"`
+	NodeId       string     `json:"node_id"`
+	UserId       int        `json:"user_id"`
+	OrgId        int        `json:"org_id,omitempty"`
+	APIKeyId     int        `json:"api_key_id,omitempty"`
+	Type         TunnelType `json:"type"`
+	PublicURL    string     `json:"public_url"`
+	LocalAddr    string     `json:"local_addr"`
+	ClientIP     string     `json:"client_ip"`
+	AgentVersion string     `json:"agent_version"`
+	StartedAt    time.Time  `json:"started_at"`
+	BytesIn      int64      `json:"bytes_in"`
+	BytesOut     int64      `json:"bytes_out"`
+}
+
+type LoginLockKind string
+
+var (
+	AccountLoginLockKind LoginLockKind = "account"
+	IPLoginLockKind      LoginLockKind = "ip"
 )
+
+// LoginFailures counts the failed password checks of an account or an ip
+// within the lockout window
+type LoginFailures struct {
+	Count        int
+	LastFailedAt time.Time
+}
+
+// LoginLock blocks password sign in of an account or from an ip until
+// ExpiresAt, Subject is the email or the ip
+type LoginLock struct {
+	Kind      LoginLockKind `json:"kind"`
+	Subject   string        `json:"subject"`
+	Failures  int           `json:"failures"`
+	LockedAt  time.Time     `json:"locked_at"`
+	ExpiresAt time.Time     `json:"expires_at"`
+}
+
+// AgentSession is a connected agent, published so session quotas hold
+// across every nat-server node
+type AgentSession struct {
+	Id       string `json:"id"`
+	UserId   int    `json:"user_id"`
+	NodeId   string `json:"node_id"`
+	APIKeyId int    `json:"api_key_id,omitempty"`
+	// the hash of the secret the agent authenticated with, a rotated key
+	// has two secrets until the grace period of the old one ends
+	APIKeyHash string    `json:"api_key_hash,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+}
+
+// Session is a signed in device, every refresh token issued to it belongs to
+// the same family and is replaced on each refresh
+type Session struct {
+	Id         string    `json:"id"`
+	UserId     int       `json:"user_id"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
+
+// Node is a running nat-server and the internal address other nodes forward
+// requests to
+type Node struct {
+	Id        string    `json:"id"`
+	Addr      string    `json:"addr"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+type TunnelType string
+
+var (
+	HttpTunnelType TunnelType = "http"
+	TcpTunnelType  TunnelType = "tcp"
+)
+
+// AuditEvent records a security relevant action, ActorId is 0 when nobody
+// could be identified
+type AuditEvent struct {
+	Id         int64          `json:"id"`
+	ActorId    int            `json:"actor_id,omitempty"`
+	Action     AuditAction    `json:"action"`
+	TargetType string         `json:"target_type,omitempty"`
+	TargetId   string         `json:"target_id,omitempty"`
+	IP         string         `json:"ip"`
+	UserAgent  string         `json:"user_agent"`
+	Metadata   map[string]any `json:"metadata"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+type AuditAction string
+
+var (
+	LoginAuditAction              AuditAction = "auth.login"
+	LoginFailedAuditAction        AuditAction = "auth.login_failed"
+	LogoutAuditAction             AuditAction = "auth.logout"
+	SessionRevokedAuditAction     AuditAction = "auth.session_revoked"
+	RefreshTokenReusedAuditAction AuditAction = "auth.refresh_token_reused"
+	MfaFailedAuditAction          AuditAction = "auth.mfa_failed"
+	LoginLockedAuditAction        AuditAction = "auth.login_locked"
+	LoginUnlockedAuditAction      AuditAction = "auth.login_unlocked"
+	IdentityLinkedAuditAction     AuditAction = "user.identity_linked"
+	IdentityUnlinkedAuditAction   AuditAction = "user.identity_unlinked"
+	TotpEnabledAuditAction        AuditAction = "user.totp_enabled"
+	TotpDisabledAuditAction       AuditAction = "user.totp_disabled"
+	RecoveryCodesAuditAction      AuditAction = "user.recovery_codes_generated"
+	PasswordResetAuditAction      AuditAction = "user.password_reset"
+	PasswordChangedAuditAction    AuditAction = "user.password_changed"
+	ProfileUpdatedAuditAction     AuditAction = "user.profile_updated"
+	EmailChangedAuditAction       AuditAction = "user.email_changed"
+	EmailVerifiedAuditAction      AuditAction = "user.email_verified"
+	UserDeletedAuditAction        AuditAction = "user.deleted"
+	DeletionScheduledAuditAction  AuditAction = "user.deletion_scheduled"
+	DeletionCancelledAuditAction  AuditAction = "user.deletion_cancelled"
+	DataExportedAuditAction       AuditAction = "user.data_exported"
+	UserSuspendedAuditAction      AuditAction = "user.suspended"
+	UserUnsuspendedAuditAction    AuditAction = "user.unsuspended"
+	AdminGrantedAuditAction       AuditAction = "user.admin_granted"
+	AdminRevokedAuditAction       AuditAction = "user.admin_revoked"
+	APIKeyCreatedAuditAction      AuditAction = "api_key.created"
+	APIKeyDeletedAuditAction      AuditAction = "api_key.deleted"
+	APIKeyRotatedAuditAction      AuditAction = "api_key.rotated"
+	APIKeyRevokedAuditAction      AuditAction = "api_key.revoked"
+	OrgCreatedAuditAction         AuditAction = "org.created"
+	OrgDeletedAuditAction         AuditAction = "org.deleted"
+	OrgMemberInvitedAuditAction   AuditAction = "org.member_invited"
+	OrgMemberJoinedAuditAction    AuditAction = "org.member_joined"
+	OrgMemberUpdatedAuditAction   AuditAction = "org.member_role_changed"
+	OrgMemberRemovedAuditAction   AuditAction = "org.member_removed"
+)
+
+// RateLimit is the state of one rate limit after a hit, Reset is when the
+// current window ends
+type RateLimit struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Duration
+}
@@ -0,0 +1,90 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+
+	"golang.org/x/oauth2"
+)
+
+// githubProvider is not an oidc provider, the identity is read from the rest
+// api. The urls are configurable so github enterprise or a mock can be used.
+type githubProvider struct {
+	config *oauth2.Config
+	apiURL string
+}
+
+func newGitHubProvider(cfg *config.Config) *githubProvider {
+	return &githubProvider{
+		config: &oauth2.Config{
+			ClientID:     cfg.OAuth.GitHub.ClientID,
+			ClientSecret: cfg.OAuth.GitHub.ClientSecret,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  cfg.OAuth.GitHub.AuthURL,
+				TokenURL: cfg.OAuth.GitHub.TokenURL,
+			},
+			RedirectURL: redirectURL(cfg, "github"),
+			Scopes:      []string{"read:user", "user:email"},
+		},
+		apiURL: cfg.OAuth.GitHub.APIURL,
+	}
+}
+
+func (g *githubProvider) Name() string {
+	return "github"
+}
+
+func (g *githubProvider) AuthCodeURL(state, verifier string) string {
+	return g.config.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier))
+}
+
+func (g *githubProvider) Exchange(ctx context.Context, code, verifier string) (*Identity, error) {
+	token, err := g.config.Exchange(exchangeContext(ctx), code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, err
+	}
+
+	var user struct {
+		Id    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+	if err := getJSON(ctx, token, g.apiURL+"/user", &user); err != nil {
+		return nil, err
+	}
+	if user.Id == 0 {
+		return nil, errors.New("github returned a user without id")
+	}
+
+	// the email on the profile may be private or unverified, the emails
+	// endpoint tells which one is the verified primary address
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, token, g.apiURL+"/user/emails", &emails); err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		Provider: g.Name(),
+		Subject:  strconv.FormatInt(user.Id, 10),
+		Name:     user.Name,
+	}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email = email.Email
+			identity.EmailVerified = email.Verified
+			break
+		}
+	}
+
+	return identity, nil
+}
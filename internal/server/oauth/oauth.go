@@ -0,0 +1,100 @@
+// Package oauth signs users in with external identity providers using the
+// authorization code flow with PKCE.
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+
+	"golang.org/x/oauth2"
+)
+
+var ErrUnknownProvider = errors.New("unknown oauth provider")
+
+// Identity is the account of a user at a provider
+type Identity struct {
+	Provider      string
+	Subject       string // stable id of the account at the provider
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type Provider interface {
+	Name() string
+	// AuthCodeURL is where the browser is sent to sign in, verifier is the
+	// pkce code verifier the callback has to present again
+	AuthCodeURL(state, verifier string) string
+	Exchange(ctx context.Context, code, verifier string) (*Identity, error)
+}
+
+// Providers holds the providers that have a client id configured
+type Providers map[string]Provider
+
+func NewProviders(ctx context.Context, cfg *config.Config) (Providers, error) {
+	providers := Providers{}
+
+	if cfg.OAuth.GitHub.ClientID != "" {
+		providers["github"] = newGitHubProvider(cfg)
+	}
+
+	if cfg.OAuth.Google.ClientID != "" {
+		google, err := newOIDCProvider(ctx, "google", cfg.OAuth.Google.Issuer, cfg.OAuth.Google.ClientID, cfg.OAuth.Google.ClientSecret, redirectURL(cfg, "google"))
+		if err != nil {
+			return nil, err
+		}
+		providers["google"] = google
+	}
+
+	return providers, nil
+}
+
+func (p Providers) Get(name string) (Provider, error) {
+	provider, ok := p[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return provider, nil
+}
+
+func redirectURL(cfg *config.Config, provider string) string {
+	return cfg.OAuth.RedirectBaseURL + "/api/v1/auth/oauth/" + provider + "/callback"
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// getJSON calls url with the access token of the user and decodes the body
+func getJSON(ctx context.Context, token *oauth2.Token, url string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	token.SetAuthHeader(req)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %d: %s", url, resp.StatusCode, body)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(dst)
+}
+
+// exchangeContext makes the oauth2 package use httpClient for the token
+// request
+func exchangeContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+}
@@ -0,0 +1,117 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// oidcProvider finds its endpoints through oidc discovery and reads the
+// identity from the userinfo endpoint
+type oidcProvider struct {
+	name        string
+	config      *oauth2.Config
+	userInfoURL string
+}
+
+func newOIDCProvider(ctx context.Context, name, issuer, clientId, clientSecret, redirectURL string) (*oidcProvider, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to discover %s: status %d", name, resp.StatusCode)
+	}
+
+	var discovery struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return nil, fmt.Errorf("failed to decode %s discovery document: %w", name, err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("%s discovery returned issuer %q, expected %q", name, discovery.Issuer, issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.UserinfoEndpoint == "" {
+		return nil, fmt.Errorf("%s discovery document is missing endpoints", name)
+	}
+
+	return &oidcProvider{
+		name: name,
+		config: &oauth2.Config{
+			ClientID:     clientId,
+			ClientSecret: clientSecret,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  discovery.AuthorizationEndpoint,
+				TokenURL: discovery.TokenEndpoint,
+			},
+			RedirectURL: redirectURL,
+			Scopes:      []string{"openid", "email", "profile"},
+		},
+		userInfoURL: discovery.UserinfoEndpoint,
+	}, nil
+}
+
+func (o *oidcProvider) Name() string {
+	return o.name
+}
+
+func (o *oidcProvider) AuthCodeURL(state, verifier string) string {
+	return o.config.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier))
+}
+
+// Exchange trusts the userinfo response since it is fetched directly from the
+// provider with the access token, the id token is not needed for that
+func (o *oidcProvider) Exchange(ctx context.Context, code, verifier string) (*Identity, error) {
+	token, err := o.config.Exchange(exchangeContext(ctx), code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, err
+	}
+
+	var userInfo struct {
+		Subject       string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified any    `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := getJSON(ctx, token, o.userInfoURL, &userInfo); err != nil {
+		return nil, err
+	}
+	if userInfo.Subject == "" {
+		return nil, errors.New("userinfo response without sub")
+	}
+
+	return &Identity{
+		Provider:      o.name,
+		Subject:       userInfo.Subject,
+		Email:         userInfo.Email,
+		EmailVerified: isTrue(userInfo.EmailVerified),
+		Name:          userInfo.Name,
+	}, nil
+}
+
+// isTrue reads email_verified, some providers send it as a string
+func isTrue(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
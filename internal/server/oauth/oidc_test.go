@@ -0,0 +1,88 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// newMockIdP serves the discovery, token and userinfo endpoints and checks
+// the pkce verifier against the challenge of the authorize url
+func newMockIdP(t *testing.T, challenge *string) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 srv.URL,
+			"authorization_endpoint": srv.URL + "/authorize",
+			"token_endpoint":         srv.URL + "/token",
+			"userinfo_endpoint":      srv.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if r.Form.Get("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != *challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "at", "token_type": "Bearer", "expires_in": 60})
+	})
+	mux.HandleFunc("GET /userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer at" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"sub":            "1234",
+			"email":          "dev@example.com",
+			"email_verified": "true",
+			"name":           "Dev",
+		})
+	})
+
+	return srv
+}
+
+func TestOIDCProvider(t *testing.T) {
+	var challenge string
+	idp := newMockIdP(t, &challenge)
+	defer idp.Close()
+
+	ctx := context.Background()
+	provider, err := newOIDCProvider(ctx, "google", idp.URL, "client", "secret", "http://localhost/callback")
+	if err != nil {
+		t.Fatalf("newOIDCProvider() returned an unexpected error: %v", err)
+	}
+
+	authURL, err := url.Parse(provider.AuthCodeURL("state-1", "verifier-verifier-verifier-verifier-verifier"))
+	if err != nil {
+		t.Fatalf("AuthCodeURL() returned an invalid url: %v", err)
+	}
+	q := authURL.Query()
+	if q.Get("state") != "state-1" || q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("Unexpected authorize url %s", authURL)
+	}
+	challenge = q.Get("code_challenge")
+
+	if _, err := provider.Exchange(ctx, "good-code", "another-verifier"); err == nil {
+		t.Fatalf("Exchange() accepted a wrong pkce verifier")
+	}
+
+	identity, err := provider.Exchange(ctx, "good-code", "verifier-verifier-verifier-verifier-verifier")
+	if err != nil {
+		t.Fatalf("Exchange() returned an unexpected error: %v", err)
+	}
+	if identity.Subject != "1234" || identity.Email != "dev@example.com" || !identity.EmailVerified {
+		t.Fatalf("Unexpected identity %+v", identity)
+	}
+}
@@ -0,0 +1,92 @@
+// Package policy decides what a user may do, either on the whole service
+// as an admin or inside an organization through their member role.
+package policy
+
+import "github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+
+type Action string
+
+const (
+	// service wide, only admins
+	ManageUsersAction      Action = "users.manage"
+	ManageAllTunnelsAction Action = "tunnels.manage_all"
+	ViewAllAuditAction     Action = "audit.view_all"
+
+	// inside an organization
+	ViewOrgAction         Action = "org.view"
+	ManageOrgAction       Action = "org.manage"
+	ManageMembersAction   Action = "org.members.manage"
+	ViewResourcesAction   Action = "org.resources.view"
+	ManageResourcesAction Action = "org.resources.manage"
+)
+
+// Subject is who is asking, Role is empty when the user is not a member of
+// the organization the action is about
+type Subject struct {
+	UserId  int
+	IsAdmin bool
+	Role    models.OrgRole
+}
+
+var roleRank = map[models.OrgRole]int{
+	models.ViewerOrgRole: 1,
+	models.MemberOrgRole: 2,
+	models.AdminOrgRole:  3,
+	models.OwnerOrgRole:  4,
+}
+
+// minimumRole is the lowest member role allowed to perform each
+// organization action
+var minimumRole = map[Action]models.OrgRole{
+	ViewOrgAction:         models.ViewerOrgRole,
+	ViewResourcesAction:   models.ViewerOrgRole,
+	ManageResourcesAction: models.MemberOrgRole,
+	ManageMembersAction:   models.AdminOrgRole,
+	ManageOrgAction:       models.OwnerOrgRole,
+}
+
+// Can reports whether s may perform action. Admins may do everything, so
+// support can step into any organization
+func Can(s Subject, action Action) bool {
+	if s.IsAdmin {
+		return true
+	}
+
+	role, ok := minimumRole[action]
+	if !ok {
+		return false
+	}
+
+	return AtLeast(s.Role, role)
+}
+
+// AtLeast reports whether role ranks at or above min, unknown roles rank
+// below every known one
+func AtLeast(role, min models.OrgRole) bool {
+	return roleRank[role] > 0 && roleRank[role] >= roleRank[min]
+}
+
+// CanAssign reports whether s may change a member from current to role,
+// current is empty for invitations. Only owners hand out or take away the
+// owner role and nobody grants more than they have
+func CanAssign(s Subject, current, role models.OrgRole) bool {
+	if !ValidRole(role) {
+		return false
+	}
+	if s.IsAdmin {
+		return true
+	}
+	if !Can(s, ManageMembersAction) {
+		return false
+	}
+	if current == models.OwnerOrgRole && s.Role != models.OwnerOrgRole {
+		return false
+	}
+
+	return AtLeast(s.Role, role)
+}
+
+func ValidRole(role models.OrgRole) bool {
+	_, ok := roleRank[role]
+	return ok
+}
@@ -0,0 +1,78 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+)
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		subject Subject
+		action  Action
+		want    bool
+	}{
+		{Subject{Role: models.ViewerOrgRole}, ViewResourcesAction, true},
+		{Subject{Role: models.ViewerOrgRole}, ManageResourcesAction, false},
+		{Subject{Role: models.MemberOrgRole}, ManageResourcesAction, true},
+		{Subject{Role: models.MemberOrgRole}, ManageMembersAction, false},
+		{Subject{Role: models.AdminOrgRole}, ManageMembersAction, true},
+		{Subject{Role: models.AdminOrgRole}, ManageOrgAction, false},
+		{Subject{Role: models.OwnerOrgRole}, ManageOrgAction, true},
+		{Subject{}, ViewOrgAction, false},
+		{Subject{Role: models.OwnerOrgRole}, ManageUsersAction, false},
+		{Subject{IsAdmin: true}, ManageUsersAction, true},
+		{Subject{IsAdmin: true}, ManageOrgAction, true},
+	}
+
+	for _, tt := range tests {
+		if got := Can(tt.subject, tt.action); got != tt.want {
+			t.Fatalf("Can(%+v, %s) = %v, want %v", tt.subject, tt.action, got, tt.want)
+		}
+	}
+}
+
+func TestCanAssign(t *testing.T) {
+	admin := Subject{Role: models.AdminOrgRole}
+	owner := Subject{Role: models.OwnerOrgRole}
+
+	if !CanAssign(admin, models.ViewerOrgRole, models.MemberOrgRole) {
+		t.Fatalf("Expected an admin to promote a viewer to member")
+	}
+	if CanAssign(admin, "", models.OwnerOrgRole) {
+		t.Fatalf("Expected an admin not to invite an owner")
+	}
+	if CanAssign(admin, models.OwnerOrgRole, models.MemberOrgRole) {
+		t.Fatalf("Expected an admin not to demote an owner")
+	}
+	if !CanAssign(owner, models.OwnerOrgRole, models.AdminOrgRole) {
+		t.Fatalf("Expected an owner to demote another owner")
+	}
+	if CanAssign(owner, models.MemberOrgRole, models.OrgRole("root")) {
+		t.Fatalf("Expected an unknown role to be rejected")
+	}
+	if CanAssign(Subject{Role: models.MemberOrgRole}, "", models.ViewerOrgRole) {
+		t.Fatalf("Expected a member not to invite anyone")
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	if !HasScope(nil, models.TunnelHttpScope) {
+		t.Fatalf("Expected a key without scopes to open http tunnels")
+	}
+	if HasScope(nil, models.DomainsWriteScope) {
+		t.Fatalf("Expected a key without scopes to not manage domains")
+	}
+
+	granted := []string{string(models.DomainsReadScope)}
+	if !HasScope(granted, models.DomainsReadScope) {
+		t.Fatalf("Expected %v to grant domains:read", granted)
+	}
+	if HasScope(granted, models.TunnelTcpScope) {
+		t.Fatalf("Expected %v to not grant tunnel:tcp", granted)
+	}
+
+	if ValidScope("tunnel:udp") {
+		t.Fatalf("Expected tunnel:udp to be an unknown scope")
+	}
+}
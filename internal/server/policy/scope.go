@@ -0,0 +1,35 @@
+package policy
+
+import (
+	"slices"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+)
+
+var scopes = []models.APIKeyScope{
+	models.TunnelHttpScope,
+	models.TunnelTcpScope,
+	models.DomainsReadScope,
+	models.DomainsWriteScope,
+	models.APIReadScope,
+}
+
+// DefaultScopes are given to keys created without scopes and to keys
+// created before scopes existed, they only open tunnels
+var DefaultScopes = []string{
+	string(models.TunnelHttpScope),
+	string(models.TunnelTcpScope),
+}
+
+func ValidScope(scope string) bool {
+	return slices.Contains(scopes, models.APIKeyScope(scope))
+}
+
+// HasScope reports whether a key with the granted permissions may use
+// scope, an empty list means the key predates scopes and gets the defaults
+func HasScope(granted []string, scope models.APIKeyScope) bool {
+	if len(granted) == 0 {
+		granted = DefaultScopes
+	}
+	return slices.Contains(granted, string(scope))
+}
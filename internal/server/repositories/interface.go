@@ -1,26 +1,94 @@
 package repositories
 
 import (
+	"context"
 	"time"
 
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
 )
 
+// UserRepo stores the users, UpdateUserEmail marks the new email as verified
+// so it must only be called once the user proved they own it.
+// ScheduleDeletion soft deletes a user until purgeAt, PurgeDeletedUsers
+// deletes the users whose purgeAt passed, scrubs their email from the audit
+// events and otps, and returns their ids. Suspend and Unsuspend return
+// ErrNotFound when there is nothing to change
 type UserRepo interface {
-	ListUsers(limit, offset int) ([]models.User, error)
+	ListUsers(filter models.UserFilter, after *models.Cursor, limit int) ([]models.User, error)
+	CountUsers(filter models.UserFilter) (int, error)
 	GetById(userId int) (*models.User, error)
 	GetByEmail(email string) (*models.User, error)
 	Create(user *models.User) error
 	Delete(userId int) error
 	VerifyUserEmail(id int) error
 	UpdateUserPassword(email string, passwdHash []byte) error
+	UpdateUserName(userId int, name string) (*models.User, error)
+	UpdateUserEmail(userId int, email string) (*models.User, error)
+	ScheduleDeletion(userId int, purgeAt time.Time) error
+	CancelDeletion(userId int) error
+	PurgeDeletedUsers() ([]int, error)
+	UpdateUserPlan(userId int, plan string) error
+	Suspend(userId int) error
+	Unsuspend(userId int) error
+	SetAdmin(userId int, isAdmin bool) error
 }
 
+type IdentityRepo interface {
+	CreateIdentity(identity *models.UserIdentity) error
+	GetIdentity(provider, subject string) (*models.UserIdentity, error)
+	ListIdentities(userId int) ([]models.UserIdentity, error)
+	DeleteIdentity(userId, identityId int) error
+}
+
+// OAuthStateRepo keeps the state and pkce verifier of pending oauth logins,
+// TakeState returns a state only once
+type OAuthStateRepo interface {
+	SaveState(state string, data *models.OAuthState, ttl time.Duration) error
+	TakeState(state string) (*models.OAuthState, error)
+}
+
+// TotpRepo stores the totp secrets and recovery codes of users, UseTotpStep
+// and UseRecoveryCode report false when the step or code was already used
+type TotpRepo interface {
+	CreateTotp(userId int, secret string) error
+	GetTotp(userId int) (*models.Totp, error)
+	EnableTotp(userId int) error
+	UseTotpStep(userId int, step int64) (bool, error)
+	DeleteTotp(userId int) error
+	ReplaceRecoveryCodes(userId int, codeHashes []string) error
+	UseRecoveryCode(userId int, codeHash string) (bool, error)
+	CountRecoveryCodes(userId int) (int, error)
+}
+
+type MfaRepo interface {
+	CreateChallenge(userId int, ttl time.Duration) (*models.MfaChallenge, error)
+	GetChallenge(token string) (*models.MfaChallenge, error)
+	FailChallenge(challenge *models.MfaChallenge) error
+	DeleteChallenge(token string) error
+}
+
+// APIRepo stores api keys, GetAPIKey also finds a key by the secret its last
+// rotation replaced until that secret expires. The Rotate methods swap in the
+// Prefix and APIKeyHash of apiKey and fill in the rest of it.
+// CheckAPIKeyValid and RevokeAPIKey only accept the secrets GetAPIKey finds
+// on a key that did not expire, RevokeAPIKey expires the key of a current
+// secret and only ends the grace period of a replaced one
 type APIRepo interface {
 	CreateAPIKey(apiKey *models.APIKey) error
-	ListAPIKeys(userId, limit, offset int) ([]models.APIKey, error)
+	ListAPIKeys(userId int, after *models.Cursor, limit int) ([]models.APIKey, error)
+	CountAPIKeys(userId int) (int, error)
 	CheckAPIKeyValid(apikey string) (bool, error)
+	GetAPIKey(apiKeyHash string) (*models.APIKey, error)
 	DeleteAPIKey(userId, keyId int) error
+	RevokeAPIKey(apiKeyHash string) (*models.APIKey, error)
+	RotateAPIKey(userId int, apiKey *models.APIKey, previousExpiresAt time.Time) error
+	UpdateAPIKeyLabels(userId, keyId int, labels map[string]string) error
+	ListOrgAPIKeys(orgId int, after *models.Cursor, limit int) ([]models.APIKey, error)
+	CountOrgAPIKeys(orgId int) (int, error)
+	DeleteOrgAPIKey(orgId, keyId int) error
+	RotateOrgAPIKey(orgId int, apiKey *models.APIKey, previousExpiresAt time.Time) error
+	UpdateOrgAPIKeyLabels(orgId, keyId int, labels map[string]string) error
+	RecordAPIKeyUses(uses []models.APIKeyUse) error
 }
 
 type EmailOtpRepo interface {
@@ -32,3 +100,130 @@ type EmailOtpRepo interface {
 	CountOtpsAfterUtcTime(email string, otpType models.OtpType, after time.Time) (int, error)
 	IncreaseAttemptAndInvalidateOtp(id int) error
 }
+
+type PlanRepo interface {
+	GetPlan(name string) (*models.Plan, error)
+	ListPlans() ([]models.Plan, error)
+}
+
+// DomainRepo stores reserved domains, the lists page newest first by
+// (created_at, id). CountDomains counts every domain a user reserved for the
+// plan quota, CountUserDomains only the ones outside an organization
+type DomainRepo interface {
+	CreateDomain(domain *models.ReservedDomain) error
+	ListDomains(userId int, after *models.Cursor, limit int) ([]models.ReservedDomain, error)
+	GetDomainByHostname(hostname string) (*models.ReservedDomain, error)
+	CountDomains(userId int) (int, error)
+	CountUserDomains(userId int) (int, error)
+	DeleteDomain(userId, domainId int) error
+	ListOrgDomains(orgId int, after *models.Cursor, limit int) ([]models.ReservedDomain, error)
+	CountOrgDomains(orgId int) (int, error)
+	DeleteOrgDomain(orgId, domainId int) error
+}
+
+// OrgRepo stores organizations, their members and pending invitations,
+// creating an organization makes its creator the first owner
+type OrgRepo interface {
+	CreateOrg(org *models.Organization, ownerId int) error
+	GetOrg(orgId int) (*models.Organization, error)
+	ListUserOrgs(userId int) ([]models.Organization, error)
+	RenameOrg(orgId int, name string) error
+	DeleteOrg(orgId int) error
+	GetMember(orgId, userId int) (*models.OrgMember, error)
+	ListMembers(orgId int) ([]models.OrgMember, error)
+	CountOwners(orgId int) (int, error)
+	UpdateMemberRole(orgId, userId int, role models.OrgRole) error
+	RemoveMember(orgId, userId int) error
+	CreateInvitation(invitation *models.OrgInvitation) error
+	ListInvitations(orgId int) ([]models.OrgInvitation, error)
+	GetInvitationByToken(tokenHash string) (*models.OrgInvitation, error)
+	DeleteInvitation(orgId, invitationId int) error
+	AcceptInvitation(invitationId, userId int) (int, error)
+}
+
+type UsageRepo interface {
+	AddUsage(userId int, bytesIn, bytesOut int64) error
+	GetCurrentMonthUsage(userId int) (int64, error)
+	ListUsage(userId int, after *models.Cursor, limit int) ([]models.TunnelUsage, error)
+	CountUsage(userId int) (int, error)
+}
+
+// AccessLogRepo stores the access logs of http tunnels, ListAccessLogs and
+// CountAccessLogs cover the logs of every user when userId is 0
+type AccessLogRepo interface {
+	CreateAccessLogs(logs []models.AccessLog) error
+	// ListAccessLogs pages newest first by (created_at, id) so logs written
+	// while paging do not shift the pages
+	ListAccessLogs(tunnelId string, userId int, after *models.Cursor, limit int) ([]models.AccessLog, error)
+	CountAccessLogs(tunnelId string, userId int) (int, error)
+}
+
+// AuditRepo stores audit events, ListEvents returns the events of every
+// actor when actorId is 0
+type AuditRepo interface {
+	CreateEvent(event *models.AuditEvent) error
+	ListEvents(actorId int, after *models.Cursor, limit int) ([]models.AuditEvent, error)
+	CountEvents(actorId int) (int, error)
+}
+
+// TunnelRepo is the registry of live tunnels, agent sessions and nodes shared
+// between the nat-server nodes and the api server
+type TunnelRepo interface {
+	SaveTunnel(tunnel *models.Tunnel, ttl time.Duration) error
+	DeleteTunnel(tunnel *models.Tunnel) error
+	GetTunnel(id string) (*models.Tunnel, error)
+	ListUserTunnels(userId int) ([]models.Tunnel, error)
+	ListOrgTunnels(orgId int) ([]models.Tunnel, error)
+	ListTunnels() ([]models.Tunnel, error)
+	RequestDisconnect(sessionId string) error
+	SubscribeDisconnects(ctx context.Context) (<-chan string, error)
+	ClaimHostname(hostname, nodeId string, ttl time.Duration) (bool, error)
+	ReleaseHostname(hostname, nodeId string) error
+	GetHostnameOwner(hostname string) (string, error)
+	SaveAgentSession(session *models.AgentSession, ttl time.Duration) error
+	DeleteAgentSession(session *models.AgentSession) error
+	CountUserAgentSessions(userId int) (int, error)
+	CountUserTunnels(userId int, tunnelType models.TunnelType) (int, error)
+	ListAPIKeyAgentSessions(apiKeyId int) ([]models.AgentSession, error)
+	SaveNode(node *models.Node, ttl time.Duration) error
+	GetNode(id string) (*models.Node, error)
+}
+
+// RateLimiter counts the hits of a key in a sliding window shared by every
+// api server, Hit also counts the hits it rejects
+type RateLimiter interface {
+	Hit(key string, limit int, window time.Duration) (*models.RateLimit, error)
+}
+
+// LoginLockRepo counts failed logins per account and per ip within a
+// window and keeps the locks they lead to, ListLocks only returns locks that
+// did not expire yet
+type LoginLockRepo interface {
+	RecordFailure(kind models.LoginLockKind, subject string, window time.Duration) (*models.LoginFailures, error)
+	GetFailures(kind models.LoginLockKind, subject string) (*models.LoginFailures, error)
+	ClearFailures(kind models.LoginLockKind, subject string) error
+	Lock(lock *models.LoginLock) error
+	GetLock(kind models.LoginLockKind, subject string) (*models.LoginLock, error)
+	ListLocks() ([]models.LoginLock, error)
+	Unlock(kind models.LoginLockKind, subject string) error
+}
+
+// TokenRevocationRepo denies access tokens before they expire
+type TokenRevocationRepo interface {
+	RevokeToken(tokenUuid string, ttl time.Duration) error
+	RevokeSession(sessionId string, ttl time.Duration) error
+	RevokeUserTokens(userId int, ttl time.Duration) error
+	IsTokenRevoked(userId int, sessionId, tokenUuid string, issuedAt time.Time) (bool, error)
+}
+
+// SessionRepo keeps the signed in sessions of users and the refresh tokens
+// issued to them
+type SessionRepo interface {
+	CreateSession(session *models.Session, refreshTokenId string, ttl time.Duration) error
+	RotateRefreshToken(refreshTokenId, newRefreshTokenId, ip, userAgent string, ttl time.Duration) (*models.Session, error)
+	GetSessionByRefreshToken(refreshTokenId string) (*models.Session, error)
+	GetSession(id string) (*models.Session, error)
+	ListUserSessions(userId int) ([]models.Session, error)
+	DeleteSession(session *models.Session) error
+	DeleteUserSessions(userId int) error
+}
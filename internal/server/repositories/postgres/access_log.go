@@ -0,0 +1,119 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/sqlc"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type accessLogRepo struct {
+	queries sqlc.Querier
+}
+
+func NewAccessLogRepo(pool *pgxpool.Pool) (*accessLogRepo, error) {
+	if pool == nil {
+		return nil, errors.New("no pgx pool provided")
+	}
+
+	return &accessLogRepo{
+		queries: sqlc.New(pool),
+	}, nil
+}
+
+// CreateAccessLogs writes a batch of logs with a single COPY
+func (a *accessLogRepo) CreateAccessLogs(logs []models.AccessLog) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows := make([]sqlc.CreateTunnelAccessLogsParams, 0, len(logs))
+	for _, log := range logs {
+		rows = append(rows, sqlc.CreateTunnelAccessLogsParams{
+			TunnelID:          log.TunnelId,
+			SessionID:         log.SessionId,
+			UserID:            int32(log.UserId),
+			RequestID:         log.RequestId,
+			Hostname:          log.Hostname,
+			Method:            log.Method,
+			Path:              log.Path,
+			Status:            int32(log.Status),
+			RemoteAddr:        log.RemoteAddr,
+			UpstreamLatencyMs: log.UpstreamLatencyMs,
+			BytesIn:           log.BytesIn,
+			BytesOut:          log.BytesOut,
+			CreatedAt:         pgtype.Timestamptz{Time: log.CreatedAt, Valid: true},
+		})
+	}
+
+	_, err := a.queries.CreateTunnelAccessLogs(ctx, rows)
+	if err != nil {
+		return fmt.Errorf("failed to create access logs: %w", err)
+	}
+
+	return nil
+}
+
+func (a *accessLogRepo) ListAccessLogs(tunnelId string, userId int, after *models.Cursor, limit int) ([]models.AccessLog, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	dbLogs, err := a.queries.ListTunnelAccessLogs(ctx, sqlc.ListTunnelAccessLogsParams{
+		TunnelID:   tunnelId,
+		UserID:     pgtype.Int4{Int32: int32(userId), Valid: userId != 0},
+		CursorID:   cursorInt8(after),
+		CursorTime: cursorTime(after),
+		RowLimit:   int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list access logs: %w", err)
+	}
+
+	return toAccessLogs(dbLogs), nil
+}
+
+func (a *accessLogRepo) CountAccessLogs(tunnelId string, userId int) (int, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	count, err := a.queries.CountTunnelAccessLogs(ctx, sqlc.CountTunnelAccessLogsParams{
+		TunnelID: tunnelId,
+		UserID:   pgtype.Int4{Int32: int32(userId), Valid: userId != 0},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count access logs: %w", err)
+	}
+
+	return int(count), nil
+}
+
+func toAccessLogs(dbLogs []sqlc.TunnelAccessLog) []models.AccessLog {
+	logs := []models.AccessLog{}
+	for _, row := range dbLogs {
+		logs = append(logs, models.AccessLog{
+			Id:                row.ID,
+			TunnelId:          row.TunnelID,
+			SessionId:         row.SessionID,
+			UserId:            int(row.UserID),
+			RequestId:         row.RequestID,
+			Hostname:          row.Hostname,
+			Method:            row.Method,
+			Path:              row.Path,
+			Status:            int(row.Status),
+			RemoteAddr:        row.RemoteAddr,
+			UpstreamLatencyMs: row.UpstreamLatencyMs,
+			BytesIn:           row.BytesIn,
+			BytesOut:          row.BytesOut,
+			CreatedAt:         row.CreatedAt.Time,
+		})
+	}
+	return logs
+}
@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -10,6 +11,7 @@ import (
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/sqlc"
 
 	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -45,13 +47,20 @@ func (a *apiKeyRepo) CreateAPIKey(apiKey *models.APIKey) error {
 		}
 	}
 
+	metadata, err := encodeLabels(apiKey.Labels)
+	if err != nil {
+		return err
+	}
+
 	createdAPIKey, err := a.queries.CreateAPIKey(ctx, sqlc.CreateAPIKeyParams{
 		Name:        apiKey.Name,
 		Prefix:      apiKey.Prefix,
 		ApiKey:      apiKey.APIKeyHash,
 		UserID:      int32(apiKey.UserId),
 		Permissions: apiKey.Permissions,
+		Metadata:    metadata,
 		ExpiresAt:   expiredAt,
+		OrgID:       pgtype.Int4{Int32: int32(apiKey.OrgId), Valid: apiKey.OrgId != 0},
 	})
 	if err != nil {
 		var pgErr *pgconn.PgError
@@ -69,32 +78,43 @@ func (a *apiKeyRepo) CreateAPIKey(apiKey *models.APIKey) error {
 	return nil
 }
 
-func (a *apiKeyRepo) ListAPIKeys(userId, limit, offset int) ([]models.APIKey, error) {
+func (a *apiKeyRepo) ListAPIKeys(userId int, after *models.Cursor, limit int) ([]models.APIKey, error) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
 	defer cancel()
 
 	keys, err := a.queries.ListAPIKeys(ctx, sqlc.ListAPIKeysParams{
-		UserID: int32(userId),
-		Limit:  int32(limit),
-		Offset: int32(offset),
+		UserID:     int32(userId),
+		CursorID:   cursorInt4(after),
+		CursorTime: cursorTime(after),
+		RowLimit:   int32(limit),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list api key: %w", err)
 	}
 
-	var modelKeys []models.APIKey
+	modelKeys := []models.APIKey{}
 
 	for _, v := range keys {
+		labels, err := decodeLabels(v.Metadata)
+		if err != nil {
+			return nil, err
+		}
+
 		modelKey := models.APIKey{
-			Id:          int(v.ID),
-			Name:        v.Name,
-			Prefix:      v.Prefix,
-			APIKeyHash:  v.ApiKey,
-			UserId:      int(v.UserID),
-			ExpireAt:    v.ExpiresAt.Time,
-			CreatedAt:   v.CreatedAt.Time,
-			Permissions: v.Permissions,
+			Id:                int(v.ID),
+			Name:              v.Name,
+			Prefix:            v.Prefix,
+			APIKeyHash:        v.ApiKey,
+			UserId:            int(v.UserID),
+			ExpireAt:          v.ExpiresAt.Time,
+			CreatedAt:         v.CreatedAt.Time,
+			Permissions:       v.Permissions,
+			Labels:            labels,
+			PreviousExpiresAt: v.PreviousExpiresAt.Time,
+			RotatedAt:         v.RotatedAt.Time,
+			LastUsedAt:        v.LastUsedAt.Time,
+			LastUsedIp:        v.LastUsedIp.String,
 		}
 
 		modelKeys = append(modelKeys, modelKey)
@@ -103,6 +123,75 @@ func (a *apiKeyRepo) ListAPIKeys(userId, limit, offset int) ([]models.APIKey, er
 	return modelKeys, nil
 }
 
+func (a *apiKeyRepo) ListOrgAPIKeys(orgId int, after *models.Cursor, limit int) ([]models.APIKey, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	keys, err := a.queries.ListOrgAPIKeys(ctx, sqlc.ListOrgAPIKeysParams{
+		OrgID:      pgtype.Int4{Int32: int32(orgId), Valid: true},
+		CursorID:   cursorInt4(after),
+		CursorTime: cursorTime(after),
+		RowLimit:   int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list org api key: %w", err)
+	}
+
+	modelKeys := []models.APIKey{}
+	for _, v := range keys {
+		labels, err := decodeLabels(v.Metadata)
+		if err != nil {
+			return nil, err
+		}
+
+		modelKeys = append(modelKeys, models.APIKey{
+			Id:                int(v.ID),
+			Name:              v.Name,
+			Prefix:            v.Prefix,
+			APIKeyHash:        v.ApiKey,
+			UserId:            int(v.UserID),
+			OrgId:             int(v.OrgID.Int32),
+			ExpireAt:          v.ExpiresAt.Time,
+			CreatedAt:         v.CreatedAt.Time,
+			Permissions:       v.Permissions,
+			Labels:            labels,
+			PreviousExpiresAt: v.PreviousExpiresAt.Time,
+			RotatedAt:         v.RotatedAt.Time,
+			LastUsedAt:        v.LastUsedAt.Time,
+			LastUsedIp:        v.LastUsedIp.String,
+		})
+	}
+
+	return modelKeys, nil
+}
+
+func (a *apiKeyRepo) CountAPIKeys(userId int) (int, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	count, err := a.queries.CountAPIKeys(ctx, int32(userId))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count api keys: %w", err)
+	}
+
+	return int(count), nil
+}
+
+func (a *apiKeyRepo) CountOrgAPIKeys(orgId int) (int, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	count, err := a.queries.CountOrgAPIKeys(ctx, pgtype.Int4{Int32: int32(orgId), Valid: true})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count org api keys: %w", err)
+	}
+
+	return int(count), nil
+}
+
 func (a *apiKeyRepo) DeleteAPIKey(userId, keyId int) error {
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
@@ -123,6 +212,26 @@ func (a *apiKeyRepo) DeleteAPIKey(userId, keyId int) error {
 	return nil
 }
 
+func (a *apiKeyRepo) DeleteOrgAPIKey(orgId, keyId int) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	rows, err := a.queries.DeleteOrgAPIKey(ctx, sqlc.DeleteOrgAPIKeyParams{
+		ID:    int32(keyId),
+		OrgID: pgtype.Int4{Int32: int32(orgId), Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete org api key: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
 func (a *apiKeyRepo) CheckAPIKeyValid(apikey string) (bool, error) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
@@ -135,3 +244,227 @@ func (a *apiKeyRepo) CheckAPIKeyValid(apikey string) (bool, error) {
 
 	return valid, nil
 }
+
+func (a *apiKeyRepo) GetAPIKey(apiKeyHash string) (*models.APIKey, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	key, err := a.queries.GetAPIKey(ctx, apiKeyHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	return toAPIKey(key)
+}
+
+func (a *apiKeyRepo) RevokeAPIKey(apiKeyHash string) (*models.APIKey, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	key, err := a.queries.RevokeAPIKey(ctx, apiKeyHash)
+	if err == nil {
+		return toAPIKey(key)
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to revoke api key: %w", err)
+	}
+
+	// a secret replaced by a rotation only loses its grace period, the key
+	// itself keeps working with its current secret
+	key, err = a.queries.RevokePreviousAPIKey(ctx, pgtype.Text{String: apiKeyHash, Valid: true})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to revoke previous api key: %w", err)
+	}
+
+	return toAPIKey(key)
+}
+
+func (a *apiKeyRepo) RotateAPIKey(userId int, apiKey *models.APIKey, previousExpiresAt time.Time) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	key, err := a.queries.RotateAPIKey(ctx, sqlc.RotateAPIKeyParams{
+		PreviousExpiresAt: pgtype.Timestamptz{Time: previousExpiresAt, Valid: !previousExpiresAt.IsZero()},
+		ApiKey:            apiKey.APIKeyHash,
+		Prefix:            apiKey.Prefix,
+		ID:                int32(apiKey.Id),
+		UserID:            int32(userId),
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to rotate api key: %w", err)
+	}
+
+	return fillRotatedAPIKey(apiKey, key)
+}
+
+func (a *apiKeyRepo) RotateOrgAPIKey(orgId int, apiKey *models.APIKey, previousExpiresAt time.Time) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	key, err := a.queries.RotateOrgAPIKey(ctx, sqlc.RotateOrgAPIKeyParams{
+		PreviousExpiresAt: pgtype.Timestamptz{Time: previousExpiresAt, Valid: !previousExpiresAt.IsZero()},
+		ApiKey:            apiKey.APIKeyHash,
+		Prefix:            apiKey.Prefix,
+		ID:                int32(apiKey.Id),
+		OrgID:             pgtype.Int4{Int32: int32(orgId), Valid: true},
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to rotate org api key: %w", err)
+	}
+
+	return fillRotatedAPIKey(apiKey, key)
+}
+
+func (a *apiKeyRepo) UpdateAPIKeyLabels(userId, keyId int, labels map[string]string) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	metadata, err := encodeLabels(labels)
+	if err != nil {
+		return err
+	}
+
+	rows, err := a.queries.UpdateAPIKeyMetadata(ctx, sqlc.UpdateAPIKeyMetadataParams{
+		Metadata: metadata,
+		ID:       int32(keyId),
+		UserID:   int32(userId),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update api key labels: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (a *apiKeyRepo) UpdateOrgAPIKeyLabels(orgId, keyId int, labels map[string]string) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	metadata, err := encodeLabels(labels)
+	if err != nil {
+		return err
+	}
+
+	rows, err := a.queries.UpdateOrgAPIKeyMetadata(ctx, sqlc.UpdateOrgAPIKeyMetadataParams{
+		Metadata: metadata,
+		ID:       int32(keyId),
+		OrgID:    pgtype.Int4{Int32: int32(orgId), Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update org api key labels: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (a *apiKeyRepo) RecordAPIKeyUses(uses []models.APIKeyUse) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	params := sqlc.UpdateAPIKeysLastUsedParams{
+		Ids:     make([]int32, 0, len(uses)),
+		UsedAts: make([]pgtype.Timestamptz, 0, len(uses)),
+		Ips:     make([]string, 0, len(uses)),
+	}
+	for _, use := range uses {
+		params.Ids = append(params.Ids, int32(use.KeyId))
+		params.UsedAts = append(params.UsedAts, pgtype.Timestamptz{Time: use.UsedAt, Valid: true})
+		params.Ips = append(params.Ips, use.Ip)
+	}
+
+	if err := a.queries.UpdateAPIKeysLastUsed(ctx, params); err != nil {
+		return fmt.Errorf("failed to record api key uses: %w", err)
+	}
+
+	return nil
+}
+
+func toAPIKey(key sqlc.ApiKey) (*models.APIKey, error) {
+	labels, err := decodeLabels(key.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.APIKey{
+		Id:                int(key.ID),
+		Name:              key.Name,
+		Prefix:            key.Prefix,
+		APIKeyHash:        key.ApiKey,
+		UserId:            int(key.UserID),
+		OrgId:             int(key.OrgID.Int32),
+		ExpireAt:          key.ExpiresAt.Time,
+		CreatedAt:         key.CreatedAt.Time,
+		Permissions:       key.Permissions,
+		Labels:            labels,
+		PreviousExpiresAt: key.PreviousExpiresAt.Time,
+		RotatedAt:         key.RotatedAt.Time,
+		LastUsedAt:        key.LastUsedAt.Time,
+		LastUsedIp:        key.LastUsedIp.String,
+	}, nil
+}
+
+// fillRotatedAPIKey copies key into apiKey, keeping the new secret the
+// caller still has to hand out
+func fillRotatedAPIKey(apiKey *models.APIKey, key sqlc.ApiKey) error {
+	rotated, err := toAPIKey(key)
+	if err != nil {
+		return err
+	}
+
+	rotated.APIkeyToken = apiKey.APIkeyToken
+	*apiKey = *rotated
+	return nil
+}
+
+// labels live in the metadata column, keys created before labels have
+// no metadata at all
+func encodeLabels(labels map[string]string) ([]byte, error) {
+	if len(labels) == 0 {
+		return nil, nil
+	}
+
+	metadata, err := json.Marshal(labels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode api key labels: %w", err)
+	}
+	return metadata, nil
+}
+
+func decodeLabels(metadata []byte) (map[string]string, error) {
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+
+	var labels map[string]string
+	if err := json.Unmarshal(metadata, &labels); err != nil {
+		return nil, fmt.Errorf("failed to decode api key labels: %w", err)
+	}
+	return labels, nil
+}
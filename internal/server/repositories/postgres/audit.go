@@ -0,0 +1,111 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/sqlc"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type auditRepo struct {
+	queries sqlc.Querier
+}
+
+func NewAuditRepo(pool *pgxpool.Pool) (*auditRepo, error) {
+	if pool == nil {
+		return nil, errors.New("no pgx pool provided")
+	}
+
+	return &auditRepo{
+		queries: sqlc.New(pool),
+	}, nil
+}
+
+func (a *auditRepo) CreateEvent(event *models.AuditEvent) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	metadata := []byte("{}")
+	if len(event.Metadata) > 0 {
+		var err error
+		metadata, err = json.Marshal(event.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit event metadata: %w", err)
+		}
+	}
+
+	row, err := a.queries.CreateAuditEvent(ctx, sqlc.CreateAuditEventParams{
+		ActorID:    pgtype.Int4{Int32: int32(event.ActorId), Valid: event.ActorId != 0},
+		Action:     string(event.Action),
+		TargetType: event.TargetType,
+		TargetID:   event.TargetId,
+		Ip:         event.IP,
+		UserAgent:  event.UserAgent,
+		Metadata:   metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create audit event: %w", err)
+	}
+
+	event.Id = row.ID
+	event.CreatedAt = row.CreatedAt.Time
+
+	return nil
+}
+
+func (a *auditRepo) CountEvents(actorId int) (int, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	count, err := a.queries.CountAuditEvents(ctx, pgtype.Int4{Int32: int32(actorId), Valid: actorId != 0})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count audit events: %w", err)
+	}
+
+	return int(count), nil
+}
+
+func (a *auditRepo) ListEvents(actorId int, after *models.Cursor, limit int) ([]models.AuditEvent, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	dbEvents, err := a.queries.ListAuditEvents(ctx, sqlc.ListAuditEventsParams{
+		ActorID:    pgtype.Int4{Int32: int32(actorId), Valid: actorId != 0},
+		CursorID:   cursorInt8(after),
+		CursorTime: cursorTime(after),
+		RowLimit:   int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+
+	events := []models.AuditEvent{}
+	for _, row := range dbEvents {
+		event := models.AuditEvent{
+			Id:         row.ID,
+			ActorId:    int(row.ActorID.Int32),
+			Action:     models.AuditAction(row.Action),
+			TargetType: row.TargetType,
+			TargetId:   row.TargetID,
+			IP:         row.Ip,
+			UserAgent:  row.UserAgent,
+			CreatedAt:  row.CreatedAt.Time,
+		}
+		if err := json.Unmarshal(row.Metadata, &event.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to decode audit event metadata: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,38 @@
+package postgres
+
+import (
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// the keyset queries skip the cursor condition when the cursor id is null,
+// which is the case for the first page
+
+func cursorInt4(after *models.Cursor) pgtype.Int4 {
+	if after == nil {
+		return pgtype.Int4{}
+	}
+	return pgtype.Int4{Int32: int32(after.Id), Valid: true}
+}
+
+func cursorInt8(after *models.Cursor) pgtype.Int8 {
+	if after == nil {
+		return pgtype.Int8{}
+	}
+	return pgtype.Int8{Int64: after.Id, Valid: true}
+}
+
+func cursorTime(after *models.Cursor) pgtype.Timestamptz {
+	if after == nil {
+		return pgtype.Timestamptz{}
+	}
+	return pgtype.Timestamptz{Time: after.Time, Valid: true}
+}
+
+func cursorValue(after *models.Cursor) pgtype.Text {
+	if after == nil {
+		return pgtype.Text{}
+	}
+	return pgtype.Text{String: after.Value, Valid: true}
+}
@@ -0,0 +1,209 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/sqlc"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type domainRepo struct {
+	queries sqlc.Querier
+}
+
+func NewDomainRepo(pool *pgxpool.Pool) (*domainRepo, error) {
+	if pool == nil {
+		return nil, errors.New("no pgx pool provided")
+	}
+
+	return &domainRepo{
+		queries: sqlc.New(pool),
+	}, nil
+}
+
+func (d *domainRepo) CreateDomain(domain *models.ReservedDomain) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	createdRow, err := d.queries.CreateReservedDomain(ctx, sqlc.CreateReservedDomainParams{
+		Hostname: domain.Hostname,
+		UserID:   int32(domain.UserId),
+		OrgID:    pgtype.Int4{Int32: int32(domain.OrgId), Valid: domain.OrgId != 0},
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			if pgErr.Code == pgerrcode.UniqueViolation {
+				return fmt.Errorf("%w: %w", ErrUniqueViolation, err)
+			}
+		}
+		return fmt.Errorf("failed to create reserved domain: %w", err)
+	}
+
+	domain.Id = int(createdRow.ID)
+	domain.CreatedAt = createdRow.CreatedAt.Time
+
+	return nil
+}
+
+func (d *domainRepo) ListDomains(userId int, after *models.Cursor, limit int) ([]models.ReservedDomain, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	dbDomains, err := d.queries.ListReservedDomains(ctx, sqlc.ListReservedDomainsParams{
+		UserID:     int32(userId),
+		CursorID:   cursorInt4(after),
+		CursorTime: cursorTime(after),
+		RowLimit:   int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reserved domains: %w", err)
+	}
+
+	domains := []models.ReservedDomain{}
+	for _, dbDomain := range dbDomains {
+		domains = append(domains, toDomain(dbDomain))
+	}
+
+	return domains, nil
+}
+
+func (d *domainRepo) ListOrgDomains(orgId int, after *models.Cursor, limit int) ([]models.ReservedDomain, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	dbDomains, err := d.queries.ListOrgReservedDomains(ctx, sqlc.ListOrgReservedDomainsParams{
+		OrgID:      pgtype.Int4{Int32: int32(orgId), Valid: true},
+		CursorID:   cursorInt4(after),
+		CursorTime: cursorTime(after),
+		RowLimit:   int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list org reserved domains: %w", err)
+	}
+
+	domains := []models.ReservedDomain{}
+	for _, dbDomain := range dbDomains {
+		domains = append(domains, toDomain(dbDomain))
+	}
+
+	return domains, nil
+}
+
+func (d *domainRepo) GetDomainByHostname(hostname string) (*models.ReservedDomain, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	dbDomain, err := d.queries.GetReservedDomainByHostname(ctx, hostname)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get reserved domain by hostname: %w", err)
+	}
+
+	domain := toDomain(dbDomain)
+	return &domain, nil
+}
+
+func (d *domainRepo) CountDomains(userId int) (int, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	count, err := d.queries.CountReservedDomains(ctx, int32(userId))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count reserved domains: %w", err)
+	}
+
+	return int(count), nil
+}
+
+func (d *domainRepo) CountUserDomains(userId int) (int, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	count, err := d.queries.CountUserReservedDomains(ctx, int32(userId))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count reserved domains: %w", err)
+	}
+
+	return int(count), nil
+}
+
+func (d *domainRepo) CountOrgDomains(orgId int) (int, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	count, err := d.queries.CountOrgReservedDomains(ctx, pgtype.Int4{Int32: int32(orgId), Valid: true})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count org reserved domains: %w", err)
+	}
+
+	return int(count), nil
+}
+
+func (d *domainRepo) DeleteDomain(userId, domainId int) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := d.queries.DeleteReservedDomain(ctx, sqlc.DeleteReservedDomainParams{
+		ID:     int32(domainId),
+		UserID: int32(userId),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete reserved domain: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (d *domainRepo) DeleteOrgDomain(orgId, domainId int) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := d.queries.DeleteOrgReservedDomain(ctx, sqlc.DeleteOrgReservedDomainParams{
+		ID:    int32(domainId),
+		OrgID: pgtype.Int4{Int32: int32(orgId), Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete org reserved domain: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func toDomain(dbDomain sqlc.ReservedDomain) models.ReservedDomain {
+	return models.ReservedDomain{
+		Id:        int(dbDomain.ID),
+		Hostname:  dbDomain.Hostname,
+		UserId:    int(dbDomain.UserID),
+		OrgId:     int(dbDomain.OrgID.Int32),
+		CreatedAt: dbDomain.CreatedAt.Time,
+	}
+}
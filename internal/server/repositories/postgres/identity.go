@@ -0,0 +1,126 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/sqlc"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type identityRepo struct {
+	queries sqlc.Querier
+}
+
+func NewIdentityRepo(pool *pgxpool.Pool) (*identityRepo, error) {
+	if pool == nil {
+		return nil, errors.New("no pgx pool provided")
+	}
+
+	return &identityRepo{
+		queries: sqlc.New(pool),
+	}, nil
+}
+
+func (i *identityRepo) CreateIdentity(identity *models.UserIdentity) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row, err := i.queries.CreateUserIdentity(ctx, sqlc.CreateUserIdentityParams{
+		UserID:   int32(identity.UserId),
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			if pgErr.Code == pgerrcode.UniqueViolation {
+				return fmt.Errorf("%w: %w", ErrUniqueViolation, err)
+			}
+		}
+		return fmt.Errorf("failed to create user identity: %w", err)
+	}
+
+	identity.Id = int(row.ID)
+	identity.CreatedAt = row.CreatedAt.Time
+
+	return nil
+}
+
+func (i *identityRepo) GetIdentity(provider, subject string) (*models.UserIdentity, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	dbIdentity, err := i.queries.GetUserIdentity(ctx, sqlc.GetUserIdentityParams{
+		Provider: provider,
+		Subject:  subject,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get user identity: %w", err)
+	}
+
+	identity := toIdentity(dbIdentity)
+	return &identity, nil
+}
+
+func (i *identityRepo) ListIdentities(userId int) ([]models.UserIdentity, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	dbIdentities, err := i.queries.ListUserIdentities(ctx, int32(userId))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user identities: %w", err)
+	}
+
+	identities := []models.UserIdentity{}
+	for _, dbIdentity := range dbIdentities {
+		identities = append(identities, toIdentity(dbIdentity))
+	}
+
+	return identities, nil
+}
+
+func (i *identityRepo) DeleteIdentity(userId, identityId int) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := i.queries.DeleteUserIdentity(ctx, sqlc.DeleteUserIdentityParams{
+		ID:     int32(identityId),
+		UserID: int32(userId),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete user identity: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func toIdentity(dbIdentity sqlc.UserIdentity) models.UserIdentity {
+	return models.UserIdentity{
+		Id:        int(dbIdentity.ID),
+		UserId:    int(dbIdentity.UserID),
+		Provider:  dbIdentity.Provider,
+		Subject:   dbIdentity.Subject,
+		Email:     dbIdentity.Email,
+		CreatedAt: dbIdentity.CreatedAt.Time,
+	}
+}
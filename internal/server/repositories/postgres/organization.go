@@ -0,0 +1,350 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/sqlc"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type orgRepo struct {
+	queries sqlc.Querier
+}
+
+func NewOrgRepo(pool *pgxpool.Pool) (*orgRepo, error) {
+	if pool == nil {
+		return nil, errors.New("no pgx pool provided")
+	}
+
+	return &orgRepo{
+		queries: sqlc.New(pool),
+	}, nil
+}
+
+func (o *orgRepo) CreateOrg(org *models.Organization, ownerId int) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row, err := o.queries.CreateOrganization(ctx, sqlc.CreateOrganizationParams{
+		Name:    org.Name,
+		OwnerID: int32(ownerId),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create organization: %w", err)
+	}
+
+	org.Id = int(row.ID)
+	org.Role = models.OwnerOrgRole
+	org.CreatedAt = row.CreatedAt.Time
+
+	return nil
+}
+
+func (o *orgRepo) GetOrg(orgId int) (*models.Organization, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	dbOrg, err := o.queries.GetOrganization(ctx, int32(orgId))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+
+	return &models.Organization{
+		Id:        int(dbOrg.ID),
+		Name:      dbOrg.Name,
+		CreatedAt: dbOrg.CreatedAt.Time,
+	}, nil
+}
+
+func (o *orgRepo) ListUserOrgs(userId int) ([]models.Organization, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	dbOrgs, err := o.queries.ListUserOrganizations(ctx, int32(userId))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+
+	orgs := []models.Organization{}
+	for _, dbOrg := range dbOrgs {
+		orgs = append(orgs, models.Organization{
+			Id:        int(dbOrg.ID),
+			Name:      dbOrg.Name,
+			Role:      models.OrgRole(dbOrg.Role),
+			CreatedAt: dbOrg.CreatedAt.Time,
+		})
+	}
+
+	return orgs, nil
+}
+
+func (o *orgRepo) RenameOrg(orgId int, name string) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := o.queries.UpdateOrganizationName(ctx, sqlc.UpdateOrganizationNameParams{
+		ID:   int32(orgId),
+		Name: name,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rename organization: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (o *orgRepo) DeleteOrg(orgId int) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := o.queries.DeleteOrganization(ctx, int32(orgId))
+	if err != nil {
+		return fmt.Errorf("failed to delete organization: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (o *orgRepo) GetMember(orgId, userId int) (*models.OrgMember, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	dbMember, err := o.queries.GetOrganizationMember(ctx, sqlc.GetOrganizationMemberParams{
+		OrgID:  int32(orgId),
+		UserID: int32(userId),
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get organization member: %w", err)
+	}
+
+	return &models.OrgMember{
+		OrgId:    int(dbMember.OrgID),
+		UserId:   int(dbMember.UserID),
+		Role:     models.OrgRole(dbMember.Role),
+		JoinedAt: dbMember.CreatedAt.Time,
+	}, nil
+}
+
+func (o *orgRepo) ListMembers(orgId int) ([]models.OrgMember, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	dbMembers, err := o.queries.ListOrganizationMembers(ctx, int32(orgId))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organization members: %w", err)
+	}
+
+	members := []models.OrgMember{}
+	for _, dbMember := range dbMembers {
+		members = append(members, models.OrgMember{
+			OrgId:    orgId,
+			UserId:   int(dbMember.UserID),
+			Name:     dbMember.Name,
+			Email:    dbMember.Email,
+			Role:     models.OrgRole(dbMember.Role),
+			JoinedAt: dbMember.CreatedAt.Time,
+		})
+	}
+
+	return members, nil
+}
+
+func (o *orgRepo) CountOwners(orgId int) (int, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	count, err := o.queries.CountOrganizationOwners(ctx, int32(orgId))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count organization owners: %w", err)
+	}
+
+	return int(count), nil
+}
+
+func (o *orgRepo) UpdateMemberRole(orgId, userId int, role models.OrgRole) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := o.queries.UpdateOrganizationMemberRole(ctx, sqlc.UpdateOrganizationMemberRoleParams{
+		OrgID:  int32(orgId),
+		UserID: int32(userId),
+		Role:   string(role),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update organization member: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (o *orgRepo) RemoveMember(orgId, userId int) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := o.queries.DeleteOrganizationMember(ctx, sqlc.DeleteOrganizationMemberParams{
+		OrgID:  int32(orgId),
+		UserID: int32(userId),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove organization member: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// CreateInvitation replaces a pending invitation for the same email, so
+// inviting again sends a fresh link
+func (o *orgRepo) CreateInvitation(invitation *models.OrgInvitation) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row, err := o.queries.CreateOrganizationInvitation(ctx, sqlc.CreateOrganizationInvitationParams{
+		OrgID:     int32(invitation.OrgId),
+		Email:     invitation.Email,
+		Role:      string(invitation.Role),
+		TokenHash: invitation.TokenHash,
+		InvitedBy: pgtype.Int4{Int32: int32(invitation.InvitedBy), Valid: invitation.InvitedBy != 0},
+		ExpiresAt: pgtype.Timestamptz{Time: invitation.ExpiresAt, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create organization invitation: %w", err)
+	}
+
+	invitation.Id = int(row.ID)
+	invitation.CreatedAt = row.CreatedAt.Time
+
+	return nil
+}
+
+func (o *orgRepo) ListInvitations(orgId int) ([]models.OrgInvitation, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	dbInvitations, err := o.queries.ListOrganizationInvitations(ctx, int32(orgId))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organization invitations: %w", err)
+	}
+
+	invitations := []models.OrgInvitation{}
+	for _, dbInvitation := range dbInvitations {
+		invitations = append(invitations, models.OrgInvitation{
+			Id:        int(dbInvitation.ID),
+			OrgId:     int(dbInvitation.OrgID),
+			Email:     dbInvitation.Email,
+			Role:      models.OrgRole(dbInvitation.Role),
+			InvitedBy: int(dbInvitation.InvitedBy.Int32),
+			ExpiresAt: dbInvitation.ExpiresAt.Time,
+			CreatedAt: dbInvitation.CreatedAt.Time,
+		})
+	}
+
+	return invitations, nil
+}
+
+func (o *orgRepo) GetInvitationByToken(tokenHash string) (*models.OrgInvitation, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	dbInvitation, err := o.queries.GetOrganizationInvitationByToken(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get organization invitation: %w", err)
+	}
+
+	return &models.OrgInvitation{
+		Id:        int(dbInvitation.ID),
+		OrgId:     int(dbInvitation.OrgID),
+		Email:     dbInvitation.Email,
+		Role:      models.OrgRole(dbInvitation.Role),
+		TokenHash: dbInvitation.TokenHash,
+		InvitedBy: int(dbInvitation.InvitedBy.Int32),
+		ExpiresAt: dbInvitation.ExpiresAt.Time,
+		CreatedAt: dbInvitation.CreatedAt.Time,
+	}, nil
+}
+
+func (o *orgRepo) DeleteInvitation(orgId, invitationId int) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := o.queries.DeleteOrganizationInvitation(ctx, sqlc.DeleteOrganizationInvitationParams{
+		ID:    int32(invitationId),
+		OrgID: int32(orgId),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete organization invitation: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// AcceptInvitation consumes the invitation and adds the user with its role
+// in one statement, it returns ErrNotFound when the invitation is gone or
+// the user already is a member
+func (o *orgRepo) AcceptInvitation(invitationId, userId int) (int, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	orgId, err := o.queries.AcceptOrganizationInvitation(ctx, sqlc.AcceptOrganizationInvitationParams{
+		ID:     int32(invitationId),
+		UserID: int32(userId),
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, fmt.Errorf("failed to accept organization invitation: %w", err)
+	}
+
+	return int(orgId), nil
+}
@@ -0,0 +1,77 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/sqlc"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type planRepo struct {
+	queries sqlc.Querier
+}
+
+func NewPlanRepo(pool *pgxpool.Pool) (*planRepo, error) {
+	if pool == nil {
+		return nil, errors.New("no pgx pool provided")
+	}
+
+	return &planRepo{
+		queries: sqlc.New(pool),
+	}, nil
+}
+
+func (p *planRepo) GetPlan(name string) (*models.Plan, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	dbPlan, err := p.queries.GetPlanByName(ctx, name)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get plan by name: %w", err)
+	}
+
+	plan := toPlanModel(dbPlan)
+	return &plan, nil
+}
+
+func (p *planRepo) ListPlans() ([]models.Plan, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	dbPlans, err := p.queries.ListPlans(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list plans: %w", err)
+	}
+
+	plans := []models.Plan{}
+	for _, dbPlan := range dbPlans {
+		plans = append(plans, toPlanModel(dbPlan))
+	}
+
+	return plans, nil
+}
+
+func toPlanModel(dbPlan sqlc.Plan) models.Plan {
+	return models.Plan{
+		Id:                   int(dbPlan.ID),
+		Name:                 dbPlan.Name,
+		MaxSessions:          int(dbPlan.MaxSessions),
+		MaxTunnelsPerSession: int(dbPlan.MaxTunnelsPerSession),
+		MaxReservedDomains:   int(dbPlan.MaxReservedDomains),
+		MaxTcpPorts:          int(dbPlan.MaxTcpPorts),
+		MonthlyBandwidth:     dbPlan.MonthlyBandwidth,
+		CreatedAt:            dbPlan.CreatedAt.Time,
+		UpdatedAt:            dbPlan.UpdatedAt.Time,
+	}
+}
@@ -0,0 +1,180 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/sqlc"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type totpRepo struct {
+	queries sqlc.Querier
+}
+
+func NewTotpRepo(pool *pgxpool.Pool) (*totpRepo, error) {
+	if pool == nil {
+		return nil, errors.New("no pgx pool provided")
+	}
+
+	return &totpRepo{
+		queries: sqlc.New(pool),
+	}, nil
+}
+
+// CreateTotp stores a new secret that is not enabled yet, it replaces a
+// secret from an earlier enrollment that was never confirmed
+func (t *totpRepo) CreateTotp(userId int, secret string) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := t.queries.UpsertUserTotp(ctx, sqlc.UpsertUserTotpParams{
+		UserID: int32(userId),
+		Secret: secret,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create totp: %w", err)
+	}
+
+	return nil
+}
+
+func (t *totpRepo) GetTotp(userId int) (*models.Totp, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	dbTotp, err := t.queries.GetUserTotp(ctx, int32(userId))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get totp: %w", err)
+	}
+
+	return &models.Totp{
+		UserId:       int(dbTotp.UserID),
+		Secret:       dbTotp.Secret,
+		Enabled:      dbTotp.Enabled,
+		LastUsedStep: dbTotp.LastUsedStep,
+		CreatedAt:    dbTotp.CreatedAt.Time,
+		EnabledAt:    dbTotp.EnabledAt.Time,
+	}, nil
+}
+
+func (t *totpRepo) EnableTotp(userId int) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := t.queries.EnableUserTotp(ctx, int32(userId))
+	if err != nil {
+		return fmt.Errorf("failed to enable totp: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (t *totpRepo) UseTotpStep(userId int, step int64) (bool, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := t.queries.UseUserTotpStep(ctx, sqlc.UseUserTotpStepParams{
+		UserID:       int32(userId),
+		LastUsedStep: step,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to use totp step: %w", err)
+	}
+
+	return rows == 1, nil
+}
+
+// DeleteTotp removes the secret together with the recovery codes
+func (t *totpRepo) DeleteTotp(userId int) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := t.queries.DeleteUserTotp(ctx, int32(userId))
+	if err != nil {
+		return fmt.Errorf("failed to delete totp: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	err = t.queries.DeleteUserRecoveryCodes(ctx, int32(userId))
+	if err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	return nil
+}
+
+func (t *totpRepo) ReplaceRecoveryCodes(userId int, codeHashes []string) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := t.queries.DeleteUserRecoveryCodes(ctx, int32(userId))
+	if err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	rows := make([]sqlc.CreateUserRecoveryCodesParams, 0, len(codeHashes))
+	for _, hash := range codeHashes {
+		rows = append(rows, sqlc.CreateUserRecoveryCodesParams{
+			UserID:   int32(userId),
+			CodeHash: hash,
+		})
+	}
+
+	_, err = t.queries.CreateUserRecoveryCodes(ctx, rows)
+	if err != nil {
+		return fmt.Errorf("failed to create recovery codes: %w", err)
+	}
+
+	return nil
+}
+
+func (t *totpRepo) UseRecoveryCode(userId int, codeHash string) (bool, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := t.queries.UseUserRecoveryCode(ctx, sqlc.UseUserRecoveryCodeParams{
+		UserID:   int32(userId),
+		CodeHash: codeHash,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+
+	return rows == 1, nil
+}
+
+func (t *totpRepo) CountRecoveryCodes(userId int) (int, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	count, err := t.queries.CountUnusedUserRecoveryCodes(ctx, int32(userId))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+
+	return int(count), nil
+}
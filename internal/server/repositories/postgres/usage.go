@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/sqlc"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type usageRepo struct {
+	queries sqlc.Querier
+}
+
+func NewUsageRepo(pool *pgxpool.Pool) (*usageRepo, error) {
+	if pool == nil {
+		return nil, errors.New("no pgx pool provided")
+	}
+
+	return &usageRepo{
+		queries: sqlc.New(pool),
+	}, nil
+}
+
+func (u *usageRepo) AddUsage(userId int, bytesIn, bytesOut int64) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := u.queries.AddTunnelUsage(ctx, sqlc.AddTunnelUsageParams{
+		UserID:   int32(userId),
+		BytesIn:  bytesIn,
+		BytesOut: bytesOut,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add tunnel usage: %w", err)
+	}
+
+	return nil
+}
+
+func (u *usageRepo) GetCurrentMonthUsage(userId int) (int64, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	total, err := u.queries.GetCurrentMonthUsage(ctx, int32(userId))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get current month usage: %w", err)
+	}
+
+	return total, nil
+}
+
+func (u *usageRepo) ListUsage(userId int, after *models.Cursor, limit int) ([]models.TunnelUsage, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	cursorPeriod := pgtype.Date{}
+	if after != nil {
+		cursorPeriod = pgtype.Date{Time: after.Time, Valid: true}
+	}
+
+	dbUsage, err := u.queries.ListTunnelUsage(ctx, sqlc.ListTunnelUsageParams{
+		UserID:       int32(userId),
+		CursorID:     cursorInt4(after),
+		CursorPeriod: cursorPeriod,
+		RowLimit:     int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tunnel usage: %w", err)
+	}
+
+	usage := []models.TunnelUsage{}
+	for _, row := range dbUsage {
+		usage = append(usage, models.TunnelUsage{
+			Id:        int(row.ID),
+			UserId:    int(row.UserID),
+			Period:    row.Period.Time,
+			BytesIn:   row.BytesIn,
+			BytesOut:  row.BytesOut,
+			UpdatedAt: row.UpdatedAt.Time,
+		})
+	}
+
+	return usage, nil
+}
+
+func (u *usageRepo) CountUsage(userId int) (int, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	count, err := u.queries.CountTunnelUsage(ctx, int32(userId))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count tunnel usage: %w", err)
+	}
+
+	return int(count), nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
@@ -12,6 +13,7 @@ import (
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -88,15 +90,7 @@ func (u *userRepo) GetByEmail(email string) (*models.User, error) {
 		return nil, fmt.Errorf("failed to get user by email: %w", err)
 	}
 
-	return &models.User{
-		Id:            int(dbUser.ID),
-		Name:          dbUser.Name,
-		Email:         dbUser.Email,
-		PasswordHash:  dbUser.PasswordHash,
-		EmailVerified: dbUser.EmailVerified,
-		CreatedAt:     dbUser.CreatedAt.Time,
-		UpdatedAt:     dbUser.UpdatedAt.Time,
-	}, nil
+	return toUser(dbUser), nil
 
 }
 
@@ -113,25 +107,27 @@ func (u *userRepo) GetById(userId int) (*models.User, error) {
 		return nil, fmt.Errorf("failed to get user by id: %w", err)
 	}
 
-	return &models.User{
-		Id:            int(dbUser.ID),
-		Name:          dbUser.Name,
-		Email:         dbUser.Email,
-		PasswordHash:  dbUser.PasswordHash,
-		EmailVerified: dbUser.EmailVerified,
-		CreatedAt:     dbUser.CreatedAt.Time,
-		UpdatedAt:     dbUser.UpdatedAt.Time,
-	}, nil
+	return toUser(dbUser), nil
 }
 
-func (u *userRepo) ListUsers(limit, offset int) ([]models.User, error) {
+func (u *userRepo) ListUsers(filter models.UserFilter, after *models.Cursor, limit int) ([]models.User, error) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	dbUsers, err := u.queries.ListUsers(ctx, sqlc.ListUsersParams{
-		Limit:  int32(limit),
-		Offset: int32(offset),
+		Search:        pgtype.Text{String: likePattern(filter.Search), Valid: filter.Search != ""},
+		EmailVerified: toPgBool(filter.EmailVerified),
+		IsAdmin:       toPgBool(filter.IsAdmin),
+		Suspended:     toPgBool(filter.Suspended),
+		Plan:          pgtype.Text{String: filter.Plan, Valid: filter.Plan != ""},
+		CreatedAfter:  pgtype.Timestamptz{Time: filter.CreatedAfter, Valid: !filter.CreatedAfter.IsZero()},
+		CreatedBefore: pgtype.Timestamptz{Time: filter.CreatedBefore, Valid: !filter.CreatedBefore.IsZero()},
+		CursorID:      cursorInt4(after),
+		Sort:          filter.Sort,
+		CursorValue:   cursorValue(after),
+		CursorTime:    cursorTime(after),
+		RowLimit:      int32(limit),
 	})
 	if err != nil {
 		return nil, err
@@ -139,23 +135,34 @@ func (u *userRepo) ListUsers(limit, offset int) ([]models.User, error) {
 
 	users := []models.User{}
 	for _, dbUser := range dbUsers {
-
-		user := models.User{
-			Id:            int(dbUser.ID),
-			Name:          dbUser.Name,
-			Email:         dbUser.Email,
-			PasswordHash:  dbUser.PasswordHash,
-			CreatedAt:     dbUser.CreatedAt.Time,
-			UpdatedAt:     dbUser.UpdatedAt.Time,
-			EmailVerified: dbUser.EmailVerified,
-		}
-		users = append(users, user)
+		users = append(users, *toUser(dbUser))
 	}
 
 	return users, nil
 
 }
 
+func (u *userRepo) CountUsers(filter models.UserFilter) (int, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	count, err := u.queries.CountUsers(ctx, sqlc.CountUsersParams{
+		Search:        pgtype.Text{String: likePattern(filter.Search), Valid: filter.Search != ""},
+		EmailVerified: toPgBool(filter.EmailVerified),
+		IsAdmin:       toPgBool(filter.IsAdmin),
+		Suspended:     toPgBool(filter.Suspended),
+		Plan:          pgtype.Text{String: filter.Plan, Valid: filter.Plan != ""},
+		CreatedAfter:  pgtype.Timestamptz{Time: filter.CreatedAfter, Valid: !filter.CreatedAfter.IsZero()},
+		CreatedBefore: pgtype.Timestamptz{Time: filter.CreatedBefore, Valid: !filter.CreatedBefore.IsZero()},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	return int(count), nil
+}
+
 func (u *userRepo) VerifyUserEmail(id int) error {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -182,3 +189,240 @@ func (u *userRepo) UpdateUserPassword(email string, passwdHash []byte) error {
 		PasswordHash: passwdHash,
 	})
 }
+
+func (u *userRepo) UpdateUserPlan(userId int, plan string) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := u.queries.UpdateUserPlan(ctx, sqlc.UpdateUserPlanParams{
+		ID:   int32(userId),
+		Plan: plan,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update user plan: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (u *userRepo) UpdateUserName(userId int, name string) (*models.User, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	dbUser, err := u.queries.UpdateUserName(ctx, sqlc.UpdateUserNameParams{
+		ID:   int32(userId),
+		Name: name,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to update user name: %w", err)
+	}
+
+	return toUser(dbUser), nil
+}
+
+func (u *userRepo) UpdateUserEmail(userId int, email string) (*models.User, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	dbUser, err := u.queries.UpdateUserEmail(ctx, sqlc.UpdateUserEmailParams{
+		ID:    int32(userId),
+		Email: email,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			if pgErr.Code == pgerrcode.UniqueViolation {
+				return nil, fmt.Errorf("%w: %w", ErrUniqueViolation, err)
+			}
+		}
+		return nil, fmt.Errorf("failed to update user email: %w", err)
+	}
+
+	return toUser(dbUser), nil
+}
+
+// ScheduleDeletion returns ErrNotFound when the user does not exist or is
+// already waiting for its purge
+func (u *userRepo) ScheduleDeletion(userId int, purgeAt time.Time) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := u.queries.ScheduleUserDeletion(ctx, sqlc.ScheduleUserDeletionParams{
+		ID:      int32(userId),
+		PurgeAt: pgtype.Timestamptz{Time: purgeAt, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to schedule user deletion: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (u *userRepo) CancelDeletion(userId int) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := u.queries.CancelUserDeletion(ctx, int32(userId))
+	if err != nil {
+		return fmt.Errorf("failed to cancel user deletion: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (u *userRepo) PurgeDeletedUsers() ([]int, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	due, err := u.queries.ListPurgeableUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list purgeable users: %w", err)
+	}
+	if len(due) == 0 {
+		return []int{}, nil
+	}
+
+	dueIds := make([]int32, 0, len(due))
+	emails := make([]string, 0, len(due))
+	for _, user := range due {
+		dueIds = append(dueIds, user.ID)
+		emails = append(emails, strings.ToLower(user.Email))
+	}
+
+	// the audit events and otps outlive the user, they only keep the email
+	// so it has to be scrubbed before the user row goes
+	err = u.queries.ScrubAuditEvents(ctx, sqlc.ScrubAuditEventsParams{
+		Ids:    dueIds,
+		Emails: emails,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scrub audit events of purged users: %w", err)
+	}
+
+	err = u.queries.DeleteOtpsByEmail(ctx, emails)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete otps of purged users: %w", err)
+	}
+
+	dbIds, err := u.queries.PurgeDeletedUsers(ctx, dueIds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to purge deleted users: %w", err)
+	}
+
+	ids := make([]int, 0, len(dbIds))
+	for _, id := range dbIds {
+		ids = append(ids, int(id))
+	}
+
+	return ids, nil
+}
+
+func (u *userRepo) Suspend(userId int) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := u.queries.SuspendUser(ctx, int32(userId))
+	if err != nil {
+		return fmt.Errorf("failed to suspend user: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (u *userRepo) Unsuspend(userId int) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := u.queries.UnsuspendUser(ctx, int32(userId))
+	if err != nil {
+		return fmt.Errorf("failed to unsuspend user: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (u *userRepo) SetAdmin(userId int, isAdmin bool) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := u.queries.UpdateUserAdmin(ctx, sqlc.UpdateUserAdminParams{
+		ID:      int32(userId),
+		IsAdmin: isAdmin,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update user admin: %w", err)
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func toUser(dbUser sqlc.User) *models.User {
+	return &models.User{
+		Id:            int(dbUser.ID),
+		Name:          dbUser.Name,
+		Email:         dbUser.Email,
+		PasswordHash:  dbUser.PasswordHash,
+		EmailVerified: dbUser.EmailVerified,
+		CreatedAt:     dbUser.CreatedAt.Time,
+		UpdatedAt:     dbUser.UpdatedAt.Time,
+		Plan:          dbUser.Plan,
+		DeletedAt:     dbUser.DeletedAt.Time,
+		PurgeAt:       dbUser.PurgeAt.Time,
+		IsAdmin:       dbUser.IsAdmin,
+		SuspendedAt:   dbUser.SuspendedAt.Time,
+	}
+}
+
+// likePattern escapes the wildcards of like so search is matched literally,
+// the query wraps it in % itself
+func likePattern(search string) string {
+	return likeEscaper.Replace(search)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func toPgBool(b *bool) pgtype.Bool {
+	if b == nil {
+		return pgtype.Bool{}
+	}
+	return pgtype.Bool{Bool: *b, Valid: true}
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"math/big"
 	"strings"
 	"time"
@@ -19,12 +20,22 @@ import (
 type TokenDetails struct {
 	Token     string
 	TokenUuid string
+	SessionId string // the session the token was issued to
 	UserID    int
 	Verified  bool
 	IsAdmin   bool
-	ExpiresIn int64
+	IssuedAt  int64
+	// IssuedAtMilli is the issue time in milliseconds, iat only has
+	// second precision which is too coarse to compare with revocations
+	IssuedAtMilli int64
+	ExpiresIn     int64
+	APIKeyId      int      // set when the request was authenticated by an api key
+	Scopes        []string // the scopes of that api key
 }
 
+// APIKeyPrefix starts every api key, it tells them apart from access tokens
+const APIKeyPrefix = "ak_"
+
 type APIKeyDetails struct {
 	Prefix  string
 	FullKey string
@@ -35,10 +46,12 @@ var (
 	ErrTokenExpired  = errors.New("token is expired")
 )
 
-func CreateToken(user *models.User, ttl time.Duration, privateKey string) (*TokenDetails, error) {
+func CreateToken(user *models.User, sessionId string, ttl time.Duration, privateKey string) (*TokenDetails, error) {
 	now := time.Now().UTC()
 	td := &TokenDetails{
-		ExpiresIn: now.Add(ttl).Unix(),
+		IssuedAt:      now.Unix(),
+		IssuedAtMilli: now.UnixMilli(),
+		ExpiresIn:     now.Add(ttl).Unix(),
 	}
 
 	uuid, err := uuid.NewV7()
@@ -47,6 +60,7 @@ func CreateToken(user *models.User, ttl time.Duration, privateKey string) (*Toke
 	}
 
 	td.TokenUuid = uuid.String()
+	td.SessionId = sessionId
 	td.UserID = user.Id
 	td.Verified = user.EmailVerified
 	td.IsAdmin = user.IsAdmin
@@ -65,10 +79,12 @@ func CreateToken(user *models.User, ttl time.Duration, privateKey string) (*Toke
 	atClaims := make(jwt.MapClaims)
 	atClaims["sub"] = user.Id
 	atClaims["token_uuid"] = td.TokenUuid
+	atClaims["sid"] = td.SessionId
 	atClaims["verified"] = td.Verified
 	atClaims["admin"] = td.IsAdmin
 	atClaims["exp"] = td.ExpiresIn
-	atClaims["iat"] = now.Unix()
+	atClaims["iat"] = td.IssuedAt
+	atClaims["iat_ms"] = td.IssuedAtMilli
 	atClaims["nbf"] = now.Unix()
 
 	td.Token, err = jwt.NewWithClaims(jwt.SigningMethodEdDSA, atClaims).SignedString(key)
@@ -118,11 +134,23 @@ func ValidateToken(token string, publicKey string) (*TokenDetails, error) {
 		return nil, ErrInvalidClaims
 	}
 
+	// tokens issued before sessions existed carry no sid
+	sessionId, _ := claims["sid"].(string)
+	issuedAt, _ := claims["iat"].(float64)
+	// tokens issued before iat_ms existed fall back to the start of their second
+	issuedAtMilli, ok := claims["iat_ms"].(float64)
+	if !ok {
+		issuedAtMilli = issuedAt * 1000
+	}
+
 	return &TokenDetails{
-		TokenUuid: fmt.Sprint(claims["token_uuid"]),
-		Verified:  claims["verified"].(bool),
-		UserID:    int(userIDFloat),
-		IsAdmin:   claims["admin"].(bool),
+		TokenUuid:     fmt.Sprint(claims["token_uuid"]),
+		SessionId:     sessionId,
+		Verified:      claims["verified"].(bool),
+		UserID:        int(userIDFloat),
+		IsAdmin:       claims["admin"].(bool),
+		IssuedAt:      int64(issuedAt),
+		IssuedAtMilli: int64(issuedAtMilli),
 	}, nil
 
 }
@@ -133,7 +161,7 @@ func GenerateAPIKeyToken(secretByteLength int) (*APIKeyDetails, error) {
 	if _, err := rand.Read(prefixBytes); err != nil {
 		return nil, fmt.Errorf("failed to generate prefix: %w", err)
 	}
-	prefix := "ak_" + hex.EncodeToString(prefixBytes)
+	prefix := APIKeyPrefix + hex.EncodeToString(prefixBytes)
 
 	secretBytes := make([]byte, secretByteLength)
 	if _, err := rand.Read(secretBytes); err != nil {
@@ -142,6 +170,7 @@ func GenerateAPIKeyToken(secretByteLength int) (*APIKeyDetails, error) {
 	tokenPart := base64.RawURLEncoding.EncodeToString(secretBytes)
 
 	fullKey := prefix + tokenPart
+	fullKey += apiKeyChecksum(fullKey)
 
 	return &APIKeyDetails{
 		Prefix:  prefix,
@@ -149,6 +178,43 @@ func GenerateAPIKeyToken(secretByteLength int) (*APIKeyDetails, error) {
 	}, nil
 }
 
+// api keys end in the crc32 of the rest of the key as 6 base62 characters,
+// so secret scanners can tell real keys from look-alikes offline. Keys
+// issued before the checksum are 62 characters long and have none
+const (
+	apiKeyChecksumLength = 6
+	legacyAPIKeyLength   = len(APIKeyPrefix) + 16 + 43
+	base62Charset        = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+func apiKeyChecksum(body string) string {
+	sum := crc32.ChecksumIEEE([]byte(body))
+
+	checksum := make([]byte, apiKeyChecksumLength)
+	for i := apiKeyChecksumLength - 1; i >= 0; i-- {
+		checksum[i] = base62Charset[sum%62]
+		sum /= 62
+	}
+	return string(checksum)
+}
+
+// ValidAPIKeyChecksum reports whether key looks like an api key we issued,
+// either with a matching checksum or in the format used before checksums
+func ValidAPIKeyChecksum(key string) bool {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return false
+	}
+	if len(key) == legacyAPIKeyLength {
+		return true
+	}
+	if len(key) <= legacyAPIKeyLength {
+		return false
+	}
+
+	body, checksum := key[:len(key)-apiKeyChecksumLength], key[len(key)-apiKeyChecksumLength:]
+	return apiKeyChecksum(body) == checksum
+}
+
 func GenerateToken(n int) string {
 	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	otp := make([]byte, n)
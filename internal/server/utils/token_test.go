@@ -7,6 +7,8 @@ import (
 	"encoding/pem"
 	"testing"
 	"time"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/server/models"
 )
 
 func generateTestKeys(t *testing.T) (privateKeyB64 string, publicKeyB64 string) {
@@ -49,9 +51,10 @@ func TestCreateAndValidateToken(t *testing.T) {
 	privateKey, publicKey := generateTestKeys(t)
 
 	userID := 1234
+	sessionId := "0192d4e4-7c2a-7b4e-9f1a-3c5d6e7f8a9b"
 	ttl := 5 * time.Minute
 
-	createdTokenDetails, err := CreateToken(userID, ttl, privateKey)
+	createdTokenDetails, err := CreateToken(&models.User{Id: userID}, sessionId, ttl, privateKey)
 	if err != nil {
 		t.Fatalf("CreateToken() returned an unexpected error: %v", err)
 	}
@@ -77,4 +80,36 @@ func TestCreateAndValidateToken(t *testing.T) {
 	if validatedTokenDetails.TokenUuid != createdTokenDetails.TokenUuid {
 		t.Errorf("Expected TokenUuid to be %q, but got %q", createdTokenDetails.TokenUuid, validatedTokenDetails.TokenUuid)
 	}
+
+	if validatedTokenDetails.SessionId != sessionId {
+		t.Errorf("Expected SessionId to be %q, but got %q", sessionId, validatedTokenDetails.SessionId)
+	}
+
+	if validatedTokenDetails.IssuedAtMilli != createdTokenDetails.IssuedAtMilli {
+		t.Errorf("Expected IssuedAtMilli to be %d, but got %d", createdTokenDetails.IssuedAtMilli, validatedTokenDetails.IssuedAtMilli)
+	}
+}
+
+func TestAPIKeyChecksum(t *testing.T) {
+	details, err := GenerateAPIKeyToken(32)
+	if err != nil {
+		t.Fatalf("GenerateAPIKeyToken() returned an unexpected error: %v", err)
+	}
+	if !ValidAPIKeyChecksum(details.FullKey) {
+		t.Fatalf("Expected a valid checksum for %s", details.FullKey)
+	}
+
+	last := details.FullKey[len(details.FullKey)-1]
+	tampered := details.FullKey[:len(details.FullKey)-1] + string(last^1)
+	if ValidAPIKeyChecksum(tampered) {
+		t.Fatalf("Expected a changed key to fail the checksum")
+	}
+
+	legacy := details.FullKey[:legacyAPIKeyLength]
+	if !ValidAPIKeyChecksum(legacy) {
+		t.Fatalf("Expected keys issued before checksums to be accepted")
+	}
+	if ValidAPIKeyChecksum("gh_" + legacy[len(APIKeyPrefix):]) {
+		t.Fatalf("Expected keys without the prefix to be rejected")
+	}
 }
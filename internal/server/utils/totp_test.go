@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateTotp(t *testing.T) {
+	// test vectors of RFC 6238 appendix B truncated to 6 digits
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		step, ok := ValidateTotp(secret, tt.code, time.Unix(tt.unix, 0))
+		if !ok {
+			t.Fatalf("ValidateTotp() rejected %s at %d", tt.code, tt.unix)
+		}
+		if step != tt.unix/30 {
+			t.Fatalf("Expected step %d, got %d", tt.unix/30, step)
+		}
+	}
+
+	if _, ok := ValidateTotp(secret, "287082", time.Unix(59+90, 0)); ok {
+		t.Fatalf("ValidateTotp() accepted a code three steps old")
+	}
+	if _, ok := ValidateTotp(secret, "28708", time.Unix(59, 0)); ok {
+		t.Fatalf("ValidateTotp() accepted a short code")
+	}
+}
+
+func TestTotpURI(t *testing.T) {
+	uri := TotpURI("Tunnel", "a@example.com", "JBSWY3DPEHPK3PXP")
+	if !strings.HasPrefix(uri, "otpauth://totp/Tunnel:a@example.com?") {
+		t.Fatalf("Unexpected uri %s", uri)
+	}
+	if !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") || !strings.Contains(uri, "issuer=Tunnel") {
+		t.Fatalf("Uri is missing the secret or issuer: %s", uri)
+	}
+}
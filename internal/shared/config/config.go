@@ -4,6 +4,8 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"net"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -14,14 +16,37 @@ type Config struct {
 		Port int
 		Host string
 	}
+	AdminServer struct {
+		Port int
+		Host string
+	}
 	NatTcpServer struct {
 		Port int
 		Host string
 	}
 	NatHttpServer struct {
+		Port   int
+		Host   string
+		Domain string // base domain tunnel hostnames are created under
+	}
+	NatAdminServer struct {
 		Port int
 		Host string
 	}
+	NatTcpTunnel struct {
+		PortStart int
+		PortEnd   int
+	}
+	Cluster struct {
+		NodeId        string
+		InternalHost  string
+		InternalPort  int
+		AdvertiseAddr string // address other nodes use to reach the internal listener
+		Secret        string // shared by all nodes, forwarding is disabled without it
+	}
+	Tracing struct {
+		Endpoint string // otlp/http collector url, spans are not exported without it
+	}
 	DB struct {
 		DSN          string
 		MaxOpenConn  int
@@ -31,6 +56,30 @@ type Config struct {
 	Cache struct {
 		DSN string
 	}
+	Mail struct {
+		Driver       string // smtp|log|file
+		From         string
+		SMTPHost     string
+		SMTPPort     int
+		SMTPUsername string
+		SMTPPassword string
+		FilePath     string // file driver appends every message to this file
+	}
+	OAuth struct {
+		RedirectBaseURL string // public url of the api server, providers redirect back to it
+		GitHub          struct {
+			ClientID     string
+			ClientSecret string
+			AuthURL      string
+			TokenURL     string
+			APIURL       string
+		}
+		Google struct {
+			ClientID     string
+			ClientSecret string
+			Issuer       string // any oidc issuer works, e.g. a local mock idp
+		}
+	}
 	Token struct {
 		AccessTokenPublicKey   string
 		AccessTokenPrivateKey  string
@@ -46,6 +95,7 @@ type Config struct {
 	Debug             bool          // run code in debug mode mostly debug log will be displayed
 	EmailOtpExpiredIn time.Duration // after how much time email expired token get expired
 	EmailOtpSalt      string
+	FrontendURL       string // base url of the web app, used for links in emails
 }
 
 func (c *Config) validate() error {
@@ -70,6 +120,21 @@ func (c *Config) validate() error {
 	if c.EmailOtpSalt == "" {
 		return errors.New("EMAIL_OTP_SALT is not set")
 	}
+	if c.Cluster.NodeId == "" {
+		return errors.New("NAT_NODE_ID is not set")
+	}
+	switch c.Mail.Driver {
+	case "smtp", "log":
+	case "file":
+		if c.Mail.FilePath == "" {
+			return errors.New("MAIL_FILE_PATH is not set")
+		}
+	default:
+		return fmt.Errorf("unknown MAIL_DRIVER %q", c.Mail.Driver)
+	}
+	if c.NatTcpTunnel.PortStart > c.NatTcpTunnel.PortEnd {
+		return errors.New("NAT_TCP_PORT_START must not be greater than NAT_TCP_PORT_END")
+	}
 
 	return nil
 }
@@ -79,10 +144,26 @@ func InitializeConfig(getenv func(string) string, args []string) (*Config, error
 
 	cfg.Server.Port = getEnvInt(getenv, "PORT", 8000)
 	cfg.Server.Host = getEnvString(getenv, "HOST", "localhost")
+	cfg.AdminServer.Host = getEnvString(getenv, "ADMIN_HOST", "localhost")
+	cfg.AdminServer.Port = getEnvInt(getenv, "ADMIN_PORT", 8001)
 	cfg.NatTcpServer.Host = getEnvString(getenv, "NAT-HOST", "localhost")
 	cfg.NatTcpServer.Port = getEnvInt(getenv, "NAT_PORT", 31000)
 	cfg.NatHttpServer.Host = getEnvString(getenv, "NAT_HTTP_HOST", "localhost")
 	cfg.NatHttpServer.Port = getEnvInt(getenv, "NAT_HTTP_PORT", 32000)
+	cfg.NatHttpServer.Domain = getEnvString(getenv, "TUNNEL_DOMAIN", "localhost")
+	cfg.NatAdminServer.Host = getEnvString(getenv, "NAT_ADMIN_HOST", "localhost")
+	cfg.NatAdminServer.Port = getEnvInt(getenv, "NAT_ADMIN_PORT", 34000)
+	cfg.NatTcpTunnel.PortStart = getEnvInt(getenv, "NAT_TCP_PORT_START", 40000)
+	cfg.NatTcpTunnel.PortEnd = getEnvInt(getenv, "NAT_TCP_PORT_END", 40100)
+
+	hostname, _ := os.Hostname()
+	cfg.Cluster.NodeId = getEnvString(getenv, "NAT_NODE_ID", hostname)
+	cfg.Cluster.InternalHost = getEnvString(getenv, "NAT_INTERNAL_HOST", "localhost")
+	cfg.Cluster.InternalPort = getEnvInt(getenv, "NAT_INTERNAL_PORT", 33000)
+	cfg.Cluster.AdvertiseAddr = getEnvString(getenv, "NAT_ADVERTISE_ADDR", net.JoinHostPort(cfg.Cluster.InternalHost, strconv.Itoa(cfg.Cluster.InternalPort)))
+	cfg.Cluster.Secret = getEnvString(getenv, "NAT_CLUSTER_SECRET", "")
+
+	cfg.Tracing.Endpoint = getEnvString(getenv, "OTEL_EXPORTER_OTLP_ENDPOINT", "")
 
 	cfg.DB.DSN = getEnvString(getenv, "DB_DSN", "")
 	cfg.DB.MaxOpenConn = getEnvInt(getenv, "DB-MAX-OPEN-CONNS", 10)
@@ -91,6 +172,24 @@ func InitializeConfig(getenv func(string) string, args []string) (*Config, error
 
 	cfg.Cache.DSN = getEnvString(getenv, "REDIS_DSN", "")
 
+	cfg.Mail.Driver = getEnvString(getenv, "MAIL_DRIVER", "log")
+	cfg.Mail.From = getEnvString(getenv, "MAIL_FROM", "Tunnel <no-reply@localhost>")
+	cfg.Mail.SMTPHost = getEnvString(getenv, "SMTP_HOST", "localhost")
+	cfg.Mail.SMTPPort = getEnvInt(getenv, "SMTP_PORT", 1025)
+	cfg.Mail.SMTPUsername = getEnvString(getenv, "SMTP_USERNAME", "")
+	cfg.Mail.SMTPPassword = getEnvString(getenv, "SMTP_PASSWORD", "")
+	cfg.Mail.FilePath = getEnvString(getenv, "MAIL_FILE_PATH", "")
+	cfg.OAuth.RedirectBaseURL = strings.TrimSuffix(getEnvString(getenv, "OAUTH_REDIRECT_BASE_URL", "http://localhost:"+strconv.Itoa(cfg.Server.Port)), "/")
+	cfg.OAuth.GitHub.ClientID = getEnvString(getenv, "OAUTH_GITHUB_CLIENT_ID", "")
+	cfg.OAuth.GitHub.ClientSecret = getEnvString(getenv, "OAUTH_GITHUB_CLIENT_SECRET", "")
+	cfg.OAuth.GitHub.AuthURL = getEnvString(getenv, "OAUTH_GITHUB_AUTH_URL", "https://github.com/login/oauth/authorize")
+	cfg.OAuth.GitHub.TokenURL = getEnvString(getenv, "OAUTH_GITHUB_TOKEN_URL", "https://github.com/login/oauth/access_token")
+	cfg.OAuth.GitHub.APIURL = strings.TrimSuffix(getEnvString(getenv, "OAUTH_GITHUB_API_URL", "https://api.github.com"), "/")
+	cfg.OAuth.Google.ClientID = getEnvString(getenv, "OAUTH_GOOGLE_CLIENT_ID", "")
+	cfg.OAuth.Google.ClientSecret = getEnvString(getenv, "OAUTH_GOOGLE_CLIENT_SECRET", "")
+	cfg.OAuth.Google.Issuer = strings.TrimSuffix(getEnvString(getenv, "OAUTH_GOOGLE_ISSUER", "https://accounts.google.com"), "/")
+	cfg.FrontendURL = strings.TrimSuffix(getEnvString(getenv, "FRONTEND_URL", "http://localhost:5173"), "/")
+
 	cfg.AppVersion = getEnvInt(getenv, "APP_VERSION", 1)
 	cfg.AppEnv = getEnvString(getenv, "APP_ENV", "development")
 
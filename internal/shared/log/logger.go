@@ -23,5 +23,5 @@ func NewLogger(cfg *config.Config, out io.Writer) *slog.Logger {
 		handler = slog.NewTextHandler(out, opts)
 	}
 
-	return slog.New(handler)
+	return slog.New(traceHandler{handler})
 }
@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RegisterDBPool exposes the connection pool statistics of pgxpool
+func RegisterDBPool(r *Registry, pool *pgxpool.Pool) {
+	r.NewGaugeFunc("db_pool_acquired_conns", "Connections currently in use.", func() float64 {
+		return float64(pool.Stat().AcquiredConns())
+	})
+	r.NewGaugeFunc("db_pool_idle_conns", "Idle connections in the pool.", func() float64 {
+		return float64(pool.Stat().IdleConns())
+	})
+	r.NewGaugeFunc("db_pool_total_conns", "Total connections in the pool.", func() float64 {
+		return float64(pool.Stat().TotalConns())
+	})
+	r.NewGaugeFunc("db_pool_max_conns", "Maximum size of the pool.", func() float64 {
+		return float64(pool.Stat().MaxConns())
+	})
+	r.NewCounterFunc("db_pool_acquires_total", "Connections acquired from the pool.", func() float64 {
+		return float64(pool.Stat().AcquireCount())
+	})
+	r.NewCounterFunc("db_pool_empty_acquires_total", "Acquires that had to wait because the pool was empty.", func() float64 {
+		return float64(pool.Stat().EmptyAcquireCount())
+	})
+	r.NewCounterFunc("db_pool_acquire_seconds_total", "Time spent acquiring connections.", func() float64 {
+		return pool.Stat().AcquireDuration().Seconds()
+	})
+}
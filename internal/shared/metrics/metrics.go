@@ -0,0 +1,314 @@
+// Package metrics keeps counters, histograms and gauges in memory and writes
+// them in the prometheus text exposition format, it avoids pulling in the
+// prometheus client for the handful of metrics both servers expose.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds in seconds used for request latencies
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+type metric interface {
+	write(w io.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteTo writes every registered metric in registration order
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := slices.Clone(r.metrics)
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, m := range metrics {
+		m.write(cw)
+	}
+
+	return cw.n, cw.w.Flush()
+}
+
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d *desc) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.kind)
+}
+
+// seriesKey joins the label values, it panics on a wrong number of values
+// since that can only be a programming error
+func (d *desc) seriesKey(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+type Counter struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labelValues []string
+	value       float64
+}
+
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{
+		desc:   desc{name: name, help: help, kind: "counter", labels: labels},
+		series: make(map[string]*counterSeries),
+	}
+	r.register(c)
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter, negative values are ignored
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	key := c.seriesKey(labelValues)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.series[key]
+	if !ok {
+		s = &counterSeries{labelValues: slices.Clone(labelValues)}
+		c.series[key] = s
+	}
+	s.value += v
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writeHeader(w)
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, s.labelValues), formatFloat(s.value))
+	}
+}
+
+type Histogram struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64 // per bucket, made cumulative when written
+	sum         float64
+	count       uint64
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+
+	h := &Histogram{
+		desc:    desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	r.register(h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := h.seriesKey(labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{
+			labelValues: slices.Clone(labelValues),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = s
+	}
+
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.writeHeader(w)
+	bucketLabels := append(slices.Clone(h.labels), "le")
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			values := append(slices.Clone(s.labelValues), formatFloat(upper))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(bucketLabels, values), cumulative)
+		}
+		values := append(slices.Clone(s.labelValues), "+Inf")
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(bucketLabels, values), s.count)
+
+		labels := formatLabels(h.labels, s.labelValues)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labels, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labels, s.count)
+	}
+}
+
+// funcMetric reads its values when scraped, for state that already lives
+// somewhere else like the connections pool or the database pool
+type funcMetric struct {
+	desc
+	fn func() map[string]float64
+}
+
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(&funcMetric{
+		desc: desc{name: name, help: help, kind: "gauge"},
+		fn:   func() map[string]float64 { return map[string]float64{"": fn()} },
+	})
+}
+
+// NewGaugeVecFunc exposes one series per key of the map returned by fn, the
+// key is the value of label
+func (r *Registry) NewGaugeVecFunc(name, help, label string, fn func() map[string]float64) {
+	r.register(&funcMetric{
+		desc: desc{name: name, help: help, kind: "gauge", labels: []string{label}},
+		fn:   fn,
+	})
+}
+
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(&funcMetric{
+		desc: desc{name: name, help: help, kind: "counter"},
+		fn:   func() map[string]float64 { return map[string]float64{"": fn()} },
+	})
+}
+
+func (f *funcMetric) write(w io.Writer) {
+	values := f.fn()
+
+	f.writeHeader(w)
+	for _, key := range sortedKeys(values) {
+		var labelValues []string
+		if len(f.labels) > 0 {
+			labelValues = []string{key}
+		}
+		fmt.Fprintf(w, "%s%s %s\n", f.name, formatLabels(f.labels, labelValues), formatFloat(values[key]))
+	}
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabelValue(v string) string {
+	return labelValueReplacer.Replace(v)
+}
+
+func escapeHelp(v string) string {
+	return helpReplacer.Replace(v)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+type countingWriter struct {
+	w *bufio.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	r := NewRegistry()
+
+	requests := r.NewCounter("http_requests_total", "HTTP requests.", "route", "status")
+	requests.Inc("GET /api/v1/users", "200")
+	requests.Inc("GET /api/v1/users", "200")
+	requests.Inc(`say "hi"`, "500")
+
+	latency := r.NewHistogram("http_request_duration_seconds", "Request latency.", []float64{0.1, 1})
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(5)
+
+	r.NewGaugeVecFunc("tunnels", "Open tunnels.", "type", func() map[string]float64 {
+		return map[string]float64{"tcp": 1, "http": 2}
+	})
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo() returned an unexpected error: %v", err)
+	}
+
+	expected := `# HELP http_requests_total HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{route="GET /api/v1/users",status="200"} 2
+http_requests_total{route="say \"hi\"",status="500"} 1
+# HELP http_request_duration_seconds Request latency.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{le="0.1"} 1
+http_request_duration_seconds_bucket{le="1"} 2
+http_request_duration_seconds_bucket{le="+Inf"} 3
+http_request_duration_seconds_sum 5.55
+http_request_duration_seconds_count 3
+# HELP tunnels Open tunnels.
+# TYPE tunnels gauge
+tunnels{type="http"} 2
+tunnels{type="tcp"} 1
+`
+	if b.String() != expected {
+		t.Fatalf("Unexpected exposition output:\n%s\nexpected:\n%s", b.String(), expected)
+	}
+}
@@ -13,7 +13,9 @@ import (
 
 const checkAPIKeyValid = `-- name: CheckAPIKeyValid :one
 SELECT EXISTS (
-    SELECT 1 FROM api_keys WHERE api_key = $1
+    SELECT 1 FROM api_keys
+    WHERE (api_key = $1 OR (previous_api_key = $1 AND previous_expires_at > NOW()))
+      AND (expires_at IS NULL OR expires_at > NOW())
 ) AS valid
 `
 
@@ -24,9 +26,33 @@ func (q *Queries) CheckAPIKeyValid(ctx context.Context, apiKey string) (bool, er
 	return valid, err
 }
 
+const countAPIKeys = `-- name: CountAPIKeys :one
+SELECT COUNT(*) FROM api_keys
+WHERE user_id = $1 AND org_id IS NULL
+`
+
+func (q *Queries) CountAPIKeys(ctx context.Context, userID int32) (int64, error) {
+	row := q.db.QueryRow(ctx, countAPIKeys, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countOrgAPIKeys = `-- name: CountOrgAPIKeys :one
+SELECT COUNT(*) FROM api_keys
+WHERE org_id = $1
+`
+
+func (q *Queries) CountOrgAPIKeys(ctx context.Context, orgID pgtype.Int4) (int64, error) {
+	row := q.db.QueryRow(ctx, countOrgAPIKeys, orgID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createAPIKey = `-- name: CreateAPIKey :one
-INSERT INTO api_keys (name, prefix, api_key, user_id, permissions, expires_at)
-VALUES ($1, $2, $3, $4, $5, $6)
+INSERT INTO api_keys (name, prefix, api_key, user_id, permissions, metadata, expires_at, org_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 RETURNING id, created_at
 `
 
@@ -36,7 +62,9 @@ type CreateAPIKeyParams struct {
 	ApiKey      string             `json:"api_key"`
 	UserID      int32              `json:"user_id"`
 	Permissions []string           `json:"permissions"`
+	Metadata    []byte             `json:"metadata"`
 	ExpiresAt   pgtype.Timestamptz `json:"expires_at"`
+	OrgID       pgtype.Int4        `json:"org_id"`
 }
 
 type CreateAPIKeyRow struct {
@@ -51,7 +79,9 @@ func (q *Queries) CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (Cre
 		arg.ApiKey,
 		arg.UserID,
 		arg.Permissions,
+		arg.Metadata,
 		arg.ExpiresAt,
+		arg.OrgID,
 	)
 	var i CreateAPIKeyRow
 	err := row.Scan(&i.ID, &i.CreatedAt)
@@ -59,7 +89,7 @@ func (q *Queries) CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (Cre
 }
 
 const deleteAPIKey = `-- name: DeleteAPIKey :execrows
-DELETE FROM api_keys where id = $1 and user_id = $2
+DELETE FROM api_keys where id = $1 and user_id = $2 and org_id IS NULL
 `
 
 type DeleteAPIKeyParams struct {
@@ -75,8 +105,26 @@ func (q *Queries) DeleteAPIKey(ctx context.Context, arg DeleteAPIKeyParams) (int
 	return result.RowsAffected(), nil
 }
 
+const deleteOrgAPIKey = `-- name: DeleteOrgAPIKey :execrows
+DELETE FROM api_keys WHERE id = $1 AND org_id = $2
+`
+
+type DeleteOrgAPIKeyParams struct {
+	ID    int32       `json:"id"`
+	OrgID pgtype.Int4 `json:"org_id"`
+}
+
+func (q *Queries) DeleteOrgAPIKey(ctx context.Context, arg DeleteOrgAPIKeyParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteOrgAPIKey, arg.ID, arg.OrgID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const getAPIKey = `-- name: GetAPIKey :one
-SELECT id, name, prefix, api_key, user_id, permissions, metadata, expires_at, created_at FROM api_keys WHERE api_key = $1
+SELECT id, name, prefix, api_key, user_id, permissions, metadata, expires_at, created_at, org_id, previous_api_key, previous_expires_at, rotated_at, last_used_at, last_used_ip FROM api_keys
+WHERE api_key = $1 OR (previous_api_key = $1 AND previous_expires_at > NOW())
 `
 
 func (q *Queries) GetAPIKey(ctx context.Context, apiKey string) (ApiKey, error) {
@@ -92,36 +140,56 @@ func (q *Queries) GetAPIKey(ctx context.Context, apiKey string) (ApiKey, error)
 		&i.Metadata,
 		&i.ExpiresAt,
 		&i.CreatedAt,
+		&i.OrgID,
+		&i.PreviousApiKey,
+		&i.PreviousExpiresAt,
+		&i.RotatedAt,
+		&i.LastUsedAt,
+		&i.LastUsedIp,
 	)
 	return i, err
 }
 
 const listAPIKeys = `-- name: ListAPIKeys :many
-SELECT id, name, prefix, api_key, user_id, permissions, expires_at, created_at
+SELECT id, name, prefix, api_key, user_id, permissions, metadata, expires_at, created_at,
+  previous_expires_at, rotated_at, last_used_at, last_used_ip
 FROM api_keys
-WHERE user_id = $1
-LIMIT $2 OFFSET $3
+WHERE user_id = $1 AND org_id IS NULL
+  AND ($2::INTEGER IS NULL OR (created_at, id) > ($3::TIMESTAMPTZ, $2))
+ORDER BY created_at, id
+LIMIT $4
 `
 
 type ListAPIKeysParams struct {
-	UserID int32 `json:"user_id"`
-	Limit  int32 `json:"limit"`
-	Offset int32 `json:"offset"`
+	UserID     int32              `json:"user_id"`
+	CursorID   pgtype.Int4        `json:"cursor_id"`
+	CursorTime pgtype.Timestamptz `json:"cursor_time"`
+	RowLimit   int32              `json:"row_limit"`
 }
 
 type ListAPIKeysRow struct {
-	ID          int32              `json:"id"`
-	Name        string             `json:"name"`
-	Prefix      string             `json:"prefix"`
-	ApiKey      string             `json:"api_key"`
-	UserID      int32              `json:"user_id"`
-	Permissions []string           `json:"permissions"`
-	ExpiresAt   pgtype.Timestamptz `json:"expires_at"`
-	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+	ID                int32              `json:"id"`
+	Name              string             `json:"name"`
+	Prefix            string             `json:"prefix"`
+	ApiKey            string             `json:"api_key"`
+	UserID            int32              `json:"user_id"`
+	Permissions       []string           `json:"permissions"`
+	Metadata          []byte             `json:"metadata"`
+	ExpiresAt         pgtype.Timestamptz `json:"expires_at"`
+	CreatedAt         pgtype.Timestamptz `json:"created_at"`
+	PreviousExpiresAt pgtype.Timestamptz `json:"previous_expires_at"`
+	RotatedAt         pgtype.Timestamptz `json:"rotated_at"`
+	LastUsedAt        pgtype.Timestamptz `json:"last_used_at"`
+	LastUsedIp        pgtype.Text        `json:"last_used_ip"`
 }
 
 func (q *Queries) ListAPIKeys(ctx context.Context, arg ListAPIKeysParams) ([]ListAPIKeysRow, error) {
-	rows, err := q.db.Query(ctx, listAPIKeys, arg.UserID, arg.Limit, arg.Offset)
+	rows, err := q.db.Query(ctx, listAPIKeys,
+		arg.UserID,
+		arg.CursorID,
+		arg.CursorTime,
+		arg.RowLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -136,8 +204,13 @@ func (q *Queries) ListAPIKeys(ctx context.Context, arg ListAPIKeysParams) ([]Lis
 			&i.ApiKey,
 			&i.UserID,
 			&i.Permissions,
+			&i.Metadata,
 			&i.ExpiresAt,
 			&i.CreatedAt,
+			&i.PreviousExpiresAt,
+			&i.RotatedAt,
+			&i.LastUsedAt,
+			&i.LastUsedIp,
 		); err != nil {
 			return nil, err
 		}
@@ -148,3 +221,291 @@ func (q *Queries) ListAPIKeys(ctx context.Context, arg ListAPIKeysParams) ([]Lis
 	}
 	return items, nil
 }
+
+const listOrgAPIKeys = `-- name: ListOrgAPIKeys :many
+SELECT id, name, prefix, api_key, user_id, permissions, metadata, expires_at, created_at, org_id,
+  previous_expires_at, rotated_at, last_used_at, last_used_ip
+FROM api_keys
+WHERE org_id = $1
+  AND ($2::INTEGER IS NULL OR (created_at, id) > ($3::TIMESTAMPTZ, $2))
+ORDER BY created_at, id
+LIMIT $4
+`
+
+type ListOrgAPIKeysParams struct {
+	OrgID      pgtype.Int4        `json:"org_id"`
+	CursorID   pgtype.Int4        `json:"cursor_id"`
+	CursorTime pgtype.Timestamptz `json:"cursor_time"`
+	RowLimit   int32              `json:"row_limit"`
+}
+
+type ListOrgAPIKeysRow struct {
+	ID                int32              `json:"id"`
+	Name              string             `json:"name"`
+	Prefix            string             `json:"prefix"`
+	ApiKey            string             `json:"api_key"`
+	UserID            int32              `json:"user_id"`
+	Permissions       []string           `json:"permissions"`
+	Metadata          []byte             `json:"metadata"`
+	ExpiresAt         pgtype.Timestamptz `json:"expires_at"`
+	CreatedAt         pgtype.Timestamptz `json:"created_at"`
+	OrgID             pgtype.Int4        `json:"org_id"`
+	PreviousExpiresAt pgtype.Timestamptz `json:"previous_expires_at"`
+	RotatedAt         pgtype.Timestamptz `json:"rotated_at"`
+	LastUsedAt        pgtype.Timestamptz `json:"last_used_at"`
+	LastUsedIp        pgtype.Text        `json:"last_used_ip"`
+}
+
+func (q *Queries) ListOrgAPIKeys(ctx context.Context, arg ListOrgAPIKeysParams) ([]ListOrgAPIKeysRow, error) {
+	rows, err := q.db.Query(ctx, listOrgAPIKeys,
+		arg.OrgID,
+		arg.CursorID,
+		arg.CursorTime,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListOrgAPIKeysRow{}
+	for rows.Next() {
+		var i ListOrgAPIKeysRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Prefix,
+			&i.ApiKey,
+			&i.UserID,
+			&i.Permissions,
+			&i.Metadata,
+			&i.ExpiresAt,
+			&i.CreatedAt,
+			&i.OrgID,
+			&i.PreviousExpiresAt,
+			&i.RotatedAt,
+			&i.LastUsedAt,
+			&i.LastUsedIp,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeAPIKey = `-- name: RevokeAPIKey :one
+UPDATE api_keys
+SET expires_at = NOW(),
+  previous_api_key = NULL,
+  previous_expires_at = NULL
+WHERE api_key = $1 AND (expires_at IS NULL OR expires_at > NOW())
+RETURNING id, name, prefix, api_key, user_id, permissions, metadata, expires_at, created_at, org_id, previous_api_key, previous_expires_at, rotated_at, last_used_at, last_used_ip
+`
+
+func (q *Queries) RevokeAPIKey(ctx context.Context, apiKey string) (ApiKey, error) {
+	row := q.db.QueryRow(ctx, revokeAPIKey, apiKey)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Prefix,
+		&i.ApiKey,
+		&i.UserID,
+		&i.Permissions,
+		&i.Metadata,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.OrgID,
+		&i.PreviousApiKey,
+		&i.PreviousExpiresAt,
+		&i.RotatedAt,
+		&i.LastUsedAt,
+		&i.LastUsedIp,
+	)
+	return i, err
+}
+
+const revokePreviousAPIKey = `-- name: RevokePreviousAPIKey :one
+UPDATE api_keys
+SET previous_api_key = NULL,
+  previous_expires_at = NULL
+WHERE previous_api_key = $1 AND previous_expires_at > NOW()
+  AND (expires_at IS NULL OR expires_at > NOW())
+RETURNING id, name, prefix, api_key, user_id, permissions, metadata, expires_at, created_at, org_id, previous_api_key, previous_expires_at, rotated_at, last_used_at, last_used_ip
+`
+
+func (q *Queries) RevokePreviousAPIKey(ctx context.Context, previousApiKey pgtype.Text) (ApiKey, error) {
+	row := q.db.QueryRow(ctx, revokePreviousAPIKey, previousApiKey)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Prefix,
+		&i.ApiKey,
+		&i.UserID,
+		&i.Permissions,
+		&i.Metadata,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.OrgID,
+		&i.PreviousApiKey,
+		&i.PreviousExpiresAt,
+		&i.RotatedAt,
+		&i.LastUsedAt,
+		&i.LastUsedIp,
+	)
+	return i, err
+}
+
+const rotateAPIKey = `-- name: RotateAPIKey :one
+UPDATE api_keys
+SET previous_api_key = CASE WHEN $1::TIMESTAMPTZ IS NULL THEN NULL ELSE api_key END,
+  previous_expires_at = $1,
+  api_key = $2,
+  prefix = $3,
+  rotated_at = NOW()
+WHERE id = $4 AND user_id = $5 AND org_id IS NULL
+RETURNING id, name, prefix, api_key, user_id, permissions, metadata, expires_at, created_at, org_id, previous_api_key, previous_expires_at, rotated_at, last_used_at, last_used_ip
+`
+
+type RotateAPIKeyParams struct {
+	PreviousExpiresAt pgtype.Timestamptz `json:"previous_expires_at"`
+	ApiKey            string             `json:"api_key"`
+	Prefix            string             `json:"prefix"`
+	ID                int32              `json:"id"`
+	UserID            int32              `json:"user_id"`
+}
+
+func (q *Queries) RotateAPIKey(ctx context.Context, arg RotateAPIKeyParams) (ApiKey, error) {
+	row := q.db.QueryRow(ctx, rotateAPIKey,
+		arg.PreviousExpiresAt,
+		arg.ApiKey,
+		arg.Prefix,
+		arg.ID,
+		arg.UserID,
+	)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Prefix,
+		&i.ApiKey,
+		&i.UserID,
+		&i.Permissions,
+		&i.Metadata,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.OrgID,
+		&i.PreviousApiKey,
+		&i.PreviousExpiresAt,
+		&i.RotatedAt,
+		&i.LastUsedAt,
+		&i.LastUsedIp,
+	)
+	return i, err
+}
+
+const rotateOrgAPIKey = `-- name: RotateOrgAPIKey :one
+UPDATE api_keys
+SET previous_api_key = CASE WHEN $1::TIMESTAMPTZ IS NULL THEN NULL ELSE api_key END,
+  previous_expires_at = $1,
+  api_key = $2,
+  prefix = $3,
+  rotated_at = NOW()
+WHERE id = $4 AND org_id = $5
+RETURNING id, name, prefix, api_key, user_id, permissions, metadata, expires_at, created_at, org_id, previous_api_key, previous_expires_at, rotated_at, last_used_at, last_used_ip
+`
+
+type RotateOrgAPIKeyParams struct {
+	PreviousExpiresAt pgtype.Timestamptz `json:"previous_expires_at"`
+	ApiKey            string             `json:"api_key"`
+	Prefix            string             `json:"prefix"`
+	ID                int32              `json:"id"`
+	OrgID             pgtype.Int4        `json:"org_id"`
+}
+
+func (q *Queries) RotateOrgAPIKey(ctx context.Context, arg RotateOrgAPIKeyParams) (ApiKey, error) {
+	row := q.db.QueryRow(ctx, rotateOrgAPIKey,
+		arg.PreviousExpiresAt,
+		arg.ApiKey,
+		arg.Prefix,
+		arg.ID,
+		arg.OrgID,
+	)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Prefix,
+		&i.ApiKey,
+		&i.UserID,
+		&i.Permissions,
+		&i.Metadata,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.OrgID,
+		&i.PreviousApiKey,
+		&i.PreviousExpiresAt,
+		&i.RotatedAt,
+		&i.LastUsedAt,
+		&i.LastUsedIp,
+	)
+	return i, err
+}
+
+const updateAPIKeyMetadata = `-- name: UpdateAPIKeyMetadata :execrows
+UPDATE api_keys SET metadata = $1 WHERE id = $2 AND user_id = $3 AND org_id IS NULL
+`
+
+type UpdateAPIKeyMetadataParams struct {
+	Metadata []byte `json:"metadata"`
+	ID       int32  `json:"id"`
+	UserID   int32  `json:"user_id"`
+}
+
+func (q *Queries) UpdateAPIKeyMetadata(ctx context.Context, arg UpdateAPIKeyMetadataParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateAPIKeyMetadata, arg.Metadata, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateAPIKeysLastUsed = `-- name: UpdateAPIKeysLastUsed :exec
+UPDATE api_keys
+SET last_used_at = u.used_at, last_used_ip = u.ip
+FROM unnest($1::INTEGER[], $2::TIMESTAMPTZ[], $3::TEXT[]) AS u(id, used_at, ip)
+WHERE api_keys.id = u.id
+`
+
+type UpdateAPIKeysLastUsedParams struct {
+	Ids     []int32              `json:"ids"`
+	UsedAts []pgtype.Timestamptz `json:"used_ats"`
+	Ips     []string             `json:"ips"`
+}
+
+func (q *Queries) UpdateAPIKeysLastUsed(ctx context.Context, arg UpdateAPIKeysLastUsedParams) error {
+	_, err := q.db.Exec(ctx, updateAPIKeysLastUsed, arg.Ids, arg.UsedAts, arg.Ips)
+	return err
+}
+
+const updateOrgAPIKeyMetadata = `-- name: UpdateOrgAPIKeyMetadata :execrows
+UPDATE api_keys SET metadata = $1 WHERE id = $2 AND org_id = $3
+`
+
+type UpdateOrgAPIKeyMetadataParams struct {
+	Metadata []byte      `json:"metadata"`
+	ID       int32       `json:"id"`
+	OrgID    pgtype.Int4 `json:"org_id"`
+}
+
+func (q *Queries) UpdateOrgAPIKeyMetadata(ctx context.Context, arg UpdateOrgAPIKeyMetadataParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateOrgAPIKeyMetadata, arg.Metadata, arg.ID, arg.OrgID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
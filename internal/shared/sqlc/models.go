@@ -9,15 +9,57 @@ import (
 )
 
 type ApiKey struct {
-	ID          int32              `json:"id"`
-	Name        string             `json:"name"`
-	Prefix      string             `json:"prefix"`
-	ApiKey      string             `json:"api_key"`
-	UserID      int32              `json:"user_id"`
-	Permissions []string           `json:"permissions"`
-	Metadata    []byte             `json:"metadata"`
-	ExpiresAt   pgtype.Timestamptz `json:"expires_at"`
-	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+	ID                int32              `json:"id"`
+	Name              string             `json:"name"`
+	Prefix            string             `json:"prefix"`
+	ApiKey            string             `json:"api_key"`
+	UserID            int32              `json:"user_id"`
+	Permissions       []string           `json:"permissions"`
+	Metadata          []byte             `json:"metadata"`
+	ExpiresAt         pgtype.Timestamptz `json:"expires_at"`
+	CreatedAt         pgtype.Timestamptz `json:"created_at"`
+	OrgID             pgtype.Int4        `json:"org_id"`
+	PreviousApiKey    pgtype.Text        `json:"previous_api_key"`
+	PreviousExpiresAt pgtype.Timestamptz `json:"previous_expires_at"`
+	RotatedAt         pgtype.Timestamptz `json:"rotated_at"`
+	LastUsedAt        pgtype.Timestamptz `json:"last_used_at"`
+	LastUsedIp        pgtype.Text        `json:"last_used_ip"`
+}
+
+type AuditEvent struct {
+	ID         int64              `json:"id"`
+	ActorID    pgtype.Int4        `json:"actor_id"`
+	Action     string             `json:"action"`
+	TargetType string             `json:"target_type"`
+	TargetID   string             `json:"target_id"`
+	Ip         string             `json:"ip"`
+	UserAgent  string             `json:"user_agent"`
+	Metadata   []byte             `json:"metadata"`
+	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+}
+
+type Organization struct {
+	ID        int32              `json:"id"`
+	Name      string             `json:"name"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type OrganizationInvitation struct {
+	ID        int32              `json:"id"`
+	OrgID     int32              `json:"org_id"`
+	Email     string             `json:"email"`
+	Role      string             `json:"role"`
+	TokenHash string             `json:"token_hash"`
+	InvitedBy pgtype.Int4        `json:"invited_by"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type OrganizationMember struct {
+	OrgID     int32              `json:"org_id"`
+	UserID    int32              `json:"user_id"`
+	Role      string             `json:"role"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
 }
 
 type OtpVerification struct {
@@ -33,6 +75,78 @@ type OtpVerification struct {
 	UpdatedAt     pgtype.Timestamptz `json:"updated_at"`
 }
 
+type Plan struct {
+	ID                   int32              `json:"id"`
+	Name                 string             `json:"name"`
+	MaxSessions          int32              `json:"max_sessions"`
+	MaxTunnelsPerSession int32              `json:"max_tunnels_per_session"`
+	MaxReservedDomains   int32              `json:"max_reserved_domains"`
+	MaxTcpPorts          int32              `json:"max_tcp_ports"`
+	MonthlyBandwidth     int64              `json:"monthly_bandwidth"`
+	CreatedAt            pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt            pgtype.Timestamptz `json:"updated_at"`
+}
+
+type ReservedDomain struct {
+	ID        int32              `json:"id"`
+	Hostname  string             `json:"hostname"`
+	UserID    int32              `json:"user_id"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	OrgID     pgtype.Int4        `json:"org_id"`
+}
+
+type TunnelAccessLog struct {
+	ID                int64              `json:"id"`
+	TunnelID          string             `json:"tunnel_id"`
+	SessionID         string             `json:"session_id"`
+	UserID            int32              `json:"user_id"`
+	RequestID         string             `json:"request_id"`
+	Hostname          string             `json:"hostname"`
+	Method            string             `json:"method"`
+	Path              string             `json:"path"`
+	Status            int32              `json:"status"`
+	RemoteAddr        string             `json:"remote_addr"`
+	UpstreamLatencyMs int64              `json:"upstream_latency_ms"`
+	BytesIn           int64              `json:"bytes_in"`
+	BytesOut          int64              `json:"bytes_out"`
+	CreatedAt         pgtype.Timestamptz `json:"created_at"`
+}
+
+type TunnelUsage struct {
+	ID        int32              `json:"id"`
+	UserID    int32              `json:"user_id"`
+	Period    pgtype.Date        `json:"period"`
+	BytesIn   int64              `json:"bytes_in"`
+	BytesOut  int64              `json:"bytes_out"`
+	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
+}
+
+type UserIdentity struct {
+	ID        int32              `json:"id"`
+	UserID    int32              `json:"user_id"`
+	Provider  string             `json:"provider"`
+	Subject   string             `json:"subject"`
+	Email     string             `json:"email"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type UserRecoveryCode struct {
+	ID        int32              `json:"id"`
+	UserID    int32              `json:"user_id"`
+	CodeHash  string             `json:"code_hash"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type UserTotp struct {
+	UserID       int32              `json:"user_id"`
+	Secret       string             `json:"secret"`
+	Enabled      bool               `json:"enabled"`
+	LastUsedStep int64              `json:"last_used_step"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+	EnabledAt    pgtype.Timestamptz `json:"enabled_at"`
+}
+
 type User struct {
 	ID            int32              `json:"id"`
 	Email         string             `json:"email"`
@@ -41,4 +155,9 @@ type User struct {
 	EmailVerified bool               `json:"email_verified"`
 	CreatedAt     pgtype.Timestamptz `json:"created_at"`
 	UpdatedAt     pgtype.Timestamptz `json:"updated_at"`
+	Plan          string             `json:"plan"`
+	DeletedAt     pgtype.Timestamptz `json:"deleted_at"`
+	PurgeAt       pgtype.Timestamptz `json:"purge_at"`
+	IsAdmin       bool               `json:"is_admin"`
+	SuspendedAt   pgtype.Timestamptz `json:"suspended_at"`
 }
@@ -51,6 +51,16 @@ func (q *Queries) CreateOtp(ctx context.Context, arg CreateOtpParams) error {
 	return err
 }
 
+const deleteOtpsByEmail = `-- name: DeleteOtpsByEmail :exec
+DELETE FROM otp_verification
+WHERE lower(email) = ANY($1::TEXT[])
+`
+
+func (q *Queries) DeleteOtpsByEmail(ctx context.Context, emails []string) error {
+	_, err := q.db.Exec(ctx, deleteOtpsByEmail, emails)
+	return err
+}
+
 const getOtp = `-- name: GetOtp :one
 SELECT id, email, otp, type, attempts, used, is_invalidated, expires_at, created_at, updated_at FROM otp_verification
 WHERE email = $1 AND type = $2
@@ -6,29 +6,102 @@ package sqlc
 
 import (
 	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type Querier interface {
+	AcceptOrganizationInvitation(ctx context.Context, arg AcceptOrganizationInvitationParams) (int32, error)
+	AddTunnelUsage(ctx context.Context, arg AddTunnelUsageParams) error
+	CancelUserDeletion(ctx context.Context, id int32) (int64, error)
 	CheckAPIKeyValid(ctx context.Context, apiKey string) (bool, error)
+	CountAPIKeys(ctx context.Context, userID int32) (int64, error)
+	CountAuditEvents(ctx context.Context, actorID pgtype.Int4) (int64, error)
+	CountOrgAPIKeys(ctx context.Context, orgID pgtype.Int4) (int64, error)
+	CountOrgReservedDomains(ctx context.Context, orgID pgtype.Int4) (int64, error)
+	CountOrganizationOwners(ctx context.Context, orgID int32) (int64, error)
 	CountOtpsAfterUtcTime(ctx context.Context, arg CountOtpsAfterUtcTimeParams) (int64, error)
+	CountReservedDomains(ctx context.Context, userID int32) (int64, error)
+	CountTunnelAccessLogs(ctx context.Context, arg CountTunnelAccessLogsParams) (int64, error)
+	CountTunnelUsage(ctx context.Context, userID int32) (int64, error)
+	CountUnusedUserRecoveryCodes(ctx context.Context, userID int32) (int64, error)
+	CountUserReservedDomains(ctx context.Context, userID int32) (int64, error)
+	CountUsers(ctx context.Context, arg CountUsersParams) (int64, error)
 	CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (CreateAPIKeyRow, error)
+	CreateAuditEvent(ctx context.Context, arg CreateAuditEventParams) (CreateAuditEventRow, error)
+	CreateOrganization(ctx context.Context, arg CreateOrganizationParams) (CreateOrganizationRow, error)
+	CreateOrganizationInvitation(ctx context.Context, arg CreateOrganizationInvitationParams) (CreateOrganizationInvitationRow, error)
 	CreateOtp(ctx context.Context, arg CreateOtpParams) error
+	CreateReservedDomain(ctx context.Context, arg CreateReservedDomainParams) (CreateReservedDomainRow, error)
+	CreateTunnelAccessLogs(ctx context.Context, arg []CreateTunnelAccessLogsParams) (int64, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (CreateUserRow, error)
+	CreateUserIdentity(ctx context.Context, arg CreateUserIdentityParams) (CreateUserIdentityRow, error)
+	CreateUserRecoveryCodes(ctx context.Context, arg []CreateUserRecoveryCodesParams) (int64, error)
 	DeleteAPIKey(ctx context.Context, arg DeleteAPIKeyParams) (int64, error)
+	DeleteOrgAPIKey(ctx context.Context, arg DeleteOrgAPIKeyParams) (int64, error)
+	DeleteOrgReservedDomain(ctx context.Context, arg DeleteOrgReservedDomainParams) (int64, error)
+	DeleteOrganization(ctx context.Context, id int32) (int64, error)
+	DeleteOrganizationInvitation(ctx context.Context, arg DeleteOrganizationInvitationParams) (int64, error)
+	DeleteOrganizationMember(ctx context.Context, arg DeleteOrganizationMemberParams) (int64, error)
+	DeleteOtpsByEmail(ctx context.Context, emails []string) error
+	DeleteReservedDomain(ctx context.Context, arg DeleteReservedDomainParams) (int64, error)
 	DeleteUser(ctx context.Context, id int32) (int64, error)
+	DeleteUserIdentity(ctx context.Context, arg DeleteUserIdentityParams) (int64, error)
+	DeleteUserRecoveryCodes(ctx context.Context, userID int32) error
+	DeleteUserTotp(ctx context.Context, userID int32) (int64, error)
+	EnableUserTotp(ctx context.Context, userID int32) (int64, error)
 	GetAPIKey(ctx context.Context, apiKey string) (ApiKey, error)
+	GetCurrentMonthUsage(ctx context.Context, userID int32) (int64, error)
+	GetOrganization(ctx context.Context, id int32) (Organization, error)
+	GetOrganizationInvitationByToken(ctx context.Context, tokenHash string) (OrganizationInvitation, error)
+	GetOrganizationMember(ctx context.Context, arg GetOrganizationMemberParams) (OrganizationMember, error)
 	GetOtp(ctx context.Context, arg GetOtpParams) (OtpVerification, error)
+	GetPlanByName(ctx context.Context, name string) (Plan, error)
+	GetReservedDomainByHostname(ctx context.Context, hostname string) (ReservedDomain, error)
 	GetUserByEmail(ctx context.Context, email string) (User, error)
 	GetUserById(ctx context.Context, id int32) (User, error)
+	GetUserIdentity(ctx context.Context, arg GetUserIdentityParams) (UserIdentity, error)
+	GetUserTotp(ctx context.Context, userID int32) (UserTotp, error)
 	IncreaseAttemptAndInvalidateOtp(ctx context.Context, id int32) error
 	IncreaseOtpAttempt(ctx context.Context, id int32) error
 	InvalidateOtp(ctx context.Context, id int32) error
 	ListAPIKeys(ctx context.Context, arg ListAPIKeysParams) ([]ListAPIKeysRow, error)
+	ListAuditEvents(ctx context.Context, arg ListAuditEventsParams) ([]AuditEvent, error)
+	ListOrgAPIKeys(ctx context.Context, arg ListOrgAPIKeysParams) ([]ListOrgAPIKeysRow, error)
+	ListOrgReservedDomains(ctx context.Context, arg ListOrgReservedDomainsParams) ([]ReservedDomain, error)
+	ListOrganizationInvitations(ctx context.Context, orgID int32) ([]ListOrganizationInvitationsRow, error)
+	ListOrganizationMembers(ctx context.Context, orgID int32) ([]ListOrganizationMembersRow, error)
+	ListPlans(ctx context.Context) ([]Plan, error)
+	ListPurgeableUsers(ctx context.Context) ([]ListPurgeableUsersRow, error)
+	ListReservedDomains(ctx context.Context, arg ListReservedDomainsParams) ([]ReservedDomain, error)
+	ListTunnelAccessLogs(ctx context.Context, arg ListTunnelAccessLogsParams) ([]TunnelAccessLog, error)
+	ListTunnelUsage(ctx context.Context, arg ListTunnelUsageParams) ([]TunnelUsage, error)
+	ListUserIdentities(ctx context.Context, userID int32) ([]UserIdentity, error)
+	ListUserOrganizations(ctx context.Context, userID int32) ([]ListUserOrganizationsRow, error)
 	ListUsers(ctx context.Context, arg ListUsersParams) ([]User, error)
+	PurgeDeletedUsers(ctx context.Context, ids []int32) ([]int32, error)
+	RevokeAPIKey(ctx context.Context, apiKey string) (ApiKey, error)
+	RevokePreviousAPIKey(ctx context.Context, previousApiKey pgtype.Text) (ApiKey, error)
+	RotateAPIKey(ctx context.Context, arg RotateAPIKeyParams) (ApiKey, error)
+	RotateOrgAPIKey(ctx context.Context, arg RotateOrgAPIKeyParams) (ApiKey, error)
+	ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) (int64, error)
+	ScrubAuditEvents(ctx context.Context, arg ScrubAuditEventsParams) error
+	SuspendUser(ctx context.Context, id int32) (int64, error)
+	UnsuspendUser(ctx context.Context, id int32) (int64, error)
+	UpdateAPIKeyMetadata(ctx context.Context, arg UpdateAPIKeyMetadataParams) (int64, error)
+	UpdateAPIKeysLastUsed(ctx context.Context, arg UpdateAPIKeysLastUsedParams) error
+	UpdateOrgAPIKeyMetadata(ctx context.Context, arg UpdateOrgAPIKeyMetadataParams) (int64, error)
+	UpdateOrganizationMemberRole(ctx context.Context, arg UpdateOrganizationMemberRoleParams) (int64, error)
+	UpdateOrganizationName(ctx context.Context, arg UpdateOrganizationNameParams) (int64, error)
+	UpdateUserAdmin(ctx context.Context, arg UpdateUserAdminParams) (int64, error)
 	UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams) (User, error)
 	UpdateUserFull(ctx context.Context, arg UpdateUserFullParams) (User, error)
 	UpdateUserName(ctx context.Context, arg UpdateUserNameParams) (User, error)
 	UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error
+	UpdateUserPlan(ctx context.Context, arg UpdateUserPlanParams) (int64, error)
+	UpsertUserTotp(ctx context.Context, arg UpsertUserTotpParams) error
+	UseUserRecoveryCode(ctx context.Context, arg UseUserRecoveryCodeParams) (int64, error)
+	UseUserTotpStep(ctx context.Context, arg UseUserTotpStepParams) (int64, error)
 	VerifyOtp(ctx context.Context, id int32) error
 	VerifyUserEmail(ctx context.Context, id int32) error
 }
@@ -11,6 +11,57 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const cancelUserDeletion = `-- name: CancelUserDeletion :execrows
+UPDATE users
+SET deleted_at = NULL, purge_at = NULL, updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NOT NULL
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.Exec(ctx, cancelUserDeletion, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const countUsers = `-- name: CountUsers :one
+SELECT COUNT(*)
+FROM users
+WHERE ($1::TEXT IS NULL OR email ILIKE '%' || $1 || '%' ESCAPE '\' OR name ILIKE '%' || $1 || '%' ESCAPE '\')
+  AND ($2::BOOL IS NULL OR email_verified = $2)
+  AND ($3::BOOL IS NULL OR is_admin = $3)
+  AND ($4::BOOL IS NULL OR (suspended_at IS NOT NULL) = $4)
+  AND ($5::TEXT IS NULL OR plan = $5)
+  AND ($6::TIMESTAMPTZ IS NULL OR created_at >= $6)
+  AND ($7::TIMESTAMPTZ IS NULL OR created_at < $7)
+`
+
+type CountUsersParams struct {
+	Search        pgtype.Text        `json:"search"`
+	EmailVerified pgtype.Bool        `json:"email_verified"`
+	IsAdmin       pgtype.Bool        `json:"is_admin"`
+	Suspended     pgtype.Bool        `json:"suspended"`
+	Plan          pgtype.Text        `json:"plan"`
+	CreatedAfter  pgtype.Timestamptz `json:"created_after"`
+	CreatedBefore pgtype.Timestamptz `json:"created_before"`
+}
+
+func (q *Queries) CountUsers(ctx context.Context, arg CountUsersParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countUsers,
+		arg.Search,
+		arg.EmailVerified,
+		arg.IsAdmin,
+		arg.Suspended,
+		arg.Plan,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (email, name, password_hash)
 VALUES ($1, $2, $3)
@@ -48,7 +99,7 @@ func (q *Queries) DeleteUser(ctx context.Context, id int32) (int64, error) {
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, email, name, password_hash, email_verified, created_at, updated_at
+SELECT id, email, name, password_hash, email_verified, created_at, updated_at, plan, deleted_at, purge_at, is_admin, suspended_at
 FROM users
 WHERE email = $1 LIMIT 1
 `
@@ -64,12 +115,17 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.EmailVerified,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Plan,
+		&i.DeletedAt,
+		&i.PurgeAt,
+		&i.IsAdmin,
+		&i.SuspendedAt,
 	)
 	return i, err
 }
 
 const getUserById = `-- name: GetUserById :one
-SELECT id, email, name, password_hash, email_verified, created_at, updated_at
+SELECT id, email, name, password_hash, email_verified, created_at, updated_at, plan, deleted_at, purge_at, is_admin, suspended_at
 FROM users
 WHERE id = $1 LIMIT 1
 `
@@ -85,24 +141,105 @@ func (q *Queries) GetUserById(ctx context.Context, id int32) (User, error) {
 		&i.EmailVerified,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Plan,
+		&i.DeletedAt,
+		&i.PurgeAt,
+		&i.IsAdmin,
+		&i.SuspendedAt,
 	)
 	return i, err
 }
 
+const listPurgeableUsers = `-- name: ListPurgeableUsers :many
+SELECT id, email FROM users
+WHERE purge_at IS NOT NULL AND purge_at <= NOW()
+`
+
+type ListPurgeableUsersRow struct {
+	ID    int32  `json:"id"`
+	Email string `json:"email"`
+}
+
+func (q *Queries) ListPurgeableUsers(ctx context.Context) ([]ListPurgeableUsersRow, error) {
+	rows, err := q.db.Query(ctx, listPurgeableUsers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListPurgeableUsersRow{}
+	for rows.Next() {
+		var i ListPurgeableUsersRow
+		if err := rows.Scan(&i.ID, &i.Email); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listUsers = `-- name: ListUsers :many
-SELECT id, email, name, password_hash, email_verified, created_at, updated_at
+SELECT id, email, name, password_hash, email_verified, created_at, updated_at, plan, deleted_at, purge_at, is_admin, suspended_at
 FROM users
-ORDER BY created_at DESC
-LIMIT $1 OFFSET $2
+WHERE ($1::TEXT IS NULL OR email ILIKE '%' || $1 || '%' ESCAPE '\' OR name ILIKE '%' || $1 || '%' ESCAPE '\')
+  AND ($2::BOOL IS NULL OR email_verified = $2)
+  AND ($3::BOOL IS NULL OR is_admin = $3)
+  AND ($4::BOOL IS NULL OR (suspended_at IS NOT NULL) = $4)
+  AND ($5::TEXT IS NULL OR plan = $5)
+  AND ($6::TIMESTAMPTZ IS NULL OR created_at >= $6)
+  AND ($7::TIMESTAMPTZ IS NULL OR created_at < $7)
+  AND ($8::INTEGER IS NULL OR CASE $9::TEXT
+    WHEN 'email' THEN (email, id) > ($10::TEXT, $8)
+    WHEN '-email' THEN (email, id) < ($10, $8)
+    WHEN 'name' THEN (name, id) > ($10, $8)
+    WHEN '-name' THEN (name, id) < ($10, $8)
+    WHEN 'created_at' THEN (created_at, id) > ($11::TIMESTAMPTZ, $8)
+    ELSE (created_at, id) < ($11, $8)
+  END)
+ORDER BY
+  CASE WHEN $9 = 'email' THEN email END ASC,
+  CASE WHEN $9 = '-email' THEN email END DESC,
+  CASE WHEN $9 = 'name' THEN name END ASC,
+  CASE WHEN $9 = '-name' THEN name END DESC,
+  CASE WHEN $9 = 'created_at' THEN created_at END ASC,
+  CASE WHEN $9 = '-created_at' THEN created_at END DESC,
+  CASE WHEN $9 IN ('email', 'name', 'created_at') THEN id END ASC,
+  id DESC
+LIMIT $12
 `
 
 type ListUsersParams struct {
-	Limit  int32 `json:"limit"`
-	Offset int32 `json:"offset"`
+	Search        pgtype.Text        `json:"search"`
+	EmailVerified pgtype.Bool        `json:"email_verified"`
+	IsAdmin       pgtype.Bool        `json:"is_admin"`
+	Suspended     pgtype.Bool        `json:"suspended"`
+	Plan          pgtype.Text        `json:"plan"`
+	CreatedAfter  pgtype.Timestamptz `json:"created_after"`
+	CreatedBefore pgtype.Timestamptz `json:"created_before"`
+	CursorID      pgtype.Int4        `json:"cursor_id"`
+	Sort          string             `json:"sort"`
+	CursorValue   pgtype.Text        `json:"cursor_value"`
+	CursorTime    pgtype.Timestamptz `json:"cursor_time"`
+	RowLimit      int32              `json:"row_limit"`
 }
 
 func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, error) {
-	rows, err := q.db.Query(ctx, listUsers, arg.Limit, arg.Offset)
+	rows, err := q.db.Query(ctx, listUsers,
+		arg.Search,
+		arg.EmailVerified,
+		arg.IsAdmin,
+		arg.Suspended,
+		arg.Plan,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+		arg.CursorID,
+		arg.Sort,
+		arg.CursorValue,
+		arg.CursorTime,
+		arg.RowLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -118,6 +255,11 @@ func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, e
 			&i.EmailVerified,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Plan,
+			&i.DeletedAt,
+			&i.PurgeAt,
+			&i.IsAdmin,
+			&i.SuspendedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -129,11 +271,103 @@ func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, e
 	return items, nil
 }
 
+const purgeDeletedUsers = `-- name: PurgeDeletedUsers :many
+DELETE FROM users
+WHERE id = ANY($1::INTEGER[]) AND purge_at IS NOT NULL AND purge_at <= NOW()
+RETURNING id
+`
+
+func (q *Queries) PurgeDeletedUsers(ctx context.Context, ids []int32) ([]int32, error) {
+	rows, err := q.db.Query(ctx, purgeDeletedUsers, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []int32{}
+	for rows.Next() {
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const scheduleUserDeletion = `-- name: ScheduleUserDeletion :execrows
+UPDATE users
+SET deleted_at = NOW(), purge_at = $2, updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+`
+
+type ScheduleUserDeletionParams struct {
+	ID      int32              `json:"id"`
+	PurgeAt pgtype.Timestamptz `json:"purge_at"`
+}
+
+func (q *Queries) ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, scheduleUserDeletion, arg.ID, arg.PurgeAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const suspendUser = `-- name: SuspendUser :execrows
+UPDATE users
+SET suspended_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND suspended_at IS NULL
+`
+
+func (q *Queries) SuspendUser(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.Exec(ctx, suspendUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const unsuspendUser = `-- name: UnsuspendUser :execrows
+UPDATE users
+SET suspended_at = NULL, updated_at = NOW()
+WHERE id = $1 AND suspended_at IS NOT NULL
+`
+
+func (q *Queries) UnsuspendUser(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.Exec(ctx, unsuspendUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateUserAdmin = `-- name: UpdateUserAdmin :execrows
+UPDATE users
+SET is_admin = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateUserAdminParams struct {
+	ID      int32 `json:"id"`
+	IsAdmin bool  `json:"is_admin"`
+}
+
+func (q *Queries) UpdateUserAdmin(ctx context.Context, arg UpdateUserAdminParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateUserAdmin, arg.ID, arg.IsAdmin)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const updateUserEmail = `-- name: UpdateUserEmail :one
 UPDATE users
-SET email = $2, updated_at = NOW()
+SET email = $2, email_verified = true, updated_at = NOW()
 WHERE id = $1
-RETURNING id, email, name, password_hash, email_verified, created_at, updated_at
+RETURNING id, email, name, password_hash, email_verified, created_at, updated_at, plan, deleted_at, purge_at, is_admin, suspended_at
 `
 
 type UpdateUserEmailParams struct {
@@ -152,6 +386,11 @@ func (q *Queries) UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams
 		&i.EmailVerified,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Plan,
+		&i.DeletedAt,
+		&i.PurgeAt,
+		&i.IsAdmin,
+		&i.SuspendedAt,
 	)
 	return i, err
 }
@@ -160,7 +399,7 @@ const updateUserFull = `-- name: UpdateUserFull :one
 UPDATE users
 SET email = $2, name = $3, password_hash = $4, email_verified = $5, updated_at = NOW()
 WHERE id = $1
-RETURNING id, email, name, password_hash, email_verified, created_at, updated_at
+RETURNING id, email, name, password_hash, email_verified, created_at, updated_at, plan, deleted_at, purge_at, is_admin, suspended_at
 `
 
 type UpdateUserFullParams struct {
@@ -188,6 +427,11 @@ func (q *Queries) UpdateUserFull(ctx context.Context, arg UpdateUserFullParams)
 		&i.EmailVerified,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Plan,
+		&i.DeletedAt,
+		&i.PurgeAt,
+		&i.IsAdmin,
+		&i.SuspendedAt,
 	)
 	return i, err
 }
@@ -196,7 +440,7 @@ const updateUserName = `-- name: UpdateUserName :one
 UPDATE users
 SET name = $2, updated_at = NOW()
 WHERE id = $1
-RETURNING id, email, name, password_hash, email_verified, created_at, updated_at
+RETURNING id, email, name, password_hash, email_verified, created_at, updated_at, plan, deleted_at, purge_at, is_admin, suspended_at
 `
 
 type UpdateUserNameParams struct {
@@ -215,6 +459,11 @@ func (q *Queries) UpdateUserName(ctx context.Context, arg UpdateUserNameParams)
 		&i.EmailVerified,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Plan,
+		&i.DeletedAt,
+		&i.PurgeAt,
+		&i.IsAdmin,
+		&i.SuspendedAt,
 	)
 	return i, err
 }
@@ -235,6 +484,25 @@ func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPassword
 	return err
 }
 
+const updateUserPlan = `-- name: UpdateUserPlan :execrows
+UPDATE users
+SET plan = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateUserPlanParams struct {
+	ID   int32  `json:"id"`
+	Plan string `json:"plan"`
+}
+
+func (q *Queries) UpdateUserPlan(ctx context.Context, arg UpdateUserPlanParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateUserPlan, arg.ID, arg.Plan)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const verifyUserEmail = `-- name: VerifyUserEmail :exec
 UPDATE users
 SET email_verified = true
@@ -0,0 +1,44 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/Mohd-Sayeedul-Hoda/tunnel/internal/shared/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Setup installs the global tracer provider and the w3c trace context
+// propagator. Without an endpoint spans are still created and propagated as
+// traceparent, they are just not exported. The returned function flushes
+// pending spans and has to be called on shutdown.
+func Setup(ctx context.Context, cfg *config.Config, serviceName string) (func(context.Context) error, error) {
+
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", serviceName),
+			attribute.Int("service.version", cfg.AppVersion),
+			attribute.String("deployment.environment.name", cfg.AppEnv),
+		)),
+	}
+
+	if cfg.Tracing.Endpoint != "" {
+		exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Tracing.Endpoint))
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+
+	provider := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
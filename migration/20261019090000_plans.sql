@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS plans(
+  id SERIAL PRIMARY KEY,
+  name TEXT NOT NULL UNIQUE,
+  max_sessions INT NOT NULL,
+  max_tunnels_per_session INT NOT NULL,
+  max_reserved_domains INT NOT NULL,
+  max_tcp_ports INT NOT NULL,
+  monthly_bandwidth BIGINT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO plans (name, max_sessions, max_tunnels_per_session, max_reserved_domains, max_tcp_ports, monthly_bandwidth)
+VALUES
+  ('free', 1, 2, 0, 0, 1073741824),
+  ('pro', 3, 10, 3, 2, 53687091200),
+  ('team', 10, 20, 20, 10, 536870912000)
+ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE users
+  ADD COLUMN IF NOT EXISTS plan TEXT NOT NULL DEFAULT 'free' REFERENCES plans(name);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN IF EXISTS plan;
+
+DROP TABLE IF EXISTS plans;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS reserved_domains(
+  id SERIAL PRIMARY KEY,
+  hostname VARCHAR(300) NOT NULL UNIQUE,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_reserved_domains_user_id
+  ON reserved_domains (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_reserved_domains_user_id;
+
+DROP TABLE IF EXISTS reserved_domains;
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS tunnel_access_logs(
+  id BIGSERIAL PRIMARY KEY,
+  tunnel_id TEXT NOT NULL,
+  session_id TEXT NOT NULL,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  request_id TEXT NOT NULL,
+  hostname TEXT NOT NULL,
+  method TEXT NOT NULL,
+  path TEXT NOT NULL,
+  status INTEGER NOT NULL,
+  remote_addr TEXT NOT NULL,
+  upstream_latency_ms BIGINT NOT NULL,
+  bytes_in BIGINT NOT NULL,
+  bytes_out BIGINT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_tunnel_access_logs_tunnel_id
+  ON tunnel_access_logs (tunnel_id, created_at DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_tunnel_access_logs_tunnel_id;
+
+DROP TABLE IF EXISTS tunnel_access_logs;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS audit_events(
+  id BIGSERIAL PRIMARY KEY,
+  actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  action VARCHAR(100) NOT NULL,
+  target_type VARCHAR(50) NOT NULL DEFAULT '',
+  target_id VARCHAR(100) NOT NULL DEFAULT '',
+  ip VARCHAR(100) NOT NULL DEFAULT '',
+  user_agent TEXT NOT NULL DEFAULT '',
+  metadata JSONB NOT NULL DEFAULT '{}',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id
+  ON audit_events (actor_id, created_at DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_audit_events_actor_id;
+
+DROP TABLE IF EXISTS audit_events;
+-- +goose StatementEnd
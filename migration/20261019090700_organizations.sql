@@ -0,0 +1,62 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS organizations(
+  id SERIAL PRIMARY KEY,
+  name VARCHAR(100) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS organization_members(
+  org_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  role VARCHAR(20) NOT NULL CHECK (role IN ('owner', 'admin', 'member', 'viewer')),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_organization_members_user_id
+  ON organization_members (user_id);
+
+CREATE TABLE IF NOT EXISTS organization_invitations(
+  id SERIAL PRIMARY KEY,
+  org_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  email VARCHAR(300) NOT NULL,
+  role VARCHAR(20) NOT NULL CHECK (role IN ('owner', 'admin', 'member', 'viewer')),
+  token_hash TEXT NOT NULL UNIQUE,
+  invited_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (org_id, email)
+);
+
+ALTER TABLE api_keys
+  ADD COLUMN IF NOT EXISTS org_id INTEGER REFERENCES organizations(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_org_id
+  ON api_keys (org_id);
+
+ALTER TABLE reserved_domains
+  ADD COLUMN IF NOT EXISTS org_id INTEGER REFERENCES organizations(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_reserved_domains_org_id
+  ON reserved_domains (org_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_reserved_domains_org_id;
+
+ALTER TABLE reserved_domains DROP COLUMN IF EXISTS org_id;
+
+DROP INDEX IF EXISTS idx_api_keys_org_id;
+
+ALTER TABLE api_keys DROP COLUMN IF EXISTS org_id;
+
+DROP TABLE IF EXISTS organization_invitations;
+
+DROP INDEX IF EXISTS idx_organization_members_user_id;
+
+DROP TABLE IF EXISTS organization_members;
+
+DROP TABLE IF EXISTS organizations;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE api_keys
+  ADD COLUMN IF NOT EXISTS previous_api_key TEXT UNIQUE,
+  ADD COLUMN IF NOT EXISTS previous_expires_at TIMESTAMPTZ,
+  ADD COLUMN IF NOT EXISTS rotated_at TIMESTAMPTZ,
+  ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMPTZ,
+  ADD COLUMN IF NOT EXISTS last_used_ip TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE api_keys
+  DROP COLUMN IF EXISTS last_used_ip,
+  DROP COLUMN IF EXISTS last_used_at,
+  DROP COLUMN IF EXISTS rotated_at,
+  DROP COLUMN IF EXISTS previous_expires_at,
+  DROP COLUMN IF EXISTS previous_api_key;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE otp_verification
+  DROP CONSTRAINT IF EXISTS otp_verification_type_check;
+
+ALTER TABLE otp_verification
+  ADD CONSTRAINT otp_verification_type_check
+  CHECK (type IN('sign-in', 'email-verification', 'forget-password', 'account-unlock'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM otp_verification WHERE type = 'account-unlock';
+
+ALTER TABLE otp_verification
+  DROP CONSTRAINT IF EXISTS otp_verification_type_check;
+
+ALTER TABLE otp_verification
+  ADD CONSTRAINT otp_verification_type_check
+  CHECK (type IN('sign-in', 'email-verification', 'forget-password'));
+-- +goose StatementEnd
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+  ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ,
+  ADD COLUMN IF NOT EXISTS purge_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_users_purge_at
+  ON users (purge_at) WHERE purge_at IS NOT NULL;
+
+ALTER TABLE otp_verification
+  DROP CONSTRAINT IF EXISTS otp_verification_type_check;
+
+ALTER TABLE otp_verification
+  ADD CONSTRAINT otp_verification_type_check
+  CHECK (type IN('sign-in', 'email-verification', 'forget-password', 'account-unlock', 'email-change', 'account-deletion'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM otp_verification WHERE type = 'account-deletion';
+
+ALTER TABLE otp_verification
+  DROP CONSTRAINT IF EXISTS otp_verification_type_check;
+
+ALTER TABLE otp_verification
+  ADD CONSTRAINT otp_verification_type_check
+  CHECK (type IN('sign-in', 'email-verification', 'forget-password', 'account-unlock', 'email-change'));
+
+DROP INDEX IF EXISTS idx_users_purge_at;
+
+ALTER TABLE users
+  DROP COLUMN IF EXISTS purge_at,
+  DROP COLUMN IF EXISTS deleted_at;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+  ADD COLUMN IF NOT EXISTS is_admin BOOL NOT NULL DEFAULT FALSE,
+  ADD COLUMN IF NOT EXISTS suspended_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_users_created_at
+  ON users (created_at DESC, id DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_users_created_at;
+
+ALTER TABLE users
+  DROP COLUMN IF EXISTS suspended_at,
+  DROP COLUMN IF EXISTS is_admin;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id_created_at
+  ON api_keys (user_id, created_at, id) WHERE org_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at
+  ON audit_events (created_at DESC, id DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_audit_events_created_at;
+
+DROP INDEX IF EXISTS idx_api_keys_user_id_created_at;
+-- +goose StatementEnd
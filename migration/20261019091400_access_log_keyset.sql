@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_tunnel_access_logs_tunnel_id_created_at
+  ON tunnel_access_logs (tunnel_id, created_at DESC, id DESC);
+
+DROP INDEX IF EXISTS idx_tunnel_access_logs_tunnel_id;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_tunnel_access_logs_tunnel_id
+  ON tunnel_access_logs (tunnel_id, created_at DESC);
+
+DROP INDEX IF EXISTS idx_tunnel_access_logs_tunnel_id_created_at;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_reserved_domains_user_id_created_at
+  ON reserved_domains (user_id, created_at DESC, id DESC) WHERE org_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_reserved_domains_org_id_created_at
+  ON reserved_domains (org_id, created_at DESC, id DESC);
+
+DROP INDEX IF EXISTS idx_reserved_domains_org_id;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_reserved_domains_org_id
+  ON reserved_domains (org_id);
+
+DROP INDEX IF EXISTS idx_reserved_domains_org_id_created_at;
+
+DROP INDEX IF EXISTS idx_reserved_domains_user_id_created_at;
+-- +goose StatementEnd
@@ -1,21 +1,95 @@
 -- name: CreateAPIKey :one
-INSERT INTO api_keys (name, prefix, api_key, user_id, permissions, expires_at)
-VALUES ($1, $2, $3, $4, $5, $6)
+INSERT INTO api_keys (name, prefix, api_key, user_id, permissions, metadata, expires_at, org_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 RETURNING id, created_at;
 
 -- name: ListAPIKeys :many
-SELECT id, name, prefix, api_key, user_id, permissions, expires_at, created_at
+SELECT id, name, prefix, api_key, user_id, permissions, metadata, expires_at, created_at,
+  previous_expires_at, rotated_at, last_used_at, last_used_ip
 FROM api_keys
-WHERE user_id = $1
-LIMIT $2 OFFSET $3;
+WHERE user_id = sqlc.arg(user_id) AND org_id IS NULL
+  AND (sqlc.narg(cursor_id)::INTEGER IS NULL OR (created_at, id) > (sqlc.narg(cursor_time)::TIMESTAMPTZ, sqlc.narg(cursor_id)))
+ORDER BY created_at, id
+LIMIT sqlc.arg(row_limit);
+
+-- name: CountAPIKeys :one
+SELECT COUNT(*) FROM api_keys
+WHERE user_id = $1 AND org_id IS NULL;
 
 -- name: DeleteAPIKey :execrows
-DELETE FROM api_keys where id = $1 and user_id = $2;
+DELETE FROM api_keys where id = $1 and user_id = $2 and org_id IS NULL;
 
 -- name: CheckAPIKeyValid :one
 SELECT EXISTS (
-    SELECT 1 FROM api_keys WHERE api_key = $1
+    SELECT 1 FROM api_keys
+    WHERE (api_key = $1 OR (previous_api_key = $1 AND previous_expires_at > NOW()))
+      AND (expires_at IS NULL OR expires_at > NOW())
 ) AS valid;
 
 -- name: GetAPIKey :one
-SELECT * FROM api_keys WHERE api_key = $1;
+SELECT * FROM api_keys
+WHERE api_key = $1 OR (previous_api_key = $1 AND previous_expires_at > NOW());
+
+-- name: ListOrgAPIKeys :many
+SELECT id, name, prefix, api_key, user_id, permissions, metadata, expires_at, created_at, org_id,
+  previous_expires_at, rotated_at, last_used_at, last_used_ip
+FROM api_keys
+WHERE org_id = sqlc.arg(org_id)
+  AND (sqlc.narg(cursor_id)::INTEGER IS NULL OR (created_at, id) > (sqlc.narg(cursor_time)::TIMESTAMPTZ, sqlc.narg(cursor_id)))
+ORDER BY created_at, id
+LIMIT sqlc.arg(row_limit);
+
+-- name: CountOrgAPIKeys :one
+SELECT COUNT(*) FROM api_keys
+WHERE org_id = $1;
+
+-- name: DeleteOrgAPIKey :execrows
+DELETE FROM api_keys WHERE id = $1 AND org_id = $2;
+
+-- name: RotateAPIKey :one
+UPDATE api_keys
+SET previous_api_key = CASE WHEN sqlc.narg(previous_expires_at)::TIMESTAMPTZ IS NULL THEN NULL ELSE api_key END,
+  previous_expires_at = sqlc.narg(previous_expires_at),
+  api_key = sqlc.arg(api_key),
+  prefix = sqlc.arg(prefix),
+  rotated_at = NOW()
+WHERE id = sqlc.arg(id) AND user_id = sqlc.arg(user_id) AND org_id IS NULL
+RETURNING *;
+
+-- name: RotateOrgAPIKey :one
+UPDATE api_keys
+SET previous_api_key = CASE WHEN sqlc.narg(previous_expires_at)::TIMESTAMPTZ IS NULL THEN NULL ELSE api_key END,
+  previous_expires_at = sqlc.narg(previous_expires_at),
+  api_key = sqlc.arg(api_key),
+  prefix = sqlc.arg(prefix),
+  rotated_at = NOW()
+WHERE id = sqlc.arg(id) AND org_id = sqlc.arg(org_id)
+RETURNING *;
+
+-- name: UpdateAPIKeyMetadata :execrows
+UPDATE api_keys SET metadata = $1 WHERE id = $2 AND user_id = $3 AND org_id IS NULL;
+
+-- name: UpdateOrgAPIKeyMetadata :execrows
+UPDATE api_keys SET metadata = $1 WHERE id = $2 AND org_id = $3;
+
+-- name: UpdateAPIKeysLastUsed :exec
+UPDATE api_keys
+SET last_used_at = u.used_at, last_used_ip = u.ip
+FROM unnest(sqlc.arg(ids)::INTEGER[], sqlc.arg(used_ats)::TIMESTAMPTZ[], sqlc.arg(ips)::TEXT[]) AS u(id, used_at, ip)
+WHERE api_keys.id = u.id;
+
+-- name: RevokeAPIKey :one
+UPDATE api_keys
+SET expires_at = NOW(),
+  previous_api_key = NULL,
+  previous_expires_at = NULL
+WHERE api_key = $1 AND (expires_at IS NULL OR expires_at > NOW())
+RETURNING *;
+
+-- name: RevokePreviousAPIKey :one
+UPDATE api_keys
+SET previous_api_key = NULL,
+  previous_expires_at = NULL
+WHERE previous_api_key = $1 AND previous_expires_at > NOW()
+  AND (expires_at IS NULL OR expires_at > NOW())
+RETURNING *;
@@ -0,0 +1,24 @@
+-- name: CreateAuditEvent :one
+INSERT INTO audit_events (actor_id, action, target_type, target_id, ip, user_agent, metadata)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, created_at;
+
+-- name: ListAuditEvents :many
+SELECT * FROM audit_events
+WHERE (sqlc.narg(actor_id)::INTEGER IS NULL OR actor_id = sqlc.narg(actor_id))
+  AND (sqlc.narg(cursor_id)::BIGINT IS NULL OR (created_at, id) < (sqlc.narg(cursor_time)::TIMESTAMPTZ, sqlc.narg(cursor_id)))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: CountAuditEvents :one
+SELECT COUNT(*) FROM audit_events
+WHERE sqlc.narg(actor_id)::INTEGER IS NULL OR actor_id = sqlc.narg(actor_id);
+
+-- name: ScrubAuditEvents :exec
+UPDATE audit_events
+SET metadata = metadata - 'email' - 'old_email',
+    target_id = CASE WHEN target_type = 'account' THEN '' ELSE target_id END
+WHERE actor_id = ANY(sqlc.arg(ids)::INTEGER[])
+   OR lower(metadata->>'email') = ANY(sqlc.arg(emails)::TEXT[])
+   OR lower(metadata->>'old_email') = ANY(sqlc.arg(emails)::TEXT[])
+   OR (target_type = 'account' AND target_id = ANY(sqlc.arg(emails)::TEXT[]));
@@ -0,0 +1,84 @@
+-- name: CreateOrganization :one
+WITH new_org AS (
+  INSERT INTO organizations (name)
+  VALUES ($1)
+  RETURNING id, created_at
+), owner AS (
+  INSERT INTO organization_members (org_id, user_id, role)
+  SELECT id, @owner_id::INTEGER, 'owner' FROM new_org
+)
+SELECT id, created_at FROM new_org;
+
+-- name: GetOrganization :one
+SELECT * FROM organizations WHERE id = $1;
+
+-- name: ListUserOrganizations :many
+SELECT o.id, o.name, o.created_at, m.role
+FROM organizations o
+JOIN organization_members m ON m.org_id = o.id
+WHERE m.user_id = $1
+ORDER BY o.created_at;
+
+-- name: UpdateOrganizationName :execrows
+UPDATE organizations SET name = $2 WHERE id = $1;
+
+-- name: DeleteOrganization :execrows
+DELETE FROM organizations WHERE id = $1;
+
+-- name: GetOrganizationMember :one
+SELECT * FROM organization_members
+WHERE org_id = $1 AND user_id = $2;
+
+-- name: ListOrganizationMembers :many
+SELECT m.user_id, u.name, u.email, m.role, m.created_at
+FROM organization_members m
+JOIN users u ON u.id = m.user_id
+WHERE m.org_id = $1
+ORDER BY m.created_at;
+
+-- name: CountOrganizationOwners :one
+SELECT COUNT(*) FROM organization_members
+WHERE org_id = $1 AND role = 'owner';
+
+-- name: UpdateOrganizationMemberRole :execrows
+UPDATE organization_members SET role = $3
+WHERE org_id = $1 AND user_id = $2;
+
+-- name: DeleteOrganizationMember :execrows
+DELETE FROM organization_members
+WHERE org_id = $1 AND user_id = $2;
+
+-- name: CreateOrganizationInvitation :one
+INSERT INTO organization_invitations (org_id, email, role, token_hash, invited_by, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (org_id, email) DO UPDATE
+SET role = EXCLUDED.role,
+    token_hash = EXCLUDED.token_hash,
+    invited_by = EXCLUDED.invited_by,
+    expires_at = EXCLUDED.expires_at,
+    created_at = NOW()
+RETURNING id, created_at;
+
+-- name: ListOrganizationInvitations :many
+SELECT id, org_id, email, role, invited_by, expires_at, created_at
+FROM organization_invitations
+WHERE org_id = $1
+ORDER BY created_at DESC;
+
+-- name: GetOrganizationInvitationByToken :one
+SELECT * FROM organization_invitations WHERE token_hash = $1;
+
+-- name: DeleteOrganizationInvitation :execrows
+DELETE FROM organization_invitations
+WHERE id = $1 AND org_id = $2;
+
+-- name: AcceptOrganizationInvitation :one
+WITH invitation AS (
+  DELETE FROM organization_invitations
+  WHERE id = $1
+  RETURNING org_id, role
+)
+INSERT INTO organization_members (org_id, user_id, role)
+SELECT org_id, @user_id::INTEGER, role FROM invitation
+ON CONFLICT (org_id, user_id) DO NOTHING
+RETURNING org_id;
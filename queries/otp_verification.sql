@@ -36,3 +36,7 @@ SET attempts = attempts + 1,
 is_invalidated = true,
 updated_at = NOW()
 WHERE id = $1;
+
+-- name: DeleteOtpsByEmail :exec
+DELETE FROM otp_verification
+WHERE lower(email) = ANY(sqlc.arg(emails)::TEXT[]);
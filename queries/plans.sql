@@ -0,0 +1,6 @@
+-- name: GetPlanByName :one
+SELECT * FROM plans WHERE name = $1;
+
+-- name: ListPlans :many
+SELECT * FROM plans
+ORDER BY monthly_bandwidth ASC;
@@ -0,0 +1,37 @@
+-- name: CreateReservedDomain :one
+INSERT INTO reserved_domains (hostname, user_id, org_id)
+VALUES ($1, $2, $3)
+RETURNING id, created_at;
+
+-- name: ListReservedDomains :many
+SELECT id, hostname, user_id, created_at, org_id
+FROM reserved_domains
+WHERE user_id = sqlc.arg(user_id) AND org_id IS NULL
+  AND (sqlc.narg(cursor_id)::INTEGER IS NULL OR (created_at, id) < (sqlc.narg(cursor_time)::TIMESTAMPTZ, sqlc.narg(cursor_id)))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: GetReservedDomainByHostname :one
+SELECT * FROM reserved_domains WHERE hostname = $1;
+
+-- name: CountReservedDomains :one
+SELECT COUNT(*) FROM reserved_domains WHERE user_id = $1;
+
+-- name: CountUserReservedDomains :one
+SELECT COUNT(*) FROM reserved_domains WHERE user_id = $1 AND org_id IS NULL;
+
+-- name: DeleteReservedDomain :execrows
+DELETE FROM reserved_domains WHERE id = $1 AND user_id = $2 AND org_id IS NULL;
+
+-- name: ListOrgReservedDomains :many
+SELECT * FROM reserved_domains
+WHERE org_id = sqlc.arg(org_id)
+  AND (sqlc.narg(cursor_id)::INTEGER IS NULL OR (created_at, id) < (sqlc.narg(cursor_time)::TIMESTAMPTZ, sqlc.narg(cursor_id)))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: CountOrgReservedDomains :one
+SELECT COUNT(*) FROM reserved_domains WHERE org_id = $1;
+
+-- name: DeleteOrgReservedDomain :execrows
+DELETE FROM reserved_domains WHERE id = $1 AND org_id = $2;
@@ -0,0 +1,19 @@
+-- name: CreateTunnelAccessLogs :copyfrom
+INSERT INTO tunnel_access_logs (
+  tunnel_id, session_id, user_id, request_id, hostname, method, path,
+  status, remote_addr, upstream_latency_ms, bytes_in, bytes_out, created_at
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13);
+
+-- name: ListTunnelAccessLogs :many
+SELECT * FROM tunnel_access_logs
+WHERE tunnel_id = sqlc.arg(tunnel_id)
+  AND (sqlc.narg(user_id)::INTEGER IS NULL OR user_id = sqlc.narg(user_id))
+  AND (sqlc.narg(cursor_id)::BIGINT IS NULL OR (created_at, id) < (sqlc.narg(cursor_time)::TIMESTAMPTZ, sqlc.narg(cursor_id)))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: CountTunnelAccessLogs :one
+SELECT COUNT(*) FROM tunnel_access_logs
+WHERE tunnel_id = sqlc.arg(tunnel_id)
+  AND (sqlc.narg(user_id)::INTEGER IS NULL OR user_id = sqlc.narg(user_id));
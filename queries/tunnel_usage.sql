@@ -0,0 +1,23 @@
+-- name: AddTunnelUsage :exec
+INSERT INTO tunnel_usage (user_id, period, bytes_in, bytes_out)
+VALUES ($1, date_trunc('month', NOW())::date, $2, $3)
+ON CONFLICT (user_id, period) DO UPDATE
+SET bytes_in = tunnel_usage.bytes_in + EXCLUDED.bytes_in,
+    bytes_out = tunnel_usage.bytes_out + EXCLUDED.bytes_out,
+    updated_at = NOW();
+
+-- name: GetCurrentMonthUsage :one
+SELECT COALESCE(SUM(bytes_in + bytes_out), 0)::BIGINT AS total
+FROM tunnel_usage
+WHERE user_id = $1 AND period = date_trunc('month', NOW())::date;
+
+-- name: ListTunnelUsage :many
+SELECT * FROM tunnel_usage
+WHERE user_id = sqlc.arg(user_id)
+  AND (sqlc.narg(cursor_id)::INTEGER IS NULL OR (period, id) < (sqlc.narg(cursor_period)::DATE, sqlc.narg(cursor_id)))
+ORDER BY period DESC, id DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: CountTunnelUsage :one
+SELECT COUNT(*) FROM tunnel_usage
+WHERE user_id = $1;
@@ -6,27 +6,61 @@ RETURNING id, created_at;
 -- name: ListUsers :many
 SELECT *
 FROM users
-ORDER BY created_at DESC
-LIMIT $1 OFFSET $2;
+WHERE (sqlc.narg(search)::TEXT IS NULL OR email ILIKE '%' || sqlc.narg(search) || '%' ESCAPE '\' OR name ILIKE '%' || sqlc.narg(search) || '%' ESCAPE '\')
+  AND (sqlc.narg(email_verified)::BOOL IS NULL OR email_verified = sqlc.narg(email_verified))
+  AND (sqlc.narg(is_admin)::BOOL IS NULL OR is_admin = sqlc.narg(is_admin))
+  AND (sqlc.narg(suspended)::BOOL IS NULL OR (suspended_at IS NOT NULL) = sqlc.narg(suspended))
+  AND (sqlc.narg(plan)::TEXT IS NULL OR plan = sqlc.narg(plan))
+  AND (sqlc.narg(created_after)::TIMESTAMPTZ IS NULL OR created_at >= sqlc.narg(created_after))
+  AND (sqlc.narg(created_before)::TIMESTAMPTZ IS NULL OR created_at < sqlc.narg(created_before))
+  AND (sqlc.narg(cursor_id)::INTEGER IS NULL OR CASE sqlc.arg(sort)::TEXT
+    WHEN 'email' THEN (email, id) > (sqlc.narg(cursor_value)::TEXT, sqlc.narg(cursor_id))
+    WHEN '-email' THEN (email, id) < (sqlc.narg(cursor_value), sqlc.narg(cursor_id))
+    WHEN 'name' THEN (name, id) > (sqlc.narg(cursor_value), sqlc.narg(cursor_id))
+    WHEN '-name' THEN (name, id) < (sqlc.narg(cursor_value), sqlc.narg(cursor_id))
+    WHEN 'created_at' THEN (created_at, id) > (sqlc.narg(cursor_time)::TIMESTAMPTZ, sqlc.narg(cursor_id))
+    ELSE (created_at, id) < (sqlc.narg(cursor_time), sqlc.narg(cursor_id))
+  END)
+ORDER BY
+  CASE WHEN sqlc.arg(sort) = 'email' THEN email END ASC,
+  CASE WHEN sqlc.arg(sort) = '-email' THEN email END DESC,
+  CASE WHEN sqlc.arg(sort) = 'name' THEN name END ASC,
+  CASE WHEN sqlc.arg(sort) = '-name' THEN name END DESC,
+  CASE WHEN sqlc.arg(sort) = 'created_at' THEN created_at END ASC,
+  CASE WHEN sqlc.arg(sort) = '-created_at' THEN created_at END DESC,
+  CASE WHEN sqlc.arg(sort) IN ('email', 'name', 'created_at') THEN id END ASC,
+  id DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: CountUsers :one
+SELECT COUNT(*)
+FROM users
+WHERE (sqlc.narg(search)::TEXT IS NULL OR email ILIKE '%' || sqlc.narg(search) || '%' ESCAPE '\' OR name ILIKE '%' || sqlc.narg(search) || '%' ESCAPE '\')
+  AND (sqlc.narg(email_verified)::BOOL IS NULL OR email_verified = sqlc.narg(email_verified))
+  AND (sqlc.narg(is_admin)::BOOL IS NULL OR is_admin = sqlc.narg(is_admin))
+  AND (sqlc.narg(suspended)::BOOL IS NULL OR (suspended_at IS NOT NULL) = sqlc.narg(suspended))
+  AND (sqlc.narg(plan)::TEXT IS NULL OR plan = sqlc.narg(plan))
+  AND (sqlc.narg(created_after)::TIMESTAMPTZ IS NULL OR created_at >= sqlc.narg(created_after))
+  AND (sqlc.narg(created_before)::TIMESTAMPTZ IS NULL OR created_at < sqlc.narg(created_before));
 
 -- name: DeleteUser :execrows
 DELETE FROM users WHERE id = $1; 
 
 -- name: GetUserByEmail :one
-SELECT id, email, name, password_hash, email_verified, created_at, updated_at
+SELECT id, email, name, password_hash, email_verified, created_at, updated_at, plan, deleted_at, purge_at, is_admin, suspended_at
 FROM users
 WHERE email = $1 LIMIT 1;
 
 -- name: GetUserById :one
-SELECT id, email, name, password_hash, email_verified, created_at, updated_at
+SELECT id, email, name, password_hash, email_verified, created_at, updated_at, plan, deleted_at, purge_at, is_admin, suspended_at
 FROM users
 WHERE id = $1 LIMIT 1;
 
 -- name: UpdateUserEmail :one
 UPDATE users
-SET email = $2, updated_at = NOW()
+SET email = $2, email_verified = true, updated_at = NOW()
 WHERE id = $1
-RETURNING id, email, name, password_hash, email_verified, created_at, updated_at;
+RETURNING id, email, name, password_hash, email_verified, created_at, updated_at, plan, deleted_at, purge_at, is_admin, suspended_at;
 
 -- name: UpdateUserPassword :exec
 UPDATE users
@@ -37,16 +71,55 @@ WHERE email = $1;
 UPDATE users
 SET name = $2, updated_at = NOW()
 WHERE id = $1
-RETURNING id, email, name, password_hash, email_verified, created_at, updated_at;
+RETURNING id, email, name, password_hash, email_verified, created_at, updated_at, plan, deleted_at, purge_at, is_admin, suspended_at;
 
 -- name: UpdateUserFull :one
 UPDATE users
 SET email = $2, name = $3, password_hash = $4, email_verified = $5, updated_at = NOW()
 WHERE id = $1
-RETURNING id, email, name, password_hash, email_verified, created_at, updated_at;
+RETURNING id, email, name, password_hash, email_verified, created_at, updated_at, plan, deleted_at, purge_at, is_admin, suspended_at;
 
 
 -- name: VerifyUserEmail :exec
 UPDATE users
 SET email_verified = true
 WHERE id = $1;
+
+-- name: UpdateUserPlan :execrows
+UPDATE users
+SET plan = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: ScheduleUserDeletion :execrows
+UPDATE users
+SET deleted_at = NOW(), purge_at = $2, updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: CancelUserDeletion :execrows
+UPDATE users
+SET deleted_at = NULL, purge_at = NULL, updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NOT NULL;
+
+-- name: ListPurgeableUsers :many
+SELECT id, email FROM users
+WHERE purge_at IS NOT NULL AND purge_at <= NOW();
+
+-- name: PurgeDeletedUsers :many
+DELETE FROM users
+WHERE id = ANY(sqlc.arg(ids)::INTEGER[]) AND purge_at IS NOT NULL AND purge_at <= NOW()
+RETURNING id;
+
+-- name: SuspendUser :execrows
+UPDATE users
+SET suspended_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND suspended_at IS NULL;
+
+-- name: UnsuspendUser :execrows
+UPDATE users
+SET suspended_at = NULL, updated_at = NOW()
+WHERE id = $1 AND suspended_at IS NOT NULL;
+
+-- name: UpdateUserAdmin :execrows
+UPDATE users
+SET is_admin = $2, updated_at = NOW()
+WHERE id = $1;
@@ -0,0 +1,38 @@
+-- name: UpsertUserTotp :exec
+INSERT INTO user_totp (user_id, secret)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, enabled = FALSE, last_used_step = 0, enabled_at = NULL, created_at = NOW();
+
+-- name: GetUserTotp :one
+SELECT * FROM user_totp
+WHERE user_id = $1;
+
+-- name: EnableUserTotp :execrows
+UPDATE user_totp
+SET enabled = TRUE, enabled_at = NOW()
+WHERE user_id = $1;
+
+-- name: UseUserTotpStep :execrows
+UPDATE user_totp
+SET last_used_step = $2
+WHERE user_id = $1 AND last_used_step < $2;
+
+-- name: DeleteUserTotp :execrows
+DELETE FROM user_totp WHERE user_id = $1;
+
+-- name: CreateUserRecoveryCodes :copyfrom
+INSERT INTO user_recovery_codes (user_id, code_hash)
+VALUES ($1, $2);
+
+-- name: DeleteUserRecoveryCodes :exec
+DELETE FROM user_recovery_codes WHERE user_id = $1;
+
+-- name: UseUserRecoveryCode :execrows
+UPDATE user_recovery_codes
+SET used_at = NOW()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+-- name: CountUnusedUserRecoveryCodes :one
+SELECT COUNT(*) FROM user_recovery_codes
+WHERE user_id = $1 AND used_at IS NULL;